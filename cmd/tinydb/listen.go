@@ -19,6 +19,7 @@ type ListenConfig struct {
 	DataDir  string       `yaml:"data_directory"`
 	PageSize int          `yaml:"page_size"`
 	LogLevel logrus.Level `yaml:"log_level"`
+	InMemory bool         `yaml:"in_memory"`
 }
 
 type ListenCommand struct {
@@ -76,6 +77,7 @@ func (i *ListenCommand) Run(args []string) int {
 	dbEngine, err := backend.Start(logger, backend.Config{
 		DataDir:  config.DataDir,
 		PageSize: 4096,
+		InMemory: config.InMemory,
 	})
 	if err != nil {
 		return 1
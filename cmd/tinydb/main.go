@@ -39,7 +39,9 @@ func main() {
 
 func makeShutdownCh() <-chan struct{} {
 	shutdownCh := make(chan struct{})
-	signalCh := make(chan os.Signal)
+	// signal.Notify does not block sending, an interrupt received before
+	// the goroutine waits is dropped unless the channel is buffered
+	signalCh := make(chan os.Signal, 1)
 
 	signal.Notify(signalCh, os.Interrupt)
 
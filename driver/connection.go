@@ -2,12 +2,15 @@ package driver
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"database/sql"
 	"database/sql/driver"
 	"encoding/binary"
 	"fmt"
 	"github.com/joeandaverde/tinydb/internal/server"
 	"io"
+	"math"
 	"net"
 )
 
@@ -15,6 +18,10 @@ type TinyDBConnection struct {
 	dsn  string
 	conn net.Conn
 
+	// prepared counts the open statements of each statement id. Statements
+	// with the same text share an id and so a statement on the server.
+	prepared map[string]int
+
 	scratch [512]byte
 }
 
@@ -49,18 +56,54 @@ func (c *TinyDBConnection) Prepare(text string) (driver.Stmt, error) {
 
 	switch server.Response(res) {
 	case server.ResponseCompleted:
+		// the number of parameters the statement is executed with
+		numInput, err := c.readUint32()
+		if err != nil {
+			return nil, err
+		}
+
+		c.prepared[statementID]++
 		return &TinyDBStmt{
-			id:      statementID,
-			command: text,
-			conn:    c,
+			id:       statementID,
+			command:  text,
+			numInput: int(numInput),
+			conn:     c,
 		}, nil
 	case server.ResponseError:
-		return nil, fmt.Errorf("prepare error")
+		return nil, c.readError("prepare error")
 	default:
 		return nil, fmt.Errorf("unexpected prepare query response")
 	}
 }
 
+// closeStmt closes a prepared statement. The server frees the statement
+// once every statement prepared with the same text is closed.
+func (c *TinyDBConnection) closeStmt(id string) error {
+	c.prepared[id]--
+	if c.prepared[id] > 0 {
+		return nil
+	}
+	delete(c.prepared, id)
+
+	if err := c.sendCommand(server.ControlClose, packString(id)); err != nil {
+		return err
+	}
+
+	res, err := c.readByte()
+	if err != nil {
+		return err
+	}
+
+	switch server.Response(res) {
+	case server.ResponseCompleted:
+		return nil
+	case server.ResponseError:
+		return c.readError("close error")
+	default:
+		return fmt.Errorf("unexpected close response")
+	}
+}
+
 // Begin begins a transaction
 func (c *TinyDBConnection) Begin() (driver.Tx, error) {
 	if _, err := c.simpleQuery("BEGIN"); err != nil {
@@ -70,25 +113,166 @@ func (c *TinyDBConnection) Begin() (driver.Tx, error) {
 	return &TinyDBTx{c}, nil
 }
 
+// BeginTx begins a transaction with the default isolation level
+func (c *TinyDBConnection) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.ReadOnly {
+		return nil, fmt.Errorf("read-only transactions are not supported")
+	}
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		return nil, fmt.Errorf("isolation level %s is not supported", level)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.Begin()
+}
+
+// cancel stops the executing statement, the rows it has not sent are
+// discarded by the server
+func (c *TinyDBConnection) cancel() error {
+	if err := c.sendCancel(); err != nil {
+		return err
+	}
+	return c.readCancelResponse()
+}
+
+// sendCancel sends a CANCEL. Unlike sendCommand it may be called while a
+// response is read.
+func (c *TinyDBConnection) sendCancel() error {
+	header := [5]byte{byte(server.ControlCancel)}
+	_, err := c.conn.Write(header[:])
+	return err
+}
+
+// readCancelResponse reads the response to a CANCEL
+func (c *TinyDBConnection) readCancelResponse() error {
+	res, err := c.readByte()
+	if err != nil {
+		return err
+	}
+	if server.Response(res) != server.ResponseCompleted {
+		return fmt.Errorf("unexpected cancel response")
+	}
+	return nil
+}
+
 // Close closes a connection
 func (c *TinyDBConnection) Close() error {
 	return c.conn.Close()
 }
 
-func (c *TinyDBConnection) execNonQuery(id string) (int64, error) {
+// execNonQuery executes a statement without rows. The server is asked to
+// cancel the statement when the context is done before it completes.
+func (c *TinyDBConnection) execNonQuery(ctx context.Context, id string, args []driver.Value) (int64, error) {
+	if err := c.bind(id, args); err != nil {
+		return 0, err
+	}
 	if err := c.sendCommand(server.ControlExecute, packString(id)); err != nil {
 		return 0, err
 	}
-	return c.readNonQueryResponse()
+	if ctx.Done() == nil {
+		return c.readNonQueryResponse()
+	}
+
+	completed := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			canceled <- c.sendCancel() == nil
+		case <-completed:
+			canceled <- false
+		}
+	}()
+
+	rowsAffected, err := c.readNonQueryResponse()
+	close(completed)
+
+	// the statement may complete before the server reads the CANCEL,
+	// which is then responded to as well
+	if <-canceled {
+		if cancelErr := c.readCancelResponse(); cancelErr != nil {
+			return 0, cancelErr
+		}
+		if err != nil {
+			return 0, ctx.Err()
+		}
+	}
+	return rowsAffected, err
 }
 
-func (c *TinyDBConnection) execQuery(id string) ([]string, error) {
+func (c *TinyDBConnection) execQuery(id string, args []driver.Value) ([]string, error) {
+	if err := c.bind(id, args); err != nil {
+		return nil, err
+	}
 	if err := c.sendCommand(server.ControlExecute, packString(id)); err != nil {
 		return nil, err
 	}
 	return c.readQueryResponse()
 }
 
+// bind binds the arguments to the parameters of a prepared statement for
+// its next execution. Statements executed without arguments are not bound.
+func (c *TinyDBConnection) bind(id string, args []driver.Value) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	payload, err := packBind(id, args)
+	if err != nil {
+		return err
+	}
+	if err := c.sendCommand(server.ControlBind, payload); err != nil {
+		return err
+	}
+
+	res, err := c.readByte()
+	if err != nil {
+		return err
+	}
+
+	switch server.Response(res) {
+	case server.ResponseCompleted:
+		return nil
+	case server.ResponseError:
+		return c.readError("error binding parameters")
+	default:
+		return fmt.Errorf("unexpected bind response")
+	}
+}
+
+// QueryInline runs a query without parameters in a single round trip, the
+// server sends all of its rows with the result rather than one for each
+// NEXT. It suits small results, which are held in memory until read.
+func (c *TinyDBConnection) QueryInline(query string) (driver.Rows, error) {
+	payload := append(packString(query), byte(server.QueryInlineRows))
+	if err := c.sendCommand(server.ControlQuery, payload); err != nil {
+		return nil, err
+	}
+	cols, err := c.readQueryResponse()
+	if err != nil {
+		return nil, fmt.Errorf("error executing query: %w", err)
+	}
+
+	rows := &TinyDBRows{conn: c, columns: cols, inline: true}
+	if cols == nil {
+		// the statement completed without a result
+		rows.done = true
+		return rows, nil
+	}
+	for {
+		data, err := rows.receive()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows.buffered = append(rows.buffered, data)
+	}
+}
+
 func (c *TinyDBConnection) simpleQuery(query string) ([]string, error) {
 	if err := c.sendCommand(server.ControlQuery, packString(query)); err != nil {
 		return nil, err
@@ -123,7 +307,13 @@ func (c *TinyDBConnection) readNonQueryResponse() (int64, error) {
 		return 0, nil
 
 	case server.ResponseError:
-		return 0, fmt.Errorf("error executing query")
+		return 0, c.readError("error executing query")
+
+	case server.ResponseConflict:
+		return 0, ErrConflict
+
+	case server.ResponseTimeout:
+		return 0, ErrQueryTimeout
 
 	default:
 		return 0, fmt.Errorf("unexpected response")
@@ -141,20 +331,16 @@ func (c *TinyDBConnection) readQueryResponse() ([]string, error) {
 		return nil, nil
 
 	case server.ResponseError:
-		return nil, fmt.Errorf("error executing query")
+		return nil, c.readError("error executing query")
 
-	case server.ResponseRowDescription:
-		row, err := c.readRow()
-		if err != nil {
-			return nil, err
-		}
+	case server.ResponseConflict:
+		return nil, ErrConflict
 
-		cols := make([]string, 0, len(row))
-		for _, c := range row {
-			cols = append(cols, string(c.([]byte)))
-		}
+	case server.ResponseTimeout:
+		return nil, ErrQueryTimeout
 
-		return cols, nil
+	case server.ResponseRowDescription:
+		return c.readColumnNames()
 	default:
 		return nil, fmt.Errorf("unexpected response")
 	}
@@ -177,6 +363,42 @@ func (c *TinyDBConnection) readUint32() (uint32, error) {
 	return binary.BigEndian.Uint32(c.scratch[:4]), nil
 }
 
+// readError reads the message following an error response
+func (c *TinyDBConnection) readError(context string) error {
+	messageLen, err := c.readUint32()
+	if err != nil {
+		return fmt.Errorf("%s: %w", context, err)
+	}
+
+	message := make([]byte, messageLen)
+	if _, err := io.ReadFull(c.conn, message); err != nil {
+		return fmt.Errorf("%s: %w", context, err)
+	}
+
+	return fmt.Errorf("%s: %s", context, message)
+}
+
+// readColumnNames reads the names of the columns of a result
+func (c *TinyDBConnection) readColumnNames() ([]string, error) {
+	columnCount, err := c.readUint32()
+	if err != nil {
+		return nil, fmt.Errorf("error reading column count from server: %w", err)
+	}
+
+	names := make([]string, columnCount)
+	for i := range names {
+		name, err := c.readPayload()
+		if err != nil {
+			return nil, fmt.Errorf("error reading column name from server: %w", err)
+		}
+		names[i] = string(name)
+	}
+
+	return names, nil
+}
+
+// readRow reads the values of a row, each value is a type tag followed
+// by a length-prefixed payload.
 func (c *TinyDBConnection) readRow() ([]interface{}, error) {
 	columnCount, err := c.readUint32()
 	if err != nil {
@@ -185,25 +407,52 @@ func (c *TinyDBConnection) readRow() ([]interface{}, error) {
 
 	dest := make([]interface{}, columnCount)
 	for i := 0; i < int(columnCount); i++ {
-		columnLen, err := c.readUint32()
+		typ, err := c.readByte()
 		if err != nil {
-			return nil, fmt.Errorf("error reading column length from server: %w", err)
-		}
-		if columnLen > 1024 {
-			return nil, fmt.Errorf("column data too big: %d", columnLen)
+			return nil, fmt.Errorf("error reading column type from server: %w", err)
 		}
 
-		columnData := make([]byte, columnLen)
-		if _, err := io.ReadFull(c.conn, columnData); err != nil {
+		columnData, err := c.readPayload()
+		if err != nil {
 			return nil, fmt.Errorf("error reading column data from server: %w", err)
 		}
 
-		dest[i] = columnData
+		switch server.ValueType(typ) {
+		case server.ValueNull:
+			dest[i] = nil
+		case server.ValueInt:
+			dest[i] = int64(binary.BigEndian.Uint64(columnData))
+		case server.ValueFloat:
+			dest[i] = math.Float64frombits(binary.BigEndian.Uint64(columnData))
+		case server.ValueText:
+			dest[i] = string(columnData)
+		case server.ValueBlob:
+			dest[i] = columnData
+		default:
+			return nil, fmt.Errorf("unexpected column type from server: %d", typ)
+		}
 	}
 
 	return dest, nil
 }
 
+// readPayload reads length-prefixed data
+func (c *TinyDBConnection) readPayload() ([]byte, error) {
+	dataLen, err := c.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if dataLen > 1024 {
+		return nil, fmt.Errorf("column data too big: %d", dataLen)
+	}
+
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 func packString(s string) []byte {
 	packed := make([]byte, 4, len(s)+4)
 	binary.BigEndian.PutUint32(packed[:], uint32(len(s)))
@@ -211,4 +460,50 @@ func packString(s string) []byte {
 	return packed
 }
 
+// packBind packs the name of a statement followed by its parameters:
+// <uint32:len name><utf-8:name><uint32:count>(<byte:type><uint32:len><payload>)*
+// Each value is encoded as in row data.
+func packBind(id string, args []driver.Value) ([]byte, error) {
+	packed := packString(id)
+
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(args)))
+	packed = append(packed, count...)
+
+	for i, a := range args {
+		number := make([]byte, 8)
+		switch v := a.(type) {
+		case nil:
+			packed = append(packed, packValue(server.ValueNull, nil)...)
+		case int64:
+			binary.BigEndian.PutUint64(number, uint64(v))
+			packed = append(packed, packValue(server.ValueInt, number)...)
+		case bool:
+			if v {
+				number[7] = 1
+			}
+			packed = append(packed, packValue(server.ValueInt, number)...)
+		case float64:
+			binary.BigEndian.PutUint64(number, math.Float64bits(v))
+			packed = append(packed, packValue(server.ValueFloat, number)...)
+		case string:
+			packed = append(packed, packValue(server.ValueText, []byte(v))...)
+		case []byte:
+			packed = append(packed, packValue(server.ValueBlob, v)...)
+		default:
+			return nil, fmt.Errorf("unsupported type %T of parameter $%d", a, i+1)
+		}
+	}
+	return packed, nil
+}
+
+// packValue packs a type tag followed by a length-prefixed payload
+func packValue(typ server.ValueType, payload []byte) []byte {
+	packed := append([]byte{byte(typ)}, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(packed[1:], uint32(len(payload)))
+	return append(packed, payload...)
+}
+
 var _ driver.Conn = (*TinyDBConnection)(nil)
+
+var _ driver.ConnBeginTx = (*TinyDBConnection)(nil)
@@ -1,14 +1,28 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/joeandaverde/tinydb/internal/server"
 	"io"
 	"net"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// ErrConflict is returned when a transaction could not be committed because
+// another transaction committed a conflicting write first. The transaction
+// has been rolled back and is safe to retry.
+var ErrConflict = errors.New("tinydb: write conflict, retry the transaction")
+
+// ErrQueryTimeout is returned when a statement ran longer than the
+// query_timeout of the connection and was canceled by the server.
+var ErrQueryTimeout = errors.New("tinydb: canceling statement due to query timeout")
+
 func init() {
 	sql.Register("tinydb", &TinyDBDriver{})
 }
@@ -18,9 +32,10 @@ type TinyDBDriver struct {
 }
 
 type TinyDBStmt struct {
-	id      string
-	command string
-	conn    *TinyDBConnection
+	id       string
+	command  string
+	numInput int
+	conn     *TinyDBConnection
 }
 
 type TinyDBTx struct {
@@ -34,26 +49,84 @@ type TinyDBResult struct {
 type TinyDBRows struct {
 	conn    *TinyDBConnection
 	columns []string
+
+	// ctx cancels the statement between rows, nil when there is none
+	ctx context.Context
+
+	// done is set once the server has sent the last row
+	done bool
+
+	// inline is set when the server sent every row with the result,
+	// the rows are read from buffered rather than asked for
+	inline   bool
+	buffered [][]interface{}
 }
 
-// Open opens a tinydb connection
+// Open opens a tinydb connection. The dsn is the address of the server
+// optionally followed by parameters, e.g. localhost:5432?query_timeout=5s
+//
+// query_timeout cancels statements running longer than the duration
 func (c *TinyDBDriver) Open(dsn string) (driver.Conn, error) {
+	addr, queryTimeout, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
 	var conn net.Conn
-	var err error
 	if c.testDialer != nil {
 		conn, err = c.testDialer()
 	} else {
-		conn, err = net.Dial("tcp", dsn)
+		conn, err = net.Dial("tcp", addr)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &TinyDBConnection{
-		dsn:  dsn,
-		conn: conn,
-	}, nil
+	tinyConn := &TinyDBConnection{
+		dsn:      dsn,
+		conn:     conn,
+		prepared: make(map[string]int),
+	}
+
+	// the server cancels statements outliving the timeout of the session
+	if queryTimeout > 0 {
+		ms := (queryTimeout + time.Millisecond - 1) / time.Millisecond
+		if _, err := tinyConn.simpleQuery(fmt.Sprintf("SET statement_timeout = %d", ms)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return tinyConn, nil
+}
+
+// parseDSN splits a dsn into the address of the server and its parameters
+func parseDSN(dsn string) (string, time.Duration, error) {
+	i := strings.IndexByte(dsn, '?')
+	if i < 0 {
+		return dsn, 0, nil
+	}
+
+	params, err := url.ParseQuery(dsn[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid dsn parameters: %w", err)
+	}
+
+	var queryTimeout time.Duration
+	for name, values := range params {
+		switch name {
+		case "query_timeout":
+			queryTimeout, err = time.ParseDuration(values[len(values)-1])
+			if err != nil || queryTimeout < 0 {
+				return "", 0, fmt.Errorf("invalid query_timeout: %s", values[len(values)-1])
+			}
+		default:
+			return "", 0, fmt.Errorf("unknown dsn parameter: %s", name)
+		}
+	}
+
+	return dsn[:i], queryTimeout, nil
 }
 
 // Close closes the statement.
@@ -65,7 +138,7 @@ func (c *TinyDBDriver) Open(dsn string) (driver.Conn, error) {
 // do not block indefinitely (e.g. apply a timeout).
 // Close closes a tinydb connection
 func (c *TinyDBStmt) Close() error {
-	return nil
+	return c.conn.closeStmt(c.id)
 }
 
 // NumInput returns the number of placeholder parameters.
@@ -78,16 +151,14 @@ func (c *TinyDBStmt) Close() error {
 // its number of placeholders. In that case, the sql package
 // will not sanity check Exec or Query argument counts.
 func (c *TinyDBStmt) NumInput() int {
-	return -1
+	return c.numInput
 }
 
 // Exec executes a query that doesn't return rows, such
 // as an INSERT or UPDATE.
 func (c *TinyDBStmt) Exec(args []driver.Value) (driver.Result, error) {
-	// TODO: bind parameters
-
 	// execute query that doesn't expect results
-	rowsAffected, err := c.conn.execNonQuery(c.id)
+	rowsAffected, err := c.conn.execNonQuery(context.Background(), c.id, args)
 	if err != nil {
 		return nil, fmt.Errorf("error executing non-query prepared statement: %w", err)
 	}
@@ -100,10 +171,8 @@ func (c *TinyDBStmt) Exec(args []driver.Value) (driver.Result, error) {
 // Query executes a query that may return rows, such as a
 // SELECT.
 func (c *TinyDBStmt) Query(args []driver.Value) (driver.Rows, error) {
-	// TODO: bind parameters
-
 	// execute the prepared statement
-	cols, err := c.conn.execQuery(c.id)
+	cols, err := c.conn.execQuery(c.id, args)
 	if err != nil {
 		return nil, fmt.Errorf("error executing prepared statement: %w", err)
 	}
@@ -111,6 +180,62 @@ func (c *TinyDBStmt) Query(args []driver.Value) (driver.Rows, error) {
 	return &TinyDBRows{conn: c.conn, columns: cols}, nil
 }
 
+// ExecContext executes a query that doesn't return rows. The server stops
+// the statement when the context is done before it completes.
+func (c *TinyDBStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := c.conn.execNonQuery(ctx, c.id, values)
+	if err != nil && err == ctx.Err() {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error executing non-query prepared statement: %w", err)
+	}
+
+	return &TinyDBResult{
+		rowsAffected: rowsAffected,
+	}, nil
+}
+
+// QueryContext executes a query that may return rows. The server stops the
+// statement when the context is done before every row was read.
+func (c *TinyDBStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.Query(values)
+	if err != nil {
+		return nil, err
+	}
+	rows.(*TinyDBRows).ctx = ctx
+
+	return rows, nil
+}
+
+// namedValues converts arguments to the values of positional parameters
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, fmt.Errorf("named parameters are not supported: %s", a.Name)
+		}
+		values[i] = a.Value
+	}
+	return values, nil
+}
+
 func (t *TinyDBTx) Commit() error {
 	if _, err := t.conn.simpleQuery("COMMIT"); err != nil {
 		return err
@@ -141,9 +266,26 @@ func (r *TinyDBRows) Columns() []string {
 	return r.columns
 }
 
-// Close closes the rows iterator.
+// Close closes the rows iterator. Rows not yet read are drained so that
+// the server finishes the statement before the next one, unless the
+// statement was canceled.
 func (r *TinyDBRows) Close() error {
-	return nil
+	if r.done {
+		return nil
+	}
+	if r.ctx != nil && r.ctx.Err() != nil {
+		r.done = true
+		return r.conn.cancel()
+	}
+
+	dest := make([]driver.Value, len(r.columns))
+	for {
+		if err := r.Next(dest); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 }
 
 // Next is called to populate the next row of data into
@@ -152,37 +294,68 @@ func (r *TinyDBRows) Close() error {
 //
 // Next returns io.EOF when there are no more rows.
 func (r *TinyDBRows) Next(dest []driver.Value) error {
-	if err := r.conn.sendCommand(server.ControlNext, nil); err != nil {
-		return fmt.Errorf("error sending next command: %w", err)
+	var data []interface{}
+	if r.inline {
+		if len(r.buffered) == 0 {
+			return io.EOF
+		}
+		data, r.buffered = r.buffered[0], r.buffered[1:]
+	} else {
+		if r.ctx != nil && r.ctx.Err() != nil {
+			r.done = true
+			if err := r.conn.cancel(); err != nil {
+				return err
+			}
+			return r.ctx.Err()
+		}
+
+		if err := r.conn.sendCommand(server.ControlNext, nil); err != nil {
+			return fmt.Errorf("error sending next command: %w", err)
+		}
+
+		var err error
+		if data, err = r.receive(); err != nil {
+			return err
+		}
+	}
+
+	if len(data) != len(dest) {
+		return fmt.Errorf("unexpected column count from server got %d expected %d", len(data), len(dest))
 	}
 
+	for i, c := range data {
+		dest[i] = c
+	}
+	return nil
+}
+
+// receive reads the next row sent by the server, io.EOF is returned once
+// the server has sent the last row
+func (r *TinyDBRows) receive() ([]interface{}, error) {
 	res, err := r.conn.readByte()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	switch server.Response(res) {
 	case server.ResponseRowData:
 		data, err := r.conn.readRow()
 		if err != nil {
-			return fmt.Errorf("error reading row data: %w", err)
-		}
-
-		if len(data) != len(dest) {
-			return fmt.Errorf("unexpected column count from server got %d expected %d", len(data), len(dest))
+			return nil, fmt.Errorf("error reading row data: %w", err)
 		}
-
-		for i, c := range data {
-			dest[i] = c
-		}
-		return nil
+		return data, nil
 
 	case server.ResponseCompleted:
-		return io.EOF
+		r.done = true
+		return nil, io.EOF
 	case server.ResponseError:
-		return fmt.Errorf("query error")
+		r.done = true
+		return nil, r.conn.readError("query error")
+	case server.ResponseTimeout:
+		r.done = true
+		return nil, ErrQueryTimeout
 	default:
-		return fmt.Errorf("unexpected response: %v", server.Response(res))
+		return nil, fmt.Errorf("unexpected response: %v", server.Response(res))
 	}
 }
 
@@ -190,6 +363,10 @@ var _ driver.Driver = (*TinyDBDriver)(nil)
 
 var _ driver.Stmt = (*TinyDBStmt)(nil)
 
+var _ driver.StmtExecContext = (*TinyDBStmt)(nil)
+
+var _ driver.StmtQueryContext = (*TinyDBStmt)(nil)
+
 var _ driver.Tx = (*TinyDBTx)(nil)
 
 var _ driver.Result = (*TinyDBResult)(nil)
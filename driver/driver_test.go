@@ -1,7 +1,14 @@
 package driver
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -91,6 +98,125 @@ func (s *DriverTestSuite) TestDriver_Exec() {
 	s.Equal("bar", name)
 }
 
+func (s *DriverTestSuite) TestDriver_InsertReturning() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE people (id int PRIMARY KEY, name text);")
+	s.NoError(err)
+
+	rows, err := db.Query("INSERT INTO people (name) VALUES ('joe'), ('ava') RETURNING id, name;")
+	s.NoError(err)
+
+	cols, err := rows.Columns()
+	s.NoError(err)
+	s.Equal([]string{"id", "name"}, cols)
+
+	type person struct {
+		id   int
+		name string
+	}
+	var people []person
+	for rows.Next() {
+		var p person
+		s.NoError(rows.Scan(&p.id, &p.name))
+		people = append(people, p)
+	}
+	s.NoError(rows.Err())
+	s.Equal([]person{{1, "joe"}, {2, "ava"}}, people)
+
+	// the returned rows were inserted
+	var count int
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM people;").Scan(&count))
+	s.Equal(2, count)
+}
+
+func (s *DriverTestSuite) TestDriver_TextRoundTrip() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE snippets (body text);")
+	s.NoError(err)
+
+	values := []string{"  spaced  ", "", "a ; b;", "\tinner  gaps\n"}
+	for _, v := range values {
+		_, err = db.Exec("INSERT INTO snippets (body) VALUES ('" + v + "');")
+		s.NoError(err)
+	}
+
+	rows, err := db.Query("SELECT body FROM snippets;")
+	s.NoError(err)
+
+	var bodies []string
+	for rows.Next() {
+		var body string
+		s.NoError(rows.Scan(&body))
+		bodies = append(bodies, body)
+	}
+	s.NoError(rows.Err())
+	s.Equal(values, bodies)
+}
+
+func (s *DriverTestSuite) TestDriver_BlobRoundTrip() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE thumbnails (name text, data blob);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO thumbnails (name, data) VALUES ('beef', x'DEADBEEF'), ('empty', x'');")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO thumbnails (name, data) VALUES ($1, $2);", "bound", []byte{0x00, 0x01, 0xff})
+	s.NoError(err)
+
+	rows, err := db.Query("SELECT data FROM thumbnails;")
+	s.NoError(err)
+
+	var blobs [][]byte
+	for rows.Next() {
+		var data []byte
+		s.NoError(rows.Scan(&data))
+		blobs = append(blobs, data)
+	}
+	s.NoError(rows.Err())
+	s.Equal([][]byte{{0xde, 0xad, 0xbe, 0xef}, {}, {0x00, 0x01, 0xff}}, blobs)
+}
+
+func (s *DriverTestSuite) TestDriver_IntegerRoundTrip() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	values := []int64{0, 1, -1, 127, -128, 128, 255, -32769, 1<<31 - 1, -1 << 31, 1 << 40, -1 << 47, 1<<63 - 1, -1 << 63}
+	_, err = db.Exec("CREATE TABLE balances (amount int);")
+	s.NoError(err)
+	for _, v := range values {
+		_, err = db.Exec("INSERT INTO balances (amount) VALUES ($1);", v)
+		s.NoError(err)
+	}
+
+	rows, err := db.Query("SELECT amount FROM balances;")
+	s.NoError(err)
+
+	var amounts []int64
+	for rows.Next() {
+		var amount int64
+		s.NoError(rows.Scan(&amount))
+		amounts = append(amounts, amount)
+	}
+	s.NoError(rows.Err())
+	s.Equal(values, amounts)
+
+	var count int
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM balances WHERE amount < 0;").Scan(&count))
+	s.Equal(6, count)
+
+	// an overflowing sum fails the statement and the connection carries on
+	var sum int64
+	err = db.QueryRow("SELECT SUM(amount) FROM balances WHERE amount > 0;").Scan(&sum)
+	s.EqualError(err, "query error: integer overflow")
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM balances WHERE amount < 0;").Scan(&count))
+	s.Equal(6, count)
+}
+
 func (s *DriverTestSuite) TestDriver_Transaction() {
 	db, err := sql.Open(s.driverName, s.dsn)
 	s.NoError(err)
@@ -165,3 +291,511 @@ func (s *DriverTestSuite) TestDriver_Transaction_Rollback() {
 	s.NoError(err)
 	s.False(rows.Next())
 }
+
+func (s *DriverTestSuite) TestDriver_Transaction_Conflict() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+	s.NotNil(db)
+
+	_, err = db.Exec("CREATE TABLE foo (name text);")
+	s.NoError(err)
+
+	// two transactions on separate connections modify the same page
+	first, err := db.Begin()
+	s.NoError(err)
+	second, err := db.Begin()
+	s.NoError(err)
+
+	_, err = first.Exec("INSERT INTO foo (name) VALUES ('first');")
+	s.NoError(err)
+	_, err = second.Exec("INSERT INTO foo (name) VALUES ('second');")
+	s.NoError(err)
+
+	s.NoError(first.Commit())
+	s.True(errors.Is(second.Commit(), ErrConflict))
+
+	// retrying the conflicting transaction succeeds
+	retry, err := db.Begin()
+	s.NoError(err)
+	_, err = retry.Exec("INSERT INTO foo (name) VALUES ('second');")
+	s.NoError(err)
+	s.NoError(retry.Commit())
+
+	rows, err := db.Query("SELECT name FROM foo;")
+	s.NoError(err)
+
+	var names []string
+	for rows.Next() {
+		var name string
+		s.NoError(rows.Scan(&name))
+		names = append(names, name)
+	}
+	s.Equal([]string{"first", "second"}, names)
+}
+
+func (s *DriverTestSuite) TestDriver_Count() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE foo (name text);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO foo (name) VALUES ('bar');")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO foo (name) VALUES ('baz');")
+	s.NoError(err)
+
+	var count int
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM foo;").Scan(&count))
+	s.Equal(2, count)
+}
+
+func (s *DriverTestSuite) TestDriver_ParamCountMismatch() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE foo (name text);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO foo (name) VALUES ('bar');")
+	s.NoError(err)
+
+	// database/sql checks the arguments against the count reported by the server
+	stmt, err := db.Prepare("SELECT name FROM foo;")
+	s.NoError(err)
+	_, err = stmt.Query("bar")
+	s.EqualError(err, "sql: expected 0 arguments, got 1")
+	_, err = db.Exec("INSERT INTO foo (name) VALUES ('bar');", "bar", "baz")
+	s.EqualError(err, "sql: expected 0 arguments, got 2")
+
+	// the server checks the parameters bound when executing
+	conn, err := db.Conn(context.Background())
+	s.NoError(err)
+	defer conn.Close()
+	s.NoError(conn.Raw(func(dc interface{}) error {
+		stmt, err := dc.(*TinyDBConnection).Prepare("SELECT name FROM foo;")
+		s.NoError(err)
+		s.Equal(0, stmt.NumInput())
+
+		_, err = stmt.Query([]driver.Value{"bar"})
+		s.EqualError(err, "error executing prepared statement: error binding parameters: bind supplies 1 parameters, but prepared statement requires 0")
+		_, err = stmt.Exec([]driver.Value{"bar", int64(2)})
+		s.EqualError(err, "error executing non-query prepared statement: error binding parameters: bind supplies 2 parameters, but prepared statement requires 0")
+
+		// the connection remains usable
+		rows, err := stmt.Query(nil)
+		s.NoError(err)
+		row := make([]driver.Value, 1)
+		s.NoError(rows.Next(row))
+		s.Equal("bar", row[0])
+		return nil
+	}))
+}
+
+func (s *DriverTestSuite) TestDriver_StmtClose() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE bookmarks (url text);")
+	s.NoError(err)
+
+	conn, err := db.Conn(context.Background())
+	s.NoError(err)
+	defer conn.Close()
+	s.NoError(conn.Raw(func(dc interface{}) error {
+		tc := dc.(*TinyDBConnection)
+
+		// statements with the same text share a statement on the server
+		first, err := tc.Prepare("INSERT INTO bookmarks (url) VALUES ($1);")
+		s.NoError(err)
+		second, err := tc.Prepare("INSERT INTO bookmarks (url) VALUES ($1);")
+		s.NoError(err)
+
+		s.NoError(first.Close())
+		_, err = second.Exec([]driver.Value{"a"})
+		s.NoError(err)
+
+		// the server frees the statement once both are closed
+		s.NoError(second.Close())
+		_, err = second.Exec(nil)
+		s.EqualError(err, "error executing non-query prepared statement: error executing query: prepared statement not found")
+
+		// the connection remains usable
+		stmt, err := tc.Prepare("INSERT INTO bookmarks (url) VALUES ($1);")
+		s.NoError(err)
+		_, err = stmt.Exec([]driver.Value{"b"})
+		s.NoError(err)
+		return stmt.Close()
+	}))
+
+	var count int
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM bookmarks;").Scan(&count))
+	s.Equal(2, count)
+}
+
+func (s *DriverTestSuite) TestDriver_ColumnAliases() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE authors (id int PRIMARY KEY, name text);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO authors (name) VALUES ('le guin');")
+	s.NoError(err)
+
+	rows, err := db.Query("SELECT name AS full_name, id author_id FROM authors;")
+	s.NoError(err)
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	s.NoError(err)
+	s.Equal([]string{"full_name", "author_id"}, cols)
+
+	s.True(rows.Next())
+	var name string
+	var id int
+	s.NoError(rows.Scan(&name, &id))
+	s.Equal("le guin", name)
+	s.Equal(1, id)
+	s.False(rows.Next())
+	s.NoError(rows.Err())
+}
+
+func (s *DriverTestSuite) TestDriver_ColumnTypes() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE staff (id int PRIMARY KEY, name text, nickname text, age int);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO staff (name, nickname, age) VALUES ('joe', 'jo', 34), ('ava', NULL, 300000);")
+	s.NoError(err)
+
+	rows, err := db.Query("SELECT id, name, nickname, age FROM staff;")
+	s.NoError(err)
+
+	type member struct {
+		id       int64
+		name     string
+		nickname sql.NullString
+		age      interface{}
+	}
+	var staff []member
+	for rows.Next() {
+		var m member
+		s.NoError(rows.Scan(&m.id, &m.name, &m.nickname, &m.age))
+		staff = append(staff, m)
+	}
+	s.NoError(rows.Err())
+
+	s.Equal([]member{
+		{1, "joe", sql.NullString{String: "jo", Valid: true}, int64(34)},
+		{2, "ava", sql.NullString{}, int64(300000)},
+	}, staff)
+}
+
+func (s *DriverTestSuite) TestDriver_Parameters() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE contacts (id int PRIMARY KEY, name text, age int);")
+	s.NoError(err)
+
+	// A NULL integer primary key is assigned the next rowid
+	insert, err := db.Prepare("INSERT INTO contacts (id, name, age) VALUES ($1, $2, $3);")
+	s.NoError(err)
+	_, err = insert.Exec(5, "ann", 31)
+	s.NoError(err)
+	_, err = insert.Exec(nil, "bob", nil)
+	s.NoError(err)
+	_, err = insert.Exec(nil, "it's", "42")
+	s.NoError(err)
+
+	var id, age int64
+	s.NoError(db.QueryRow("SELECT id FROM contacts WHERE name = $1;", "bob").Scan(&id))
+	s.Equal(int64(6), id)
+	s.NoError(db.QueryRow("SELECT age FROM contacts WHERE name = $1;", "it's").Scan(&age))
+	s.Equal(int64(42), age)
+
+	// Parameters may be referenced in any order and more than once
+	rows, err := db.Query("SELECT name FROM contacts WHERE age > $2 OR name = $1 OR id = $2;", "bob", 40)
+	s.NoError(err)
+	var names []string
+	for rows.Next() {
+		var name string
+		s.NoError(rows.Scan(&name))
+		names = append(names, name)
+	}
+	s.NoError(rows.Err())
+	s.Equal([]string{"bob", "it's"}, names)
+
+	// The number of arguments must match the placeholders
+	_, err = db.Query("SELECT name FROM contacts WHERE name = $1;")
+	s.EqualError(err, "sql: expected 1 arguments, got 0")
+
+	conn, err := db.Conn(context.Background())
+	s.NoError(err)
+	defer conn.Close()
+	s.NoError(conn.Raw(func(dc interface{}) error {
+		stmt, err := dc.(*TinyDBConnection).Prepare("SELECT name FROM contacts WHERE name = $1;")
+		s.NoError(err)
+		s.Equal(1, stmt.NumInput())
+
+		_, err = stmt.Query([]driver.Value{"ann", "bob"})
+		s.EqualError(err, "error executing prepared statement: error binding parameters: bind supplies 2 parameters, but prepared statement requires 1")
+		_, err = stmt.Query(nil)
+		s.EqualError(err, "error executing prepared statement: error executing query: bind supplies 0 parameters, but prepared statement requires 1")
+		return nil
+	}))
+}
+
+func (s *DriverTestSuite) TestDriver_PositionalParameters() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE badges (name text, level int);")
+	s.NoError(err)
+
+	_, err = db.Exec("INSERT INTO badges (name, level) VALUES (?, ?);", "bar", 2)
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO badges (name, level) VALUES (?, ?);", "baz", 3)
+	s.NoError(err)
+
+	rows, err := db.Query("SELECT * FROM badges WHERE name = ?;", "bar")
+	s.NoError(err)
+	var levels []int64
+	for rows.Next() {
+		var name string
+		var level int64
+		s.NoError(rows.Scan(&name, &level))
+		s.Equal("bar", name)
+		levels = append(levels, level)
+	}
+	s.NoError(rows.Err())
+	s.Equal([]int64{2}, levels)
+
+	// Each ? is numbered after the placeholders before it
+	var name string
+	s.NoError(db.QueryRow("SELECT name FROM badges WHERE level > ? AND name = ?;", 2, "baz").Scan(&name))
+	s.Equal("baz", name)
+
+	_, err = db.Query("SELECT name FROM badges WHERE name = ?;")
+	s.EqualError(err, "sql: expected 1 arguments, got 0")
+}
+
+func (s *DriverTestSuite) TestDriver_Explain() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE gadgets (name text, price int);")
+	s.NoError(err)
+
+	rows, err := db.Query("EXPLAIN SELECT * FROM gadgets WHERE name = 'bar';")
+	s.NoError(err)
+
+	cols, err := rows.Columns()
+	s.NoError(err)
+	s.Equal([]string{"addr", "opcode", "p1", "p2", "p3", "p4", "comment"}, cols)
+
+	var opcodes []string
+	for rows.Next() {
+		var addr, p1, p2, p3 int64
+		var opcode, comment string
+		var p4 sql.NullString
+		s.NoError(rows.Scan(&addr, &opcode, &p1, &p2, &p3, &p4, &comment))
+		s.Equal(int64(len(opcodes)), addr)
+		opcodes = append(opcodes, opcode)
+	}
+	s.NoError(rows.Err())
+	s.Contains(opcodes, "OpOpenRead")
+	s.Contains(opcodes, "OpResultRow")
+	s.Equal("OpHalt", opcodes[len(opcodes)-1])
+
+	// The explained statement is not run
+	rows, err = db.Query("EXPLAIN INSERT INTO gadgets (name, price) VALUES ('bar', 1);")
+	s.NoError(err)
+	s.NoError(rows.Close())
+	var count int64
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM gadgets;").Scan(&count))
+	s.Equal(int64(0), count)
+}
+
+// countingConn counts the writes made to a connection
+type countingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.Conn.Write(b)
+}
+
+func (s *DriverTestSuite) TestDriver_QueryInline() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE colors (name text, hex text);")
+	s.NoError(err)
+	_, err = db.Exec("INSERT INTO colors (name, hex) VALUES ('red', 'ff0000'), ('green', '00ff00'), ('blue', '0000ff');")
+	s.NoError(err)
+
+	conn, err := db.Conn(context.Background())
+	s.NoError(err)
+	defer conn.Close()
+
+	s.NoError(conn.Raw(func(driverConn interface{}) error {
+		c := driverConn.(*TinyDBConnection)
+		counting := &countingConn{Conn: c.conn}
+		c.conn = counting
+		defer func() { c.conn = counting.Conn }()
+
+		rows, err := c.QueryInline("SELECT name, hex FROM colors;")
+		s.NoError(err)
+		s.Equal([]string{"name", "hex"}, rows.Columns())
+
+		// the rows were sent with the result of a single command, its
+		// header and its payload
+		s.Equal(2, counting.writes)
+
+		var names []interface{}
+		dest := make([]driver.Value, 2)
+		for rows.Next(dest) == nil {
+			names = append(names, dest[0])
+		}
+		s.Equal([]interface{}{"red", "green", "blue"}, names)
+		s.NoError(rows.Close())
+		s.Equal(2, counting.writes)
+
+		// a statement without a result completes right away
+		rows, err = c.QueryInline("INSERT INTO colors (name, hex) VALUES ('black', '000000');")
+		s.NoError(err)
+		s.Equal(io.EOF, rows.Next(dest))
+
+		_, err = c.QueryInline("SELECT nosuch FROM colors;")
+		s.Error(err)
+		return nil
+	}))
+
+	// the connection carries on with the next statement
+	var count int64
+	s.NoError(conn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM colors;").Scan(&count))
+	s.Equal(int64(4), count)
+}
+
+func (s *DriverTestSuite) TestDriver_QueryTimeout() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+
+	_, err = db.Exec("CREATE TABLE events (name text);")
+	s.NoError(err)
+	tx, err := db.Begin()
+	s.NoError(err)
+	for i := 0; i < 200; i++ {
+		_, err = tx.Exec("INSERT INTO events (name) VALUES ($1);", fmt.Sprintf("event %d", i))
+		s.NoError(err)
+	}
+	s.NoError(tx.Commit())
+
+	timed, err := sql.Open(s.driverName, s.dsn+"?query_timeout=20ms")
+	s.NoError(err)
+
+	// the scan outlives the timeout while the rows are read slowly
+	rows, err := timed.Query("SELECT name FROM events;")
+	s.NoError(err)
+	s.True(rows.Next())
+	time.Sleep(50 * time.Millisecond)
+	for rows.Next() {
+	}
+	s.ErrorIs(rows.Err(), ErrQueryTimeout)
+
+	// the connection carries on with the next statement
+	var count int
+	s.NoError(timed.QueryRow("SELECT COUNT(*) FROM events;").Scan(&count))
+	s.Equal(200, count)
+
+	for dsn, message := range map[string]string{
+		s.dsn + "?query_timeout=soon": "invalid query_timeout: soon",
+		s.dsn + "?timeout=5s":         "unknown dsn parameter: timeout",
+	} {
+		invalid, err := sql.Open(s.driverName, dsn)
+		s.NoError(err)
+		s.EqualError(invalid.Ping(), message)
+	}
+}
+
+func (s *DriverTestSuite) TestDriver_QueryContextCancel() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE readings (value int);")
+	s.NoError(err)
+	tx, err := db.Begin()
+	s.NoError(err)
+	for i := 0; i < 200; i++ {
+		_, err = tx.Exec("INSERT INTO readings (value) VALUES ($1);", i)
+		s.NoError(err)
+	}
+	s.NoError(tx.Commit())
+
+	// the scan stops when the context is canceled between rows
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, "SELECT value FROM readings;")
+	s.NoError(err)
+	for i := 0; i < 10; i++ {
+		s.True(rows.Next())
+	}
+	cancel()
+	for rows.Next() {
+	}
+	s.ErrorIs(rows.Err(), context.Canceled)
+	s.NoError(rows.Close())
+
+	// a canceled context is not sent
+	_, err = db.ExecContext(ctx, "INSERT INTO readings (value) VALUES (1000);")
+	s.ErrorIs(err, context.Canceled)
+	_, err = db.BeginTx(ctx, nil)
+	s.ErrorIs(err, context.Canceled)
+
+	_, err = db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	s.EqualError(err, "read-only transactions are not supported")
+
+	// the connection carries on with the next statement
+	var count int
+	s.NoError(db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM readings;").Scan(&count))
+	s.Equal(200, count)
+}
+
+func (s *DriverTestSuite) TestDriver_ExecContextCancel() {
+	db, err := sql.Open(s.driverName, s.dsn)
+	s.NoError(err)
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE samples (id int, label text);")
+	s.NoError(err)
+	tx, err := db.Begin()
+	s.NoError(err)
+	for i := 0; i < 200; i++ {
+		var values []string
+		var args []interface{}
+		for j := 0; j < 10; j++ {
+			values = append(values, fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2))
+			args = append(args, i*10+j, fmt.Sprintf("sample-%d", i*10+j))
+		}
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO samples (id, label) VALUES %s;", strings.Join(values, ", ")), args...)
+		s.NoError(err)
+	}
+	s.NoError(tx.Commit())
+
+	// the statement is stopped on the server while it executes
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = db.ExecContext(ctx, "CREATE INDEX idx_samples_label ON samples (label);")
+	s.ErrorIs(err, context.Canceled)
+
+	// the canceled statement is rolled back
+	_, err = db.Exec("CREATE INDEX idx_samples_label ON samples (label);")
+	s.NoError(err)
+
+	// the connection carries on with the next statement
+	var count int
+	s.NoError(db.QueryRow("SELECT COUNT(*) FROM samples;").Scan(&count))
+	s.Equal(2000, count)
+}
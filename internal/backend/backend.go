@@ -2,15 +2,24 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joeandaverde/tinydb/internal/pager"
 	"github.com/joeandaverde/tinydb/internal/virtualmachine"
 	"github.com/joeandaverde/tinydb/tsql"
+	"github.com/joeandaverde/tinydb/tsql/ast"
 )
 
+// ErrStatementTimeout is returned when a statement runs longer than the
+// statement timeout of the session
+var ErrStatementTimeout = errors.New("canceling statement due to statement timeout")
+
 type Backend struct {
 	sync.Mutex
 
@@ -20,6 +29,21 @@ type Backend struct {
 	failed     bool
 	proc       chan struct{}
 	log        logrus.FieldLogger
+
+	// statementTimeout aborts statements running longer than the duration, 0 disables the timeout
+	statementTimeout time.Duration
+
+	// savepoints of the transaction from the oldest to the newest
+	savepoints []savepoint
+	// savepointTx is set when the transaction was started by a savepoint,
+	// the transaction commits when its first savepoint is released
+	savepointTx bool
+}
+
+// savepoint is a named snapshot of the pager within a transaction
+type savepoint struct {
+	name     string
+	snapshot *pager.Snapshot
 }
 
 // Row is a row in a result
@@ -34,17 +58,40 @@ const (
 	exitCodeCommit
 	exitCodeRollback
 	exitCodeError
+	exitCodeCanceled
+	exitCodeSavepoint
+	exitCodeConstraint
+	exitCodeStatement
 )
 
 type ProgramInstance struct {
-	Pid    int
-	Tag    string
+	Pid int
+	Tag string
+
+	// Output receives the result rows, a row must be copied to be kept
+	// past the next row
 	Output <-chan virtualmachine.Output
 	Exit   <-chan error
 
 	inTx    bool
 	program *virtualmachine.Program
 	pager   pager.Pager
+
+	// savepoint is the savepoint operation requested by the program
+	savepoint *virtualmachine.Savepoint
+}
+
+// explain sends a row for each instruction of an explained statement
+func explain(ctx context.Context, stmt *virtualmachine.PreparedStatement, out chan<- virtualmachine.Output) error {
+	defer close(out)
+	for _, row := range stmt.ExplainRows() {
+		select {
+		case out <- virtualmachine.Output{Data: row}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
 func NewBackend(logger logrus.FieldLogger, p pager.Pager) *Backend {
@@ -76,8 +123,8 @@ func (b *Backend) Prepare(command string) (*virtualmachine.PreparedStatement, er
 	return preparedStmt, nil
 }
 
-// Exec executes a statement
-func (b *Backend) Exec(ctx context.Context, stmt *virtualmachine.PreparedStatement) (*ProgramInstance, error) {
+// Exec executes a statement with the values bound to its parameters
+func (b *Backend) Exec(ctx context.Context, stmt *virtualmachine.PreparedStatement, params ...interface{}) (*ProgramInstance, error) {
 	// reserve the processor
 	<-b.proc
 
@@ -90,12 +137,23 @@ func (b *Backend) Exec(ctx context.Context, stmt *virtualmachine.PreparedStateme
 
 	log := b.log.WithField("pid", pid)
 	program := virtualmachine.NewProgram(pid, stmt)
+	if err := program.Bind(params); err != nil {
+		b.proc <- struct{}{}
+		return nil, err
+	}
+
+	// The rows of an explained statement are its instructions
+	output := program.Output()
+	explainOut := make(chan virtualmachine.Output)
+	if stmt.Explain {
+		output = explainOut
+	}
 
 	// ready program for execution
 	exitCh := make(chan error, 1)
 	instance := &ProgramInstance{
 		Pid:     pid,
-		Output:  program.Output(),
+		Output:  output,
 		Exit:    exitCh,
 		Tag:     stmt.Tag,
 		inTx:    b.inTx,
@@ -109,10 +167,47 @@ func (b *Backend) Exec(ctx context.Context, stmt *virtualmachine.PreparedStateme
 		// release processor reservation
 		defer func() { b.proc <- struct{}{} }()
 
+		// Session parameters are changed without running the program
+		if s, ok := stmt.Statement.(*ast.SetStatement); ok {
+			log.Debugf("set %s", s.Name)
+			exitCh <- b.set(s)
+			return
+		}
+
+		// The instructions of an explained statement are listed rather than run
+		if stmt.Explain {
+			log.Debugf("explain")
+			exitCh <- explain(ctx, stmt, explainOut)
+			return
+		}
+
+		// Abort the program when it runs longer than the statement timeout
+		runCtx := ctx
+		if b.statementTimeout > 0 {
+			var cancel context.CancelFunc
+			runCtx, cancel = context.WithTimeout(ctx, b.statementTimeout)
+			defer cancel()
+		}
+
 		log.Debugf("running program")
-		c, err := run(ctx, instance)
+		c, err := run(runCtx, instance)
 
 		switch c {
+		case exitCodeCanceled:
+			log.Debugf("program exit: canceled")
+			if ctx.Err() == nil {
+				err = ErrStatementTimeout
+			}
+			exitCh <- b.abort(err)
+			return
+		case exitCodeConstraint:
+			log.Debugf("program exit: constraint")
+			exitCh <- b.abort(err)
+			return
+		case exitCodeStatement:
+			log.Debugf("program exit: statement error")
+			exitCh <- b.abort(err)
+			return
 		case exitCodeError:
 			log.Debugf("program exit: error")
 			exitCh <- b.fatal(err)
@@ -129,6 +224,10 @@ func (b *Backend) Exec(ctx context.Context, stmt *virtualmachine.PreparedStateme
 			log.Debugf("program exit: rollback")
 			exitCh <- b.rollback()
 			return
+		case exitCodeSavepoint:
+			log.Debugf("program exit: savepoint")
+			exitCh <- b.savepoint(instance.savepoint)
+			return
 		default:
 			log.Debugf("program exit: code %d", c)
 			exitCh <- b.fatal(fmt.Errorf("unknown program exit code: %d", c))
@@ -143,6 +242,7 @@ func (b *Backend) fatal(err error) error {
 	log := b.log.WithField("pid", b.pidCounter)
 	b.inTx = false
 	b.failed = true
+	b.clearSavepoints()
 	log.WithError(err).Error("fatal error")
 	b.pager.Reset()
 	return err
@@ -153,16 +253,39 @@ func (b *Backend) rollback() error {
 	log := b.log.WithField("pid", b.pidCounter)
 
 	b.inTx = false
+	b.clearSavepoints()
 	log.Debug("rollback")
 	b.pager.Reset()
 	return nil
 }
 
+// abort rolls back any changes made by a canceled program
+func (b *Backend) abort(err error) error {
+	b.rollback()
+	return err
+}
+
+// set changes a configuration parameter of the session
+func (b *Backend) set(s *ast.SetStatement) error {
+	switch strings.ToLower(s.Name) {
+	case "statement_timeout":
+		ms, err := strconv.Atoi(s.Value)
+		if err != nil || ms < 0 {
+			return fmt.Errorf("invalid value for parameter %s: %s", s.Name, s.Value)
+		}
+		b.statementTimeout = time.Duration(ms) * time.Millisecond
+		return nil
+	default:
+		return fmt.Errorf("unrecognized configuration parameter: %s", s.Name)
+	}
+}
+
 // commit ensures modifications are persisted
 func (b *Backend) commit() error {
 	log := b.log.WithField("pid", b.pidCounter)
 
 	b.inTx = false
+	b.clearSavepoints()
 	log.Debug("commit")
 	if err := b.pager.Flush(); err != nil {
 		log.WithError(err).Error("commit failed")
@@ -172,6 +295,53 @@ func (b *Backend) commit() error {
 	return nil
 }
 
+// savepoint starts, releases or rolls back to a savepoint. A savepoint
+// outside of a transaction starts one.
+func (b *Backend) savepoint(s *virtualmachine.Savepoint) error {
+	log := b.log.WithField("pid", b.pidCounter)
+
+	if s.Op == virtualmachine.SavepointBegin {
+		if !b.inTx {
+			b.inTx = true
+			b.savepointTx = true
+		}
+		log.Debugf("savepoint %s", s.Name)
+		b.savepoints = append(b.savepoints, savepoint{name: s.Name, snapshot: b.pager.Snapshot()})
+		return nil
+	}
+
+	// The most recent savepoint of the name is used
+	i := len(b.savepoints) - 1
+	for i >= 0 && b.savepoints[i].name != s.Name {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("no such savepoint: %s", s.Name)
+	}
+
+	switch s.Op {
+	case virtualmachine.SavepointRelease:
+		// Changes made since the savepoint belong to the enclosing savepoint
+		log.Debugf("release savepoint %s", s.Name)
+		b.savepoints = b.savepoints[:i]
+		if len(b.savepoints) == 0 && b.savepointTx {
+			return b.commit()
+		}
+	case virtualmachine.SavepointRollback:
+		// The savepoint remains and may be rolled back to again
+		log.Debugf("rollback to savepoint %s", s.Name)
+		b.pager.Restore(b.savepoints[i].snapshot)
+		b.savepoints = b.savepoints[:i+1]
+	}
+	return nil
+}
+
+// clearSavepoints forgets the savepoints of a transaction that ended
+func (b *Backend) clearSavepoints() {
+	b.savepoints = nil
+	b.savepointTx = false
+}
+
 // begin makes no changes to the underlying pager and ensures the backend is in a transacted state
 func (b *Backend) begin() error {
 	log := b.log.WithField("pid", b.pidCounter)
@@ -187,9 +357,25 @@ func run(ctx context.Context, instance *ProgramInstance) (exitCode, error) {
 		Rollback:   false,
 	}, instance.pager)
 	if err != nil {
+		if ctx.Err() != nil {
+			return exitCodeCanceled, err
+		}
+		var constraintErr *virtualmachine.ConstraintError
+		if errors.As(err, &constraintErr) {
+			return exitCodeConstraint, err
+		}
+		var statementErr *virtualmachine.StatementError
+		if errors.As(err, &statementErr) {
+			return exitCodeStatement, err
+		}
 		return exitCodeError, err
 	}
 
+	if flags.Savepoint != nil {
+		instance.savepoint = flags.Savepoint
+		return exitCodeSavepoint, nil
+	}
+
 	if flags.Rollback {
 		return exitCodeRollback, nil
 	}
@@ -3,14 +3,23 @@ package backend
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/joeandaverde/tinydb/internal/pager"
+	"github.com/joeandaverde/tinydb/internal/storage"
+	"github.com/joeandaverde/tinydb/internal/virtualmachine"
+	"github.com/joeandaverde/tinydb/tsql"
+	"github.com/joeandaverde/tinydb/tsql/ast"
 )
 
 type BackendTestSuite struct {
@@ -29,9 +38,10 @@ func (s *BackendTestSuite) SetupTest() {
 	logger := logrus.New()
 	logger.SetLevel(logrus.DebugLevel)
 
+	// Tests that reopen a database start their own engine in a data dir
 	dbEngine, err := Start(logger, Config{
-		DataDir:  tempDir,
 		PageSize: 4096,
+		InMemory: true,
 	})
 	s.NoError(err)
 
@@ -84,155 +94,2172 @@ func (s *BackendTestSuite) TestSimple() {
 	s.Equal("bar", rows[0].Data[0].(string))
 }
 
-func (s *BackendTestSuite) TestSimple_NoData() {
-	s.assertQuery("create table foo (name text)")
+func (s *BackendTestSuite) TestSimple_ProjectColumns() {
+	s.assertQuery("create table regions (id int, name text, state text)")
+	s.assertQuery("insert into regions (id, name, state) values (1, 'north', 'MN'), (2, 'south', 'TX')")
 
-	rows, err := s.simpleQuery("select * from foo")
+	// Columns are read by their offset in the record, not their position in the result
+	rows, err := s.simpleQuery("select state, id from regions")
 	s.NoError(err)
-	s.Empty(rows)
+	s.Len(rows, 2)
+	s.Equal([]interface{}{"MN", 1}, rows[0].Data)
+	s.Equal([]interface{}{"TX", 2}, rows[1].Data)
+
+	s.assertSameResults("select state, id from regions")
+	s.assertSameResults("select name, name, id from regions where state = 'TX'")
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter() {
-	s.assertQuery("create table foo (name text)")
-	s.assertQuery("insert into foo (name) values ('bar')")
-	s.assertQuery("insert into foo (name) values ('baz')")
+func (s *BackendTestSuite) TestSimple_UniqueColumn() {
+	s.assertQuery("create table newsletters (id int primary key, email text unique, name text)")
+	s.assertQuery("insert into newsletters (id, email, name) values (1, 'joe@example.com', 'joe')")
+	s.assertQuery("insert into newsletters (id, email, name) values (2, 'ava@example.com', 'ava')")
 
-	rows, err := s.simpleQuery("select * from foo where name = 'bar'")
+	_, err := s.simpleQuery("insert into newsletters (id, email, name) values (3, 'joe@example.com', 'again')")
+	s.EqualError(err, "UNIQUE constraint failed: newsletters.email")
+
+	// A statement with a duplicate value inserts none of its rows
+	_, err = s.simpleQuery("insert into newsletters (id, email, name) values (4, 'eve@example.com', 'eve'), (5, 'eve@example.com', 'again')")
+	s.EqualError(err, "UNIQUE constraint failed: newsletters.email")
+
+	// NULL values never conflict
+	s.assertQuery("insert into newsletters (id, name) values (6, 'bob')")
+	s.assertQuery("insert into newsletters (id, name) values (7, 'sam')")
+
+	rows, err := s.simpleQuery("select id, email from newsletters")
 	s.NoError(err)
 
-	expectedResults := [][]interface{}{{"bar"}}
+	expectedResults := [][]interface{}{
+		{1, "joe@example.com"},
+		{2, "ava@example.com"},
+		{6, nil},
+		{7, nil},
+	}
 	s.Len(rows, len(expectedResults))
 	for i, e := range expectedResults {
 		s.Equal(e, rows[i].Data)
 	}
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter2() {
-	s.assertQuery("create table foo (name text)")
-	s.assertQuery("insert into foo (name) values ('bar')")
-	s.assertQuery("insert into foo (name) values ('bam')")
-	s.assertQuery("insert into foo (name) values ('baz')")
+func (s *BackendTestSuite) TestSimple_QuotedIdentifiers() {
+	s.assertQuery("create table \"menu items\" (\"select\" text, `order` int)")
+	s.assertQuery("insert into \"menu items\" (\"select\", `order`) values ('soup', 2), ('bread', 1)")
 
-	rows, err := s.simpleQuery("select * from foo where name = 'baz' OR name = 'bam'")
+	rows, err := s.simpleQuery("select \"select\", `order` from \"menu items\" where `order` > 1")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"soup", 2}, rows[0].Data)
+
+	s.assertSameResults("select \"select\", \"order\" from `menu items` order by `order`")
+	s.assertSameResults("select \"select\" from \"menu items\" where \"select\" = 'bread'")
+}
+
+func (s *BackendTestSuite) TestSimple_NegativeNumbers() {
+	s.assertQuery("create table thermometers (site text, reading int)")
+	s.assertQuery("create index thermometers_reading on thermometers (reading)")
+	s.assertQuery("insert into thermometers (site, reading) values ('pole', -30), ('desert', 45), ('harbor', -3), ('peak', -12)")
+
+	rows, err := s.simpleQuery("select site from thermometers where reading = -3")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"harbor"}, rows[0].Data)
+
+	s.assertSameResults("select site, reading - -5, reading-5, -2.5 * reading from thermometers")
+	s.assertSameResults("select site from thermometers where reading < -10 order by reading")
+	s.assertSameResults("select site from thermometers where reading between -15 and 0 order by site")
+}
+
+func (s *BackendTestSuite) TestSimple_PrimaryKeyRowID() {
+	s.assertQuery("create table accounts (id int primary key, name text)")
+	s.assertQuery("insert into accounts (name) values ('joe')")
+	s.assertQuery("insert into accounts (name) values ('ava')")
+
+	rows, err := s.simpleQuery("select id, name from accounts")
 	s.NoError(err)
 
 	expectedResults := [][]interface{}{
-		{"bam"},
-		{"baz"},
+		{1, "joe"},
+		{2, "ava"},
 	}
 	s.Len(rows, len(expectedResults))
 	for i, e := range expectedResults {
 		s.Equal(e, rows[i].Data)
 	}
+
+	rows, err = s.simpleQuery("select name from accounts where id = 2")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal("ava", rows[0].Data[0])
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter3() {
-	s.assertQuery("create table foo (name text)")
-	for i := 0; i < 10; i++ {
-		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
-	}
+func (s *BackendTestSuite) TestSimple_PrimaryKeyUnique() {
+	s.assertQuery("create table editions (id int primary key, title text)")
+	s.assertQuery("insert into editions (id, title) values (1, 'first')")
 
-	rows, err := s.simpleQuery("select * from foo where (name = '1' OR name = '2') OR name = '7' OR name = '4'")
+	_, err := s.simpleQuery("insert into editions (id, title) values (1, 'again')")
+	s.EqualError(err, "UNIQUE constraint failed: editions.id")
+
+	// A statement with a duplicate key inserts none of its rows
+	_, err = s.simpleQuery("insert into editions (id, title) values (2, 'second'), (2, 'again')")
+	s.EqualError(err, "UNIQUE constraint failed: editions.id")
+
+	// The backend remains usable after the failed statements
+	s.assertQuery("insert into editions (id, title) values (3, 'third')")
+	rows, err := s.simpleQuery("select id, title from editions")
 	s.NoError(err)
+	s.Len(rows, 2)
+	s.Equal([]interface{}{1, "first"}, rows[0].Data)
+	s.Equal([]interface{}{3, "third"}, rows[1].Data)
+}
 
-	expectedResults := [][]interface{}{
-		{"1"},
-		{"2"},
-		{"4"},
-		{"7"},
+// pageMap is a page source keeping pages in a map
+type pageMap struct {
+	pageSize int
+	pages    map[int][]byte
+}
+
+func (m *pageMap) PageSize() int {
+	return m.pageSize
+}
+
+func (m *pageMap) ReservedSpace() int {
+	return 0
+}
+
+func (m *pageMap) TotalPages() int {
+	return len(m.pages)
+}
+
+func (m *pageMap) Read(page int) ([]byte, error) {
+	data, ok := m.pages[page]
+	if !ok {
+		return nil, fmt.Errorf("page does not exist: %d", page)
 	}
-	s.Len(rows, len(expectedResults))
-	for i, e := range expectedResults {
-		s.Equal(e, rows[i].Data)
+	return append([]byte(nil), data...), nil
+}
+
+func (m *pageMap) Write(pages ...storage.Page) error {
+	for _, p := range pages {
+		m.pages[p.PageNumber] = append([]byte(nil), p.Data[:m.pageSize]...)
 	}
+	return nil
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter4() {
-	s.assertQuery("create table foo (name text)")
-	for i := 1; i <= 10; i++ {
-		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+func (s *BackendTestSuite) TestSimple_CustomPageSource() {
+	file := &pageMap{pageSize: 4096, pages: make(map[int][]byte)}
+	s.NoError(pager.Initialize(file))
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	s.assertQuery("create table notes (body text)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 500; i++ {
+		s.assertQuery(fmt.Sprintf("insert into notes (body) values ('note %d')", i))
 	}
+	s.assertQuery("COMMIT")
 
-	rows, err := s.simpleQuery("select * from foo where name = '1' AND name != '2'")
+	rows, err := s.simpleQuery("select * from notes where body = 'note 499'")
 	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal("note 499", rows[0].Data[0])
 
-	expectedResults := [][]interface{}{
-		{"1"},
+	// the rows span several pages written to the custom source
+	s.Greater(file.TotalPages(), 2)
+}
+
+// countingPageMap is a page source counting the pages read from it
+type countingPageMap struct {
+	*pageMap
+	reads int
+}
+
+func (m *countingPageMap) Read(page int) ([]byte, error) {
+	m.reads++
+	return m.pageMap.Read(page)
+}
+
+func (s *BackendTestSuite) TestSimple_CreateIndex() {
+	file := &countingPageMap{pageMap: &pageMap{pageSize: 4096, pages: make(map[int][]byte)}}
+	s.NoError(pager.Initialize(file))
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	s.assertQuery("create table measurements (sensor text, value int)")
+
+	// Half of the rows are indexed when the index is created, the rest as they are inserted
+	insert := func(from, to int) {
+		s.assertQuery("BEGIN")
+		for i := from; i < to; i++ {
+			value := i * 7 % 500
+			s.assertQuery(fmt.Sprintf("insert into measurements (sensor, value) values ('sensor %d in the north field', %d)", i, value))
+		}
+		s.assertQuery("COMMIT")
 	}
-	s.Len(rows, len(expectedResults))
-	for i, e := range expectedResults {
-		s.Equal(e, rows[i].Data)
+	insert(0, 250)
+	s.assertQuery("create index measurements_value on measurements (value)")
+	insert(250, 500)
+
+	s.assertSameResults("select value from measurements where value >= 100 AND value < 140 order by value")
+	s.assertSameResults("select value from measurements where value between 480 and 1000")
+	s.assertSameResults("select value from measurements where value > 495")
+	s.assertSameResults("select value from measurements where value <= 3")
+	s.assertSameResults("select value from measurements where value = 250")
+	s.assertSameResults("select value from measurements where 10 > value AND value > 4")
+	s.assertSameResults("select count(*) from measurements where value < 1000")
+	s.assertSameResults("select sensor from measurements where value = 250")
+
+	// Count the pages read by a query on a fresh pager
+	pagesRead := func(query string) int {
+		s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+		file.reads = 0
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		s.Len(rows, 40)
+		return file.reads
 	}
+
+	// The index holds every column of the first query, the second reads the table
+	indexScan := pagesRead("select value from measurements where value >= 100 AND value < 140")
+	tableScan := pagesRead("select sensor from measurements where value >= 100 AND value < 140")
+	s.Less(indexScan, tableScan)
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter_ComboOrAnd() {
-	s.assertQuery("create table foo (name text)")
-	for i := 0; i < 10; i++ {
-		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+func (s *BackendTestSuite) TestSimple_TextRoundTrip() {
+	s.assertQuery("create table snippets (body text)")
+
+	values := []string{
+		"  spaced  ",
+		"\tinner  \t gaps\n",
+		"",
+		" ",
+		"a;b; ",
+		";",
+		"SELECT 1; DROP",
+	}
+	for _, v := range values {
+		s.assertQuery(fmt.Sprintf("insert into snippets (body) values ('%s')", v))
 	}
 
-	rows, err := s.simpleQuery("select * from foo where (name = '1' AND name != '2') OR name = '3'")
+	rows, err := s.simpleQuery("select body from snippets")
 	s.NoError(err)
+	s.Len(rows, len(values))
+	for i, v := range values {
+		s.Equal([]interface{}{v}, rows[i].Data)
+	}
 
-	expectedResults := [][]interface{}{
-		{"1"},
-		{"3"},
+	s.assertSameResults("select body from snippets")
+	s.assertSameResults("select body from snippets where body = '  spaced  '")
+	s.assertSameResults("select body from snippets where body = ''")
+	s.assertSameResults("select body from snippets where body = 'a;b; '")
+}
+
+func (s *BackendTestSuite) TestSimple_BlobRoundTrip() {
+	s.assertQuery("create table digests (name text, digest blob)")
+	s.assertQuery("insert into digests (name, digest) values ('beef', x'DEADBEEF')")
+	s.assertQuery("insert into digests (name, digest) values ('empty', x'')")
+	s.assertQuery("insert into digests (name, digest) values ('zero', x'00ff00')")
+	s.assertQuery("insert into digests (name) values ('none')")
+
+	rows, err := s.simpleQuery("select name, digest from digests")
+	s.NoError(err)
+	s.Len(rows, 4)
+	s.Equal([]interface{}{"beef", []byte{0xde, 0xad, 0xbe, 0xef}}, rows[0].Data)
+	s.Equal([]interface{}{"empty", []byte{}}, rows[1].Data)
+	s.Equal([]interface{}{"zero", []byte{0x00, 0xff, 0x00}}, rows[2].Data)
+	s.Equal([]interface{}{"none", nil}, rows[3].Data)
+
+	s.assertSameResults("select name, digest from digests")
+	s.assertSameResults("select name from digests where digest = x'DEADBEEF'")
+	s.assertSameResults("select name, digest from digests order by digest")
+
+	// a blob is summed as the number its bytes spell, 0 when they spell none
+	s.assertQuery("insert into digests (name, digest) values ('twelve', x'3132')")
+	s.assertSameResults("select sum(digest), avg(digest) from digests")
+	s.assertSameResults("select sum(digest) from digests where name = 'beef'")
+
+	// the session carries on
+	s.assertSameResults("select count(*) from digests")
+}
+
+func (s *BackendTestSuite) TestSimple_OrderByMultibyte() {
+	s.assertQuery("create table lexicon (word text)")
+	for _, w := range []string{"zebra", "Ωmega", "élan", "日本", "😀", "ﬁn", "apple", "Zulu"} {
+		s.assertQuery(fmt.Sprintf("insert into lexicon (word) values ('%s')", w))
 	}
-	s.Len(rows, len(expectedResults))
-	for i, e := range expectedResults {
-		s.Equal(e, rows[i].Data)
+
+	// UTF-8 text compared byte by byte is in code point order
+	rows, err := s.simpleQuery("select word from lexicon order by word")
+	s.NoError(err)
+	var words []interface{}
+	for _, r := range rows {
+		words = append(words, r.Data[0])
 	}
+	s.Equal([]interface{}{"Zulu", "apple", "zebra", "élan", "Ωmega", "日本", "ﬁn", "😀"}, words)
+
+	s.assertSameResults("select word from lexicon order by word")
+	s.assertSameResults("select word from lexicon where word > 'zz' order by word desc")
 }
 
-func (s *BackendTestSuite) TestSimple_WithFilter_ComboOrAndGrouping() {
-	s.assertQuery("create table foo (name text)")
-	for i := 0; i < 10; i++ {
-		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+func (s *BackendTestSuite) TestSimple_FloatRoundTrip() {
+	s.assertQuery("create table temperatures (city text, degrees real)")
+	s.assertQuery("insert into temperatures (city, degrees) values ('oslo', '-3.5')")
+	s.assertQuery("insert into temperatures (city, degrees) values ('lima', 20)")
+	s.assertQuery("insert into temperatures (city, degrees) values ('cairo', '31.25')")
+	s.assertQuery("insert into temperatures (city, degrees) values ('rome', 3.14)")
+
+	rows, err := s.simpleQuery("select city, degrees from temperatures")
+	s.NoError(err)
+	s.Len(rows, 4)
+	s.Equal([]interface{}{"oslo", -3.5}, rows[0].Data)
+	s.Equal([]interface{}{"lima", 20.0}, rows[1].Data)
+	s.Equal([]interface{}{"rome", 3.14}, rows[3].Data)
+
+	s.assertSameResults("select city, degrees from temperatures")
+	s.assertSameResults("select city from temperatures where degrees > 20")
+	s.assertSameResults("select city from temperatures where degrees = 20")
+	s.assertSameResults("select city from temperatures where degrees < 20.5")
+	s.assertSameResults("select city from temperatures where degrees = 3.14")
+	s.assertSameResults("select city, degrees from temperatures order by degrees")
+	s.assertSameResults("select city from temperatures where degrees < .5e2 AND degrees > 2e1")
+	s.assertSameResults("select city, degrees * 1E-1, degrees + .25 from temperatures")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_Arithmetic() {
+	s.assertQuery("create table listings (title text, price real, qty int)")
+	s.assertQuery("insert into listings (title, price, qty) values ('dune', 10.25, 3)")
+	s.assertQuery("insert into listings (title, price, qty) values ('emma', 2.5, 0)")
+	s.assertQuery("insert into listings (title, price, qty) values ('ulysses', 9.5, 2)")
+	s.assertQuery("insert into listings (title, qty) values ('beloved', 4)")
+
+	s.assertSameResults("select title from listings where price + 1 > 10")
+	s.assertSameResults("select title from listings where price - 1 > 8")
+	s.assertSameResults("select title from listings where qty * 2 >= 6")
+	s.assertSameResults("select title from listings where qty / 2 = 1")
+	s.assertSameResults("select title from listings where price / qty > 3")
+	s.assertSameResults("select title from listings where 10 / qty > 2 OR qty + price < 3")
+}
+
+func (s *BackendTestSuite) TestSimple_ComputedColumns() {
+	s.assertQuery("create table parcels (id int primary key, weight int, rate real, label text)")
+	s.assertQuery("insert into parcels (id, weight, rate, label) values (1, 12, 1.5, 'small'), (2, 40, 0.75, 'large'), (3, 7, 2.0, 'tiny')")
+	s.assertQuery("insert into parcels (id, label) values (4, 'empty')")
+
+	rows, err := s.simpleQuery("select id + 10, label from parcels where weight > 10")
+	s.NoError(err)
+	s.Len(rows, 2)
+	s.Equal([]interface{}{11, "small"}, rows[0].Data)
+	s.Equal([]interface{}{12, "large"}, rows[1].Data)
+
+	s.assertSameResults("select id + 10, label from parcels")
+	s.assertSameResults("select weight * 2 - id, weight / 3 from parcels")
+	s.assertSameResults("select weight * rate, (weight + 1) * (id - 1) from parcels")
+	s.assertSameResults("select 1, 'label', label from parcels")
+	s.assertSameResults("select weight + 1 AS heavier from parcels where id = 2")
+	s.assertSameResults("select id * 100 from parcels order by weight desc")
+
+	_, err = s.simpleQuery("select weight > 10 from parcels")
+	s.EqualError(err, "unsupported result column: (weight > 10)")
+	_, err = s.simpleQuery("select count(*) + 1 from parcels")
+	s.EqualError(err, "unsupported result column: (COUNT(*) + 1)")
+	_, err = s.simpleQuery("select missing + 1 from parcels")
+	s.EqualError(err, "no such column: missing")
+}
+
+func (s *BackendTestSuite) TestSimple_BigInt() {
+	s.assertQuery("create table ledgers (account text, balance bigint)")
+	s.assertQuery("insert into ledgers (account, balance) values ('max', 9223372036854775807)")
+	s.assertQuery("insert into ledgers (account, balance) values ('wide', 2147483648)")
+	s.assertQuery("insert into ledgers (account, balance) values ('small', 7)")
+
+	rows, err := s.simpleQuery("select balance from ledgers where account = 'max'")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{9223372036854775807}, rows[0].Data)
+
+	s.assertSameResults("select account, balance from ledgers")
+	s.assertSameResults("select account from ledgers where balance > 2147483647")
+	s.assertSameResults("select account from ledgers where balance = 9223372036854775807")
+	s.assertSameResults("select account from ledgers where balance * 2 > 4294967296")
+	s.assertSameResults("select account from ledgers where balance + 1 > 9223372036854775807")
+	s.assertSameResults("select account from ledgers where balance - 9223372036854775807 < 0")
+	s.assertSameResults("select avg(balance), max(balance), min(balance) from ledgers")
+
+	// An integer literal too large for an integer is a float
+	s.assertQuery("insert into ledgers (account, balance) values ('huge', 9223372036854775808)")
+	s.assertSameResults("select balance from ledgers where account = 'huge'")
+	s.assertSameResults("select account from ledgers where balance > 9223372036854775807")
+
+	// Adding near-max integers overflows into a float rather than wrapping
+	s.assertQuery("insert into ledgers (account, balance) values ('doubled', 9223372036854775807 + 9223372036854775806)")
+	s.assertSameResults("select balance from ledgers where account = 'doubled'")
+	s.assertSameResults("select account from ledgers where balance + 9223372036854775806 > 0")
+
+	s.assertSameResults("select sum(balance) from ledgers where account != 'max' AND account != 'doubled'")
+
+	// The integer sum overflowing is an error of the statement alone
+	_, err = s.simpleQuery("select sum(balance) from ledgers where account = 'max' OR account = 'wide'")
+	s.EqualError(err, "integer overflow")
+	s.assertSameResults("select account, balance from ledgers")
+
+	// within a transaction the statement is rolled back with it
+	s.assertQuery("BEGIN")
+	s.assertQuery("insert into ledgers (account, balance) values ('pending', 1)")
+	_, err = s.simpleQuery("select sum(balance) from ledgers where account = 'max' OR account = 'wide'")
+	s.EqualError(err, "integer overflow")
+	rows, err = s.simpleQuery("select balance from ledgers where account = 'pending'")
+	s.NoError(err)
+	s.Empty(rows)
+}
+
+func (s *BackendTestSuite) TestSimple_QualifiedAlias() {
+	s.assertQuery("create table painters (name text, born int)")
+	s.assertQuery("insert into painters (name, born) values ('vermeer', 1632), ('hopper', 1882), ('kahlo', 1907)")
+
+	rows, err := s.simpleQuery("select * from painters p where p.name = 'hopper'")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"hopper", 1882}, rows[0].Data)
+
+	s.assertSameResults("select * from painters p where p.name = 'hopper'")
+	s.assertSameResults("select p.name from painters AS p where p.born > 1800 AND p.name != 'kahlo'")
+	s.assertSameResults("select name from painters where painters.born < 1900")
+
+	_, err = s.simpleQuery("select * from painters p where q.name = 'hopper'")
+	s.EqualError(err, "no such column: q.name")
+
+	// A table given an alias is only known by its alias
+	_, err = s.simpleQuery("select * from painters p where painters.name = 'hopper'")
+	s.EqualError(err, "no such column: painters.name")
+}
+
+func (s *BackendTestSuite) TestSimple_Join() {
+	s.assertQuery("create table authors (author_id int, name text)")
+	s.assertQuery("create table books (author_id int, title text)")
+	s.assertQuery("insert into authors (author_id, name) values (1, 'le guin')")
+	s.assertQuery("insert into authors (author_id, name) values (2, 'banks')")
+	s.assertQuery("insert into books (author_id, title) values (2, 'excession')")
+	s.assertQuery("insert into books (author_id, title) values (1, 'the dispossessed')")
+	s.assertQuery("insert into books (author_id, title) values (2, 'inversions')")
+
+	rows, err := s.simpleQuery("select a.name, title from authors a, books")
+	s.NoError(err)
+	s.Len(rows, 6)
+	s.Equal([]interface{}{"le guin", "excession"}, rows[0].Data)
+	s.Equal([]interface{}{"banks", "inversions"}, rows[5].Data)
+
+	s.assertSameResults("select a.name, title from authors a, books")
+	s.assertSameResults("select books.title, authors.author_id from authors, books")
+	s.assertSameResults("select * from books, authors")
+	s.assertSameResults("select a.name, b.name from authors a, authors b")
+	s.assertSameResults("select name, title from authors, books where title = 'excession'")
+
+	// Rows of the tables are matched by qualified columns
+	s.assertSameResults("select name, title from authors a, books b where a.author_id = b.author_id")
+	s.assertSameResults("select name, title from authors, books where authors.author_id = books.author_id")
+	s.assertSameResults("select a.name, b.name from authors a, authors b where a.author_id < b.author_id")
+	s.assertSameResults("select title from authors a, books b where a.author_id = b.author_id AND a.name != 'banks'")
+	s.assertSameResults("select t.name from authors AS t where t.name = 'banks'")
+	s.assertSameResults("select x.name, y.name from authors AS x, authors AS y where x.author_id != y.author_id")
+	s.assertSameResults("select x.name, y.title from authors as x, books y where x.author_id = y.author_id")
+
+	// JOIN ... ON filters the cross join by its condition
+	s.assertSameResults("select a.name, b.title from authors a join books b on a.author_id = b.author_id")
+	s.assertSameResults("select a.name, b.title from authors AS a INNER JOIN books AS b ON a.author_id = b.author_id WHERE b.title != 'excession'")
+	s.assertSameResults("select x.name, y.name from authors x join authors y on x.author_id < y.author_id")
+
+	_, err = s.simpleQuery("select title from books where nosuch = 1")
+	s.EqualError(err, "no such column: nosuch")
+	_, err = s.simpleQuery("select title from authors, books where author_id = 1")
+	s.EqualError(err, "ambiguous column name: author_id")
+
+	// nothing is joined with an empty table
+	s.assertQuery("create table reviews (title text, stars int)")
+	s.assertSameResults("select name, stars from authors, reviews")
+	s.assertSameResults("select name, stars from reviews, authors")
+}
+
+func (s *BackendTestSuite) TestSimple_InsertMissingTable() {
+	// the error is reported when the statement is prepared, not when it runs
+	stmt, err := s.backend.Prepare("insert into missing_table (name) values ('a')")
+	s.EqualError(err, "no such table: missing_table")
+	s.Nil(stmt)
+
+	_, err = s.simpleQuery("insert into missing_table (name) values ('a') returning name")
+	s.EqualError(err, "no such table: missing_table")
+}
+
+func (s *BackendTestSuite) TestSimple_SelectMissingTable() {
+	// a missing table is an error rather than an empty result
+	stmt, err := s.backend.Prepare("select * from missing_table")
+	s.EqualError(err, "no such table: missing_table")
+	s.Nil(stmt)
+
+	rows, err := s.simpleQuery("select * from missing_table")
+	s.EqualError(err, "no such table: missing_table")
+	s.Empty(rows)
+}
+
+func (s *BackendTestSuite) TestSimple_InvalidResultColumns() {
+	s.assertQuery("create table novels (title text, pages int)")
+	s.assertQuery("insert into novels (title, pages) values ('emma', 474)")
+
+	// Queries that cannot be run are reported when they are prepared
+	for query, message := range map[string]string{
+		"select title, count(*) from novels":                        "cannot mix aggregate and non-aggregate columns",
+		"select * , count(*) from novels":                           "cannot mix aggregate and non-aggregate columns",
+		"select title from novels group by pages":                   "column title must appear in the GROUP BY clause or be used in an aggregate function",
+		"select pages, title, count(*) from novels group by pages":  "column title must appear in the GROUP BY clause or be used in an aggregate function",
+		"select title from novels group by nosuch":                  "no such column: nosuch",
+		"select count(nosuch) from novels":                          "no such column: nosuch",
+		"select distinct count(*) from novels":                      "DISTINCT with aggregates is not supported",
+		"select distinct title from novels order by pages":          "ORDER BY term must appear in the select list with DISTINCT",
+		"select title from novels order by nosuch":                  "no such column: nosuch",
+		"select title from novels order by count(*)":                "unsupported order by expression: COUNT(*)",
+		"select title from novels group by title order by title":    "ORDER BY with GROUP BY is not supported",
+		"select title from novels group by title having pages > 1":  "column pages must appear in the GROUP BY clause or be used in an aggregate function",
+		"select title from novels group by title having (pages)":    "column pages must appear in the GROUP BY clause or be used in an aggregate function",
+		"select title from novels group by title having nosuch > 1": "no such column: nosuch",
+		"select sum(*) from novels":                                 "wrong number of arguments to function SUM()",
+		"select case when nosuch then 1 end from novels":            "no such column: nosuch",
+	} {
+		_, err := s.simpleQuery(query)
+		s.EqualError(err, message, query)
 	}
 
-	rows, err := s.simpleQuery("select * from foo where name = '1' AND (name != '2' OR name = '3')")
+	// The backend is still usable
+	rows, err := s.simpleQuery("select title from novels")
 	s.NoError(err)
+	s.Equal([]interface{}{"emma"}, rows[0].Data)
 
-	expectedResults := [][]interface{}{
-		{"1"},
+	// a column of HAVING is grouped by or aggregated
+	rows, err = s.simpleQuery("select title from novels group by title having pages > 1 OR sum(pages) > 1 AND title = 'emma'")
+	s.Error(err)
+	rows, err = s.simpleQuery("select title from novels group by title having sum(pages) > 1 AND title = 'emma'")
+	s.NoError(err)
+	s.Equal([]interface{}{"emma"}, rows[0].Data)
+
+	// every non-aggregate column is grouped by
+	rows, err = s.simpleQuery("select pages, title, count(*) from novels group by pages, title")
+	s.NoError(err)
+	s.Equal([]interface{}{474, "emma", 1}, rows[0].Data)
+}
+
+func (s *BackendTestSuite) TestSimple_RangesWithinOr() {
+	s.assertQuery("create table shipments (weight int, distance int, carrier text)")
+	s.assertQuery("BEGIN")
+	carriers := []string{"'ups'", "'fedex'", "NULL"}
+	for i := 0; i < 60; i++ {
+		weight, distance := fmt.Sprint(i%7), fmt.Sprint(i%5)
+		if i%11 == 0 {
+			weight = "NULL"
+		}
+		if i%13 == 0 {
+			distance = "NULL"
+		}
+		s.assertQuery(fmt.Sprintf("insert into shipments (weight, distance, carrier) values (%s, %s, %s)",
+			weight, distance, carriers[i%3]))
 	}
-	s.Len(rows, len(expectedResults))
-	for i, e := range expectedResults {
-		s.Equal(e, rows[i].Data)
+	s.assertQuery("COMMIT")
+
+	s.assertSameResults("select * from shipments where (weight > 1 AND distance < 2) OR carrier = 'ups'")
+	s.assertSameResults("select * from shipments where carrier = 'ups' OR (weight > 1 AND distance < 2)")
+	s.assertSameResults("select * from shipments where (weight >= 5 AND distance <= 1) OR (weight < 1 AND distance > 3) OR carrier IS NULL")
+	s.assertSameResults("select * from shipments where (weight >= 1 AND (distance <= 1 OR carrier > 'm')) OR weight < 1")
+	s.assertSameResults("select * from shipments where (weight BETWEEN 2 AND 4 OR distance = 0) AND carrier = 'fedex'")
+}
+
+func (s *BackendTestSuite) TestSimple_IndexLookup() {
+	file := &countingPageMap{pageMap: &pageMap{pageSize: 4096, pages: make(map[int][]byte)}}
+	s.NoError(pager.Initialize(file))
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	s.assertQuery("create table subscribers (email text, plan text, seats int)")
+	s.assertQuery("BEGIN")
+	plans := []string{"free", "team", "enterprise"}
+	for i := 0; i < 3000; i++ {
+		s.assertQuery(fmt.Sprintf("insert into subscribers (email, plan, seats) values ('user%d@example.com', '%s', %d)",
+			i*7%3000, plans[i%3], i%50))
+	}
+	s.assertQuery("COMMIT")
+
+	// Count the pages read by a query on a fresh pager
+	pagesRead := func(query string) int {
+		s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+		file.reads = 0
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		s.Len(rows, 1)
+		return file.reads
 	}
+
+	const lookup = "select plan, seats from subscribers where email = 'user1234@example.com'"
+	tableScan := pagesRead(lookup)
+
+	s.assertQuery("create index subscribers_email on subscribers (email)")
+	indexScan := pagesRead(lookup)
+	s.Less(indexScan*4, tableScan)
+
+	s.assertSameResults(lookup)
+	s.assertSameResults("select * from subscribers where 'user0@example.com' = email")
+	s.assertSameResults("select seats from subscribers where email = 'user2999@example.com' AND seats > 10")
+	s.assertSameResults("select seats from subscribers where email = 'nobody@example.com'")
+	s.assertSameResults("select count(*) from subscribers where email = 'user5@example.com'")
+
+	// Rows inserted after the index is created are found through it
+	s.assertQuery("insert into subscribers (email, plan, seats) values ('user5@example.com', 'free', 1)")
+	s.assertSameResults("select plan, seats from subscribers where email = 'user5@example.com'")
 }
 
-func (s *BackendTestSuite) assertQuery(query string) {
-	_, err := s.sqlite.Exec(query)
+func (s *BackendTestSuite) TestSimple_RowID() {
+	s.assertQuery("create table memos (body text)")
+	for i := 1; i <= 5; i++ {
+		s.assertQuery(fmt.Sprintf("insert into memos (body) values ('memo %d')", i))
+	}
+
+	rows, err := s.simpleQuery("select rowid, body from memos where rowid = 3")
 	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{3, "memo 3"}, rows[0].Data)
 
-	_, err = s.simpleQuery(query)
+	s.assertSameResults("select rowid, body from memos")
+	s.assertSameResults("select * from memos where rowid = 1")
+	s.assertSameResults("select body from memos where rowid = 5")
+	s.assertSameResults("select body from memos where rowid = 42")
+	s.assertSameResults("select rowid from memos where rowid > 3")
+	s.assertSameResults("select rowid from memos where rowid >= 3")
+	s.assertSameResults("select rowid from memos where 2 < rowid AND rowid < 5")
+	s.assertSameResults("select rowid from memos where rowid > 5")
+	s.assertSameResults("select rowid from memos where rowid >= 0")
+	s.assertSameResults("select rowid from memos where rowid > 2.5")
+	s.assertSameResults("select m.rowid, m.body from memos m where m.rowid < 3")
+
+	// A column named rowid is read instead of the rowid
+	s.assertQuery("create table tickets (rowid int, title text)")
+	s.assertQuery("insert into tickets (rowid, title) values (10, 'ten')")
+	s.assertQuery("insert into tickets (rowid, title) values (20, 'twenty')")
+	s.assertSameResults("select rowid, title from tickets where rowid = 20")
+	s.assertSameResults("select rowid, title from tickets where rowid > 1")
+}
+
+func (s *BackendTestSuite) TestSimple_PrimaryKeyLookup() {
+	file := &countingPageMap{pageMap: &pageMap{pageSize: 4096, pages: make(map[int][]byte)}}
+	s.NoError(pager.Initialize(file))
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	// Most rows are inserted before rows with a smaller id
+	s.assertQuery("create table invoices (id int primary key, customer text, total int)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 10000; i++ {
+		id := i*7919%10000 + 1
+		s.assertQuery(fmt.Sprintf("insert into invoices (id, customer, total) values (%d, 'customer %d', %d)", id, id%300, id*3%1000))
+	}
+	s.assertQuery("COMMIT")
+
+	// Count the pages read by a query on a fresh pager
+	pagesRead := func(query string) int {
+		s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+		file.reads = 0
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		s.Len(rows, 1)
+		return file.reads
+	}
+
+	// Besides the schema and the root only the page holding the row is read
+	s.Equal(3, pagesRead("select customer, total from invoices where id = 4321"))
+	s.Equal(3, pagesRead("select customer, total from invoices where rowid = 4321"))
+	s.Less(50, pagesRead("select customer, total from invoices where total = 963 AND id > 4000.5 AND id < 4500"))
+
+	// An integer lower bound on the id skips the leaves holding smaller ids
+	s.Less(
+		pagesRead("select customer, total from invoices where total = 963 AND id > 4000 AND id < 4500"),
+		pagesRead("select customer, total from invoices where total = 963 AND id > 4000.5 AND id < 4500"),
+	)
+
+	s.assertSameResults("select * from invoices where id = 1")
+	s.assertSameResults("select * from invoices where 10000 = id")
+	s.assertSameResults("select customer from invoices where id = 5000 AND total > 500")
+	s.assertSameResults("select customer from invoices where id = 5000 AND total < 500")
+	s.assertSameResults("select * from invoices where id = 10001")
+	s.assertSameResults("select count(*) from invoices where id = 77")
+	s.assertSameResults("select id from invoices where id < 20 order by id")
+
+	// Rows without an id are given the next rowid
+	s.assertQuery("insert into invoices (customer, total) values ('customer 0', 0)")
+	rows, err := s.simpleQuery("select customer, total from invoices where id = 10001")
 	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"customer 0", 0}, rows[0].Data)
 }
 
-func (s *BackendTestSuite) simpleQuery(query string) ([]*Row, error) {
-	stmt, err := s.backend.Prepare(query)
-	if err != nil {
-		return nil, err
+func (s *BackendTestSuite) TestSimple_RowIDAfterReopen() {
+	open := func(dataDir string) *Engine {
+		engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+		s.NoError(err)
+		s.backend = NewBackend(logrus.New(), engine.NewPager())
+		return engine
+	}
+	ids := func() []interface{} {
+		rows, err := s.simpleQuery("select id from ledger")
+		s.NoError(err)
+		var ids []interface{}
+		for _, r := range rows {
+			ids = append(ids, r.Data[0])
+		}
+		return ids
 	}
 
-	proc, err := s.backend.Exec(context.Background(), stmt)
-	if err != nil {
-		return nil, err
+	dataDir, err := os.MkdirTemp(".tinydb-test", "reopen-test-*")
+	s.NoError(err)
+
+	engine := open(dataDir)
+	s.assertQuery("create table ledger (id int primary key, memo text)")
+	s.assertQuery("insert into ledger (memo) values ('a'), ('b'), ('c')")
+	s.assertQuery("insert into ledger (id, memo) values (10, 'd')")
+	s.NoError(engine.wal.Checkpoint())
+
+	// Rows inserted after reopening follow the largest rowid
+	engine = open(dataDir)
+	s.assertQuery("insert into ledger (memo) values ('e'), ('f')")
+	s.Equal([]interface{}{1, 2, 3, 10, 11, 12}, ids())
+
+	// and so do rows inserted after reopening again
+	s.NoError(engine.wal.Checkpoint())
+	open(dataDir)
+	s.assertQuery("insert into ledger (memo) values ('g')")
+	s.Equal([]interface{}{1, 2, 3, 10, 11, 12, 13}, ids())
+}
+
+func (s *BackendTestSuite) TestSimple_RecoverAfterCrash() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "recover-test-*")
+	s.NoError(err)
+
+	engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	s.assertQuery("create table journal (entry text)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 200; i++ {
+		s.assertQuery(fmt.Sprintf("insert into journal (entry) values ('entry %d')", i))
 	}
+	s.assertQuery("COMMIT")
 
-	var rows []*Row
-	for {
-		select {
-		case r, ok := <-proc.Output:
-			if ok {
-				rows = append(rows, &Row{Data: r.Data})
-			}
-		case err := <-proc.Exit:
-			if err != nil {
-				return nil, err
-			}
-			return rows, nil
+	// Reopen without checkpointing the committed pages to the db file
+	engine, err = Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	rows, err := s.simpleQuery("select count(*) from journal")
+	s.NoError(err)
+	s.Equal([]interface{}{200}, rows[0].Data)
+
+	rows, err = s.simpleQuery("select entry from journal where entry = 'entry 199'")
+	s.NoError(err)
+	s.Len(rows, 1)
+}
+
+func (s *BackendTestSuite) TestSavepoint_Nested() {
+	s.assertQuery("create table tallies (label text)")
+	s.assertQuery("BEGIN")
+	s.assertQuery("insert into tallies (label) values ('a')")
+	s.assertQuery("SAVEPOINT outer_sp")
+	s.assertQuery("insert into tallies (label) values ('b')")
+	s.assertQuery("SAVEPOINT inner_sp")
+	s.assertQuery("insert into tallies (label) values ('c')")
+
+	// only the changes of the inner savepoint are undone
+	s.assertQuery("ROLLBACK TO SAVEPOINT inner_sp")
+	s.assertSameResults("select label from tallies")
+	s.assertQuery("insert into tallies (label) values ('d')")
+	s.assertQuery("RELEASE SAVEPOINT inner_sp")
+
+	// a savepoint may be rolled back to more than once
+	s.assertQuery("SAVEPOINT inner_sp")
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 200; j++ {
+			s.assertQuery(fmt.Sprintf("insert into tallies (label) values ('e%d')", j))
 		}
+		s.assertQuery("ROLLBACK TO inner_sp")
 	}
+	s.assertQuery("RELEASE outer_sp")
+	s.assertQuery("COMMIT")
+
+	s.assertSameResults("select label from tallies")
+	rows, err := s.simpleQuery("select label from tallies")
+	s.NoError(err)
+	s.Len(rows, 3)
+
+	// the savepoints ended with the transaction
+	_, err = s.simpleQuery("RELEASE outer_sp")
+	s.EqualError(err, "no such savepoint: outer_sp")
+}
+
+func (s *BackendTestSuite) TestSavepoint_Transaction() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "savepoint-test-*")
+	s.NoError(err)
+
+	engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	s.assertQuery("create table marks (label text)")
+
+	// a savepoint outside of a transaction starts one
+	s.assertQuery("SAVEPOINT sp1")
+	s.assertQuery("insert into marks (label) values ('kept')")
+	s.assertQuery("SAVEPOINT sp2")
+	s.assertQuery("insert into marks (label) values ('undone')")
+	s.assertQuery("ROLLBACK TO sp2")
+
+	_, err = s.simpleQuery("ROLLBACK TO missing")
+	s.EqualError(err, "no such savepoint: missing")
+
+	// committed rows are read by another backend
+	committed := func() []*Row {
+		b := s.backend
+		defer func() { s.backend = b }()
+		s.backend = NewBackend(logrus.New(), engine.NewPager())
+		rows, err := s.simpleQuery("select label from marks")
+		s.NoError(err)
+		return rows
+	}
+
+	// nothing is committed until the first savepoint is released
+	s.assertQuery("RELEASE sp2")
+	s.Empty(committed())
+
+	s.assertQuery("RELEASE sp1")
+	rows := committed()
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"kept"}, rows[0].Data)
+
+	// rolling back the transaction forgets its savepoints
+	s.assertQuery("BEGIN")
+	s.assertQuery("SAVEPOINT sp3")
+	s.assertQuery("ROLLBACK")
+	_, err = s.simpleQuery("ROLLBACK TO sp3")
+	s.EqualError(err, "no such savepoint: sp3")
+}
+
+func (s *BackendTestSuite) TestSimple_SchemaCookie() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "cookie-test-*")
+	s.NoError(err)
+
+	engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	// Every change to the schema changes the cookie
+	s.assertQuery("create table drawers (label text)")
+	s.assertQuery("create index drawers_label on drawers (label)")
+	s.assertQuery("insert into drawers (label) values ('socks')")
+	s.NoError(engine.Sync())
+
+	// The cookie is kept in the header of the db file like SQLite's
+	header := make([]byte, 100)
+	f, err := os.Open(path.Join(dataDir, "tiny.db"))
+	s.NoError(err)
+	defer f.Close()
+	_, err = f.ReadAt(header, 0)
+	s.NoError(err)
+	s.Equal([]byte{0, 0, 0, 2}, header[storage.SchemaCookieOffset:][:4])
+
+	engine, err = Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	cookie, err := pager.SchemaCookie(engine.NewPager())
+	s.NoError(err)
+	s.Equal(uint32(2), cookie)
+}
+
+func (s *BackendTestSuite) TestSimple_InMemory() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "memory-test-*")
+	s.NoError(err)
+
+	engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096, InMemory: true})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	s.assertQuery("create table scratchpad (note text)")
+	for i := 0; i < 100; i++ {
+		s.assertQuery(fmt.Sprintf("insert into scratchpad (note) values ('note %d')", i))
+	}
+	s.NoError(engine.Sync())
+
+	// Pagers of the engine share the database
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+	rows, err := s.simpleQuery("select count(*) from scratchpad")
+	s.NoError(err)
+	s.Equal([]interface{}{100}, rows[0].Data)
+
+	// and nothing is written to the data dir
+	entries, err := os.ReadDir(dataDir)
+	s.NoError(err)
+	s.Empty(entries)
+}
+
+func (s *BackendTestSuite) TestSimple_InMemoryConcurrent() {
+	engine, err := Start(logrus.New(), Config{PageSize: 4096, InMemory: true})
+	s.NoError(err)
+	_, err = runQuery(NewBackend(logrus.New(), engine.NewPager()), "create table tallies (worker int, n int)")
+	s.NoError(err)
+
+	// Each connection has its own pager over the shared database
+	const workers, inserts = 4, 50
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			b := NewBackend(logrus.New(), engine.NewPager())
+			for i := 0; i < inserts; i++ {
+				query := fmt.Sprintf("insert into tallies (worker, n) values (%d, %d)", w, i)
+				_, err := runQuery(b, query)
+				for errors.Is(err, pager.ErrConflict) {
+					_, err = runQuery(b, query)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+	for w := 0; w < workers; w++ {
+		s.NoError(<-errs)
+	}
+
+	rows, err := runQuery(NewBackend(logrus.New(), engine.NewPager()), "select count(*) from tallies")
+	s.NoError(err)
+	s.Equal([]interface{}{workers * inserts}, rows[0].Data)
+}
+
+func (s *BackendTestSuite) TestSimple_Sync() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "sync-test-*")
+	s.NoError(err)
+
+	engine, err := Start(logrus.New(), Config{DataDir: dataDir, PageSize: 4096})
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), engine.NewPager())
+
+	s.assertQuery("create table backups (name text)")
+	for i := 0; i < 100; i++ {
+		s.assertQuery(fmt.Sprintf("insert into backups (name) values ('backup %d')", i))
+	}
+	s.NoError(engine.Sync())
+
+	// The rows are read from the db file without the WAL
+	file, err := storage.OpenDbFile(path.Join(dataDir, "tiny.db"), 4096)
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	rows, err := s.simpleQuery("select count(*) from backups")
+	s.NoError(err)
+	s.Equal([]interface{}{100}, rows[0].Data)
+
+	rows, err = s.simpleQuery("select name from backups where name = 'backup 99'")
+	s.NoError(err)
+	s.Len(rows, 1)
+}
+
+func (s *BackendTestSuite) TestSimple_ReadSQLiteFile() {
+	dataDir, err := os.MkdirTemp(".tinydb-test", "sqlite-file-*")
+	s.NoError(err)
+	dbPath := path.Join(dataDir, "created-by-sqlite.db")
+
+	// The integers need 1 to 8 bytes including the constants 0 and 1
+	db, err := sql.Open("sqlite3", dbPath)
+	s.NoError(err)
+	for _, stmt := range []string{
+		"CREATE TABLE planets (id INTEGER PRIMARY KEY, name TEXT, moons INTEGER, distance INTEGER)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('mercury', 0, 57909227)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('earth', 1, 149598262)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('mars', 2, 227943824)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('jupiter', 95, 778340821)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('saturn', 146, 1426666422)",
+		"INSERT INTO planets (name, moons, distance) VALUES ('neptune', 16, NULL)",
+		"INSERT INTO planets (id, name, moons, distance) VALUES (4000, 'pluto', 5, 5906380000)",
+	} {
+		_, err := db.Exec(stmt)
+		s.NoError(err)
+	}
+	s.NoError(db.Close())
+
+	file, err := storage.OpenDbFile(dbPath, 4096)
+	s.NoError(err)
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	rows, err := s.simpleQuery("select * from planets")
+	s.NoError(err)
+	var actual [][]interface{}
+	for _, r := range rows {
+		actual = append(actual, r.Data)
+	}
+	s.Equal([][]interface{}{
+		{1, "mercury", 0, 57909227},
+		{2, "earth", 1, 149598262},
+		{3, "mars", 2, 227943824},
+		{4, "jupiter", 95, 778340821},
+		{5, "saturn", 146, 1426666422},
+		{6, "neptune", 16, nil},
+		{4000, "pluto", 5, 5906380000},
+	}, actual)
+
+	rows, err = s.simpleQuery("select name from planets where id = 3")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{"mars"}, rows[0].Data)
+
+	rows, err = s.simpleQuery("select name from planets where moons > 10 order by name")
+	s.NoError(err)
+	s.Len(rows, 3)
+	s.Equal([]interface{}{"jupiter"}, rows[0].Data)
+}
+
+func (s *BackendTestSuite) TestExplain() {
+	s.assertQuery("create table inventory (sku text, qty int)")
+
+	opcodes := func(query string) []interface{} {
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		var ops []interface{}
+		for i, r := range rows {
+			s.Len(r.Data, 7)
+			s.Equal(i, r.Data[0])
+			ops = append(ops, r.Data[1])
+		}
+		return ops
+	}
+
+	ops := opcodes("EXPLAIN SELECT * FROM inventory")
+	s.Contains(ops, "OpOpenRead")
+	s.Contains(ops, "OpHalt")
+
+	// The explained statement is not run
+	s.Contains(opcodes("EXPLAIN INSERT INTO inventory (sku, qty) VALUES ('a', 1)"), "OpInsert")
+	s.Contains(opcodes("EXPLAIN CREATE TABLE warehouses (name text)"), "OpCreateTable")
+
+	rows, err := s.simpleQuery("select count(*) from inventory")
+	s.NoError(err)
+	s.Equal([]interface{}{0}, rows[0].Data)
+	_, err = s.simpleQuery("select * from warehouses")
+	s.Error(err)
+}
+
+func (s *BackendTestSuite) TestSimple_Affinity() {
+	s.assertQuery("create table readings (sensor text, value int)")
+	s.assertQuery("insert into readings (sensor, value) values ('a', '42')")
+	s.assertQuery("insert into readings (sensor, value) values (7, 300)")
+	s.assertQuery("insert into readings (sensor, value) values ('b', ' 007 ')")
+	s.assertQuery("insert into readings (sensor, value) values ('c', 'high')")
+	s.assertQuery("insert into readings (sensor, value) values (300, '12')")
+
+	rows, err := s.simpleQuery("select sensor, value from readings")
+	s.NoError(err)
+
+	// values are stored with the type of their column when they can be converted
+	expectedResults := [][]interface{}{
+		{"a", 42},
+		{"7", 300},
+		{"b", 7},
+		{"c", "high"},
+		{"300", 12},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+
+	s.assertSameResults("select sensor, value from readings")
+	s.assertSameResults("select sensor from readings where value = 42")
+	s.assertSameResults("select value from readings where sensor = '7'")
+}
+
+func (s *BackendTestSuite) TestSimple_InsertMultipleRows() {
+	s.assertQuery("create table colors (name text, hex text)")
+	s.assertQuery("insert into colors (name, hex) values ('red', 'ff0000'), ('green', '00ff00'),('blue', '0000ff')")
+
+	rows, err := s.simpleQuery("select name, hex from colors")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"red", "ff0000"},
+		{"green", "00ff00"},
+		{"blue", "0000ff"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+	s.assertSameResults("select name, hex from colors")
+
+	_, err = s.simpleQuery("insert into colors (name, hex) values ('black', '000000'), ('white')")
+	s.Error(err)
+}
+
+func (s *BackendTestSuite) TestSimple_InsertColumnReference() {
+	s.assertQuery("create table shades (name text, level int)")
+
+	_, err := s.simpleQuery("insert into shades (name, level) values ('ivory', level)")
+	s.EqualError(err, "no such column: level")
+	_, err = s.simpleQuery("insert into shades (name, level) values ('sand', 1), ('slate', 2 + other)")
+	s.EqualError(err, "no such column: other")
+
+	rows, err := s.simpleQuery("select name from shades")
+	s.NoError(err)
+	s.Len(rows, 0)
+}
+
+func (s *BackendTestSuite) TestSimple_InsertFiveRows() {
+	s.assertQuery("create table shades (name text, level int)")
+	s.assertQuery("insert into shades (name, level) values ('ivory', 1), ('sand', 2), ('slate', 3), ('ash', 4), ('ink', 5)")
+
+	rows, err := s.simpleQuery("select name, level from shades")
+	s.NoError(err)
+	s.Len(rows, 5)
+	s.assertSameResults("select name, level from shades")
+}
+
+func (s *BackendTestSuite) TestSimple_InsertReturning() {
+	s.assertQuery("create table pets (id int primary key, name text, kind text)")
+
+	rows, err := s.simpleQuery("insert into pets (name, kind) values ('rex', 'dog'), ('tom', 'cat') returning id, name")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{1, "rex"},
+		{2, "tom"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+
+	rows, err = s.simpleQuery("insert into pets (id, name) values (7, 'polly') returning *")
+	s.NoError(err)
+	s.Len(rows, 1)
+	s.Equal([]interface{}{7, "polly", nil}, rows[0].Data)
+
+	rows, err = s.simpleQuery("select id, name, kind from pets")
+	s.NoError(err)
+	s.Len(rows, 3)
+}
+
+func (s *BackendTestSuite) TestSession_StatementTimeout() {
+	s.assertQuery("create table events (name text)")
+	values := make([]string, 100)
+	for i := range values {
+		values[i] = fmt.Sprintf("('event %d')", i)
+	}
+	s.assertQuery("insert into events (name) values " + strings.Join(values, ", "))
+
+	_, err := s.simpleQuery("SET statement_timeout = 20")
+	s.NoError(err)
+
+	// The scan outlives the timeout while the rows are consumed slowly
+	stmt, err := s.backend.Prepare("select * from events")
+	s.NoError(err)
+	proc, err := s.backend.Exec(context.Background(), stmt)
+	s.NoError(err)
+
+	<-proc.Output
+	time.Sleep(50 * time.Millisecond)
+	for range proc.Output {
+	}
+	s.ErrorIs(<-proc.Exit, ErrStatementTimeout)
+
+	// The session remains usable and the timeout can be disabled
+	_, err = s.simpleQuery("SET statement_timeout = 0")
+	s.NoError(err)
+	rows, err := s.simpleQuery("select * from events")
+	s.NoError(err)
+	s.Len(rows, len(values))
+
+	_, err = s.simpleQuery("SET statement_timeout = 'soon'")
+	s.EqualError(err, "invalid value for parameter statement_timeout: soon")
+	_, err = s.simpleQuery("SET missing_parameter = 1")
+	s.EqualError(err, "unrecognized configuration parameter: missing_parameter")
+}
+
+func (s *BackendTestSuite) TestSimple_NoData() {
+	s.assertQuery("create table foo (name text)")
+
+	rows, err := s.simpleQuery("select * from foo")
+	s.NoError(err)
+	s.Empty(rows)
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter() {
+	s.assertQuery("create table foo (name text)")
+	s.assertQuery("insert into foo (name) values ('bar')")
+	s.assertQuery("insert into foo (name) values ('baz')")
+
+	rows, err := s.simpleQuery("select * from foo where name = 'bar'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{{"bar"}}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter2() {
+	s.assertQuery("create table foo (name text)")
+	s.assertQuery("insert into foo (name) values ('bar')")
+	s.assertQuery("insert into foo (name) values ('bam')")
+	s.assertQuery("insert into foo (name) values ('baz')")
+
+	rows, err := s.simpleQuery("select * from foo where name = 'baz' OR name = 'bam'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"bam"},
+		{"baz"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter3() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo where (name = '1' OR name = '2') OR name = '7' OR name = '4'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"1"},
+		{"2"},
+		{"4"},
+		{"7"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter4() {
+	s.assertQuery("create table foo (name text)")
+	for i := 1; i <= 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo where name = '1' AND name != '2'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"1"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_NotEqual() {
+	s.assertQuery("create table foo (name text)")
+	s.assertQuery("insert into foo (name) values ('bar')")
+	s.assertQuery("insert into foo (name) values ('baz')")
+	s.assertQuery("insert into foo (name) values ('qux')")
+
+	rows, err := s.simpleQuery("select * from foo where name != 'bar'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"baz"},
+		{"qux"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+
+	// <> is another spelling of !=
+	rows, err = s.simpleQuery("select * from foo where name <> 'bar'")
+	s.NoError(err)
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+	s.assertSameResults("select * from foo where name <> 'baz' AND name<>'qux'")
+	s.assertSameResults("select * from foo where name != 'baz' and name != 'qux'")
+	s.assertSameResults("select * from foo where name = 'baz' or name = 'qux'")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_ThreeTermAnd() {
+	s.assertQuery("create table people (name text, state text)")
+	s.assertQuery("insert into people (name, state) values ('joe', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('joe', 'CA')")
+	s.assertQuery("insert into people (name, state) values ('ava', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('sam', 'NY')")
+
+	s.assertSameResults("select * from people where name = 'joe' AND state = 'TX' AND name = 'joe'")
+	s.assertSameResults("select * from people where name = 'joe' AND state = 'TX' AND state = 'CA'")
+	s.assertSameResults("select * from people where state = 'TX' AND name = 'ava' AND state = 'TX' AND name = 'ava'")
+	s.assertSameResults("select * from people where name = 'joe' AND (state = 'CA' AND name = 'joe')")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_Comparisons() {
+	s.assertQuery("create table scores (name text, score int)")
+	s.assertQuery("insert into scores (name, score) values ('ava', 3)")
+	s.assertQuery("insert into scores (name, score) values ('joe', 5)")
+	s.assertQuery("insert into scores (name, score) values ('sam', 300)")
+	s.assertQuery("insert into scores (name) values ('kim')")
+	s.assertQuery("insert into scores (score) values (5)")
+
+	for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+		s.assertSameResults(fmt.Sprintf("select * from scores where score %s 5", op))
+		s.assertSameResults(fmt.Sprintf("select * from scores where 5 %s score", op))
+		s.assertSameResults(fmt.Sprintf("select * from scores where name %s 'joe'", op))
+		s.assertSameResults(fmt.Sprintf("select * from scores where score %s 5 AND name %s 'b'", op, op))
+		s.assertSameResults(fmt.Sprintf("select * from scores where score %s 5 OR name = 'kim'", op))
+		s.assertSameResults(fmt.Sprintf("select * from scores where name = 'kim' OR score %s 5", op))
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_Not() {
+	s.assertQuery("create table scores (name text, score int)")
+	s.assertQuery("insert into scores (name, score) values ('ava', 3)")
+	s.assertQuery("insert into scores (name, score) values ('joe', 5)")
+	s.assertQuery("insert into scores (name, score) values ('sam', 300)")
+	s.assertQuery("insert into scores (name) values ('kim')")
+	s.assertQuery("insert into scores (score) values (5)")
+
+	// A NULL operand makes NOT of a comparison NULL as well
+	s.assertSameResults("select * from scores where NOT (score = 5)")
+	s.assertSameResults("select * from scores where NOT score > 5")
+	s.assertSameResults("select * from scores where NOT (name IS NULL)")
+	s.assertSameResults("select * from scores where NOT NOT (score = 5)")
+	s.assertSameResults("select * from scores where NOT (score = 5 AND name = 'joe')")
+	s.assertSameResults("select * from scores where NOT (score = 5 OR name = 'ava')")
+	s.assertSameResults("select * from scores where NOT (score IN (3, 300)) AND NOT name LIKE 'j%'")
+	s.assertSameResults("select * from scores where NOT (score BETWEEN 4 AND 400) OR NOT (name != 'kim')")
+	s.assertSameResults("select name, CASE WHEN NOT (score < 5) THEN 'high' ELSE 'low' END from scores")
+
+	_, err := s.simpleQuery("select * from scores where NOT score")
+	s.EqualError(err, "unsupported use of NOT: (NOT score)")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_NullTest() {
+	s.assertQuery("create table scores (name text, score int)")
+	s.assertQuery("insert into scores (name, score) values ('ava', 3)")
+	s.assertQuery("insert into scores (name, score) values ('joe', 0)")
+	s.assertQuery("insert into scores (name) values ('kim')")
+	s.assertQuery("insert into scores (score) values (5)")
+	s.assertQuery("insert into scores (name, score) values ('', 7)")
+
+	s.assertSameResults("select * from scores where score IS NULL")
+	s.assertSameResults("select * from scores where score IS NOT NULL")
+	s.assertSameResults("select * from scores where name IS NULL")
+	s.assertSameResults("select * from scores where name is not null")
+	s.assertSameResults("select * from scores where name IS NULL OR score IS NULL")
+	s.assertSameResults("select * from scores where name IS NOT NULL AND score IS NOT NULL")
+	s.assertSameResults("select count(*) from scores where score IS NULL")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_Like() {
+	s.assertQuery("create table fruits (name text, qty int)")
+	s.assertQuery("insert into fruits (name, qty) values ('banana', 12)")
+	s.assertQuery("insert into fruits (name, qty) values ('apple', 3)")
+	s.assertQuery("insert into fruits (name, qty) values ('bun', 1)")
+	s.assertQuery("insert into fruits (name, qty) values ('', 5)")
+	s.assertQuery("insert into fruits (qty) values (7)")
+
+	s.assertSameResults("select * from fruits where name LIKE 'ba%'")
+	s.assertSameResults("select * from fruits where name LIKE '%le'")
+	s.assertSameResults("select * from fruits where name LIKE '%an%'")
+	s.assertSameResults("select * from fruits where name LIKE 'b_n'")
+	s.assertSameResults("select * from fruits where name LIKE '%'")
+	s.assertSameResults("select * from fruits where name LIKE ''")
+	s.assertSameResults("select * from fruits where name NOT LIKE 'b%'")
+	s.assertSameResults("select * from fruits where name NOT LIKE 'b%' OR qty = 7")
+	s.assertSameResults("select * from fruits where name LIKE 'a%' OR name LIKE 'bu%'")
+	s.assertSameResults("select * from fruits where qty LIKE '1%'")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_In() {
+	s.assertQuery("create table tasks (title text, status text, priority int)")
+	s.assertQuery("insert into tasks (title, status, priority) values ('a', 'active', 1)")
+	s.assertQuery("insert into tasks (title, status, priority) values ('b', 'pending', 2)")
+	s.assertQuery("insert into tasks (title, status, priority) values ('c', 'done', 3)")
+	s.assertQuery("insert into tasks (title, priority) values ('d', 2)")
+	s.assertQuery("insert into tasks (title, status) values ('e', 'active')")
+
+	s.assertSameResults("select * from tasks where status IN ('done')")
+	s.assertSameResults("select * from tasks where status IN ('active', 'pending')")
+	s.assertSameResults("select * from tasks where status NOT IN ('active', 'pending')")
+	s.assertSameResults("select * from tasks where priority IN (1, 3)")
+	s.assertSameResults("select * from tasks where priority not in (1, 3)")
+	s.assertSameResults("select * from tasks where status IN ('done', NULL)")
+	s.assertSameResults("select * from tasks where status NOT IN ('done', NULL)")
+	s.assertSameResults("select * from tasks where status IN ('done') OR priority IN (2)")
+	s.assertSameResults("select * from tasks where status NOT IN ('done') OR priority = 3")
+	s.assertSameResults("select * from tasks where priority NOT IN (1) AND status IN ('active', 'done')")
+	s.assertSameResults("select * from tasks where status IN ('active', 'pending', 'done')")
+	s.assertSameResults("select * from tasks where status IN ('archived', 'deleted')")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_Between() {
+	s.assertQuery("create table people_ages (name text, age int)")
+	s.assertQuery("insert into people_ages (name, age) values ('ava', 12)")
+	s.assertQuery("insert into people_ages (name, age) values ('joe', 18)")
+	s.assertQuery("insert into people_ages (name, age) values ('kim', 40)")
+	s.assertQuery("insert into people_ages (name, age) values ('lee', 65)")
+	s.assertQuery("insert into people_ages (name, age) values ('max', 80)")
+	s.assertQuery("insert into people_ages (name) values ('nan')")
+
+	s.assertSameResults("select * from people_ages where age BETWEEN 18 AND 65")
+	s.assertSameResults("select * from people_ages where age NOT BETWEEN 18 AND 65")
+	s.assertSameResults("select * from people_ages where name BETWEEN 'b' AND 'l'")
+	s.assertSameResults("select * from people_ages where name NOT BETWEEN 'b' AND 'l'")
+	s.assertSameResults("select * from people_ages where age BETWEEN 65 AND 18")
+	s.assertSameResults("select * from people_ages where age BETWEEN NULL AND 65")
+	s.assertSameResults("select * from people_ages where age NOT BETWEEN NULL AND 15")
+	s.assertSameResults("select * from people_ages where age NOT BETWEEN 15 AND NULL")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_BetweenBoundaries() {
+	s.assertQuery("create table numbers (id int, name text)")
+	for i := 1; i <= 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into numbers (id, name) values (%d, 'n%d')", i, i))
+	}
+
+	s.assertSameResults("select id from numbers where id BETWEEN 3 AND 7")
+	s.assertSameResults("select id from numbers where id BETWEEN 3 AND 3")
+	s.assertSameResults("select id from numbers where id BETWEEN 10 AND 20")
+	s.assertSameResults("select id from numbers where id BETWEEN 0 AND 0")
+	s.assertSameResults("select id from numbers where id NOT BETWEEN 3 AND 7")
+	s.assertSameResults("select id from numbers where id NOT BETWEEN 1 AND 10")
+
+	// combined with other terms
+	s.assertSameResults("select id from numbers where id BETWEEN 3 AND 7 AND name = 'n5'")
+	s.assertSameResults("select id from numbers where name = 'n5' AND id BETWEEN 3 AND 7")
+	s.assertSameResults("select id from numbers where id BETWEEN 3 AND 4 OR id BETWEEN 8 AND 9")
+	s.assertSameResults("select id from numbers where id BETWEEN 3 AND 4 OR name = 'n9'")
+	s.assertSameResults("select id from numbers where name = 'n9' OR id NOT BETWEEN 2 AND 9")
+	s.assertSameResults("select id from numbers where (id >= 2 AND id <= 3) OR (id >= 6 AND id < 8)")
+	s.assertSameResults("select id from numbers where (id BETWEEN 2 AND 8 OR id = 10) AND id NOT BETWEEN 4 AND 6")
+}
+
+func (s *BackendTestSuite) TestSimple_Case() {
+	s.assertQuery("create table grades (name text, score int)")
+	s.assertQuery("insert into grades (name, score) values ('ava', 95)")
+	s.assertQuery("insert into grades (name, score) values ('joe', 82)")
+	s.assertQuery("insert into grades (name, score) values ('kim', 70)")
+	s.assertQuery("insert into grades (name, score) values ('lee', 40)")
+	s.assertQuery("insert into grades (name) values ('max')")
+
+	// multiple arms with and without ELSE
+	s.assertSameResults("select name, CASE WHEN score >= 90 THEN 'A' WHEN score >= 80 THEN 'B' WHEN score >= 70 THEN 'C' ELSE 'F' END from grades")
+	s.assertSameResults("select name, CASE WHEN score >= 90 THEN 'A' WHEN score >= 80 THEN 'B' END from grades")
+	s.assertSameResults("select CASE name WHEN 'ava' THEN 1 WHEN 'kim' THEN 2 ELSE 0 END, score from grades")
+	s.assertSameResults("select CASE score WHEN 40 THEN 'low' END from grades")
+	s.assertSameResults("select CASE WHEN score IS NULL THEN 0 ELSE score END from grades")
+
+	// in the WHERE clause
+	s.assertSameResults("select name from grades where CASE WHEN score >= 80 THEN 'pass' ELSE 'fail' END = 'pass'")
+	s.assertSameResults("select name from grades where CASE name WHEN 'joe' THEN 1 WHEN 'lee' THEN 1 END = 1")
+	s.assertSameResults("select name from grades where CASE name WHEN 'joe' THEN 1 END IS NULL")
+
+	// ordered by another column
+	s.assertSameResults("select CASE WHEN score > 75 THEN name ELSE 'hidden' END from grades order by score desc")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_InEmpty() {
+	s.assertQuery("create table labels (name text)")
+	s.assertQuery("insert into labels (name) values ('bug')")
+	s.assertQuery("insert into labels (name) values ('feature')")
+	s.assertQuery("insert into labels (name) values (NULL)")
+
+	s.assertSameResults("select * from labels where name IN ()")
+	s.assertSameResults("select * from labels where name NOT IN ()")
+	s.assertSameResults("select * from labels where name IN () OR name = 'bug'")
+	s.assertSameResults("select * from labels where name NOT IN () OR name = 'bug'")
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_LikeEscape() {
+	s.assertQuery("create table discounts (label text)")
+	s.assertQuery("insert into discounts (label) values ('100%')")
+	s.assertQuery("insert into discounts (label) values ('1000')")
+
+	rows, err := s.simpleQuery(`select * from discounts where label LIKE '100\%'`)
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"100%"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_ComboOrAnd() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo where (name = '1' AND name != '2') OR name = '3'")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"1"},
+		{"3"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_WithFilter_ComboOrAndGrouping() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo where name = '1' AND (name != '2' OR name = '3')")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"1"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_Limit() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo limit 3")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"0"},
+		{"1"},
+		{"2"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_LimitOffset() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo limit 2 offset 7")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"7"},
+		{"8"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_LimitAfterFilter() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	rows, err := s.simpleQuery("select * from foo where name = '5' OR name = '7' OR name = '9' limit 2 offset 1")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"7"},
+		{"9"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_LimitZero() {
+	s.assertQuery("create table foo (name text)")
+	s.assertQuery("insert into foo (name) values ('bar')")
+
+	rows, err := s.simpleQuery("select * from foo limit 0")
+	s.NoError(err)
+	s.Empty(rows)
+}
+
+func (s *BackendTestSuite) TestSimple_LimitStopsScan() {
+	file := &countingPageMap{pageMap: &pageMap{pageSize: 4096, pages: make(map[int][]byte)}}
+	s.NoError(pager.Initialize(file))
+	s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+
+	s.assertQuery("create table logs (line text, level int)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 3000; i++ {
+		s.assertQuery(fmt.Sprintf("insert into logs (line, level) values ('line %d of the server log written at noon', %d)", i, i%5))
+	}
+	s.assertQuery("COMMIT")
+
+	// Count the pages read by a query on a fresh pager
+	pagesRead := func(query string, count int) int {
+		s.backend = NewBackend(logrus.New(), pager.NewPager(file))
+		file.reads = 0
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		s.Len(rows, count)
+		return file.reads
+	}
+
+	// The scan stops once the limit is reached rather than reading every leaf
+	full := pagesRead("select * from logs where level = 9", 0)
+	s.Less(40, full)
+	s.Greater(5, pagesRead("select * from logs limit 10", 10))
+	s.Greater(5, pagesRead("select line from logs where level = 3 limit 10", 10))
+	s.Greater(full/2, pagesRead("select line from logs limit 10 offset 1000", 10))
+
+	s.assertSameResults("select * from logs limit 10")
+	s.assertSameResults("select line from logs where level = 3 limit 10 offset 5")
+}
+
+func (s *BackendTestSuite) TestSimple_OrderBy() {
+	s.assertQuery("create table people (name text, state text)")
+	s.assertQuery("insert into people (name, state) values ('carl', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('alice', 'CA')")
+	s.assertQuery("insert into people (name, state) values ('bob', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('dave', 'CA')")
+
+	rows, err := s.simpleQuery("select name from people order by name")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"alice"},
+		{"bob"},
+		{"carl"},
+		{"dave"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_OrderByDesc() {
+	s.assertQuery("create table people (name text, state text)")
+	s.assertQuery("insert into people (name, state) values ('carl', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('alice', 'CA')")
+	s.assertQuery("insert into people (name, state) values ('bob', 'TX')")
+
+	rows, err := s.simpleQuery("select name, state from people where state = 'TX' OR name = 'alice' order by name desc")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"carl", "TX"},
+		{"bob", "TX"},
+		{"alice", "CA"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_OrderByMultipleColumns() {
+	s.assertQuery("create table people (name text, state text)")
+	s.assertQuery("insert into people (name, state) values ('carl', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('alice', 'CA')")
+	s.assertQuery("insert into people (name, state) values ('bob', 'TX')")
+	s.assertQuery("insert into people (name, state) values ('dave', 'CA')")
+
+	rows, err := s.simpleQuery("select * from people order by state desc, name asc limit 3 offset 1")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"carl", "TX"},
+		{"alice", "CA"},
+		{"dave", "CA"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+}
+
+func (s *BackendTestSuite) TestSimple_Distinct() {
+	s.assertQuery("create table consignments (state text, carrier text, boxes int)")
+	s.assertQuery(`insert into consignments (state, carrier, boxes) values
+		('TX', 'ups', 1), ('TX', 'ups', 2), ('TX', 'fedex', 1), ('CA', 'ups', 3),
+		('CA', 'ups', 3), ('TX', 'ups', 1), ('NY', 'usps', 2), ('CA', 'fedex', 4)`)
+
+	// Every projected column is considered, not only the first
+	rows, err := s.simpleQuery("select distinct state, carrier from consignments")
+	s.NoError(err)
+
+	seen := make(map[string]int)
+	for _, r := range rows {
+		seen[fmt.Sprintf("%s %s", r.Data[0], r.Data[1])]++
+	}
+	s.Equal(map[string]int{
+		"TX ups":   1,
+		"TX fedex": 1,
+		"CA ups":   1,
+		"CA fedex": 1,
+		"NY usps":  1,
+	}, seen)
+
+	rows, err = s.simpleQuery("select distinct state from consignments")
+	s.NoError(err)
+	s.Len(rows, 3)
+
+	rows, err = s.simpleQuery("select distinct * from consignments")
+	s.NoError(err)
+	s.Len(rows, 6)
+
+	rows, err = s.simpleQuery("select distinct carrier, boxes * 0 from consignments where state != 'NY'")
+	s.NoError(err)
+	s.Len(rows, 2)
+}
+
+func (s *BackendTestSuite) TestSimple_DistinctOrderByLimit() {
+	s.assertQuery("create table visits (city text, day int)")
+	for _, v := range []string{
+		"('paris', 1)", "('oslo', 2)", "('rome', 1)", "('paris', 3)", "('lima', 2)",
+		"('oslo', 2)", "('cairo', 5)", "('rome', 4)", "('paris', 1)", "('quito', 2)",
+		"('bern', 1)", "('lima', 5)",
+	} {
+		s.assertQuery("insert into visits (city, day) values " + v)
+	}
+
+	rows, err := s.simpleQuery("select distinct city from visits order by city limit 5")
+	s.NoError(err)
+
+	expectedResults := [][]interface{}{
+		{"bern"},
+		{"cairo"},
+		{"lima"},
+		{"oslo"},
+		{"paris"},
+	}
+	s.Len(rows, len(expectedResults))
+	for i, e := range expectedResults {
+		s.Equal(e, rows[i].Data)
+	}
+
+	s.assertSameResults("select distinct city from visits order by city limit 5")
+	s.assertSameResults("select distinct city from visits order by city desc limit 3 offset 2")
+	s.assertSameResults("select distinct city, day from visits order by day desc, city limit 6")
+	// Only rome was visited on day 4
+	s.assertSameResults("select distinct day from visits where city != 'rome' order by day limit 10")
+}
+
+func (s *BackendTestSuite) TestAggregate_CountStar() {
+	s.assertQuery("create table foo (name text)")
+	for i := 0; i < 10; i++ {
+		s.assertQuery(fmt.Sprintf("insert into foo (name) values ('%d')", i))
+	}
+
+	s.assertSameResults("select count(*) from foo")
+	s.assertSameResults("select count(*) from foo where name = '1' OR name = '3'")
+	s.assertSameResults("select count(*) from foo where name = 'missing'")
+	s.assertSameResults("select count(*), COUNT(*) from foo")
+}
+
+func (s *BackendTestSuite) TestAggregate_CountStarEmpty() {
+	s.assertQuery("create table foo (name text)")
+
+	s.assertSameResults("select count(*) from foo")
+	s.assertSameResults("select count(*) from foo limit 1 offset 1")
+}
+
+func (s *BackendTestSuite) TestAggregate_CountStarSplit() {
+	s.assertQuery("create table clicks (name text)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 2000; i++ {
+		s.assertQuery(fmt.Sprintf("insert into clicks (name) values ('click %d')", i))
+	}
+	s.assertQuery("COMMIT")
+
+	// The rows are counted across the leaves of the table
+	s.assertSameResults("select count(*) from clicks")
+	s.assertSameResults("select count(*), count(*) from clicks")
+	s.assertSameResults("select count(*) from clicks limit 1 offset 1")
+	s.assertSameResults("select count(*) from clicks where name > 'click 5'")
+}
+
+// BenchmarkCount compares counting the rows of a table with counting the
+// values of a column, which reads every row
+func BenchmarkCount(b *testing.B) {
+	file := &pageMap{pageSize: 4096, pages: make(map[int][]byte)}
+	if err := pager.Initialize(file); err != nil {
+		b.Fatal(err)
+	}
+	backend := NewBackend(logrus.New(), pager.NewPager(file))
+
+	queries := []string{"create table hits (name text)", "BEGIN"}
+	for i := 0; i < 5000; i++ {
+		queries = append(queries, fmt.Sprintf("insert into hits (name) values ('hit %d')", i))
+	}
+	queries = append(queries, "COMMIT")
+	for _, q := range queries {
+		if _, err := runQuery(backend, q); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, bm := range []struct{ name, query string }{
+		{"CountStar", "select count(*) from hits"},
+		{"Scan", "select count(name) from hits"},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rows, err := runQuery(backend, bm.query)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if rows[0].Data[0] != 5000 {
+					b.Fatalf("unexpected count %v", rows[0].Data[0])
+				}
+			}
+		})
+	}
+}
+
+func (s *BackendTestSuite) TestAggregate_Functions() {
+	s.assertQuery("create table items (name text, qty int)")
+	s.assertQuery("insert into items (name, qty) values ('apple', 3)")
+	s.assertQuery("insert into items (name, qty) values ('pear', 1000)")
+	s.assertQuery("insert into items (name, qty) values ('fig', 8)")
+	s.assertQuery("insert into items (name) values ('kiwi')")
+
+	s.assertSameResults("select count(*) from items")
+	s.assertSameResults("select count(qty) from items")
+	s.assertSameResults("select count(name) from items")
+	s.assertSameResults("select sum(qty) from items")
+	s.assertSameResults("select avg(qty) from items")
+	s.assertSameResults("select min(qty) from items")
+	s.assertSameResults("select max(qty) from items")
+	s.assertSameResults("select min(name), max(name) from items")
+}
+
+func (s *BackendTestSuite) TestAggregate_Mixed() {
+	s.assertQuery("create table items (name text, qty int)")
+	s.assertQuery("insert into items (name, qty) values ('apple', 3)")
+	s.assertQuery("insert into items (name, qty) values ('pear', 1000)")
+	s.assertQuery("insert into items (name, qty) values ('fig', 8)")
+	s.assertQuery("insert into items (name) values ('kiwi')")
+
+	s.assertSameResults("select count(*), count(qty), sum(qty), avg(qty), min(qty), max(qty) from items")
+	s.assertSameResults("select count(*), sum(qty), max(name) from items where name = 'apple' OR name = 'kiwi'")
+}
+
+func (s *BackendTestSuite) TestAggregate_IntegerColumn() {
+	s.assertQuery("create table items (name text, qty int)")
+	s.assertQuery("BEGIN")
+	for i := 0; i < 500; i++ {
+		if i%5 == 0 {
+			s.assertQuery(fmt.Sprintf("insert into items (name) values ('%d')", i))
+			continue
+		}
+		s.assertQuery(fmt.Sprintf("insert into items (name, qty) values ('%d', %d)", i, (i*37)%1000))
+	}
+	s.assertQuery("COMMIT")
+
+	s.assertSameResults("select count(*), count(qty), sum(qty), avg(qty), min(qty), max(qty) from items")
+	s.assertSameResults("select count(*), sum(qty), avg(qty) from items where qty = 74")
+	s.assertSameResults("select sum(qty), avg(qty), min(qty), max(qty) from items where qty = 1")
+}
+
+func (s *BackendTestSuite) TestAggregate_FloatColumn() {
+	s.assertQuery("create table catalog (title text, price real, qty int)")
+	s.assertQuery("insert into catalog (title, price, qty) values ('dune', 10.25, 3)")
+	s.assertQuery("insert into catalog (title, price, qty) values ('emma', 2.5, 1)")
+	s.assertQuery("insert into catalog (title, price, qty) values ('ulysses', 7.75, 2)")
+	s.assertQuery("insert into catalog (title, qty) values ('beloved', 4)")
+
+	s.assertSameResults("select sum(price), avg(price) from catalog")
+	s.assertSameResults("select sum(price), avg(price) from catalog where price > 5")
+	s.assertSameResults("select sum(qty), sum(title), avg(title) from catalog")
+}
+
+func (s *BackendTestSuite) TestAggregate_Distinct() {
+	s.assertQuery("create table sales (name text, state text, qty int)")
+	s.assertQuery("insert into sales (name, state, qty) values ('apple', 'TX', 3)")
+	s.assertQuery("insert into sales (name, state, qty) values ('apple', 'CA', 3)")
+	s.assertQuery("insert into sales (name, state, qty) values ('pear', 'TX', 8)")
+	s.assertQuery("insert into sales (name, state, qty) values ('fig', 'TX', 3)")
+	s.assertQuery("insert into sales (name, state) values ('fig', 'CA')")
+	s.assertQuery("insert into sales (name, state) values ('kiwi', 'CA')")
+
+	s.assertSameResults("select count(distinct qty), count(qty), count(distinct name) from sales")
+	s.assertSameResults("select count(distinct state), sum(distinct qty), avg(distinct qty) from sales")
+	s.assertSameResults("select count(distinct qty) from sales where name = 'kiwi'")
+	s.assertSameResults("select state, count(distinct name), count(name) from sales group by state")
+	s.assertSameResults("select state from sales group by state having count(distinct qty) > 1")
+}
+
+func (s *BackendTestSuite) TestAggregate_NoRows() {
+	s.assertQuery("create table items (name text, qty int)")
+	s.assertQuery("insert into items (name) values ('kiwi')")
+
+	s.assertSameResults("select count(qty), sum(qty), avg(qty), min(qty), max(qty) from items")
+	s.assertSameResults("select count(*), sum(qty), avg(qty), min(qty), max(qty) from items where name = 'missing'")
+}
+
+func (s *BackendTestSuite) TestGroupBy() {
+	s.assertQuery("create table sales (name text, state text, qty int)")
+	s.assertQuery("insert into sales (name, state, qty) values ('apple', 'TX', 3)")
+	s.assertQuery("insert into sales (name, state, qty) values ('pear', 'CA', 1000)")
+	s.assertQuery("insert into sales (name, state, qty) values ('fig', 'TX', 8)")
+	s.assertQuery("insert into sales (name, state) values ('kiwi', 'NY')")
+	s.assertQuery("insert into sales (name, state, qty) values ('plum', 'TX', 20)")
+	s.assertQuery("insert into sales (name, qty) values ('lime', 7)")
+
+	s.assertSameResults("select state, count(*) from sales group by state")
+	s.assertSameResults("select state, sum(qty) from sales group by state")
+	s.assertSameResults("select count(*), state, sum(qty), count(qty), max(name) from sales group by state")
+	s.assertSameResults("select state from sales group by state")
+	s.assertSameResults("select state, count(*) from sales group by state limit 2 offset 1")
+}
+
+func (s *BackendTestSuite) TestGroupBy_Having() {
+	s.assertQuery("create table sales (name text, state text, qty int)")
+	s.assertQuery("insert into sales (name, state, qty) values ('apple', 'TX', 3)")
+	s.assertQuery("insert into sales (name, state, qty) values ('pear', 'CA', 1000)")
+	s.assertQuery("insert into sales (name, state, qty) values ('fig', 'TX', 8)")
+	s.assertQuery("insert into sales (name, state, qty) values ('kiwi', 'NY', 5)")
+	s.assertQuery("insert into sales (name, state, qty) values ('plum', 'TX', 20)")
+	s.assertQuery("insert into sales (name, state, qty) values ('lime', 'NY', 7)")
+
+	s.assertSameResults("select state, count(*) from sales group by state having count(*) = 2")
+	s.assertSameResults("select state, count(*) from sales group by state having state = 'NY'")
+	s.assertSameResults("select state from sales group by state having sum(qty) = 1000")
+	s.assertSameResults("select state, sum(qty) from sales group by state having count(*) = 1 OR count(*) = 3")
+	s.assertSameResults("select state, count(*) from sales where state = 'TX' group by state having count(*) = 3")
+	s.assertSameResults("select state from sales group by state having count(*) = 4")
+	s.assertSameResults("select state, count(*) from sales group by state having state != 'TX'")
+	s.assertSameResults("select state, count(*) from sales group by state having count(*) = 2 AND state != 'NY'")
+	s.assertSameResults("select state, count(*) from sales group by state having count(*) > 1 AND state != 'TX'")
+}
+
+func (s *BackendTestSuite) TestGroupBy_MultipleColumns() {
+	s.assertQuery("create table orders (state text, city text, qty int)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Austin', 1)")
+	s.assertQuery("insert into orders (state, city, qty) values ('CA', 'Fresno', 2)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Dallas', 3)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Austin', 4)")
+	s.assertQuery("insert into orders (state, city, qty) values ('CA', 'Fresno', 5)")
+	s.assertQuery("insert into orders (state, city, qty) values ('CA', 'Austin', 6)")
+
+	s.assertSameResults("select state, city, count(*) from orders group by state, city")
+	s.assertSameResults("select city, state, sum(qty) from orders group by city, state")
+	s.assertSameResults("select count(*) from orders group by state, city")
+}
+
+func (s *BackendTestSuite) TestGroupBy_Where() {
+	s.assertQuery("create table orders (state text, city text, qty int)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Austin', 1)")
+	s.assertQuery("insert into orders (state, city, qty) values ('CA', 'Fresno', 2)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Dallas', 3)")
+	s.assertQuery("insert into orders (state, city, qty) values ('TX', 'Austin', 4)")
+	s.assertQuery("insert into orders (state, city, qty) values ('CA', 'Fresno', 5)")
+
+	s.assertSameResults("select state, count(*) from orders where city = 'Austin' group by state")
+	s.assertSameResults("select city, sum(qty) from orders where state = 'TX' group by city")
+	s.assertSameResults("select city, count(*) from orders where state = 'NY' group by city")
+}
+
+func (s *BackendTestSuite) TestGroupBy_SingleRowGroups() {
+	s.assertQuery("create table sales (name text, state text, qty int)")
+	s.assertQuery("insert into sales (name, state, qty) values ('apple', 'TX', 3)")
+	s.assertQuery("insert into sales (name, state, qty) values ('pear', 'CA', 1000)")
+	s.assertQuery("insert into sales (name, state, qty) values ('fig', 'NY', 8)")
+
+	s.assertSameResults("select state, count(*), sum(qty) from sales group by state")
+	s.assertSameResults("select state, count(*), sum(qty) from sales where state = 'NY' group by state")
+}
+
+func (s *BackendTestSuite) TestGroupBy_Empty() {
+	s.assertQuery("create table sales (name text, state text, qty int)")
+
+	s.assertSameResults("select state, count(*), sum(qty) from sales group by state")
+}
+
+func (s *BackendTestSuite) TestSimple_EvaluateMatchesVM() {
+	s.assertQuery("CREATE TABLE measures (name text, qty int, price float)")
+	s.assertQuery("INSERT INTO measures (name, qty, price) VALUES ('apple', 3, 1.5), ('fig', 1, 0.25), ('pear', 7, 2.0)")
+
+	// the values of each row by column, ordered by name
+	var measures []evalRow
+	rows, err := s.simpleQuery("SELECT name, qty, price FROM measures ORDER BY name")
+	s.NoError(err)
+	for _, r := range rows {
+		measures = append(measures, evalRow{"name": r.Data[0], "qty": r.Data[1], "price": r.Data[2]})
+	}
+
+	// Evaluate folds the values of INSERT, each expression must produce
+	// the same value as the VM and sqlite do
+	for _, expr := range []string{
+		"qty + 1",
+		"price + qty",
+		"qty + 9223372036854775807",
+		"1 + 2",
+		"2.5 + 1",
+		"x'0102'",
+	} {
+		query := fmt.Sprintf("SELECT %s FROM measures ORDER BY name", expr)
+		s.assertSameResults(query)
+
+		stmt, err := tsql.Parse(query)
+		s.NoError(err)
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		s.Len(rows, len(measures))
+		for i, m := range measures {
+			v := virtualmachine.Evaluate(stmt.(*ast.SelectStatement).Columns[0].Expr, m)
+			s.NoError(v.Error, expr)
+			s.Equal(rows[i].Data[0], v.Value, expr)
+		}
+	}
+
+	// a filter selects the rows for which Evaluate is true
+	for _, expr := range []string{
+		"name = 'pear'",
+		"qty = 3",
+		"name LIKE 'p%'",
+		"name NOT LIKE '%e'",
+		"qty = 3 AND name = 'pear'",
+		"qty = 1 OR name = 'pear'",
+	} {
+		query := fmt.Sprintf("SELECT name FROM measures WHERE %s ORDER BY name", expr)
+		s.assertSameResults(query)
+
+		stmt, err := tsql.Parse(query)
+		s.NoError(err)
+		rows, err := s.simpleQuery(query)
+		s.NoError(err)
+		var actual, expected []interface{}
+		for _, r := range rows {
+			actual = append(actual, r.Data[0])
+		}
+		for _, m := range measures {
+			v := virtualmachine.Evaluate(stmt.(*ast.SelectStatement).Filter, m)
+			s.NoError(v.Error, expr)
+			if v.Value == true {
+				expected = append(expected, m["name"])
+			}
+		}
+		s.Equal(expected, actual, expr)
+	}
+}
+
+// evalRow resolves the columns of a row for Evaluate
+type evalRow map[string]interface{}
+
+func (r evalRow) GetValue(ident *ast.Ident) (interface{}, bool) {
+	v, ok := r[ident.Value]
+	return v, ok
+}
+
+func (s *BackendTestSuite) assertQuery(query string) {
+	_, err := s.sqlite.Exec(query)
+	s.NoError(err)
+
+	_, err = s.simpleQuery(query)
+	s.NoError(err)
+}
+
+func (s *BackendTestSuite) simpleQuery(query string) ([]*Row, error) {
+	return runQuery(s.backend, query)
+}
+
+// runQuery executes a query and collects the rows it produces
+func runQuery(backend *Backend, query string) ([]*Row, error) {
+	stmt, err := backend.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := backend.Exec(context.Background(), stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*Row
+	for {
+		select {
+		case r, ok := <-proc.Output:
+			if ok {
+				// a row is only valid until the next is received
+				rows = append(rows, &Row{Data: append([]interface{}(nil), r.Data...)})
+			}
+		case err := <-proc.Exit:
+			if err != nil {
+				return nil, err
+			}
+			return rows, nil
+		}
+	}
+}
+
+// assertSameResults runs a query against tinydb and sqlite and asserts the rows match
+func (s *BackendTestSuite) assertSameResults(query string) {
+	rows, err := s.simpleQuery(query)
+	s.NoError(err)
+
+	actual := [][]interface{}{}
+	for _, r := range rows {
+		actual = append(actual, r.Data)
+	}
+
+	expected, err := s.sqliteQuery(query)
+	s.NoError(err)
+
+	s.Equal(expected, actual, query)
+}
+
+// sqliteQuery collects the rows of a query against sqlite using the types produced by tinydb
+func (s *BackendTestSuite) sqliteQuery(query string) ([][]interface{}, error) {
+	rows, err := s.sqlite.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := [][]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, v := range values {
+			switch t := v.(type) {
+			case int64:
+				values[i] = int(t)
+			}
+		}
+		result = append(result, values)
+	}
+
+	return result, rows.Err()
 }
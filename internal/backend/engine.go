@@ -15,6 +15,13 @@ import (
 type Config struct {
 	DataDir  string
 	PageSize int
+
+	// CachePages limits the number of pages cached by each pager, 0 is unlimited
+	CachePages int
+
+	// InMemory keeps the database in memory rather than in DataDir.
+	// The database is lost when the engine stops.
+	InMemory bool
 }
 
 // Engine holds metadata and indexes about the database
@@ -23,18 +30,37 @@ type Engine struct {
 	log       logrus.FieldLogger
 	config    Config
 	wal       *storage.WAL
+	file      storage.File
 	pagerPool *pager.Pool
 	txID      uint32
 }
 
 // Start initializes a new TinyDb database engine
 func Start(log logrus.FieldLogger, config Config) (*Engine, error) {
-	log.Infof("Starting database engine [DataDir: %s]", config.DataDir)
-
 	if config.PageSize < 1024 {
 		return nil, errors.New("page size must be greater than or equal to 1024")
 	}
 
+	// An in memory database has no file to log writes to, the pages are
+	// read and written directly.
+	if config.InMemory {
+		log.Info("Starting in memory database engine")
+
+		memFile := storage.NewMemoryFile(config.PageSize)
+		if err := pager.Initialize(memFile); err != nil {
+			return nil, err
+		}
+
+		return &Engine{
+			config:    config,
+			log:       log,
+			file:      memFile,
+			pagerPool: pager.NewPool(pager.NewPagerWithCache(memFile, config.CachePages)),
+		}, nil
+	}
+
+	log.Infof("Starting database engine [DataDir: %s]", config.DataDir)
+
 	dbPath := path.Join(config.DataDir, "tiny.db")
 
 	// Open the main database file
@@ -60,7 +86,8 @@ func Start(log logrus.FieldLogger, config Config) (*Engine, error) {
 		config:    config,
 		log:       log,
 		wal:       wal,
-		pagerPool: pager.NewPool(pager.NewPager(wal)),
+		file:      wal,
+		pagerPool: pager.NewPool(pager.NewPagerWithCache(wal, config.CachePages)),
 	}, nil
 }
 
@@ -70,5 +97,22 @@ func (e *Engine) TxID() uint32 {
 }
 
 func (e *Engine) NewPager() pager.Pager {
-	return pager.NewPager(e.wal)
+	return pager.NewPagerWithCache(e.file, e.config.CachePages)
+}
+
+// Sync makes every committed transaction durable in the database file by
+// flushing the pager and checkpointing the WAL. The database file may then
+// be read or copied without the WAL. An in memory database has no file to
+// make durable.
+func (e *Engine) Sync() error {
+	e.Lock()
+	defer e.Unlock()
+
+	if err := e.pagerPool.Flush(); err != nil {
+		return err
+	}
+	if e.wal == nil {
+		return nil
+	}
+	return e.wal.Checkpoint()
 }
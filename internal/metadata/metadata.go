@@ -3,6 +3,7 @@ package metadata
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/joeandaverde/tinydb/internal/pager"
 	"github.com/joeandaverde/tinydb/internal/storage"
@@ -16,6 +17,8 @@ type ColumnDefinition struct {
 	Type         storage.SQLType
 	Offset       int
 	PrimaryKey   bool
+	NotNull      bool
+	Unique       bool
 	DefaultValue interface{}
 }
 
@@ -24,16 +27,73 @@ type TableDefinition struct {
 	RawText  string
 	Columns  []*ColumnDefinition
 	RootPage int
+	Indexes  []*IndexDefinition
 }
 
-var tableCache = make(map[string]*TableDefinition)
+// IndexDefinition represents an index on columns of a table. Each entry of
+// the index holds the values of the columns followed by the rowid.
+// A unique index allows no two entries with the same non-NULL values.
+type IndexDefinition struct {
+	Name     string
+	Columns  []*ColumnDefinition
+	RootPage int
+	Unique   bool
+}
+
+// schema holds the definitions of the tables of a database as of a
+// schema cookie. Tables that could not be read are kept with their error.
+type schema struct {
+	cookie uint32
+	tables map[string]*TableDefinition
+	errs   map[string]error
+}
 
+var (
+	schemaMu sync.Mutex
+
+	// schemas caches the schema of each database by the source of its pages
+	schemas = make(map[storage.File]*schema)
+
+	// schemaLoads counts the times a schema is read from the schema table
+	schemaLoads int
+)
+
+// GetTableDefinition finds the definition of a table and its indexes. The
+// schema table is only read again once the schema cookie changes.
 func GetTableDefinition(p pager.Pager, name string) (*TableDefinition, error) {
-	if tableDefinition, ok := tableCache[name]; ok {
-		return tableDefinition, nil
+	cookie, err := pager.SchemaCookie(p)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	// A table missing from the cache is looked for again, the cache may
+	// hold the schema of a transaction that was rolled back.
+	s, ok := schemas[pager.Source(p)]
+	if !ok || s.cookie != cookie || (s.tables[name] == nil && s.errs[name] == nil) {
+		if s, err = loadSchema(p, cookie); err != nil {
+			return nil, err
+		}
+		schemas[pager.Source(p)] = s
 	}
 
-	cursor, err := pager.NewCursor(p, pager.CURSOR_READ, 1, name)
+	if err, ok := s.errs[name]; ok {
+		return nil, err
+	}
+	if t, ok := s.tables[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("no such table: %s", name)
+}
+
+// loadSchema reads the definitions of every table and index from the
+// schema table
+func loadSchema(p pager.Pager, cookie uint32) (*schema, error) {
+	schemaLoads++
+
+	cursor, err := pager.NewCursor(p, pager.CURSOR_READ, 1, ".schema")
 	if err != nil {
 		return nil, err
 	}
@@ -43,19 +103,18 @@ func GetTableDefinition(p pager.Pager, name string) (*TableDefinition, error) {
 		return nil, err
 	}
 
+	var tableRecords, indexRecords []*storage.Record
 	for hasMore {
 		record, err := cursor.CurrentCell()
 		if err != nil {
 			return nil, err
 		}
 
-		if name == record.Fields[1].Data.(string) {
-			tableDefinition, err := tableDefinitionFromRecord(record)
-			if err != nil {
-				return nil, err
-			}
-			tableCache[name] = tableDefinition
-			return tableDefinition, nil
+		switch record.Fields[0].Data {
+		case "table":
+			tableRecords = append(tableRecords, record)
+		case "index":
+			indexRecords = append(indexRecords, record)
 		}
 
 		hasMore, err = cursor.Next()
@@ -64,7 +123,46 @@ func GetTableDefinition(p pager.Pager, name string) (*TableDefinition, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("table not found: %s", name)
+	s := &schema{
+		cookie: cookie,
+		tables: make(map[string]*TableDefinition),
+		errs:   make(map[string]error),
+	}
+
+	for _, record := range tableRecords {
+		name := record.Fields[1].Data.(string)
+		table, err := tableDefinitionFromRecord(record)
+		if err != nil {
+			s.errs[name] = err
+			continue
+		}
+		s.tables[name] = table
+	}
+
+	for _, record := range indexRecords {
+		table, ok := s.tables[record.Fields[2].Data.(string)]
+		if !ok {
+			continue
+		}
+
+		var index *IndexDefinition
+		// Indexes created for constraints have no SQL
+		if record.Fields[4].Data == nil {
+			index, err = autoindexDefinitionFromRecord(table, record)
+		} else {
+			index, err = indexDefinitionFromRecord(table, record)
+		}
+		if err != nil {
+			delete(s.tables, table.Name)
+			s.errs[table.Name] = err
+			continue
+		}
+		if index != nil {
+			table.Indexes = append(table.Indexes, index)
+		}
+	}
+
+	return s, nil
 }
 
 func tableDefinitionFromRecord(record *storage.Record) (*TableDefinition, error) {
@@ -85,27 +183,109 @@ func tableDefinitionFromRecord(record *storage.Record) (*TableDefinition, error)
 			Name:       c.Name,
 			Type:       sqlType,
 			PrimaryKey: c.PrimaryKey,
+			NotNull:    c.NotNull,
+			Unique:     c.Unique,
 		})
 	}
-	var rootPage int
+	rootPage, err := rootPageFromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TableDefinition{
+		Name:     record.Fields[1].Data.(string),
+		RootPage: rootPage,
+		Columns:  cols,
+	}, nil
+}
+
+func indexDefinitionFromRecord(table *TableDefinition, record *storage.Record) (*IndexDefinition, error) {
+	createSQL := record.Fields[4].Data.(string)
+	stmt, err := tsql.Parse(createSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	var cols []*ColumnDefinition
+	for _, name := range stmt.(*ast.CreateIndexStatement).Columns {
+		col := table.Column(name)
+		if col == nil {
+			return nil, fmt.Errorf("no such column: %s", name)
+		}
+		cols = append(cols, col)
+	}
+
+	rootPage, err := rootPageFromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IndexDefinition{
+		Name:     record.Fields[1].Data.(string),
+		Columns:  cols,
+		RootPage: rootPage,
+	}, nil
+}
+
+// AutoindexName is the name of the index enforcing the n-th UNIQUE
+// column of a table, counting from 1.
+func AutoindexName(table string, n int) string {
+	return fmt.Sprintf("sqlite_autoindex_%s_%d", table, n)
+}
+
+// autoindexDefinitionFromRecord finds the UNIQUE column enforced by an
+// index created along with the table. Indexes of constraints other than
+// UNIQUE are not maintained and are ignored.
+func autoindexDefinitionFromRecord(table *TableDefinition, record *storage.Record) (*IndexDefinition, error) {
+	name := record.Fields[1].Data.(string)
+
+	n := 0
+	for _, c := range table.Columns {
+		if !c.Unique {
+			continue
+		}
+		n++
+		if name != AutoindexName(table.Name, n) {
+			continue
+		}
+		rootPage, err := rootPageFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		return &IndexDefinition{
+			Name:     name,
+			Columns:  []*ColumnDefinition{c},
+			RootPage: rootPage,
+			Unique:   true,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func rootPageFromRecord(record *storage.Record) (int, error) {
 	switch p := record.Fields[3].Data.(type) {
 	case int:
-		rootPage = p
+		return p, nil
 	case int64:
-		rootPage = int(p)
+		return int(p), nil
 	case uint:
-		rootPage = int(p)
+		return int(p), nil
 	case uint8:
-		rootPage = int(p)
+		return int(p), nil
 	case uint64:
-		rootPage = int(p)
+		return int(p), nil
 	default:
-		return nil, fmt.Errorf("unexpected root page type %v", reflect.TypeOf(record.Fields[3].Data))
+		return 0, fmt.Errorf("unexpected root page type %v", reflect.TypeOf(record.Fields[3].Data))
 	}
+}
 
-	return &TableDefinition{
-		Name:     record.Fields[1].Data.(string),
-		RootPage: rootPage,
-		Columns:  cols,
-	}, nil
+// Column finds a column of the table by name
+func (t *TableDefinition) Column(name string) *ColumnDefinition {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
 }
@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/internal/pager"
+	"github.com/joeandaverde/tinydb/internal/storage"
+)
+
+func TestGetTableDefinition_SchemaCookie(t *testing.T) {
+	r := require.New(t)
+
+	file := storage.NewMemoryFile(4096)
+	r.NoError(pager.Initialize(file))
+	p := pager.NewPager(file)
+
+	// addSchema adds an entry to the schema table and changes the cookie
+	// as DDL statements do
+	rowID := uint32(0)
+	addSchema := func(typ string, name string, table string, sql string) {
+		root, err := p.Allocate(pager.PageTypeLeaf)
+		r.NoError(err)
+		r.NoError(p.Write(root))
+
+		rowID++
+		cursor, err := pager.NewCursor(p, pager.CURSOR_WRITE, 1, ".schema")
+		r.NoError(err)
+		r.NoError(cursor.Insert(storage.NewMasterTableRecord(rowID, typ, name, table, root.Number(), sql)))
+
+		cookie, err := pager.SchemaCookie(p)
+		r.NoError(err)
+		r.NoError(pager.SetSchemaCookie(p, cookie+1))
+	}
+
+	addSchema("table", "shelves", "shelves", "CREATE TABLE shelves (label text, height int)")
+
+	loads := schemaLoads
+	for i := 0; i < 1000; i++ {
+		table, err := GetTableDefinition(p, "shelves")
+		r.NoError(err)
+		r.Len(table.Columns, 2)
+		r.Empty(table.Indexes)
+	}
+	r.Equal(loads+1, schemaLoads)
+
+	// the schema is read again once it changes
+	addSchema("index", "shelves_height", "shelves", "CREATE INDEX shelves_height ON shelves (height)")
+	for i := 0; i < 1000; i++ {
+		table, err := GetTableDefinition(p, "shelves")
+		r.NoError(err)
+		r.Len(table.Indexes, 1)
+		r.Equal("shelves_height", table.Indexes[0].Name)
+	}
+	r.Equal(loads+2, schemaLoads)
+
+	_, err := GetTableDefinition(p, "cabinets")
+	r.EqualError(err, "no such table: cabinets")
+}
@@ -10,6 +10,14 @@ import (
 type BTreeTable struct {
 	rootPage int
 	pager    Pager
+
+	// rightmost is the leaf holding the largest rowids of the table and
+	// lastRowID the largest of them. A record with a larger rowid is added
+	// to the leaf without descending from the root. rightmost is zero when
+	// the leaf isn't known, it is forgotten whenever an insert takes the
+	// full path and learned again when that insert appends to the leaf.
+	rightmost int
+	lastRowID uint32
 }
 
 func NewBTreeTable(rootPage int, p Pager) *BTreeTable {
@@ -19,6 +27,10 @@ func NewBTreeTable(rootPage int, p Pager) *BTreeTable {
 	}
 }
 
+// Insert places a record in the table in the order of its rowid. Records
+// are usually appended to the rightmost page, a record with a smaller rowid
+// is placed among the records of the page it belongs to. Consecutive appends
+// through the same BTreeTable skip the descent from the root.
 func (b *BTreeTable) Insert(r *storage.Record) error {
 	buf := bytes.Buffer{}
 	if err := r.Write(&buf); err != nil {
@@ -26,138 +38,278 @@ func (b *BTreeTable) Insert(r *storage.Record) error {
 	}
 	recordBytes := buf.Bytes()
 
-	// Load the table root page
-	root, err := b.pager.Read(b.rootPage)
+	// Append to the rightmost leaf when it has room
+	if b.rightmost != 0 && r.RowID > b.lastRowID {
+		leaf, err := b.pager.Read(b.rightmost)
+		if err != nil {
+			return err
+		}
+		if leaf.Fits(len(recordBytes)) {
+			leaf.AddCell(recordBytes)
+			if err := b.pager.Write(leaf); err != nil {
+				return err
+			}
+			b.lastRowID = r.RowID
+			return nil
+		}
+	}
+	b.rightmost = 0
+
+	// Descend from the root to the leaf the record belongs to
+	var path []branch
+	leaf, err := b.pager.Read(b.rootPage)
 	if err != nil {
 		return err
 	}
+	for leaf.header.Type == PageTypeInternal {
+		index, child, err := childFor(leaf, r.RowID)
+		if err != nil {
+			return err
+		}
+		path = append(path, branch{page: leaf.Number(), index: index})
+		if leaf, err = b.pager.Read(child); err != nil {
+			return err
+		}
+	}
+	if leaf.header.Type != PageTypeLeaf {
+		return errors.New("unsupported page type")
+	}
 
-	if root.header.Type == PageTypeLeaf {
-		if !root.Fits(len(recordBytes)) {
-			parent, left, right, err := splitPage(b.pager, root)
-			if err != nil {
-				return err
-			}
+	return b.insertLeaf(path, leaf, r, recordBytes)
+}
 
-			// Write the record to the right page
-			right.AddCell(recordBytes)
+// insertLeaf places a record in a leaf after every record with a rowid
+// not greater. path holds the interior pages from the root to the leaf.
+// When the leaf is full its lower part is moved to a new page placed before
+// it, a full root is split into two new pages instead. A record appended to
+// the rightmost leaf leaves every other record behind so that appends fill
+// the leaves.
+func (b *BTreeTable) insertLeaf(path []branch, leaf *MemPage, r *storage.Record, recordBytes []byte) error {
+	// The leaf holding the largest rowids is reached through right pages
+	rightEdge, err := b.rightEdge(path)
+	if err != nil {
+		return err
+	}
 
-			// Write all pages to disk
-			return b.pager.Write(left, right, parent)
+	// A record following every record of the leaf is added when it fits
+	last, err := appends(leaf, r.RowID)
+	if err != nil {
+		return err
+	}
+	if last && leaf.Fits(len(recordBytes)) {
+		leaf.AddCell(recordBytes)
+		if err := b.pager.Write(leaf); err != nil {
+			return err
 		}
+		if rightEdge {
+			b.rightmost, b.lastRowID = leaf.Number(), r.RowID
+		}
+		return nil
+	}
 
-		// Write the record to the leaf page
-		root.AddCell(recordBytes)
+	records, err := readRecords(leaf)
+	if err != nil {
+		return err
+	}
 
-		// Save the page
-		return b.pager.Write(root)
-	} else if root.header.Type == PageTypeInternal {
-		// TODO: For now, just write to the right most page.
-		destPage, err := b.pager.Read(root.header.RightPage)
-		if err != nil {
-			return err
+	at := len(records)
+	for i, e := range records {
+		if e.RowID > r.RowID {
+			at = i
+			break
 		}
+	}
+	records = append(records[:at], append([]*storage.Record{r}, records[at:]...)...)
 
-		// If the rightmost page is full, create a new page and update the pointer.
-		if !destPage.Fits(len(recordBytes)) {
-			maxRowID, err := maxRowID(destPage)
-			if err != nil {
-				return err
-			}
+	cells, err := recordCells(records)
+	if err != nil {
+		return err
+	}
 
-			internalNode := storage.InteriorNode{
-				LeftChild: uint32(destPage.Number()),
-				Key:       maxRowID,
-			}
+	appending := rightEdge && at == len(records)-1
 
-			if !root.Fits(storage.InteriorNodeSize) {
-				return errors.New("not yet supporting adding another internal node")
-			}
+	if fitsCells(leaf, PageTypeLeaf, cells) {
+		writeCells(leaf, PageTypeLeaf, 0, cells)
+		if err := b.pager.Write(leaf); err != nil {
+			return err
+		}
+		if appending {
+			b.rightmost, b.lastRowID = leaf.Number(), r.RowID
+		}
+		return nil
+	}
 
-			// Allocate a new page, update internal node right pointer.
-			destPage, err = b.pager.Allocate(PageTypeLeaf) //Leaf
-			if err != nil {
-				return err
-			}
-			root.header.RightPage = destPage.Number()
+	if len(records) < 2 {
+		return errors.New("record does not fit in a page")
+	}
+	mid := len(records) / 2
+	if appending {
+		mid = len(records) - 1
+	}
 
-			// Add link to the newly added page.
-			interiorCell, err := internalNode.ToBytes()
-			if err != nil {
-				return err
-			}
-			root.AddCell(interiorCell)
+	left, err := b.pager.Allocate(PageTypeLeaf)
+	if err != nil {
+		return err
+	}
+	node := storage.InteriorNode{
+		LeftChild: uint32(left.Number()),
+		Key:       records[mid-1].RowID,
+	}
+	writeCells(left, PageTypeLeaf, 0, cells[:mid])
 
-			// Write the record
-			destPage.AddCell(recordBytes)
-			return b.pager.Write(root, destPage)
+	if len(path) == 0 {
+		right, err := b.pager.Allocate(PageTypeLeaf)
+		if err != nil {
+			return err
+		}
+		nodeCell, err := node.ToBytes()
+		if err != nil {
+			return err
 		}
 
-		// Write the record
-		destPage.AddCell(recordBytes)
-		return b.pager.Write(destPage)
-	} else {
-		return errors.New("unsupported page type")
+		writeCells(right, PageTypeLeaf, 0, cells[mid:])
+		writeCells(leaf, PageTypeInternal, right.Number(), [][]byte{nodeCell})
+		if err := b.pager.Write(left, right, leaf); err != nil {
+			return err
+		}
+		if appending {
+			b.rightmost, b.lastRowID = right.Number(), r.RowID
+		}
+		return nil
 	}
-}
 
-func splitPage(pager Pager, p *MemPage) (*MemPage, *MemPage, *MemPage, error) {
-	// New page for the left node
-	leftPage, err := pager.Allocate(PageTypeLeaf)
+	writeCells(leaf, PageTypeLeaf, 0, cells[mid:])
+	written, err := b.insertNode(path, node, appending)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
+	}
+	if err := b.pager.Write(append([]*MemPage{left, leaf}, written...)...); err != nil {
+		return err
 	}
+	if appending {
+		b.rightmost, b.lastRowID = leaf.Number(), r.RowID
+	}
+	return nil
+}
 
-	// New page for the right node
-	rightPage, err := pager.Allocate(PageTypeLeaf)
+// insertNode places an interior cell in the last page of the path before
+// the child that was followed. When the page is full its lower half is moved
+// to a new page placed before it in its parent, the right page of the new
+// page being the child of the cell in the middle whose key moves up to the
+// parent. A full root is split into two new pages instead. The cell of a
+// record appended to the table leaves every other cell but the last behind.
+// Returns the pages to be written.
+func (b *BTreeTable) insertNode(path []branch, node storage.InteriorNode, appending bool) ([]*MemPage, error) {
+	parent := path[len(path)-1]
+	page, err := b.pager.Read(parent.page)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	// Max key
-	maxRowID, err := maxRowID(p)
-	if err != nil {
-		return nil, nil, nil, err
+	var nodes []storage.InteriorNode
+	for i := 0; i < page.CellCount(); i++ {
+		n, err := page.ReadInteriorNode(i)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *n)
 	}
+	nodes = append(nodes[:parent.index], append([]storage.InteriorNode{node}, nodes[parent.index:]...)...)
 
-	// Copy the page to the left
-	p.CopyTo(leftPage)
+	var cells [][]byte
+	for _, n := range nodes {
+		cell, err := n.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
 
-	// Update the header to make the page an interior node
-	newHeader := NewPageHeader(PageTypeInternal, len(p.data))
-	newHeader.RightPage = rightPage.Number()
-	p.SetHeader(newHeader)
+	rightPage := page.header.RightPage
+	if fitsCells(page, PageTypeInternal, cells) {
+		writeCells(page, PageTypeInternal, rightPage, cells)
+		return []*MemPage{page}, nil
+	}
 
-	// Add a cell to the new internal page
-	cell := storage.InteriorNode{
-		LeftChild: uint32(leftPage.Number()),
-		Key:       maxRowID,
+	mid := len(nodes) / 2
+	if appending {
+		mid = len(nodes) - 2
 	}
 
-	cellBytes, err := cell.ToBytes()
+	left, err := b.pager.Allocate(PageTypeInternal)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
+	}
+	promoted := storage.InteriorNode{
+		LeftChild: uint32(left.Number()),
+		Key:       nodes[mid].Key,
 	}
-	p.AddCell(cellBytes)
+	writeCells(left, PageTypeInternal, int(nodes[mid].LeftChild), cells[:mid])
 
-	return p, leftPage, rightPage, nil
-}
+	if len(path) == 1 {
+		right, err := b.pager.Allocate(PageTypeInternal)
+		if err != nil {
+			return nil, err
+		}
+		promotedCell, err := promoted.ToBytes()
+		if err != nil {
+			return nil, err
+		}
 
-func maxRowID(p *MemPage) (uint32, error) {
-	recordIter := newRecordIter(p)
-	maxRowID := uint32(0)
+		writeCells(right, PageTypeInternal, rightPage, cells[mid+1:])
+		writeCells(page, PageTypeInternal, right.Number(), [][]byte{promotedCell})
+		return []*MemPage{left, right, page}, nil
+	}
 
-	for recordIter.Next() {
-		if recordIter.Error() != nil {
-			return 0, recordIter.Error()
+	writeCells(page, PageTypeInternal, rightPage, cells[mid+1:])
+	written, err := b.insertNode(path[:len(path)-1], promoted, appending)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*MemPage{left, page}, written...), nil
+}
+
+// rightEdge determines if every interior page of the path was left through
+// its right page, which leads to the leaf holding the largest rowids.
+func (b *BTreeTable) rightEdge(path []branch) (bool, error) {
+	for _, step := range path {
+		p, err := b.pager.Read(step.page)
+		if err != nil {
+			return false, err
+		}
+		if step.index != p.CellCount() {
+			return false, nil
 		}
+	}
+	return true, nil
+}
 
-		record := recordIter.Current()
-		if record.RowID > maxRowID {
-			maxRowID = record.RowID
+// childFor finds the first cell of an interior table page whose largest
+// rowid is not less than the rowid and its left child, or the cell count
+// and the right page when there is none.
+func childFor(p *MemPage, rowID uint32) (int, int, error) {
+	for i := 0; i < p.CellCount(); i++ {
+		node, err := p.ReadInteriorNode(i)
+		if err != nil {
+			return 0, 0, err
 		}
+		if node.Key >= rowID {
+			return i, int(node.LeftChild), nil
+		}
+	}
+	return p.CellCount(), p.header.RightPage, nil
+}
+
+// appends determines if a rowid is not less than any rowid of a leaf
+func appends(p *MemPage, rowID uint32) (bool, error) {
+	if p.CellCount() == 0 {
+		return true, nil
+	}
+	last, err := p.ReadRecord(p.CellCount() - 1)
+	if err != nil {
+		return false, err
 	}
-	return maxRowID, nil
+	return last.RowID <= rowID, nil
 }
 
 type recorditerator struct {
@@ -0,0 +1,283 @@
+package pager
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/joeandaverde/tinydb/internal/storage"
+)
+
+// BTreeIndex is a b-tree of records kept in the order of their fields.
+// Each record holds the indexed values followed by the rowid of the
+// table row they belong to, which makes every entry unique.
+type BTreeIndex struct {
+	rootPage int
+	pager    Pager
+}
+
+func NewBTreeIndex(rootPage int, p Pager) *BTreeIndex {
+	return &BTreeIndex{
+		rootPage: rootPage,
+		pager:    p,
+	}
+}
+
+// Insert places a record in the index after every smaller entry
+func (b *BTreeIndex) Insert(r *storage.Record) error {
+	// Load the index root page
+	root, err := b.pager.Read(b.rootPage)
+	if err != nil {
+		return err
+	}
+
+	switch root.header.Type {
+	case PageTypeLeafIndex:
+		records, err := readRecords(root)
+		if err != nil {
+			return err
+		}
+		records = insertOrdered(records, r)
+		cells, err := recordCells(records)
+		if err != nil {
+			return err
+		}
+
+		if fitsCells(root, PageTypeLeafIndex, cells) {
+			writeCells(root, PageTypeLeafIndex, 0, cells)
+			return b.pager.Write(root)
+		}
+
+		// Move each half of the entries to a new page, the root
+		// becomes an interior page pointing to both.
+		left, err := b.pager.Allocate(PageTypeLeafIndex)
+		if err != nil {
+			return err
+		}
+		right, err := b.pager.Allocate(PageTypeLeafIndex)
+		if err != nil {
+			return err
+		}
+
+		mid := len(records) / 2
+		node, err := storage.IndexInteriorNode{
+			LeftChild: uint32(left.Number()),
+			Key:       records[mid-1],
+		}.ToBytes()
+		if err != nil {
+			return err
+		}
+
+		writeCells(left, PageTypeLeafIndex, 0, cells[:mid])
+		writeCells(right, PageTypeLeafIndex, 0, cells[mid:])
+		writeCells(root, PageTypeInternalIndex, right.Number(), [][]byte{node})
+
+		return b.pager.Write(left, right, root)
+	case PageTypeInternalIndex:
+		nodes, err := readIndexInteriorNodes(root)
+		if err != nil {
+			return err
+		}
+
+		// The entry belongs to the first child whose largest entry is
+		// greater, or the right page when there is none.
+		pos := len(nodes)
+		childPage := root.header.RightPage
+		for i, n := range nodes {
+			if compareKey(n.Key, r) >= 0 {
+				pos = i
+				childPage = int(n.LeftChild)
+				break
+			}
+		}
+
+		child, err := b.pager.Read(childPage)
+		if err != nil {
+			return err
+		}
+		records, err := readRecords(child)
+		if err != nil {
+			return err
+		}
+		records = insertOrdered(records, r)
+		cells, err := recordCells(records)
+		if err != nil {
+			return err
+		}
+
+		if fitsCells(child, PageTypeLeafIndex, cells) {
+			writeCells(child, PageTypeLeafIndex, 0, cells)
+			return b.pager.Write(child)
+		}
+
+		// Move the lower half of the entries to a new page placed before the child
+		left, err := b.pager.Allocate(PageTypeLeafIndex)
+		if err != nil {
+			return err
+		}
+
+		mid := len(records) / 2
+		nodes = append(nodes[:pos], append([]*storage.IndexInteriorNode{{
+			LeftChild: uint32(left.Number()),
+			Key:       records[mid-1],
+		}}, nodes[pos:]...)...)
+
+		var nodeCells [][]byte
+		for _, n := range nodes {
+			cell, err := n.ToBytes()
+			if err != nil {
+				return err
+			}
+			nodeCells = append(nodeCells, cell)
+		}
+		if !fitsCells(root, PageTypeInternalIndex, nodeCells) {
+			return errors.New("not yet supporting adding another internal node")
+		}
+
+		writeCells(left, PageTypeLeafIndex, 0, cells[:mid])
+		writeCells(child, PageTypeLeafIndex, 0, cells[mid:])
+		writeCells(root, PageTypeInternalIndex, root.header.RightPage, nodeCells)
+
+		return b.pager.Write(left, child, root)
+	default:
+		return errors.New("unsupported page type")
+	}
+}
+
+// insertOrdered inserts a record after every smaller record
+func insertOrdered(records []*storage.Record, r *storage.Record) []*storage.Record {
+	pos := len(records)
+	for i, e := range records {
+		if compareKey(e, r) > 0 {
+			pos = i
+			break
+		}
+	}
+
+	result := make([]*storage.Record, 0, len(records)+1)
+	result = append(result, records[:pos]...)
+	result = append(result, r)
+	return append(result, records[pos:]...)
+}
+
+func readRecords(p *MemPage) ([]*storage.Record, error) {
+	var records []*storage.Record
+	recordIter := newRecordIter(p)
+	for recordIter.Next() {
+		if recordIter.Error() != nil {
+			return nil, recordIter.Error()
+		}
+		records = append(records, recordIter.Current())
+	}
+	return records, nil
+}
+
+func readIndexInteriorNodes(p *MemPage) ([]*storage.IndexInteriorNode, error) {
+	nodes := make([]*storage.IndexInteriorNode, 0, p.CellCount())
+	for i := 0; i < p.CellCount(); i++ {
+		n, err := p.ReadIndexInteriorNode(i)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func recordCells(records []*storage.Record) ([][]byte, error) {
+	cells := make([][]byte, 0, len(records))
+	for _, r := range records {
+		cell, err := r.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+	}
+	return cells, nil
+}
+
+// fitsCells determines if the cells fit in an empty page of the specified type
+func fitsCells(p *MemPage, pageType PageType, cells [][]byte) bool {
+	size := cellPointersStart(pageType, p.Number())
+	for _, c := range cells {
+		size += 2 + len(c)
+	}
+	return size <= p.UsableSize()
+}
+
+// writeCells replaces the content of the page with the cells in order
+func writeCells(p *MemPage, pageType PageType, rightPage int, cells [][]byte) {
+	header := NewPageHeader(pageType, p.UsableSize())
+	header.RightPage = rightPage
+	p.SetHeader(header)
+
+	for _, c := range cells {
+		p.AddCell(c)
+	}
+}
+
+// compareKey orders an index entry and a key by the fields of the key.
+// An entry beginning with the fields of the key is equal to it.
+func compareKey(entry *storage.Record, key *storage.Record) int {
+	for i, f := range key.Fields {
+		if i >= len(entry.Fields) {
+			return -1
+		}
+		if c := compareFields(entry.Fields[i], f); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareFields orders two fields of any type. NULL comes first followed
+// by numbers, strings and blobs.
+func compareFields(a *storage.Field, b *storage.Field) int {
+	if ra, rb := fieldRank(a), fieldRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.Data.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(av, b.Data.(string))
+	case []byte:
+		return bytes.Compare(av, b.Data.([]byte))
+	default:
+		ai, bi := fieldNumber(a), fieldNumber(b)
+		if ai < bi {
+			return -1
+		}
+		if ai > bi {
+			return 1
+		}
+		return 0
+	}
+}
+
+func fieldRank(f *storage.Field) int {
+	switch f.Data.(type) {
+	case nil:
+		return 0
+	case string:
+		return 2
+	case []byte:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// fieldNumber reads an integer or float field as a float so that both
+// are ordered together
+func fieldNumber(f *storage.Field) float64 {
+	switch v := f.Data.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,109 @@
+package pager
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/joeandaverde/tinydb/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func indexEntry(value int, rowID int) *storage.Record {
+	return storage.NewRecord(uint32(rowID), []*storage.Field{
+		{Type: storage.Integer, Data: value},
+		{Type: storage.Integer, Data: rowID},
+	})
+}
+
+func newTestIndex(t *testing.T, values []int) (Pager, int) {
+	assert := require.New(t)
+	file := storage.NewMemoryFile(testPageSize)
+	assert.NoError(Initialize(file))
+	p := NewPager(file)
+
+	root, err := p.Allocate(PageTypeLeafIndex)
+	assert.NoError(err)
+	assert.NoError(p.Write(root))
+
+	index := NewBTreeIndex(root.Number(), p)
+	for i, v := range values {
+		assert.NoError(index.Insert(indexEntry(v, i+1)))
+	}
+
+	return p, root.Number()
+}
+
+func TestBTreeIndex_Insert_Ordered(t *testing.T) {
+	assert := require.New(t)
+	const count = 2000
+
+	values := rand.New(rand.NewSource(1)).Perm(count)
+	p, rootPage := newTestIndex(t, values)
+
+	root, err := p.Read(rootPage)
+	assert.NoError(err)
+	assert.Equal(PageTypeInternalIndex, root.header.Type)
+
+	cursor, err := NewCursor(p, CURSOR_READ, rootPage, "idx")
+	assert.NoError(err)
+
+	ok, err := cursor.Rewind()
+	assert.NoError(err)
+
+	seen := 0
+	for ok {
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		assert.Equal(seen, record.Fields[0].Data)
+		assert.Equal(uint32(record.Fields[1].Data.(int)), record.RowID)
+
+		seen++
+		ok, err = cursor.Next()
+		assert.NoError(err)
+	}
+	assert.Equal(count, seen)
+}
+
+func TestCursor_SeekGE(t *testing.T) {
+	assert := require.New(t)
+
+	// Every even number from 0 to 1998
+	var values []int
+	for i := 0; i < 1000; i++ {
+		values = append(values, i*2)
+	}
+	p, rootPage := newTestIndex(t, values)
+
+	cursor, err := NewCursor(p, CURSOR_READ, rootPage, "idx")
+	assert.NoError(err)
+
+	key := func(v int) *storage.Record {
+		return storage.NewRecord(0, []*storage.Field{{Type: storage.Integer, Data: v}})
+	}
+
+	for _, v := range []int{0, 1, 2, 501, 998, 1000, 1997, 1998} {
+		ok, err := cursor.SeekGE(key(v))
+		assert.NoError(err)
+		assert.True(ok)
+
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		assert.Equal(v+v%2, record.Fields[0].Data)
+
+		// the remaining entries follow in order
+		count := 1
+		for {
+			ok, err = cursor.Next()
+			assert.NoError(err)
+			if !ok {
+				break
+			}
+			count++
+		}
+		assert.Equal(1000-(v+1)/2, count)
+	}
+
+	ok, err := cursor.SeekGE(key(1999))
+	assert.NoError(err)
+	assert.False(ok)
+}
@@ -0,0 +1,369 @@
+package pager
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/joeandaverde/tinydb/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBTreeTable_Insert_Unordered(t *testing.T) {
+	assert := require.New(t)
+	const count = 2000
+
+	file := storage.NewMemoryFile(testPageSize)
+	assert.NoError(Initialize(file))
+	p := NewPager(file)
+
+	root, err := p.Allocate(PageTypeLeaf)
+	assert.NoError(err)
+	assert.NoError(p.Write(root))
+
+	// The upper half of the rows is appended before the lower half is
+	// inserted in random order.
+	table := NewBTreeTable(root.Number(), p)
+	insert := func(rowID int) {
+		assert.NoError(table.Insert(storage.NewRecord(uint32(rowID), []*storage.Field{
+			{Type: storage.Text, Data: fmt.Sprintf("row %d", rowID)},
+		})))
+	}
+	for i := count / 2; i < count; i++ {
+		insert(i + 1)
+	}
+	for _, i := range rand.New(rand.NewSource(1)).Perm(count / 2) {
+		insert(i + 1)
+	}
+
+	cursor, err := NewCursor(p, CURSOR_READ, root.Number(), "table")
+	assert.NoError(err)
+
+	ok, err := cursor.Rewind()
+	assert.NoError(err)
+
+	seen := 0
+	for ok {
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		assert.Equal(uint32(seen+1), record.RowID)
+
+		seen++
+		ok, err = cursor.Next()
+		assert.NoError(err)
+	}
+	assert.Equal(count, seen)
+
+	// The rows are spread across the leaves of the split table
+	rootPage, err := p.Read(root.Number())
+	assert.NoError(err)
+	assert.Equal(PageTypeInternal, rootPage.header.Type)
+	n, err := cursor.Count()
+	assert.NoError(err)
+	assert.Equal(count, n)
+
+	for _, rowID := range []uint32{1, 2, 999, 1000, 1001, 1500, 2000} {
+		ok, err := cursor.SeekRowID(rowID)
+		assert.NoError(err)
+		assert.True(ok)
+
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		assert.Equal(fmt.Sprintf("row %d", rowID), record.Fields[0].Data)
+	}
+
+	ok, err = cursor.SeekRowID(count + 1)
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestBTreeTable_Insert_AppendAfterUnordered(t *testing.T) {
+	assert := require.New(t)
+
+	file := storage.NewMemoryFile(testPageSize)
+	assert.NoError(Initialize(file))
+	p := NewPager(file)
+
+	root, err := p.Allocate(PageTypeLeaf)
+	assert.NoError(err)
+	assert.NoError(p.Write(root))
+
+	// Appends are interleaved with rowids belonging to earlier leaves,
+	// which must not be added to the leaf appended to.
+	table := NewBTreeTable(root.Number(), p)
+	var rowIDs []int
+	for i := 1; i <= 600; i++ {
+		rowIDs = append(rowIDs, 2*i)
+		if i%50 == 0 {
+			rowIDs = append(rowIDs, 2*i-51)
+		}
+	}
+	for _, rowID := range rowIDs {
+		assert.NoError(table.Insert(storage.NewRecord(uint32(rowID), []*storage.Field{
+			{Type: storage.Text, Data: fmt.Sprintf("row %d", rowID)},
+		})))
+	}
+
+	cursor, err := NewCursor(p, CURSOR_READ, root.Number(), "table")
+	assert.NoError(err)
+
+	ok, err := cursor.Rewind()
+	assert.NoError(err)
+
+	var read []uint32
+	for ok {
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		read = append(read, record.RowID)
+
+		ok, err = cursor.Next()
+		assert.NoError(err)
+	}
+	assert.Len(read, len(rowIDs))
+	for i := 1; i < len(read); i++ {
+		assert.Less(read[i-1], read[i])
+	}
+
+	rootPage, err := p.Read(root.Number())
+	assert.NoError(err)
+	assert.Equal(PageTypeInternal, rootPage.header.Type)
+}
+
+func TestBTreeTable_Insert_InteriorSplits(t *testing.T) {
+	const count = 20000
+
+	sequential := make([]int, count)
+	for i := range sequential {
+		sequential[i] = i
+	}
+
+	for _, tc := range []struct {
+		name   string
+		rowIDs []int
+	}{
+		{"sequential", sequential},
+		{"random", rand.New(rand.NewSource(2)).Perm(count)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			// Small pages hold few interior cells so that the tree grows
+			// several levels deep
+			file := storage.NewMemoryFile(512)
+			assert.NoError(Initialize(file))
+			p := NewPager(file)
+
+			root, err := p.Allocate(PageTypeLeaf)
+			assert.NoError(err)
+			assert.NoError(p.Write(root))
+
+			table := NewBTreeTable(root.Number(), p)
+			for _, i := range tc.rowIDs {
+				assert.NoError(table.Insert(storage.NewRecord(uint32(i+1), []*storage.Field{
+					{Type: storage.Text, Data: fmt.Sprintf("row %d of the table", i+1)},
+				})))
+			}
+
+			// Every key is the largest rowid below its left child and the
+			// rowids below the right page are larger
+			depth, first, last := checkTableTree(t, p, root.Number())
+			assert.Less(2, depth)
+			assert.Equal(uint32(1), first)
+			assert.Equal(uint32(count), last)
+
+			cursor, err := NewCursor(p, CURSOR_READ, root.Number(), "table")
+			assert.NoError(err)
+
+			ok, err := cursor.Rewind()
+			assert.NoError(err)
+			seen := 0
+			for ok {
+				record, err := cursor.CurrentCell()
+				assert.NoError(err)
+				assert.Equal(uint32(seen+1), record.RowID)
+				seen++
+				ok, err = cursor.Next()
+				assert.NoError(err)
+			}
+			assert.Equal(count, seen)
+
+			n, err := cursor.Count()
+			assert.NoError(err)
+			assert.Equal(count, n)
+			max, err := cursor.MaxRowID()
+			assert.NoError(err)
+			assert.Equal(uint32(count), max)
+
+			for rowID := uint32(1); rowID <= count; rowID += 97 {
+				ok, err := cursor.SeekRowID(rowID)
+				assert.NoError(err)
+				assert.True(ok)
+				record, err := cursor.CurrentCell()
+				assert.NoError(err)
+				assert.Equal(fmt.Sprintf("row %d of the table", rowID), record.Fields[0].Data)
+
+				ok, err = cursor.SeekRowIDLE(rowID)
+				assert.NoError(err)
+				assert.True(ok)
+				record, err = cursor.CurrentCell()
+				assert.NoError(err)
+				assert.Equal(rowID, record.RowID)
+			}
+		})
+	}
+}
+
+// checkTableTree verifies the order of the keys of a table btree, returning
+// its depth and the smallest and largest rowids below the page
+func checkTableTree(t *testing.T, p Pager, page int) (int, uint32, uint32) {
+	assert := require.New(t)
+
+	mp, err := p.Read(page)
+	assert.NoError(err)
+	if mp.header.Type == PageTypeLeaf {
+		assert.Positive(mp.CellCount())
+		first, err := mp.ReadRecord(0)
+		assert.NoError(err)
+		last, err := mp.ReadRecord(mp.CellCount() - 1)
+		assert.NoError(err)
+		return 1, first.RowID, last.RowID
+	}
+	assert.Equal(PageTypeInternal, mp.header.Type)
+
+	var depth int
+	var first, prev uint32
+	for i := 0; i < mp.CellCount(); i++ {
+		node, err := mp.ReadInteriorNode(i)
+		assert.NoError(err)
+		d, lo, hi := checkTableTree(t, p, int(node.LeftChild))
+		assert.Equal(node.Key, hi)
+		if i == 0 {
+			depth, first = d, lo
+		} else {
+			assert.Equal(depth, d)
+			assert.Less(prev, lo)
+		}
+		prev = hi
+	}
+	d, lo, hi := checkTableTree(t, p, mp.header.RightPage)
+	if mp.CellCount() == 0 {
+		depth, first = d, lo
+	} else {
+		assert.Equal(depth, d)
+		assert.Less(prev, lo)
+	}
+	return depth + 1, first, hi
+}
+
+func TestCursor_SeekRowIDRange(t *testing.T) {
+	assert := require.New(t)
+	const count = 1000
+
+	file := storage.NewMemoryFile(testPageSize)
+	assert.NoError(Initialize(file))
+	p := NewPager(file)
+
+	root, err := p.Allocate(PageTypeLeaf)
+	assert.NoError(err)
+	assert.NoError(p.Write(root))
+
+	// Only even rowids are present so that every odd rowid is missing
+	table := NewBTreeTable(root.Number(), p)
+	for i := 1; i <= count; i++ {
+		assert.NoError(table.Insert(storage.NewRecord(uint32(2*i), []*storage.Field{
+			{Type: storage.Text, Data: fmt.Sprintf("row %d", 2*i)},
+		})))
+	}
+
+	// The largest rowid of each leaf and the rowids around it are boundaries
+	rootPage, err := p.Read(root.Number())
+	assert.NoError(err)
+	assert.Equal(PageTypeInternal, rootPage.header.Type)
+	targets := []uint32{0, 1, 2, 3, 1000, 1001, 2*count - 1, 2 * count, 2*count + 1}
+	for i := 0; i < rootPage.CellCount(); i++ {
+		node, err := rootPage.ReadInteriorNode(i)
+		assert.NoError(err)
+		targets = append(targets, node.Key-1, node.Key, node.Key+1)
+	}
+
+	cursor, err := NewCursor(p, CURSOR_READ, root.Number(), "table")
+	assert.NoError(err)
+
+	for _, target := range targets {
+		// The first record not less than the target, then the following records
+		want := (target + 1) / 2 * 2
+		if want == 0 {
+			want = 2
+		}
+		ok, err := cursor.SeekRowIDGE(target)
+		assert.NoError(err)
+		for ; want <= 2*count; want += 2 {
+			assert.True(ok, "GE %d", target)
+			record, err := cursor.CurrentCell()
+			assert.NoError(err)
+			assert.Equal(want, record.RowID, "GE %d", target)
+			ok, err = cursor.Next()
+			assert.NoError(err)
+		}
+		assert.False(ok, "GE %d", target)
+
+		// The last record not greater than the target
+		ok, err = cursor.SeekRowIDLE(target)
+		assert.NoError(err)
+		if target < 2 {
+			assert.False(ok, "LE %d", target)
+			continue
+		}
+		assert.True(ok, "LE %d", target)
+		record, err := cursor.CurrentCell()
+		assert.NoError(err)
+		want = target / 2 * 2
+		if want > 2*count {
+			want = 2 * count
+		}
+		assert.Equal(want, record.RowID, "LE %d", target)
+	}
+}
+
+func BenchmarkBTreeTable_Insert_Sequential(b *testing.B) {
+	const count = 2000
+
+	// Without the fast path each insert descends from the root
+	for _, bc := range []struct {
+		name      string
+		sameTable bool
+	}{
+		{"append", true},
+		{"descend", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				file := storage.NewMemoryFile(testPageSize)
+				if err := Initialize(file); err != nil {
+					b.Fatal(err)
+				}
+				p := NewPager(file)
+				root, err := p.Allocate(PageTypeLeaf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := p.Write(root); err != nil {
+					b.Fatal(err)
+				}
+
+				table := NewBTreeTable(root.Number(), p)
+				for i := 1; i <= count; i++ {
+					if !bc.sameTable {
+						table = NewBTreeTable(root.Number(), p)
+					}
+					err := table.Insert(storage.NewRecord(uint32(i), []*storage.Field{
+						{Type: storage.Text, Data: "row"},
+					}))
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -23,10 +23,21 @@ type Cursor struct {
 	currentPage int
 	cellIndex   int
 
-	parentIndex int
-	parentPage  int
+	// parents are the interior pages above the current page, the root first
+	parents []branch
 
 	pager Pager
+
+	// table inserts the records of a write cursor, it is kept between
+	// inserts so that appends find the rightmost leaf directly
+	table *BTreeTable
+}
+
+// branch is a position in an interior page, the cell whose left child is
+// followed or the cell count when the right page is followed.
+type branch struct {
+	page  int
+	index int
 }
 
 // NewCursor initializes a cursor to traverse the database btree
@@ -36,8 +47,6 @@ func NewCursor(pager Pager, typ CursorType, rootPage int, name string) (*Cursor,
 		pager:       pager,
 		rootPage:    rootPage,
 		currentPage: rootPage,
-		parentPage:  0,
-		parentIndex: 0,
 		cellIndex:   0,
 		typ:         typ,
 	}, nil
@@ -51,7 +60,7 @@ func (c *Cursor) CurrentCell() (*storage.Record, error) {
 	}
 
 	// Attempt to access non-leaf cell
-	if p.header.Type != PageTypeLeaf {
+	if p.header.Type != PageTypeLeaf && p.header.Type != PageTypeLeafIndex {
 		return nil, errors.New("expected current position to be on leaf node")
 	}
 
@@ -60,8 +69,16 @@ func (c *Cursor) CurrentCell() (*storage.Record, error) {
 
 // Insert places a record in the btree
 func (c *Cursor) Insert(record *storage.Record) error {
-	btreeTable := NewBTreeTable(c.rootPage, c.pager)
-	return btreeTable.Insert(record)
+	if c.table == nil {
+		c.table = NewBTreeTable(c.rootPage, c.pager)
+	}
+	return c.table.Insert(record)
+}
+
+// IdxInsert places a record in the index btree
+func (c *Cursor) IdxInsert(record *storage.Record) error {
+	btreeIndex := NewBTreeIndex(c.rootPage, c.pager)
+	return btreeIndex.Insert(record)
 }
 
 // Next advances the cursor to the next record
@@ -74,57 +91,319 @@ func (c *Cursor) Next() (bool, error) {
 
 	nextIndex := c.cellIndex + 1
 
-	// Encountering an internal page should traverse its children
-	if p.header.Type == PageTypeInternal {
-		if nextIndex < int(p.header.NumCells) {
-			interiorNode, err := p.ReadInteriorNode(nextIndex)
-			if err != nil {
-				return false, err
+	// Encountering an internal page should traverse its children,
+	// the right page being the last.
+	if p.header.Type == PageTypeInternal || p.header.Type == PageTypeInternalIndex {
+		if nextIndex <= p.CellCount() {
+			nextPage := p.header.RightPage
+			if nextIndex < p.CellCount() {
+				if nextPage, err = leftChild(p, nextIndex); err != nil {
+					return false, err
+				}
 			}
 
-			nextPage := int(interiorNode.LeftChild)
-
 			// Store the position in the parent
-			// This may need to become a stack or linked list.
-			c.parentPage = p.Number()
-			c.parentIndex = nextIndex
+			c.parents = append(c.parents, branch{page: p.Number(), index: nextIndex})
 
 			// Start at the beginning of the child node
 			c.currentPage = nextPage
 			c.cellIndex = -1
-		} else {
-			// TODO: Confirm intended behavior of right page
+			return c.Next()
+		}
+	} else if nextIndex < p.CellCount() {
+		c.cellIndex = nextIndex
+		return true, nil
+	}
+
+	// The page has been completely traversed.
+	// No parent, we're done.
+	if len(c.parents) == 0 {
+		return false, nil
+	}
+
+	// Restore parent interior node position
+	parent := c.parents[len(c.parents)-1]
+	c.parents = c.parents[:len(c.parents)-1]
+	c.currentPage = parent.page
+	c.cellIndex = parent.index
 
-			// The last node to be traversed.
-			c.parentPage = 0
-			c.parentIndex = 0
+	// Start at next child in parent
+	return c.Next()
+}
 
-			// Last page is the right page.
+// SeekGE positions the cursor at the first entry of an index btree that is
+// not less than the key. Only the leading fields of each entry present in
+// the key are compared. returns true if there is such an entry false otherwise
+func (c *Cursor) SeekGE(key *storage.Record) (bool, error) {
+	c.currentPage = c.rootPage
+	c.parents = nil
+
+	p, err := c.pager.Read(c.rootPage)
+	if err != nil {
+		return false, err
+	}
+
+	// Descend into the first child whose largest entry is not less than
+	// the key, the right page is the last to be traversed.
+	for p.header.Type == PageTypeInternalIndex {
+		index, child := p.CellCount(), p.header.RightPage
+		for i := 0; i < p.CellCount(); i++ {
+			node, err := p.ReadIndexInteriorNode(i)
+			if err != nil {
+				return false, err
+			}
+			if compareKey(node.Key, key) >= 0 {
+				index, child = i, int(node.LeftChild)
+				break
+			}
+		}
+
+		c.parents = append(c.parents, branch{page: p.Number(), index: index})
+		c.currentPage = child
+		if p, err = c.pager.Read(child); err != nil {
+			return false, err
+		}
+	}
+
+	if p.header.Type != PageTypeLeafIndex {
+		return false, errors.New("expected an index btree")
+	}
+
+	// Position before the first entry not less than the key
+	c.cellIndex = -1
+	for i := 0; i < p.CellCount(); i++ {
+		record, err := p.ReadRecord(i)
+		if err != nil {
+			return false, err
+		}
+		if compareKey(record, key) >= 0 {
+			break
+		}
+		c.cellIndex = i
+	}
+
+	return c.Next()
+}
+
+// SeekRowID positions the cursor at the record of a table btree with the rowid.
+// returns true if there is such a record false otherwise
+func (c *Cursor) SeekRowID(rowID uint32) (bool, error) {
+	p, err := c.seekLeaf(rowID)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < p.CellCount(); i++ {
+		record, err := p.ReadRecord(i)
+		if err != nil {
+			return false, err
+		}
+		if record.RowID == rowID {
+			c.cellIndex = i
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SeekRowIDGE positions the cursor at the first record of a table btree with
+// a rowid not less than the rowid.
+// returns true if there is such a record false otherwise
+func (c *Cursor) SeekRowIDGE(rowID uint32) (bool, error) {
+	p, err := c.seekLeaf(rowID)
+	if err != nil {
+		return false, err
+	}
+
+	// Position before the first record not less than the rowid
+	c.cellIndex = -1
+	for i := 0; i < p.CellCount(); i++ {
+		record, err := p.ReadRecord(i)
+		if err != nil {
+			return false, err
+		}
+		if record.RowID >= rowID {
+			break
+		}
+		c.cellIndex = i
+	}
+
+	return c.Next()
+}
+
+// SeekRowIDLE positions the cursor at the last record of a table btree with
+// a rowid not greater than the rowid.
+// returns true if there is such a record false otherwise
+func (c *Cursor) SeekRowIDLE(rowID uint32) (bool, error) {
+	p, err := c.seekLeaf(rowID)
+	if err != nil {
+		return false, err
+	}
+
+	c.cellIndex = -1
+	for i := 0; i < p.CellCount(); i++ {
+		record, err := p.ReadRecord(i)
+		if err != nil {
+			return false, err
+		}
+		if record.RowID > rowID {
+			break
+		}
+		c.cellIndex = i
+	}
+	if c.cellIndex >= 0 {
+		return true, nil
+	}
+
+	// Every record of the leaf is greater, the record is the last of the
+	// previous leaf. It is below the nearest parent that has a child before
+	// the one followed, at the end of the right pages of that child.
+	for len(c.parents) > 0 {
+		parent := c.parents[len(c.parents)-1]
+		c.parents = c.parents[:len(c.parents)-1]
+		if parent.index == 0 {
+			continue
+		}
+
+		p, err = c.pager.Read(parent.page)
+		if err != nil {
+			return false, err
+		}
+		c.parents = append(c.parents, branch{page: parent.page, index: parent.index - 1})
+		if c.currentPage, err = leftChild(p, parent.index-1); err != nil {
+			return false, err
+		}
+		for {
+			if p, err = c.pager.Read(c.currentPage); err != nil {
+				return false, err
+			}
+			if p.header.Type != PageTypeInternal {
+				break
+			}
+			c.parents = append(c.parents, branch{page: p.Number(), index: p.CellCount()})
 			c.currentPage = p.header.RightPage
-			c.cellIndex = -1
 		}
+		c.cellIndex = p.CellCount() - 1
+		return c.cellIndex >= 0, nil
+	}
+
+	return false, nil
+}
+
+// seekLeaf positions the cursor on the leaf of a table btree that holds the
+// rowid when the table has such a record.
+func (c *Cursor) seekLeaf(rowID uint32) (*MemPage, error) {
+	c.currentPage = c.rootPage
+	c.parents = nil
+
+	p, err := c.pager.Read(c.rootPage)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.header.Type == PageTypeInternal {
+		index, child, err := childFor(p, rowID)
+		if err != nil {
+			return nil, err
+		}
+
+		c.parents = append(c.parents, branch{page: p.Number(), index: index})
+		c.currentPage = child
+		if p, err = c.pager.Read(child); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.header.Type != PageTypeLeaf {
+		return nil, errors.New("expected a table btree")
+	}
+
+	return p, nil
+}
 
-		return c.Next()
+// MaxRowID finds the largest rowid of a table btree, which is the rowid of
+// the last record of its rightmost leaf. returns 0 if the table is empty
+func (c *Cursor) MaxRowID() (uint32, error) {
+	p, err := c.pager.Read(c.rootPage)
+	if err != nil {
+		return 0, err
 	}
 
-	// If leaf has been completely traversed.
-	// Go go to next leaf or done.
-	if nextIndex >= int(p.header.NumCells) {
-		// No parent, we're done.
-		if c.parentPage == 0 {
-			return false, nil
+	for p.header.Type == PageTypeInternal {
+		if p, err = c.pager.Read(p.header.RightPage); err != nil {
+			return 0, err
 		}
+	}
+
+	if p.header.Type != PageTypeLeaf {
+		return 0, errors.New("expected a table btree")
+	}
+
+	if p.CellCount() == 0 {
+		return 0, nil
+	}
+
+	record, err := p.ReadRecord(p.CellCount() - 1)
+	if err != nil {
+		return 0, err
+	}
+	return record.RowID, nil
+}
+
+// Count finds the number of records of a table btree by adding up the cell
+// counts of its leaf pages. No record is read.
+func (c *Cursor) Count() (int, error) {
+	return countCells(c.pager, c.rootPage)
+}
+
+// countCells adds up the cell counts of the leaf pages below a page
+func countCells(pager Pager, page int) (int, error) {
+	p, err := pager.Read(page)
+	if err != nil {
+		return 0, err
+	}
 
-		// Restore parent interior node position
-		c.currentPage = c.parentPage
-		c.cellIndex = c.parentIndex
+	if p.header.Type == PageTypeLeaf {
+		return p.CellCount(), nil
+	}
+	if p.header.Type != PageTypeInternal {
+		return 0, errors.New("expected a table btree")
+	}
+
+	count, err := countCells(pager, p.header.RightPage)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < p.CellCount(); i++ {
+		child, err := leftChild(p, i)
+		if err != nil {
+			return 0, err
+		}
+		n, err := countCells(pager, child)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
 
-		// Start at next child in parent
-		return c.Next()
+// leftChild reads the page number of the left child of an interior cell
+func leftChild(p *MemPage, cellIndex int) (int, error) {
+	if p.header.Type == PageTypeInternalIndex {
+		node, err := p.ReadIndexInteriorNode(cellIndex)
+		if err != nil {
+			return 0, err
+		}
+		return int(node.LeftChild), nil
 	}
 
-	c.cellIndex = nextIndex
-	return true, nil
+	node, err := p.ReadInteriorNode(cellIndex)
+	if err != nil {
+		return 0, err
+	}
+	return int(node.LeftChild), nil
 }
 
 // Rewind sets the cursor to the first entry in the btree
@@ -132,7 +411,6 @@ func (c *Cursor) Next() (bool, error) {
 func (c *Cursor) Rewind() (bool, error) {
 	c.currentPage = c.rootPage
 	c.cellIndex = -1
-	c.parentIndex = 0
-	c.parentPage = 0
+	c.parents = nil
 	return c.Next()
 }
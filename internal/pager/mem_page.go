@@ -8,11 +8,12 @@ import (
 	"github.com/joeandaverde/tinydb/internal/storage"
 )
 
-// NewPageHeader creates a new PageHeader
-func NewPageHeader(pageType PageType, pageSize int) PageHeader {
+// NewPageHeader creates a new PageHeader for an empty page. The usable size
+// is the page size less the reserved region at the end of the page.
+func NewPageHeader(pageType PageType, usableSize int) PageHeader {
 	return PageHeader{
 		Type:                pageType,
-		CellsOffset:         uint16(pageSize),
+		CellsOffset:         uint16(usableSize),
 		FreeBlock:           0,
 		NumCells:            0,
 		FragmentedFreeBytes: 0,
@@ -69,7 +70,7 @@ type PageHeader struct {
 	NumCells uint16
 
 	// CellsOffset the start of the cell content area. A zero value for this integer is interpreted as 65536.
-	// If the page contains no cells, this field contains the value PageSize.
+	// If the page contains no cells, this field contains the usable size of the page.
 	CellsOffset uint16
 
 	// FragmentedFreeBytes the number of fragmented free bytes within the cell content area.
@@ -85,6 +86,9 @@ type MemPage struct {
 	pageNumber int
 	data       []byte
 	dirty      bool
+
+	// reservedSpace is the size of the reserved region at the end of the page
+	reservedSpace int
 }
 
 // Number is the page number
@@ -109,9 +113,23 @@ func (p *MemPage) SetHeader(h PageHeader) {
 func (p *MemPage) CopyTo(dst *MemPage) {
 	dst.dirty = true
 	dst.header = p.header
+	dst.reservedSpace = p.reservedSpace
 	copy(dst.data, p.data)
 }
 
+// clone makes a copy of the page
+func (p *MemPage) clone() *MemPage {
+	c := *p
+	c.data = make([]byte, len(p.data))
+	copy(c.data, p.data)
+	return &c
+}
+
+// UsableSize is the size of the page excluding the reserved region.
+func (p *MemPage) UsableSize() int {
+	return len(p.data) - p.reservedSpace
+}
+
 // Fits determines if there's enough space in the page for a cell
 // of the specified size.
 func (p *MemPage) Fits(recordLen int) bool {
@@ -119,7 +137,7 @@ func (p *MemPage) Fits(recordLen int) bool {
 	cellPointerOffset := cellPointersStart(p.header.Type, p.pageNumber) + int(p.header.NumCells)*2
 
 	// Where cell data would start
-	cellDataOffset := int(p.header.CellsOffset) - recordLen
+	cellDataOffset := p.cellsOffset() - recordLen
 
 	return cellPointerOffset+2 <= cellDataOffset
 }
@@ -146,6 +164,13 @@ func (p *MemPage) ReadInteriorNode(cellIndex int) (*storage.InteriorNode, error)
 	return storage.ReadInteriorNode(p.data[cellDataStart:])
 }
 
+// ReadIndexInteriorNode returns the index interior node of the requested cell.
+func (p *MemPage) ReadIndexInteriorNode(cellIndex int) (*storage.IndexInteriorNode, error) {
+	cellDataStart := p.cellDataOffset(cellIndex)
+
+	return storage.ReadIndexInteriorNode(p.data[cellDataStart:])
+}
+
 // AddCell adds a cell entry to the page. This function assumes
 // that the page can fit the new cell.
 func (p *MemPage) AddCell(data []byte) {
@@ -154,8 +179,7 @@ func (p *MemPage) AddCell(data []byte) {
 	// Every cell is 2 bytes
 	cellPointerOffset := cellPointersStart(p.header.Type, p.pageNumber) + int(2*p.header.NumCells)
 
-	cellLength := uint16(len(data))
-	cellOffset := p.header.CellsOffset - cellLength
+	cellOffset := uint16(p.cellsOffset() - len(data))
 
 	// Write a pointer to the new cell
 	binary.BigEndian.PutUint16(p.data[cellPointerOffset:], cellOffset)
@@ -173,6 +197,19 @@ func (p *MemPage) AddCell(data []byte) {
 	p.updateHeaderData()
 }
 
+// cellsOffset is the start of the cell content area, which never extends
+// into the reserved region.
+func (p *MemPage) cellsOffset() int {
+	offset := int(p.header.CellsOffset)
+	if offset == 0 {
+		offset = 65536
+	}
+	if usable := p.UsableSize(); offset > usable {
+		return usable
+	}
+	return offset
+}
+
 func (p *MemPage) updateHeaderData() {
 	headerOffset := headerOffset(p.pageNumber)
 	header := p.data[headerOffset:]
@@ -215,7 +252,8 @@ func headerOffset(pageNumber int) int {
 }
 
 // FromBytes parses a byte slice to a MemPage and takes ownership of the slice.
-func FromBytes(pageNumber int, data []byte) (*MemPage, error) {
+// The last reservedSpace bytes of the page are never used for cells.
+func FromBytes(pageNumber int, data []byte, reservedSpace int) (*MemPage, error) {
 	offset := headerOffset(pageNumber)
 
 	view := data[offset:]
@@ -232,10 +270,11 @@ func FromBytes(pageNumber int, data []byte) (*MemPage, error) {
 	}
 
 	return &MemPage{
-		header:     header,
-		pageNumber: pageNumber,
-		data:       data,
-		dirty:      false,
+		header:        header,
+		pageNumber:    pageNumber,
+		data:          data,
+		dirty:         false,
+		reservedSpace: reservedSpace,
 	}, nil
 }
 
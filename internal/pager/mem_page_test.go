@@ -1,6 +1,8 @@
 package pager
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/joeandaverde/tinydb/internal/storage"
@@ -30,3 +32,29 @@ func TestMemPage_AddCell_InteriorNode(t *testing.T) {
 		assert.Equal(cellBytes, page.data[page.header.CellsOffset:int(page.header.CellsOffset)+len(cellBytes)])
 	}
 }
+
+func TestMemPage_AddCell_ReservedRegion(t *testing.T) {
+	assert := require.New(t)
+	const reserved = 32
+
+	// A page whose header claims the whole page for cells
+	data := make([]byte, testPageSize)
+	data[0] = byte(PageTypeLeaf)
+	binary.BigEndian.PutUint16(data[5:7], uint16(testPageSize))
+	for i := testPageSize - reserved; i < testPageSize; i++ {
+		data[i] = 0xAA
+	}
+
+	page, err := FromBytes(2, data, reserved)
+	assert.NoError(err)
+	assert.Equal(testPageSize-reserved, page.UsableSize())
+
+	cell := bytes.Repeat([]byte{0x01}, 100)
+	for page.Fits(len(cell)) {
+		page.AddCell(cell)
+		assert.LessOrEqual(int(page.header.CellsOffset)+len(cell), testPageSize-reserved)
+	}
+
+	assert.Greater(page.CellCount(), 0)
+	assert.Equal(bytes.Repeat([]byte{0xAA}, reserved), page.data[testPageSize-reserved:])
+}
@@ -1,10 +1,20 @@
 package pager
 
 import (
+	"container/list"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+
 	"github.com/joeandaverde/tinydb/internal/storage"
 )
 
+// ErrConflict is returned when flushing a page that was changed in the
+// page source after it was read by the pager. The pager discards its
+// cached pages so the transaction can be retried against fresh data.
+var ErrConflict = errors.New("write conflict: page modified by another transaction")
+
 type PageReader interface {
 	Read(page int) (*MemPage, error)
 }
@@ -14,6 +24,15 @@ type PageWriter interface {
 	Allocate(PageType) (*MemPage, error)
 	Flush() error
 	Reset()
+	Snapshot() *Snapshot
+	Restore(*Snapshot)
+}
+
+// Snapshot holds copies of the dirty pages of a pager at some point of a
+// transaction, to undo the changes made afterwards.
+type Snapshot struct {
+	pageCount int
+	pages     []*MemPage
 }
 
 // Pager manages database paging
@@ -24,16 +43,37 @@ type Pager interface {
 
 type pager struct {
 	pageCount int
-	pageCache map[int]*MemPage
+
+	// pageCache holds the element of each cached page in recent, which
+	// orders the pages from the most to the least recently used.
+	pageCache map[int]*list.Element
+	recent    *list.List
+
+	// maxCachePages is the number of pages cached before the least
+	// recently used clean pages are evicted, 0 caches every page.
+	maxCachePages int
+
+	hits      int
+	misses    int
+	evictions int
+
+	// versions holds a checksum of each page as it was in the source
+	// when last read or flushed. Used to detect conflicting writes.
+	versions map[int]uint32
+
+	// seen is the version of a versioned source the clean cached pages
+	// are known to be current with
+	seen uint64
 
 	file storage.File
 }
 
 func Initialize(file storage.File) error {
 	newPage := &MemPage{
-		header:     NewPageHeader(PageTypeLeaf, file.PageSize()),
-		pageNumber: 1,
-		data:       make([]byte, file.PageSize()),
+		header:        NewPageHeader(PageTypeLeaf, file.PageSize()-file.ReservedSpace()),
+		pageNumber:    1,
+		data:          make([]byte, file.PageSize()),
+		reservedSpace: file.ReservedSpace(),
 	}
 	newPage.updateHeaderData()
 
@@ -41,11 +81,66 @@ func Initialize(file storage.File) error {
 }
 
 func NewPager(file storage.File) Pager {
+	return NewPagerWithCache(file, 0)
+}
+
+// NewPagerWithCache creates a pager caching up to maxCachePages pages.
+// Dirty pages are never evicted so the cache exceeds the limit until they
+// are flushed.
+func NewPagerWithCache(file storage.File, maxCachePages int) Pager {
 	return &pager{
-		pageCount: file.TotalPages(),
-		pageCache: make(map[int]*MemPage),
-		file:      file,
+		pageCount:     file.TotalPages(),
+		pageCache:     make(map[int]*list.Element),
+		recent:        list.New(),
+		maxCachePages: maxCachePages,
+		versions:      make(map[int]uint32),
+		seen:          sourceVersion(file),
+		file:          file,
+	}
+}
+
+// Source is the page source a pager reads from. Pagers of the same
+// database share a source.
+func Source(p Pager) storage.File {
+	if pg, ok := p.(*pager); ok {
+		return pg.file
+	}
+	return nil
+}
+
+// SchemaCookie reads the schema cookie from the header on page 1. The
+// cookie is changed by every change to the schema.
+func SchemaCookie(p Pager) (uint32, error) {
+	page, err := p.Read(1)
+	if err != nil {
+		return 0, err
 	}
+	return binary.BigEndian.Uint32(page.data[storage.SchemaCookieOffset:]), nil
+}
+
+// SetSchemaCookie writes the schema cookie to the header on page 1
+func SetSchemaCookie(p Pager, cookie uint32) error {
+	page, err := p.Read(1)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(page.data[storage.SchemaCookieOffset:], cookie)
+	page.dirty = true
+	return p.Write(page)
+}
+
+// sourceVersion is the version of a versioned page source, 0 otherwise
+func sourceVersion(file storage.File) uint64 {
+	if v, ok := file.(storage.Versioned); ok {
+		return v.Version()
+	}
+	return 0
+}
+
+// CacheStats reports the number of reads served by the cache, the number
+// of reads from the page source and the number of pages evicted.
+func (p *pager) CacheStats() (hits, misses, evictions int) {
+	return p.hits, p.misses, p.evictions
 }
 
 // Read reads a full page from cache or the page source
@@ -54,47 +149,118 @@ func (p *pager) Read(pageNumber int) (*MemPage, error) {
 		return nil, fmt.Errorf("page [%d] out of bounds", pageNumber)
 	}
 
-	if tablePage, ok := p.pageCache[pageNumber]; ok {
-		return tablePage, nil
-	}
+	// Pages committed by other pagers replace the cached ones, whether
+	// they are read from the log or the database file
+	p.reconcile()
 
-	// Ensure the page hasn't been retrieved into the cache since releasing the read lock
-	if tablePage, ok := p.pageCache[pageNumber]; ok {
+	if tablePage, ok := p.cached(pageNumber); ok {
+		p.hits++
 		return tablePage, nil
 	}
 
 	// Read raw page data from the source
+	p.misses++
 	data, err := p.file.Read(pageNumber)
 	if err != nil {
 		return nil, err
 	}
+	p.versions[pageNumber] = crc32.ChecksumIEEE(data)
 
 	// Parse bytes to a page
-	page, err := FromBytes(pageNumber, data)
+	page, err := FromBytes(pageNumber, data, p.file.ReservedSpace())
 	if err != nil {
 		return nil, err
 	}
 
 	// Cache the result for later reads
-	p.pageCache[pageNumber] = page
+	p.cache(page)
 
-	return p.pageCache[pageNumber], nil
+	return page, nil
 }
 
 // Write updates pages in the pager
 func (p *pager) Write(pages ...*MemPage) error {
 	for _, pg := range pages {
-		p.pageCache[pg.Number()] = pg
+		p.cache(pg)
 	}
 
 	return nil
 }
 
+// reconcile discards the clean cached pages written to a versioned source
+// since the pager was last current with it. Dirty pages are kept, writes
+// made over stale pages are detected as conflicts when flushed.
+func (p *pager) reconcile() {
+	src, ok := p.file.(storage.Versioned)
+	if !ok {
+		return
+	}
+
+	version := src.Version()
+	if version == p.seen {
+		return
+	}
+	for pageNumber, e := range p.pageCache {
+		if !e.Value.(*MemPage).dirty && src.PageVersion(pageNumber) > p.seen {
+			p.uncache(pageNumber)
+		}
+	}
+	p.seen = version
+}
+
+// cached finds a page in the cache, marking it as the most recently used
+func (p *pager) cached(pageNumber int) (*MemPage, bool) {
+	e, ok := p.pageCache[pageNumber]
+	if !ok {
+		return nil, false
+	}
+	p.recent.MoveToFront(e)
+	return e.Value.(*MemPage), true
+}
+
+// cache adds a page to the cache as the most recently used, replacing the
+// cached page of the same number.
+func (p *pager) cache(page *MemPage) {
+	if e, ok := p.pageCache[page.Number()]; ok {
+		e.Value = page
+		p.recent.MoveToFront(e)
+	} else {
+		p.pageCache[page.Number()] = p.recent.PushFront(page)
+	}
+	p.evict()
+}
+
+// evict removes the least recently used clean pages while the cache holds
+// more pages than allowed.
+func (p *pager) evict() {
+	if p.maxCachePages <= 0 {
+		return
+	}
+
+	for e := p.recent.Back(); e != nil && len(p.pageCache) > p.maxCachePages; {
+		prev := e.Prev()
+		if page := e.Value.(*MemPage); !page.dirty {
+			p.uncache(page.Number())
+			p.evictions++
+		}
+		e = prev
+	}
+}
+
+// uncache removes a page from the cache
+func (p *pager) uncache(pageNumber int) {
+	if e, ok := p.pageCache[pageNumber]; ok {
+		p.recent.Remove(e)
+		delete(p.pageCache, pageNumber)
+	}
+}
+
 // Flush flushes all dirty pages to destination
 func (p *pager) Flush() error {
 	var dirtyPages []storage.Page
 	var dirtyMemPages []*MemPage
-	for _, page := range p.pageCache {
+	for _, e := range p.pageCache {
+		page := e.Value.(*MemPage)
 		if !page.dirty {
 			continue
 		}
@@ -104,29 +270,101 @@ func (p *pager) Flush() error {
 	}
 
 	if len(dirtyPages) > 0 {
+		if err := p.checkConflicts(dirtyMemPages); err != nil {
+			return err
+		}
+		before := sourceVersion(p.file)
 		if err := p.file.Write(dirtyPages...); err != nil {
 			return err
 		}
 		p.pageCount = p.file.TotalPages()
+
+		// The cache is still current when no other write was committed
+		// since the pager was last current with the source
+		if after := sourceVersion(p.file); before == p.seen && after == before+1 {
+			p.seen = after
+		}
 	}
 
-	for _, p := range dirtyMemPages {
-		p.dirty = false
+	for _, page := range dirtyMemPages {
+		page.dirty = false
+		p.versions[page.pageNumber] = crc32.ChecksumIEEE(page.data)
 	}
 
+	// Flushed pages may now be evicted
+	p.evict()
+
 	return nil
 }
 
+// checkConflicts ensures none of the pages were modified in the source
+// since they were read. Pages allocated by this pager conflict if the
+// source has since grown to include them.
+func (p *pager) checkConflicts(pages []*MemPage) error {
+	for _, page := range pages {
+		version, ok := p.versions[page.pageNumber]
+		if !ok {
+			if page.pageNumber <= p.file.TotalPages() {
+				return p.conflict()
+			}
+			continue
+		}
+
+		data, err := p.file.Read(page.pageNumber)
+		if err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(data) != version {
+			return p.conflict()
+		}
+	}
+
+	return nil
+}
+
+// conflict discards every cached page as any of them may be stale
+func (p *pager) conflict() error {
+	p.pageCount = p.file.TotalPages()
+	p.pageCache = make(map[int]*list.Element)
+	p.recent = list.New()
+	p.versions = make(map[int]uint32)
+	p.seen = sourceVersion(p.file)
+	return ErrConflict
+}
+
 // Reset clears all dirty pages
 func (p *pager) Reset() {
 	p.pageCount = p.file.TotalPages()
-	for k, page := range p.pageCache {
-		if page.dirty {
-			delete(p.pageCache, k)
+	for k, e := range p.pageCache {
+		if e.Value.(*MemPage).dirty {
+			p.uncache(k)
 		}
 	}
 }
 
+// Snapshot copies the dirty pages so that changes made afterwards can be
+// undone by Restore.
+func (p *pager) Snapshot() *Snapshot {
+	s := &Snapshot{pageCount: p.pageCount}
+	for _, e := range p.pageCache {
+		if page := e.Value.(*MemPage); page.dirty {
+			s.pages = append(s.pages, page.clone())
+		}
+	}
+	return s
+}
+
+// Restore undoes the changes made since a snapshot. Pages changed since
+// are discarded to be read again from the page source and the dirty pages
+// of the snapshot are restored. The snapshot may be restored again.
+func (p *pager) Restore(s *Snapshot) {
+	p.Reset()
+	p.pageCount = s.pageCount
+	for _, page := range s.pages {
+		p.cache(page.clone())
+	}
+}
+
 // Allocate allocates a new dirty page in the pager.
 //
 // Page 1 of a database file is the root page of a table b-tree that
@@ -145,14 +383,15 @@ func (p *pager) Reset() {
 func (p *pager) Allocate(pageType PageType) (*MemPage, error) {
 	p.pageCount = p.pageCount + 1
 	newPage := &MemPage{
-		header:     NewPageHeader(pageType, p.file.PageSize()),
-		pageNumber: p.pageCount,
-		data:       make([]byte, p.file.PageSize()),
-		dirty:      true,
+		header:        NewPageHeader(pageType, p.file.PageSize()-p.file.ReservedSpace()),
+		pageNumber:    p.pageCount,
+		data:          make([]byte, p.file.PageSize()),
+		dirty:         true,
+		reservedSpace: p.file.ReservedSpace(),
 	}
 	newPage.updateHeaderData()
-	p.pageCache[p.pageCount] = newPage
-	return p.pageCache[p.pageCount], nil
+	p.cache(newPage)
+	return newPage, nil
 }
 
 var _ Pager = (*pager)(nil)
@@ -1,6 +1,10 @@
 package pager
 
 import (
+	"errors"
+	"path"
+	"strings"
+
 	"github.com/joeandaverde/tinydb/internal/storage"
 	"github.com/stretchr/testify/suite"
 	"testing"
@@ -82,6 +86,225 @@ func (s *PagerTestSuite) TestPager_Reset_PersistedPage() {
 	s.Equal(expectedData, actualPageOne.data)
 }
 
+func (s *PagerTestSuite) TestPager_SnapshotRestore() {
+	persisted, err := s.pager.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	persisted.AddCell([]byte{0xB, 0xE, 0xE, 0xF})
+	s.NoError(s.pager.Flush())
+	flushedData := append([]byte(nil), persisted.data...)
+
+	// page one is changed before the snapshot and page two after
+	persisted.AddCell([]byte{0xD, 0xE, 0xA, 0xD})
+	s.NoError(s.pager.Write(persisted))
+	snapshotData := append([]byte(nil), persisted.data...)
+	snapshot := s.pager.Snapshot()
+
+	persisted.AddCell([]byte{0xB, 0xE, 0xD, 0xA})
+	s.NoError(s.pager.Write(persisted))
+	allocated, err := s.pager.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.Equal(2, allocated.Number())
+
+	// restoring the snapshot may be repeated
+	for i := 0; i < 2; i++ {
+		s.pager.Restore(snapshot)
+
+		pageOne, err := s.pager.Read(1)
+		s.NoError(err)
+		s.Equal(snapshotData, pageOne.data)
+		s.True(pageOne.dirty)
+
+		_, err = s.pager.Read(2)
+		s.Error(err)
+
+		pageOne.AddCell([]byte{0xF, 0xE, 0xE, 0xD})
+		s.NoError(s.pager.Write(pageOne))
+	}
+
+	// the page allocated after the snapshot is allocated again
+	allocated, err = s.pager.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.Equal(2, allocated.Number())
+
+	// changes before the snapshot are still rolled back by a reset
+	s.pager.Reset()
+	pageOne, err := s.pager.Read(1)
+	s.NoError(err)
+	s.Equal(flushedData, pageOne.data)
+}
+
+func (s *PagerTestSuite) TestPager_Flush_Conflict() {
+	file := storage.NewMemoryFile(testPageSize)
+	s.NoError(Initialize(file))
+
+	first, second := NewPager(file), NewPager(file)
+
+	// both pagers read the same committed page
+	firstPage, err := first.Read(1)
+	s.NoError(err)
+	secondPage, err := second.Read(1)
+	s.NoError(err)
+
+	// first writer commits
+	firstPage.AddCell([]byte{0xB, 0xE, 0xE, 0xF})
+	s.NoError(first.Write(firstPage))
+	s.NoError(first.Flush())
+
+	// second writer modified a stale copy of the page
+	secondPage.AddCell([]byte{0xD, 0xE, 0xA, 0xD})
+	s.NoError(second.Write(secondPage))
+	err = second.Flush()
+	s.True(errors.Is(err, ErrConflict))
+
+	// retrying against fresh data succeeds
+	second.Reset()
+	retryPage, err := second.Read(1)
+	s.NoError(err)
+	s.Equal([]byte{0xB, 0xE, 0xE, 0xF}, retryPage.data[len(retryPage.data)-4:])
+
+	retryPage.AddCell([]byte{0xD, 0xE, 0xA, 0xD})
+	s.NoError(second.Write(retryPage))
+	s.NoError(second.Flush())
+}
+
+func (s *PagerTestSuite) TestPager_Flush_ConflictAllocate() {
+	file := storage.NewMemoryFile(testPageSize)
+	s.NoError(Initialize(file))
+
+	first, second := NewPager(file), NewPager(file)
+
+	_, err := first.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.NoError(first.Flush())
+
+	// second pager allocates the same page number
+	_, err = second.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.True(errors.Is(second.Flush(), ErrConflict))
+}
+
+func (s *PagerTestSuite) TestPager_Read_CommittedByOtherPager() {
+	file := storage.NewMemoryFile(testPageSize)
+	s.NoError(Initialize(file))
+
+	reader, writer := NewPager(file).(*pager), NewPager(file)
+	_, err := writer.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.NoError(writer.Flush())
+
+	_, err = reader.Read(1)
+	s.NoError(err)
+	_, err = reader.Read(2)
+	s.NoError(err)
+
+	// the writer changes page one, the reader's copy of page two stays
+	// cached
+	page, err := writer.Read(1)
+	s.NoError(err)
+	page.AddCell([]byte{0xB, 0xE, 0xE, 0xF})
+	s.NoError(writer.Write(page))
+	s.NoError(writer.Flush())
+
+	hits, misses, _ := reader.CacheStats()
+	page, err = reader.Read(1)
+	s.NoError(err)
+	s.Equal([]byte{0xB, 0xE, 0xE, 0xF}, page.data[len(page.data)-4:])
+	_, err = reader.Read(2)
+	s.NoError(err)
+
+	hitsAfter, missesAfter, _ := reader.CacheStats()
+	s.Equal(hits+1, hitsAfter)
+	s.Equal(misses+1, missesAfter)
+
+	// the writer's own commit leaves its cache current
+	hits, misses, _ = writer.(*pager).CacheStats()
+	_, err = writer.Read(1)
+	s.NoError(err)
+	hitsAfter, missesAfter, _ = writer.(*pager).CacheStats()
+	s.Equal(hits+1, hitsAfter)
+	s.Equal(misses, missesAfter)
+}
+
+func (s *PagerTestSuite) TestPager_Read_Checkpoint() {
+	dbFile, err := storage.OpenDbFile(path.Join(s.T().TempDir(), "tiny.db"), testPageSize)
+	s.NoError(err)
+	s.NoError(Initialize(dbFile))
+	wal, err := storage.OpenWAL(dbFile)
+	s.NoError(err)
+
+	reader, writer := NewPager(wal).(*pager), NewPager(wal)
+	lastCell := func(p Pager) []byte {
+		page, err := p.Read(1)
+		s.NoError(err)
+		return page.data[page.header.CellsOffset:][:4]
+	}
+	commit := func(cell []byte) {
+		page, err := writer.Read(1)
+		s.NoError(err)
+		page.AddCell(cell)
+		s.NoError(writer.Write(page))
+		s.NoError(writer.Flush())
+	}
+
+	// the page is read from the log, then from the db file once checkpointed
+	commit([]byte{0xB, 0xE, 0xE, 0xF})
+	s.Equal([]byte{0xB, 0xE, 0xE, 0xF}, lastCell(reader))
+	s.NoError(wal.Checkpoint())
+	s.Equal([]byte{0xB, 0xE, 0xE, 0xF}, lastCell(reader))
+
+	// checkpointing doesn't change the page, the cached copy is kept
+	_, misses, _ := reader.CacheStats()
+	s.NoError(wal.Checkpoint())
+	s.Equal([]byte{0xB, 0xE, 0xE, 0xF}, lastCell(reader))
+	_, missesAfter, _ := reader.CacheStats()
+	s.Equal(misses, missesAfter)
+
+	// a commit checkpointed before the reader reads again replaces the
+	// cached copy
+	commit([]byte{0xD, 0xE, 0xA, 0xD})
+	s.NoError(wal.Checkpoint())
+	s.Equal([]byte{0xD, 0xE, 0xA, 0xD}, lastCell(reader))
+	commit([]byte{0xF, 0xE, 0xE, 0xD})
+	s.Equal([]byte{0xF, 0xE, 0xE, 0xD}, lastCell(reader))
+	s.NoError(wal.Checkpoint())
+	s.Equal([]byte{0xF, 0xE, 0xE, 0xD}, lastCell(reader))
+}
+
+// reservedFile is a page source configured with a reserved region
+type reservedFile struct {
+	*storage.MemoryFile
+	reserved int
+}
+
+func (f *reservedFile) ReservedSpace() int {
+	return f.reserved
+}
+
+func (s *PagerTestSuite) TestPager_ReservedSpace() {
+	const reserved = 64
+	file := &reservedFile{MemoryFile: storage.NewMemoryFile(testPageSize), reserved: reserved}
+	s.NoError(Initialize(file))
+	p := NewPager(file)
+
+	page, err := p.Allocate(PageTypeLeaf)
+	s.NoError(err)
+	s.Equal(testPageSize-reserved, int(page.header.CellsOffset))
+
+	cell := make([]byte, 500)
+	for page.Fits(len(cell)) {
+		page.AddCell(cell)
+	}
+	s.NoError(p.Flush())
+
+	// cells read back from the source also stay out of the reserved region
+	p.Reset()
+	page, err = p.Read(1)
+	s.NoError(err)
+	s.Equal(testPageSize-reserved, page.UsableSize())
+	s.Equal(testPageSize-reserved, int(page.header.CellsOffset))
+	s.False(page.Fits(testPageSize - reserved))
+}
+
 func blankMemPage(pageType PageType) *MemPage {
 	p := &MemPage{
 		header:     NewPageHeader(pageType, testPageSize),
@@ -90,3 +313,51 @@ func blankMemPage(pageType PageType) *MemPage {
 	}
 	return p
 }
+
+func (s *PagerTestSuite) TestPager_EvictLeastRecentlyUsed() {
+	const cachePages = 10
+	file := storage.NewMemoryFile(testPageSize)
+	s.NoError(Initialize(file))
+	p := NewPagerWithCache(file, cachePages).(*pager)
+
+	root, err := p.Allocate(PageTypeLeaf)
+	s.NoError(err)
+
+	// Fill about 100 pages of the table
+	table := NewBTreeTable(root.Number(), p)
+	const count = 900
+	for i := 1; i <= count; i++ {
+		s.NoError(table.Insert(storage.NewRecord(uint32(i), []*storage.Field{
+			{Type: storage.Text, Data: strings.Repeat("x", 400)},
+		})))
+	}
+
+	// Dirty pages stay cached until flushed
+	_, _, evictions := p.CacheStats()
+	s.Equal(0, evictions)
+	s.Greater(len(p.pageCache), cachePages)
+
+	s.NoError(p.Flush())
+	s.Greater(file.TotalPages(), 100)
+	s.Len(p.pageCache, cachePages)
+
+	// Scanning the table reads the evicted pages again
+	_, missesBefore, _ := p.CacheStats()
+	cursor, err := NewCursor(p, CURSOR_READ, root.Number(), "table")
+	s.NoError(err)
+	seen := 0
+	for ok, err := cursor.Rewind(); ok; ok, err = cursor.Next() {
+		s.NoError(err)
+		record, err := cursor.CurrentCell()
+		s.NoError(err)
+		s.Equal(uint32(seen+1), record.RowID)
+		seen++
+	}
+	s.Equal(count, seen)
+
+	hits, misses, evictions := p.CacheStats()
+	s.Greater(hits, 0)
+	s.Greater(misses-missesBefore, 90)
+	s.Greater(evictions, 90)
+	s.LessOrEqual(len(p.pageCache), cachePages)
+}
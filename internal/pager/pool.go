@@ -43,3 +43,8 @@ func (p *Pool) Release(connectionID int) {
 		<-p.writeSema
 	}
 }
+
+// Flush flushes the dirty pages of the pooled pager
+func (p *Pool) Flush() error {
+	return p.pager.Flush()
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	backend2 "github.com/joeandaverde/tinydb/internal/backend"
+	"math"
 	"net"
 	"strconv"
 	"sync"
@@ -29,6 +30,8 @@ type (
 
 const (
 	ResponseError          Response = 'E'
+	ResponseConflict       Response = 'X'
+	ResponseTimeout        Response = 'T'
 	ResponseCompleted      Response = 'C'
 	ResponseRowData        Response = 'D'
 	ResponseRowDescription Response = 'B'
@@ -41,6 +44,28 @@ const (
 	ControlExecute  Control = 'E'
 	ControlQuery    Control = 'Q'
 	ControlNext     Control = 'N'
+	ControlClose    Control = 'C'
+	ControlCancel   Control = 'X'
+)
+
+// QueryFlag is a bit set following the text of a simple query
+type QueryFlag byte
+
+const (
+	// QueryInlineRows sends every row of the result after its description
+	// and then completes, without waiting for a NEXT for each row
+	QueryInlineRows QueryFlag = 1 << iota
+)
+
+// ValueType tags each value of row data
+type ValueType byte
+
+const (
+	ValueNull  ValueType = 'N'
+	ValueInt   ValueType = 'I'
+	ValueFloat ValueType = 'F'
+	ValueText  ValueType = 'T'
+	ValueBlob  ValueType = 'B'
 )
 
 var errNoMoreRows = errors.New("end of result")
@@ -55,8 +80,14 @@ func (c Control) String() string {
 		return "CONTROL_QUERY"
 	case ControlDescribe:
 		return "CONTROL_DESCRIBE"
+	case ControlBind:
+		return "CONTROL_BIND"
 	case ControlNext:
 		return "CONTROL_NEXT"
+	case ControlClose:
+		return "CONTROL_CLOSE"
+	case ControlCancel:
+		return "CONTROL_CANCEL"
 	default:
 		return strconv.Itoa(int(c))
 	}
@@ -73,6 +104,18 @@ type Connection struct {
 	preparedCache map[string]*virtualmachine.PreparedStatement
 	proc          *backend2.ProgramInstance
 
+	// cancel cancels the executing statement, it is guarded by cancelMu
+	// rather than the connection as a statement is canceled while a
+	// command is handled
+	cancel   context.CancelFunc
+	cancelMu sync.Mutex
+
+	// bound holds the parameters bound to a prepared statement for its next execution
+	bound map[string][]interface{}
+
+	// explained holds the rows of an explained statement not yet sent
+	explained [][]interface{}
+
 	recvBuffer [512]byte
 	sendBuffer [512]byte
 }
@@ -83,6 +126,7 @@ func NewConnection(logger logrus.FieldLogger, p pager.Pager, conn net.Conn) *Con
 		log:           logger,
 		pager:         p,
 		preparedCache: make(map[string]*virtualmachine.PreparedStatement),
+		bound:         make(map[string][]interface{}),
 		backend:       backend2.NewBackend(logger, p),
 	}
 }
@@ -102,77 +146,154 @@ func (c *Connection) Handle(ctx context.Context, cmd Command) error {
 		c.log.Debugf("preparing: %s @ %s", name, text)
 		stmt, err := c.backend.Prepare(text)
 		if err != nil {
-			if err := c.writeByte(ResponseError); err != nil {
-				return err
-			}
-			return nil
+			return c.writeError(err.Error())
 		}
 
 		// cache for subsequent execution
 		c.preparedCache[name] = stmt
 
+		// let the client know how many parameters to bind
 		if err := c.writeByte(ResponseCompleted); err != nil {
 			return err
 		}
-		return nil
+		return c.writeUint32(uint32(stmt.ParamCount))
+
+	case ControlBind:
+		n, name := c.readString(cmd.Payload)
+		stmt, ok := c.preparedCache[name]
+		if !ok {
+			return c.writeError("prepared statement not found")
+		}
+
+		params, err := c.readParams(cmd.Payload[n:])
+		if err != nil {
+			return c.writeError(err.Error())
+		}
+		if err := stmt.CheckParams(len(params)); err != nil {
+			return c.writeError(err.Error())
+		}
+
+		// the parameters are used by the next execution of the statement
+		c.bound[name] = params
+		return c.writeByte(ResponseCompleted)
 
 	case ControlExecute:
 		_, name := c.readString(cmd.Payload)
 		stmt, ok := c.preparedCache[name]
 		if !ok {
-			return fmt.Errorf("prepared statement not found")
+			return c.writeError("prepared statement not found")
+		}
+
+		params := c.bound[name]
+		delete(c.bound, name)
+		if err := stmt.CheckParams(len(params)); err != nil {
+			return c.writeError(err.Error())
 		}
 
-		return c.exec(ctx, name, stmt)
+		return c.exec(ctx, name, stmt, params)
+
+	case ControlDescribe:
+		_, name := c.readString(cmd.Payload)
+		stmt, ok := c.preparedCache[name]
+		if !ok {
+			return c.writeError("prepared statement not found")
+		}
+
+		if err := c.writeByte(ResponseRowDescription); err != nil {
+			return err
+		}
+		return c.writeColumnMeta(stmt.ColumnMeta)
 
 	case ControlQuery:
-		_, commandText := c.readString(cmd.Payload)
+		// query payload: <uint32:len sql><utf-8:sql>[<byte:flags>]
+		n, commandText := c.readString(cmd.Payload)
+		var flags QueryFlag
+		if len(cmd.Payload) > n {
+			flags = QueryFlag(cmd.Payload[n])
+		}
 
 		stmt, err := c.backend.Prepare(commandText)
 		if err != nil {
-			return err
+			return c.writeError(err.Error())
 		}
 
-		return c.exec(ctx, "(unnamed)", stmt)
+		if err := stmt.CheckParams(0); err != nil {
+			return c.writeError(err.Error())
+		}
 
-	case ControlNext:
-		if c.proc == nil {
-			return errors.New("unexpected next when no statement is executing")
+		if err := c.exec(ctx, "(unnamed)", stmt, nil); err != nil {
+			return err
+		}
+		if flags&QueryInlineRows == 0 || !(stmt.Explain || stmt.ReturnsRows()) {
+			return nil
 		}
 
-		data, err := c.next(ctx, c.proc)
-		if err != nil {
-			if err == errNoMoreRows {
-				c.log.Debug("no more rows")
-				return c.writeByte(ResponseCompleted)
+		// send the rows right away rather than as each is asked for
+		for {
+			done, err := c.writeNext(ctx)
+			if err != nil || done {
+				return err
 			}
-			return fmt.Errorf("error getting next: %w", err)
 		}
 
-		c.log.Debug("writing row data")
-		if err := c.writeByte(ResponseRowData); err != nil {
-			return err
-		}
-		if err := c.writeColumns(data); err != nil {
-			return err
+	case ControlNext:
+		_, err := c.writeNext(ctx)
+		return err
+
+	case ControlClose:
+		// close payload: <uint32:len name><utf-8:name>
+		_, name := c.readString(cmd.Payload)
+
+		// the statement is freed, executing it again requires a new PARSE
+		delete(c.preparedCache, name)
+		delete(c.bound, name)
+		return c.writeByte(ResponseCompleted)
+
+	case ControlCancel:
+		// the executing statement stops and its remaining rows are discarded
+		c.Interrupt()
+		if c.proc != nil {
+			for range c.proc.Output {
+			}
+			<-c.proc.Exit
 		}
-		return nil
+		c.explained = nil
+		return c.writeByte(ResponseCompleted)
 
 	default:
 		return fmt.Errorf("unknown control character: %d", cmd.Control)
 	}
 }
 
-func (c *Connection) exec(ctx context.Context, name string, stmt *virtualmachine.PreparedStatement) error {
+func (c *Connection) exec(ctx context.Context, name string, stmt *virtualmachine.PreparedStatement, params []interface{}) error {
 	c.log.Debugf("statement: %s", name)
 
-	proc, err := c.backend.Exec(ctx, stmt)
+	// The instructions of an explained statement are sent as its rows
+	// without running it
+	if stmt.Explain {
+		c.explained = stmt.ExplainRows()
+		if err := c.writeByte(ResponseRowDescription); err != nil {
+			return err
+		}
+		return c.writeStringColumns(stmt.Columns)
+	}
+
+	// a statement still sending rows is canceled by the next
+	c.Interrupt()
+
+	stmtCtx, cancel := context.WithCancel(ctx)
+	c.cancelMu.Lock()
+	c.cancel = cancel
+	c.cancelMu.Unlock()
+
+	proc, err := c.backend.Exec(stmtCtx, stmt, params...)
 	if err != nil {
+		c.Interrupt()
 		return fmt.Errorf("error executing statement: %w", err)
 	}
 	c.proc = proc
 
-	if stmt.Statement.ReturnsRows() {
+	if stmt.ReturnsRows() {
 		if err := c.writeByte(ResponseRowDescription); err != nil {
 			return err
 		}
@@ -183,6 +304,7 @@ func (c *Connection) exec(ctx context.Context, name string, stmt *virtualmachine
 		return nil
 	}
 
+	defer c.Interrupt()
 	defer func() { c.proc = nil }()
 
 	// Not returning rows, wait for query to complete
@@ -190,6 +312,17 @@ func (c *Connection) exec(ctx context.Context, name string, stmt *virtualmachine
 	case <-ctx.Done():
 		return ctx.Err()
 	case err := <-proc.Exit:
+		if errors.Is(err, pager.ErrConflict) {
+			// the transaction was rolled back, the client may retry
+			return c.writeByte(ResponseConflict)
+		}
+		if errors.Is(err, backend2.ErrStatementTimeout) {
+			return c.writeByte(ResponseTimeout)
+		}
+		if errors.Is(err, context.Canceled) {
+			// the client canceled the statement, which was rolled back
+			return c.writeError("canceling statement due to user request")
+		}
 		if err != nil {
 			return err
 		}
@@ -201,6 +334,72 @@ func (c *Connection) exec(ctx context.Context, name string, stmt *virtualmachine
 	return nil
 }
 
+// Interrupt cancels the executing statement. Unlike Handle it may be called
+// while a command is handled, a CANCEL is received while the statement it
+// cancels runs.
+func (c *Connection) Interrupt() {
+	c.cancelMu.Lock()
+	defer c.cancelMu.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+// writeNext sends the next row of the executing statement, or completes
+// the statement when it has no more rows. done reports whether the
+// statement was completed.
+func (c *Connection) writeNext(ctx context.Context) (done bool, err error) {
+	if c.explained != nil {
+		return c.nextExplained()
+	}
+
+	if c.proc == nil {
+		return false, errors.New("unexpected next when no statement is executing")
+	}
+
+	data, err := c.next(ctx, c.proc)
+	if err != nil {
+		if err == errNoMoreRows {
+			c.log.Debug("no more rows")
+
+			// the rows end early when the statement is canceled or fails
+			exitErr := <-c.proc.Exit
+			if errors.Is(exitErr, backend2.ErrStatementTimeout) {
+				return true, c.writeByte(ResponseTimeout)
+			}
+			if exitErr != nil {
+				return true, c.writeError(exitErr.Error())
+			}
+			return true, c.writeByte(ResponseCompleted)
+		}
+		return false, fmt.Errorf("error getting next: %w", err)
+	}
+
+	c.log.Debug("writing row data")
+	if err := c.writeByte(ResponseRowData); err != nil {
+		return false, err
+	}
+	return false, c.writeColumns(data)
+}
+
+// nextExplained sends the next row of an explained statement
+func (c *Connection) nextExplained() (bool, error) {
+	if len(c.explained) == 0 {
+		c.explained = nil
+		c.log.Debug("no more rows")
+		return true, c.writeByte(ResponseCompleted)
+	}
+
+	data := c.explained[0]
+	c.explained = c.explained[1:]
+	if err := c.writeByte(ResponseRowData); err != nil {
+		return false, err
+	}
+	return false, c.writeColumns(data)
+}
+
 // next returns the next result from the program instance or an error
 // indicating that the result is complete.
 func (c *Connection) next(ctx context.Context, p *backend2.ProgramInstance) ([]interface{}, error) {
@@ -215,6 +414,48 @@ func (c *Connection) next(ctx context.Context, p *backend2.ProgramInstance) ([]i
 	}
 }
 
+// readParams reads the parameters following the name of a statement to
+// bind: <uint32:count>(<byte:type><uint32:len><payload>)*. Each value is
+// encoded as in row data.
+func (c *Connection) readParams(data []byte) ([]interface{}, error) {
+	if len(data) < 4 {
+		return nil, errors.New("malformed bind: missing parameter count")
+	}
+
+	count := binary.BigEndian.Uint32(data[:4])
+	data = data[4:]
+
+	params := make([]interface{}, 0, count)
+	for i := 0; i < int(count); i++ {
+		if len(data) < 5 || len(data[5:]) < int(binary.BigEndian.Uint32(data[1:5])) {
+			return nil, errors.New("malformed bind: truncated parameter")
+		}
+		typ := ValueType(data[0])
+		payload := data[5:][:binary.BigEndian.Uint32(data[1:5])]
+		data = data[5+len(payload):]
+
+		if (typ == ValueInt || typ == ValueFloat) && len(payload) != 8 {
+			return nil, errors.New("malformed bind: numeric parameters are 8 bytes")
+		}
+
+		switch typ {
+		case ValueNull:
+			params = append(params, nil)
+		case ValueInt:
+			params = append(params, int(int64(binary.BigEndian.Uint64(payload))))
+		case ValueFloat:
+			params = append(params, math.Float64frombits(binary.BigEndian.Uint64(payload)))
+		case ValueText:
+			params = append(params, string(payload))
+		case ValueBlob:
+			params = append(params, append([]byte(nil), payload...))
+		default:
+			return nil, fmt.Errorf("malformed bind: unexpected parameter type %d", typ)
+		}
+	}
+	return params, nil
+}
+
 func (c *Connection) readString(data []byte) (int, string) {
 	textLen := binary.BigEndian.Uint32(data[:4])
 	text := string(data[4:][:textLen])
@@ -222,6 +463,9 @@ func (c *Connection) readString(data []byte) (int, string) {
 
 }
 
+// writeColumns writes the values of a row, each value is a type tag
+// followed by a length-prefixed payload: <byte:type><uint32:len><payload>.
+// Integers and floats are 8 bytes big-endian and NULL has no payload.
 func (c *Connection) writeColumns(data []interface{}) error {
 	// write out number of columns to come
 	if err := c.writeUint32(uint32(len(data))); err != nil {
@@ -229,19 +473,43 @@ func (c *Connection) writeColumns(data []interface{}) error {
 	}
 
 	for _, d := range data {
+		var err error
 		switch v := d.(type) {
+		case nil:
+			err = c.writeValue(ValueNull, nil)
+		case int:
+			binary.BigEndian.PutUint64(c.sendBuffer[8:16], uint64(v))
+			err = c.writeValue(ValueInt, c.sendBuffer[8:16])
+		case float64:
+			binary.BigEndian.PutUint64(c.sendBuffer[8:16], math.Float64bits(v))
+			err = c.writeValue(ValueFloat, c.sendBuffer[8:16])
 		case string:
-			if err := c.writeString(v); err != nil {
-				return err
-			}
+			err = c.writeValue(ValueText, []byte(v))
+		case []byte:
+			err = c.writeValue(ValueBlob, v)
 		default:
 			return errors.New("error getting next: unsupported type")
 		}
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func (c *Connection) writeValue(typ ValueType, payload []byte) error {
+	c.sendBuffer[0] = byte(typ)
+	if _, err := c.Write(c.sendBuffer[:1]); err != nil {
+		return err
+	}
+	if err := c.writeUint32(uint32(len(payload))); err != nil {
+		return err
+	}
+	_, err := c.Write(payload)
+	return err
+}
+
 func (c *Connection) writeStringColumns(data []string) error {
 	// write out number of columns to come
 	if err := c.writeUint32(uint32(len(data))); err != nil {
@@ -257,6 +525,33 @@ func (c *Connection) writeStringColumns(data []string) error {
 	return nil
 }
 
+// writeColumnMeta writes the name, type and nullability of each column
+func (c *Connection) writeColumnMeta(columns []virtualmachine.ColumnMeta) error {
+	// write out number of columns to come
+	if err := c.writeUint32(uint32(len(columns))); err != nil {
+		return err
+	}
+
+	for _, col := range columns {
+		if err := c.writeString(col.Name); err != nil {
+			return err
+		}
+		if err := c.writeString(col.Type.String()); err != nil {
+			return err
+		}
+
+		c.sendBuffer[0] = 0
+		if col.Nullable {
+			c.sendBuffer[0] = 1
+		}
+		if _, err := c.Write(c.sendBuffer[:1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *Connection) writeString(s string) error {
 	if err := c.writeUint32(uint32(len(s))); err != nil {
 		return err
@@ -275,6 +570,14 @@ func (c *Connection) writeUint32(n uint32) error {
 	return err
 }
 
+// writeError responds with an error followed by its message
+func (c *Connection) writeError(message string) error {
+	if err := c.writeByte(ResponseError); err != nil {
+		return err
+	}
+	return c.writeString(message)
+}
+
 func (c *Connection) writeByte(b Response) error {
 	c.sendBuffer[0] = byte(b)
 	_, err := c.Write(c.sendBuffer[:1])
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/internal/backend"
+)
+
+// recordingConn collects the responses written to a connection
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (r *recordingConn) Write(b []byte) (int, error) {
+	return r.written.Write(b)
+}
+
+func TestConnection_Close(t *testing.T) {
+	r := require.New(t)
+
+	engine, err := backend.Start(logrus.New(), backend.Config{PageSize: 4096, InMemory: true})
+	r.NoError(err)
+
+	rc := &recordingConn{}
+	conn := NewConnection(logrus.New(), engine.NewPager(), rc)
+
+	handle := func(ctrl Control, payload []byte) []byte {
+		rc.written.Reset()
+		r.NoError(conn.Handle(context.Background(), Command{Control: ctrl, Payload: payload}))
+		return rc.written.Bytes()
+	}
+
+	res := handle(ControlQuery, packString("CREATE TABLE notebooks (name text)"))
+	r.Equal([]byte{byte(ResponseCompleted)}, res)
+
+	res = handle(ControlParse, append(packString("SELECT name FROM notebooks"), packString("stmt1")...))
+	r.Equal(byte(ResponseCompleted), res[0])
+	r.Contains(conn.preparedCache, "stmt1")
+
+	res = handle(ControlClose, packString("stmt1"))
+	r.Equal([]byte{byte(ResponseCompleted)}, res)
+	r.NotContains(conn.preparedCache, "stmt1")
+
+	// executing the closed statement is an error
+	res = handle(ControlExecute, packString("stmt1"))
+	r.Equal(byte(ResponseError), res[0])
+	r.Contains(string(res), "prepared statement not found")
+
+	// closing an unknown statement is not an error
+	res = handle(ControlClose, packString("stmt1"))
+	r.Equal([]byte{byte(ResponseCompleted)}, res)
+}
+
+// packString packs a length-prefixed string as sent by clients
+func packString(s string) []byte {
+	packed := make([]byte, 4, 4+len(s))
+	binary.BigEndian.PutUint32(packed, uint32(len(s)))
+	return append(packed, s...)
+}
@@ -62,7 +62,26 @@ func (s *Server) Handle(conn net.Conn, engine *backend.Engine) {
 	dbConn := NewConnection(s.log, engine.NewPager(), conn)
 	defer dbConn.Close()
 
+	// Commands are read while the previous is handled so that a CANCEL
+	// reaches the statement it cancels
+	commands := make(chan Command)
+	done := make(chan struct{})
+	defer close(done)
+	go s.read(dbConn, commands, done)
+
 	// TODO: handle errors gracefully rather than closing connection
+	for cmd := range commands {
+		if err := dbConn.Handle(context.Background(), cmd); err != nil {
+			s.log.WithError(err).Error("terminating connection: error handling command")
+			return
+		}
+	}
+}
+
+// read reads the commands of a connection until it is closed or done
+func (s *Server) read(dbConn *Connection, commands chan<- Command, done <-chan struct{}) {
+	defer close(commands)
+
 	for {
 		// 1 byte for control
 		// 4 bytes for payload length
@@ -88,12 +107,20 @@ func (s *Server) Handle(conn net.Conn, engine *backend.Engine) {
 			}
 		}
 
-		// handle the command
-		if err := dbConn.Handle(context.Background(), Command{
+		// the statement is canceled right away, the command is then
+		// handled in turn to respond to it
+		if control == ControlCancel {
+			dbConn.Interrupt()
+		}
+
+		// the payload is copied as the buffer is read into for the next command
+		cmd := Command{
 			Control: control,
-			Payload: dbConn.recvBuffer[:payloadLen],
-		}); err != nil {
-			s.log.WithError(err).Error("terminating connection: error handling command")
+			Payload: append([]byte(nil), dbConn.recvBuffer[:payloadLen]...),
+		}
+		select {
+		case commands <- cmd:
+		case <-done:
 			return
 		}
 	}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ReaderWriterAt is random access storage, e.g. an *os.File or a client for
+// an object store supporting ranged reads and writes.
+type ReaderWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// BlockFile keeps each page at a fixed offset of a ReaderWriterAt
+type BlockFile struct {
+	rw         ReaderWriterAt
+	pageSize   int
+	totalPages int
+
+	mu *sync.RWMutex
+}
+
+// NewBlockFile creates a page source over storage already holding totalPages pages
+func NewBlockFile(rw ReaderWriterAt, pageSize int, totalPages int) *BlockFile {
+	return &BlockFile{
+		rw:         rw,
+		pageSize:   pageSize,
+		totalPages: totalPages,
+		mu:         &sync.RWMutex{},
+	}
+}
+
+func (f *BlockFile) PageSize() int {
+	return f.pageSize
+}
+
+func (f *BlockFile) ReservedSpace() int {
+	return 0
+}
+
+func (f *BlockFile) TotalPages() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.totalPages
+}
+
+func (f *BlockFile) Read(page int) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if page < 1 || page > f.totalPages {
+		return nil, fmt.Errorf("page does not exist: %d", page)
+	}
+
+	data := make([]byte, f.pageSize)
+	n, err := f.rw.ReadAt(data, f.pageOffset(page))
+	// ReadAt may report io.EOF along with a full read of the last page
+	if err != nil && !(err == io.EOF && n == len(data)) {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (f *BlockFile) Write(pages ...Page) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, page := range pages {
+		if page.PageNumber > f.totalPages+1 {
+			return errors.New("cannot grow the db file with a gap in pages")
+		}
+
+		if _, err := f.rw.WriteAt(page.Data[:f.pageSize], f.pageOffset(page.PageNumber)); err != nil {
+			return err
+		}
+
+		if page.PageNumber > f.totalPages {
+			f.totalPages = page.PageNumber
+		}
+	}
+
+	return nil
+}
+
+func (f *BlockFile) pageOffset(page int) int64 {
+	return int64(page-1) * int64(f.pageSize)
+}
+
+var _ File = (*BlockFile)(nil)
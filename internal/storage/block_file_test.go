@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBlocks is random access storage held in memory
+type memoryBlocks struct {
+	data []byte
+}
+
+func (m *memoryBlocks) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memoryBlocks) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func TestBlockFile_ReadWrite(t *testing.T) {
+	assert := require.New(t)
+	f := NewBlockFile(&memoryBlocks{}, 1024, 0)
+
+	page1 := make([]byte, 1024)
+	page1[0] = 1
+	page2 := make([]byte, 1024)
+	page2[1023] = 2
+	assert.NoError(f.Write(Page{PageNumber: 1, Data: page1}, Page{PageNumber: 2, Data: page2}))
+	assert.Equal(2, f.TotalPages())
+
+	data, err := f.Read(2)
+	assert.NoError(err)
+	assert.Equal(page2, data)
+
+	data, err = f.Read(1)
+	assert.NoError(err)
+	assert.Equal(page1, data)
+
+	_, err = f.Read(3)
+	assert.Error(err)
+}
+
+func TestBlockFile_Gap(t *testing.T) {
+	assert := require.New(t)
+	f := NewBlockFile(&memoryBlocks{}, 1024, 0)
+
+	assert.Error(f.Write(Page{PageNumber: 2, Data: make([]byte, 1024)}))
+	assert.Equal(0, f.TotalPages())
+}
@@ -10,6 +10,8 @@ import (
 type FileHeader struct {
 	// 16-17	PageSize	uint16	Size of database page
 	PageSize uint16
+	// 20	ReservedSpace	uint8	Bytes of unused "reserved" space at the end of each page.
+	ReservedSpace uint8
 	// 24-27	FileChangeCounter	uint32	Initialized to 0. Each time a modification is made to the database, this counter is increased.
 	FileChangeCounter uint32
 	// 40-43	SchemaVersion	uint32	Initialized to 0. Each time the database schema is modified, this counter is increased.
@@ -18,6 +20,10 @@ type FileHeader struct {
 	SizeInPages uint32
 }
 
+// SchemaCookieOffset is the offset of the schema version within the
+// header, which is kept in the first 100 bytes of page 1
+const SchemaCookieOffset = 40
+
 // NewFileHeader creates a new FileHeader
 func NewFileHeader(pageSize uint16) FileHeader {
 	return FileHeader{
@@ -49,7 +55,7 @@ func (h FileHeader) WriteTo(w io.Writer) (int64, error) {
 	// 19	1	File format read version. 1 for legacy; 2 for WAL.
 	data[19] = 1
 	// 20	1	Bytes of unused "reserved" space at the end of each page. Usually 0.
-	data[20] = 0
+	data[20] = h.ReservedSpace
 	// 21	1	Maximum embedded payload fraction. Must be 64.
 	data[21] = 64
 	// 22	1	Minimum embedded payload fraction. Must be 32.
@@ -84,6 +90,7 @@ func ParseFileHeader(buf []byte) (FileHeader, error) {
 
 	return FileHeader{
 		PageSize:          binary.BigEndian.Uint16(buf[16:18]),
+		ReservedSpace:     buf[20],
 		FileChangeCounter: binary.BigEndian.Uint32(buf[24:28]),
 		SizeInPages:       binary.BigEndian.Uint32(buf[28:32]),
 		SchemaVersion:     binary.BigEndian.Uint32(buf[40:44]),
@@ -61,3 +61,44 @@ func ReadInteriorNode(data []byte) (*InteriorNode, error) {
 
 	return &InteriorNode{LeftChild: leftChild, Key: uint32(key)}, nil
 }
+
+// IndexInteriorNode is a cell of an interior index page. Key is the
+// largest entry of the left child.
+type IndexInteriorNode struct {
+	LeftChild uint32
+	Key       *Record
+}
+
+// ToBytes serializes an index interior node to a byte slice
+func (r IndexInteriorNode) ToBytes() ([]byte, error) {
+	buf := bytes.Buffer{}
+
+	// Write the child page
+	if err := binary.Write(&buf, binary.BigEndian, r.LeftChild); err != nil {
+		return nil, err
+	}
+
+	// Write the key
+	if err := r.Key.Write(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReadIndexInteriorNode parses an index interior node from a byte slice
+func ReadIndexInteriorNode(data []byte) (*IndexInteriorNode, error) {
+	reader := bytes.NewReader(data)
+
+	var leftChild uint32
+	if err := binary.Read(reader, binary.BigEndian, &leftChild); err != nil {
+		return nil, err
+	}
+
+	key, err := ReadRecord(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IndexInteriorNode{LeftChild: leftChild, Key: key}, nil
+}
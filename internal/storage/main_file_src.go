@@ -1,17 +1,29 @@
 package storage
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"os"
 	"sync"
 )
 
+// File is a page source that can be read from and written to
 type File interface {
 	PageReader
 	PageWriter
 }
 
+// Versioned is a page source that numbers the writes committed to it, so
+// that readers caching its pages can tell which of them have changed.
+type Versioned interface {
+	// Version is the number of writes committed
+	Version() uint64
+	// PageVersion is the version of the write that last changed a page,
+	// 0 when the page has not changed since the source was opened
+	PageVersion(page int) uint64
+}
+
 type DbFile struct {
 	path       string
 	header     FileHeader
@@ -68,6 +80,11 @@ func (f *DbFile) PageSize() int {
 	return f.pageSize
 }
 
+// ReservedSpace is the number of bytes reserved at the end of each page
+func (f *DbFile) ReservedSpace() int {
+	return int(f.header.ReservedSpace)
+}
+
 func (f *DbFile) TotalPages() int {
 	return f.totalPages
 }
@@ -92,6 +109,11 @@ func (f *DbFile) Read(page int) ([]byte, error) {
 		return nil, err
 	}
 
+	// The schema cookie is the only field of the header kept in page 1
+	if page == 1 {
+		binary.BigEndian.PutUint32(data[SchemaCookieOffset:], f.header.SchemaVersion)
+	}
+
 	return data, nil
 }
 
@@ -116,6 +138,7 @@ func (f *DbFile) Write(pages ...Page) error {
 		readOffset := 0
 		if page.PageNumber == 1 {
 			readOffset = 100
+			f.header.SchemaVersion = binary.BigEndian.Uint32(page.Data[SchemaCookieOffset:])
 		}
 
 		if _, err := f.file.Write(page.Data[readOffset:]); err != nil {
@@ -1,34 +1,63 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 type MemoryFile struct {
+	mu       *sync.RWMutex
 	pageSize int
 	data     []byte
+
+	version      uint64
+	pageVersions map[int]uint64
 }
 
 func NewMemoryFile(pageSize int) *MemoryFile {
-	return &MemoryFile{pageSize: pageSize}
+	return &MemoryFile{
+		mu:           &sync.RWMutex{},
+		pageSize:     pageSize,
+		pageVersions: make(map[int]uint64),
+	}
 }
 
 func (m *MemoryFile) PageSize() int {
 	return m.pageSize
 }
 
+func (m *MemoryFile) ReservedSpace() int {
+	return 0
+}
+
 func (m *MemoryFile) TotalPages() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return len(m.data) / m.pageSize
 }
 
 func (m *MemoryFile) Read(page int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	offset := (page - 1) * m.pageSize
 	if offset+m.pageSize > len(m.data) {
 		return nil, fmt.Errorf("page does not exist: %d", page)
 	}
-	return m.data[offset:][:m.pageSize], nil
+	dest := make([]byte, m.pageSize)
+	copy(dest, m.data[offset:][:m.pageSize])
+	return dest, nil
 }
 
 func (m *MemoryFile) Write(pages ...Page) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.version++
 	for _, p := range pages {
+		m.pageVersions[p.PageNumber] = m.version
+
 		offset := (p.PageNumber - 1) * m.pageSize
 		// crudely expand memory linearly
 		for offset >= len(m.data) {
@@ -41,4 +70,19 @@ func (m *MemoryFile) Write(pages ...Page) error {
 	return nil
 }
 
+func (m *MemoryFile) Version() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.version
+}
+
+func (m *MemoryFile) PageVersion(page int) uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.pageVersions[page]
+}
+
 var _ File = (*MemoryFile)(nil)
+var _ Versioned = (*MemoryFile)(nil)
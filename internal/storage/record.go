@@ -5,7 +5,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"strings"
 )
 
 type SQLType uint32
@@ -14,23 +16,48 @@ const (
 	Null    = 0
 	Byte    = 1
 	Integer = 4
+	Float   = 7
+	Blob    = 12
 	Text    = 28
 	Unknown = 999
 )
 
 func SQLTypeFromString(t string) (SQLType, error) {
-	switch t {
+	switch strings.ToLower(t) {
 	case "text":
 		return Text, nil
-	case "int":
+	case "int", "integer", "bigint":
 		return Integer, nil
 	case "byte":
 		return Byte, nil
+	case "float", "real":
+		return Float, nil
+	case "blob":
+		return Blob, nil
 	default:
 		return Unknown, fmt.Errorf("unexpected SQL string type")
 	}
 }
 
+func (t SQLType) String() string {
+	switch t {
+	case Null:
+		return "null"
+	case Byte:
+		return "byte"
+	case Integer:
+		return "int"
+	case Float:
+		return "float"
+	case Text:
+		return "text"
+	case Blob:
+		return "blob"
+	default:
+		return "unknown"
+	}
+}
+
 // Field is a field in a database record
 type Field struct {
 	Type SQLType
@@ -73,16 +100,26 @@ func (r Record) Write(bs io.ByteWriter) error {
 		}
 
 		switch f.Type {
-		case Byte:
-			colBuf.WriteByte(1)
-		case Integer:
-			colBuf.WriteByte(4)
+		case Byte, Integer:
+			v, ok := integerValue(f.Data)
+			if !ok {
+				return fmt.Errorf("not supported integer type: %v", reflect.TypeOf(f.Data))
+			}
+			colBuf.WriteByte(byte(integerSerialType(v)))
+		case Float:
+			colBuf.WriteByte(7)
 		case Text:
 			fieldSize := uint64(2*len(f.Data.(string)) + 13)
 			_, err := WriteVarint(&colBuf, fieldSize)
 			if err != nil {
 				return fmt.Errorf("unable to write varint")
 			}
+		case Blob:
+			fieldSize := uint64(2*len(f.Data.([]byte)) + 12)
+			_, err := WriteVarint(&colBuf, fieldSize)
+			if err != nil {
+				return fmt.Errorf("unable to write varint")
+			}
 		default:
 			return fmt.Errorf("Unknown sql type")
 		}
@@ -106,16 +143,21 @@ func (r Record) Write(bs io.ByteWriter) error {
 		}
 
 		switch f.Data.(type) {
-		case int8:
-			recordBuffer.Write([]byte{byte(f.Data.(int8))})
-		case byte:
-			recordBuffer.Write([]byte{f.Data.(byte)})
-		case int:
-			if err := binary.Write(&recordBuffer, binary.BigEndian, uint32(f.Data.(int))); err != nil {
+		case int8, byte, int:
+			v, _ := integerValue(f.Data)
+			width := integerWidths[integerSerialType(v)-1]
+			for i := width - 1; i >= 0; i-- {
+				recordBuffer.WriteByte(byte(v >> (8 * i)))
+			}
+		case float64:
+			// IEEE-754 64 bit float, big-endian like integers
+			if err := binary.Write(&recordBuffer, binary.BigEndian, math.Float64bits(f.Data.(float64))); err != nil {
 				return err
 			}
 		case string:
 			recordBuffer.Write([]byte(f.Data.(string)))
+		case []byte:
+			recordBuffer.Write(f.Data.([]byte))
 		default:
 			return fmt.Errorf("not supported type: %v", reflect.TypeOf(f.Data))
 		}
@@ -167,10 +209,9 @@ func NewMasterTableRecord(rowID uint32, typeName string, name string, tableName
 			Data: tableName,
 		},
 		{
-			Type: Byte,
-			// TODO: this seems to be optimized from int to a byte by sqlite for early pages
+			Type: Integer,
 			// rootpage: integer
-			Data: byte(rootPage),
+			Data: rootPage,
 		},
 		{
 			Type: Text,
@@ -180,6 +221,44 @@ func NewMasterTableRecord(rowID uint32, typeName string, name string, tableName
 	})
 }
 
+// integerWidths are the sizes in bytes of the integers of serial types 1 to 6
+var integerWidths = []int{1, 2, 3, 4, 6, 8}
+
+// integerSerialType is the serial type of the narrowest signed integer
+// that holds v
+func integerSerialType(v int64) int {
+	for i, width := range integerWidths {
+		limit := int64(1) << (8*width - 1)
+		if width == 8 || (v >= -limit && v < limit) {
+			return i + 1
+		}
+	}
+	return len(integerWidths)
+}
+
+// integerValue widens the integer data of a field
+func integerValue(data interface{}) (int64, bool) {
+	switch v := data.(type) {
+	case int8:
+		return int64(v), true
+	case byte:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// readInteger reads a signed big-endian integer
+func readInteger(bs []byte) int {
+	v := int64(int8(bs[0]))
+	for _, b := range bs[1:] {
+		v = v<<8 | int64(b)
+	}
+	return int(v)
+}
+
 func ReadRecordHeader(r io.ByteReader) (uint64, uint64, error) {
 	recordSize, _, err := ReadVarint(r)
 	if err != nil {
@@ -215,28 +294,40 @@ func ReadRecord(r io.ByteReader) (*Record, error) {
 			return nil, err
 		}
 
+		// Serial types of the SQLite record format
 		var sqlType SQLType
+		var data interface{}
 		numBytes := 1
-		switch colType {
-		case 0:
+		switch {
+		case colType == 0:
 			// NULL
-		case 1:
-			sqlType = Byte
-			numBytes = 1
-		case 4:
+		case colType >= 1 && colType <= 6:
+			// 8, 16, 24, 32, 48 or 64 bit signed big-endian integer
 			sqlType = Integer
-			numBytes = 4
-		default:
-			// TODO: default for text isnt appropriate, it should be something like
-			// odd numbers greater than 12?
+			numBytes = integerWidths[colType-1]
+		case colType == 7:
+			// IEEE-754 64 bit float
+			sqlType = Float
+			numBytes = 8
+		case colType == 8 || colType == 9:
+			// the integer 0 or 1 with no data
+			sqlType = Integer
+			numBytes = 0
+			data = int(colType - 8)
+		case colType >= 12 && colType%2 == 0:
+			sqlType = Blob
+			numBytes = int(colType-12) / 2
+		case colType >= 13 && colType%2 == 1:
 			sqlType = Text
 			numBytes = int(colType-13) / 2
+		default:
+			return nil, fmt.Errorf("unsupported serial type: %d", colType)
 		}
 
 		fields = append(fields, &Field{
 			Type: sqlType,
 			Len:  numBytes,
-			Data: nil,
+			Data: data,
 		})
 
 		recordHeaderLen = recordHeaderLen - uint64(n)
@@ -244,16 +335,23 @@ func ReadRecord(r io.ByteReader) (*Record, error) {
 
 	for _, f := range fields {
 		switch f.Type {
-		case Byte:
-			b, _ := r.ReadByte()
-			f.Data = b
 		case Integer:
+			if f.Len == 0 {
+				continue
+			}
+			var bs []byte
+			for i := 0; i < f.Len; i++ {
+				b, _ := r.ReadByte()
+				bs = append(bs, b)
+			}
+			f.Data = readInteger(bs)
+		case Float:
 			var bs []byte
 			for i := 0; i < f.Len; i++ {
 				b, _ := r.ReadByte()
 				bs = append(bs, b)
 			}
-			f.Data = int(binary.BigEndian.Uint32(bs))
+			f.Data = math.Float64frombits(binary.BigEndian.Uint64(bs))
 		case Text:
 			var bs []byte
 			for i := 0; i < f.Len; i++ {
@@ -261,6 +359,12 @@ func ReadRecord(r io.ByteReader) (*Record, error) {
 				bs = append(bs, b)
 			}
 			f.Data = string(bs)
+		case Blob:
+			bs := make([]byte, f.Len)
+			for i := range bs {
+				bs[i], _ = r.ReadByte()
+			}
+			f.Data = bs
 		}
 	}
 
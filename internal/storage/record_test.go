@@ -21,3 +21,105 @@ func TestNewMasterTableRecord(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(expectedBytes, buf.Bytes())
 }
+
+func TestRecord_Float(t *testing.T) {
+	assert := require.New(t)
+
+	record := NewRecord(3, []*Field{
+		{Type: Float, Data: 3.25},
+		{Type: Integer, Data: 7},
+		{Type: Float, Data: -0.1},
+		{Type: Float, Data: nil},
+	})
+	buf := bytes.Buffer{}
+	assert.NoError(record.Write(&buf))
+
+	// the first float is 8 bytes big-endian following the header
+	bs := buf.Bytes()
+	assert.Equal([]byte{0x05, 0x07, 0x01, 0x07, 0x00}, bs[2:7])
+	assert.Equal([]byte{0x40, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, bs[7:15])
+
+	read, err := ReadRecord(&buf)
+	assert.NoError(err)
+	assert.Equal(uint32(3), read.RowID)
+	assert.Len(read.Fields, 4)
+	assert.Equal(SQLType(Float), read.Fields[0].Type)
+	assert.Equal(3.25, read.Fields[0].Data)
+	assert.Equal(7, read.Fields[1].Data)
+	assert.Equal(-0.1, read.Fields[2].Data)
+	assert.Nil(read.Fields[3].Data)
+}
+
+func TestRecord_Integer(t *testing.T) {
+	assert := require.New(t)
+
+	// Each integer is stored in the narrowest width that holds it
+	tests := []struct {
+		value      int
+		serialType byte
+		data       []byte
+	}{
+		{0, 1, []byte{0x00}},
+		{-1, 1, []byte{0xff}},
+		{127, 1, []byte{0x7f}},
+		{-128, 1, []byte{0x80}},
+		{128, 2, []byte{0x00, 0x80}},
+		{255, 2, []byte{0x00, 0xff}},
+		{-32769, 3, []byte{0xff, 0x7f, 0xff}},
+		{1<<31 - 1, 4, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{-1 << 31, 4, []byte{0x80, 0x00, 0x00, 0x00}},
+		{1 << 31, 5, []byte{0x00, 0x00, 0x80, 0x00, 0x00, 0x00}},
+		{-1 << 47, 5, []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{1 << 47, 6, []byte{0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{1<<63 - 1, 6, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{-1 << 63, 6, []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, test := range tests {
+		record := NewRecord(1, []*Field{{Type: Integer, Data: test.value}})
+		buf := bytes.Buffer{}
+		assert.NoError(record.Write(&buf))
+
+		bs := buf.Bytes()
+		assert.Equal(test.serialType, bs[3], "serial type of %d", test.value)
+		assert.Equal(test.data, bs[4:], "data of %d", test.value)
+
+		read, err := ReadRecord(&buf)
+		assert.NoError(err)
+		assert.Equal(SQLType(Integer), read.Fields[0].Type)
+		assert.Equal(test.value, read.Fields[0].Data)
+	}
+}
+
+func TestSQLTypeFromString_Float(t *testing.T) {
+	for _, name := range []string{"float", "REAL"} {
+		typ, err := SQLTypeFromString(name)
+		require.NoError(t, err)
+		require.Equal(t, SQLType(Float), typ)
+	}
+}
+
+func TestRecord_Blob(t *testing.T) {
+	assert := require.New(t)
+
+	record := NewRecord(5, []*Field{
+		{Type: Blob, Data: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{Type: Blob, Data: []byte{}},
+		{Type: Text, Data: "ab"},
+	})
+	buf := bytes.Buffer{}
+	assert.NoError(record.Write(&buf))
+
+	// a blob has an even serial type of twice its length plus 12
+	bs := buf.Bytes()
+	assert.Equal([]byte{0x04, 0x14, 0x0C, 0x11}, bs[2:6])
+	assert.Equal([]byte{0xde, 0xad, 0xbe, 0xef, 'a', 'b'}, bs[6:])
+
+	read, err := ReadRecord(&buf)
+	assert.NoError(err)
+	assert.Len(read.Fields, 3)
+	assert.Equal(SQLType(Blob), read.Fields[0].Type)
+	assert.Equal([]byte{0xde, 0xad, 0xbe, 0xef}, read.Fields[0].Data)
+	assert.Equal(SQLType(Blob), read.Fields[1].Type)
+	assert.Equal([]byte{}, read.Fields[1].Data)
+	assert.Equal("ab", read.Fields[2].Data)
+}
@@ -5,9 +5,21 @@ type Payload struct {
 	Record *Record
 }
 
+// PageReader reads fixed size pages from a page source. The pager only
+// depends on this interface and PageWriter so pages may be kept anywhere,
+// e.g. in a local file, in memory or in an object store.
 type PageReader interface {
+	// PageSize is the size in bytes of every page in the source
 	PageSize() int
+
+	// ReservedSpace is the number of bytes reserved at the end of each page
+	ReservedSpace() int
+
+	// TotalPages is the number of pages in the source
 	TotalPages() int
+
+	// Read returns a copy of a page. Pages are numbered starting at 1.
+	// Reading a page that was never written is an error.
 	Read(page int) ([]byte, error)
 }
 
@@ -16,6 +28,8 @@ type Page struct {
 	Data       []byte
 }
 
+// PageWriter writes full pages to a page source. Writing the page after the
+// last page grows the source by one page.
 type PageWriter interface {
 	Write(...Page) error
 }
@@ -37,3 +37,19 @@ func TestFileHeader_ReadHeader(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(h, result)
 }
+
+func TestFileHeader_ReservedSpace(t *testing.T) {
+	assert := require.New(t)
+	buf := bytes.Buffer{}
+	h := NewFileHeader(1024)
+	h.ReservedSpace = 32
+	_, err := h.WriteTo(&buf)
+	assert.NoError(err)
+
+	bs := buf.Bytes()
+	assert.Equal(byte(32), bs[20])
+
+	result, err := ParseFileHeader(bs)
+	assert.NoError(err)
+	assert.Equal(uint8(32), result.ReservedSpace)
+}
@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"hash/crc64"
+	"fmt"
 	"io"
 	"math/rand"
 	"os"
+	"sort"
 	"sync"
 )
 
@@ -41,6 +42,10 @@ const (
 // 16			4	Checksum-1: Cumulative checksum up through and including this page
 // 20			4	Checksum-2: Second half of the cumulative checksum.
 
+// walByteOrder is the order of the words summed by checkSum, which the
+// magic number 0x377f0682 declares as little-endian.
+var walByteOrder = binary.LittleEndian
+
 // WAL represents a write ahead log
 type WAL struct {
 	file             *os.File
@@ -51,8 +56,29 @@ type WAL struct {
 	pos              uint32
 	totalPages       int
 
-	pageCache map[int][]byte
-	mu        *sync.RWMutex
+	// cumulative checksum of the last frame written
+	checksum1 uint32
+	checksum2 uint32
+
+	// frames locates the latest frame of each page in the log
+	frames map[int]walFrame
+
+	// version counts the transactions written, pageVersions holds the
+	// version of the last transaction to write each page. A checkpoint
+	// moves pages to the db file without changing them, their versions
+	// are kept.
+	version      uint64
+	pageVersions map[int]uint64
+
+	mu *sync.RWMutex
+}
+
+// walFrame locates a frame in the log along with the cumulative checksum
+// of the frames preceding it, which the checksum of the frame continues.
+type walFrame struct {
+	offset    uint32
+	checksum1 uint32
+	checksum2 uint32
 }
 
 func OpenWAL(dbFile *DbFile) (*WAL, error) {
@@ -61,13 +87,108 @@ func OpenWAL(dbFile *DbFile) (*WAL, error) {
 		return nil, err
 	}
 
-	return &WAL{
-		file:       f,
-		dbFile:     dbFile,
-		mu:         &sync.RWMutex{},
-		totalPages: dbFile.TotalPages(),
-		pageCache:  make(map[int][]byte),
-	}, nil
+	w := &WAL{
+		file:         f,
+		dbFile:       dbFile,
+		mu:           &sync.RWMutex{},
+		totalPages:   dbFile.TotalPages(),
+		frames:       make(map[int]walFrame),
+		pageVersions: make(map[int]uint64),
+	}
+
+	// Committed pages may not have been checkpointed to the db file
+	if err := w.Recover(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Recover locates the pages of committed transactions in the log. Frames
+// following the last commit belong to a transaction that never completed
+// and frames with other salts were written before the last checkpoint,
+// neither are replayed. Replay also stops at the first frame whose checksum
+// does not continue the checksum of the frames before it, a transaction
+// with such a frame is lost. New frames are written after the last commit.
+func (w *WAL) Recover() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	header := make([]byte, WALHeaderLen)
+	if n, err := w.file.ReadAt(header, 0); n < WALHeaderLen {
+		if err == io.EOF {
+			// Nothing has been logged
+			return nil
+		}
+		return err
+	}
+
+	// A log with an invalid header is ignored
+	s0, s1, err := checkSum(header[:24], 0, 0, walByteOrder)
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != WALMagicNumber ||
+		binary.BigEndian.Uint32(header[8:12]) != uint32(w.dbFile.PageSize()) ||
+		binary.BigEndian.Uint32(header[24:28]) != s0 ||
+		binary.BigEndian.Uint32(header[28:32]) != s1 {
+		return nil
+	}
+
+	salt1 := binary.BigEndian.Uint32(header[16:20])
+	salt2 := binary.BigEndian.Uint32(header[20:24])
+
+	// Frames of the transaction being read
+	pending := make(map[int]walFrame)
+
+	frame := make([]byte, WALFrameHeaderLen+w.dbFile.PageSize())
+	for pos := WALHeaderLen; ; pos += len(frame) {
+		if n, err := w.file.ReadAt(frame, int64(pos)); n < len(frame) {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		if binary.BigEndian.Uint32(frame[8:12]) != salt1 || binary.BigEndian.Uint32(frame[12:16]) != salt2 {
+			break
+		}
+
+		f := walFrame{offset: uint32(pos), checksum1: s0, checksum2: s1}
+		if s0, s1, err = frameChecksum(frame, s0, s1); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint32(frame[16:20]) != s0 || binary.BigEndian.Uint32(frame[20:24]) != s1 {
+			break
+		}
+		pending[int(binary.BigEndian.Uint32(frame[0:4]))] = f
+
+		// The last frame of a transaction holds the size of the database
+		dbSize := int(binary.BigEndian.Uint32(frame[4:8]))
+		if dbSize == 0 {
+			continue
+		}
+
+		for pageNumber, f := range pending {
+			w.frames[pageNumber] = f
+		}
+		pending = make(map[int]walFrame)
+
+		if dbSize > w.totalPages {
+			w.totalPages = dbSize
+		}
+		w.pos = uint32(pos + len(frame))
+		w.checksum1, w.checksum2 = s0, s1
+	}
+
+	// Continue the log of the header
+	if w.pos > 0 {
+		w.checkpointNumber = binary.BigEndian.Uint32(header[12:16])
+		w.salt1 = salt1
+		w.salt2 = salt2
+	}
+
+	return nil
 }
 
 func (w *WAL) TotalPages() int {
@@ -78,15 +199,44 @@ func (w *WAL) PageSize() int {
 	return w.dbFile.PageSize()
 }
 
+func (w *WAL) ReservedSpace() int {
+	return w.dbFile.ReservedSpace()
+}
+
 func (w *WAL) Read(page int) ([]byte, error) {
-	if data, ok := w.pageCache[page]; ok {
-		dest := make([]byte, len(data))
-		copy(dest, data)
-		return dest, nil
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if f, ok := w.frames[page]; ok {
+		return w.readFrame(f)
 	}
 	return w.dbFile.Read(page)
 }
 
+// readFrame reads the page held by a frame of the log, verifying the frame
+// was written with the salts and checksum expected at its position.
+func (w *WAL) readFrame(f walFrame) ([]byte, error) {
+	frame := make([]byte, WALFrameHeaderLen+w.dbFile.PageSize())
+	if _, err := w.file.ReadAt(frame, int64(f.offset)); err != nil {
+		return nil, err
+	}
+
+	pageNumber := binary.BigEndian.Uint32(frame[0:4])
+	if binary.BigEndian.Uint32(frame[8:12]) != w.salt1 || binary.BigEndian.Uint32(frame[12:16]) != w.salt2 {
+		return nil, fmt.Errorf("wal frame of page %d has unexpected salts", pageNumber)
+	}
+
+	s0, s1, err := frameChecksum(frame, f.checksum1, f.checksum2)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(frame[16:20]) != s0 || binary.BigEndian.Uint32(frame[20:24]) != s1 {
+		return nil, fmt.Errorf("wal frame of page %d has an invalid checksum", pageNumber)
+	}
+
+	return frame[WALFrameHeaderLen:], nil
+}
+
 func (w *WAL) Write(pages ...Page) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -99,33 +249,52 @@ func (w *WAL) Write(pages ...Page) error {
 	}
 
 	// Write all pages out. The last page written is the commit page.
+	w.version++
 	for i, p := range pages {
-		dest := make([]byte, len(p.Data))
-		copy(dest, p.Data)
-		w.pageCache[p.PageNumber] = dest
-
 		if p.PageNumber > w.totalPages {
 			w.totalPages = p.PageNumber
 		}
 
+		f := walFrame{offset: w.pos, checksum1: w.checksum1, checksum2: w.checksum2}
 		lastPage := i == len(pages)-1
-		if err := w.writeLog(p.PageNumber, dest, lastPage); err != nil {
+		if err := w.writeLog(p.PageNumber, p.Data, lastPage); err != nil {
 			return err
 		}
+		w.frames[p.PageNumber] = f
+		w.pageVersions[p.PageNumber] = w.version
 	}
 
 	return nil
 }
 
+func (w *WAL) Version() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.version
+}
+
+func (w *WAL) PageVersion(page int) uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.pageVersions[page]
+}
+
 func (w *WAL) Checkpoint() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Write all pages to db file
+	// Write all pages to db file in order as it cannot grow with a gap
 	var pagesToWrite []Page
-	for pageNumber, data := range w.pageCache {
+	for pageNumber, f := range w.frames {
+		data, err := w.readFrame(f)
+		if err != nil {
+			return err
+		}
 		pagesToWrite = append(pagesToWrite, Page{PageNumber: pageNumber, Data: data})
 	}
+	sort.Slice(pagesToWrite, func(i, j int) bool {
+		return pagesToWrite[i].PageNumber < pagesToWrite[j].PageNumber
+	})
 
 	if len(pagesToWrite) > 0 {
 		if err := w.dbFile.Write(pagesToWrite...); err != nil {
@@ -133,8 +302,10 @@ func (w *WAL) Checkpoint() error {
 		}
 	}
 
-	// Checkpoints always start at the beginning of the file
+	// Checkpoints always start at the beginning of the file, the frames
+	// written before are overwritten.
 	w.pos = 0
+	w.frames = make(map[int]walFrame)
 
 	return nil
 }
@@ -153,13 +324,14 @@ func (w *WAL) writeHeader() error {
 	binary.BigEndian.PutUint32(header[16:20], w.salt1)
 	binary.BigEndian.PutUint32(header[20:24], w.salt2)
 
-	// Calculate the sum of the header up to this point
-	h := crc64.New(crc64.MakeTable(crc64.ISO))
-	_, err := h.Write(header[:24])
+	// Calculate the sum of the header up to this point, the checksum of
+	// each frame continues from it.
+	s0, s1, err := checkSum(header[:24], 0, 0, walByteOrder)
 	if err != nil {
 		return err
 	}
-	binary.BigEndian.PutUint64(header[24:32], h.Sum64())
+	binary.BigEndian.PutUint32(header[24:28], s0)
+	binary.BigEndian.PutUint32(header[28:32], s1)
 
 	// Write the header to the start of the file & flush
 	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
@@ -172,6 +344,7 @@ func (w *WAL) writeHeader() error {
 
 	// The next write to the WAL will be here.
 	w.pos = WALHeaderLen
+	w.checksum1, w.checksum2 = s0, s1
 
 	return nil
 }
@@ -182,13 +355,15 @@ func (w *WAL) writeLog(pageNumber int, data []byte, isCommit bool) error {
 		return err
 	}
 
-	if _, err := io.Copy(w.file, bytes.NewReader(frame)); err != nil {
+	if _, err := w.file.WriteAt(frame, int64(w.pos)); err != nil {
 		return err
 	} else if err := w.file.Sync(); err != nil {
 		return err
 	}
 
 	w.pos += uint32(len(frame))
+	w.checksum1 = binary.BigEndian.Uint32(frame[16:20])
+	w.checksum2 = binary.BigEndian.Uint32(frame[20:24])
 	return nil
 }
 
@@ -198,7 +373,7 @@ func (w *WAL) makeWalFrame(pageNumber int, data []byte, isCommit bool) ([]byte,
 	binary.BigEndian.PutUint32(header[0:4], uint32(pageNumber))
 
 	if isCommit {
-		binary.BigEndian.PutUint32(header[4:8], 1)
+		binary.BigEndian.PutUint32(header[4:8], uint32(w.totalPages))
 	} else {
 		binary.BigEndian.PutUint32(header[4:8], 0)
 	}
@@ -206,28 +381,42 @@ func (w *WAL) makeWalFrame(pageNumber int, data []byte, isCommit bool) ([]byte,
 	binary.BigEndian.PutUint32(header[8:12], w.salt1)
 	binary.BigEndian.PutUint32(header[12:16], w.salt2)
 
+	pageBuffer := bytes.NewBuffer(header)
+	if _, err := pageBuffer.Write(data); err != nil {
+		return nil, err
+	}
+	frame := pageBuffer.Bytes()
+
 	// The checksum values in the final 8 bytes of the frame-header exactly
 	// match the checksum computed consecutively on the first 24 bytes of
 	// the WAL header and the first 8 bytes and the content of all frames
 	// up to and including the current frame.
-	binary.BigEndian.PutUint64(header[24:32], 0)
-
-	pageBuffer := bytes.NewBuffer(header)
-	if _, err := pageBuffer.Write(header); err != nil {
-		return nil, err
-	} else if _, err := pageBuffer.Write(data); err != nil {
+	s0, s1, err := frameChecksum(frame, w.checksum1, w.checksum2)
+	if err != nil {
 		return nil, err
 	}
+	binary.BigEndian.PutUint32(frame[16:20], s0)
+	binary.BigEndian.PutUint32(frame[20:24], s1)
+
+	return frame, nil
+}
 
-	return pageBuffer.Bytes(), nil
+// frameChecksum continues a cumulative checksum with the first 8 bytes and
+// the content of a frame.
+func frameChecksum(frame []byte, s0, s1 uint32) (uint32, uint32, error) {
+	s0, s1, err := checkSum(frame[:8], s0, s1, walByteOrder)
+	if err != nil {
+		return 0, 0, err
+	}
+	return checkSum(frame[WALFrameHeaderLen:], s0, s1, walByteOrder)
 }
 
-// checkSum only works for content which is an odd multiple of 8 bytes in length.
+// checkSum only works for content which is a multiple of 8 bytes in length.
 func checkSum(b []byte, s0, s1 uint32, order binary.ByteOrder) (uint32, uint32, error) {
-	// Work in chunks of 8 bytes, x better be odd
+	// Work in chunks of 8 bytes
 	x := len(b) >> 3
-	if x%2 == 0 {
-		return 0, 0, errors.New("checkSum only works with odd multiples of 8 bytes")
+	if len(b)%8 != 0 {
+		return 0, 0, errors.New("checkSum only works with multiples of 8 bytes")
 	}
 
 	for i := 0; i < x; i++ {
@@ -240,3 +429,4 @@ func checkSum(b []byte, s0, s1 uint32, order binary.ByteOrder) (uint32, uint32,
 
 var _ PageReader = (*WAL)(nil)
 var _ PageWriter = (*WAL)(nil)
+var _ Versioned = (*WAL)(nil)
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"encoding/binary"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -28,3 +30,152 @@ func TestChecksum(t *testing.T) {
 	assert.Equal(expectedSum1, s0)
 	assert.Equal(expectedSum2, s1)
 }
+
+func TestWAL_Recover(t *testing.T) {
+	assert := require.New(t)
+	dbPath := path.Join(t.TempDir(), "tiny.db")
+
+	page := func(pageNumber int, value byte) Page {
+		data := make([]byte, 1024)
+		data[200] = value
+		return Page{PageNumber: pageNumber, Data: data}
+	}
+	open := func() *WAL {
+		dbFile, err := OpenDbFile(dbPath, 1024)
+		assert.NoError(err)
+		wal, err := OpenWAL(dbFile)
+		assert.NoError(err)
+		return wal
+	}
+	assertPage := func(wal *WAL, pageNumber int, value byte) {
+		data, err := wal.Read(pageNumber)
+		assert.NoError(err)
+		assert.Equal(value, data[200])
+	}
+
+	dbFile, err := OpenDbFile(dbPath, 1024)
+	assert.NoError(err)
+	assert.NoError(dbFile.Write(page(1, 1)))
+
+	wal, err := OpenWAL(dbFile)
+	assert.NoError(err)
+	assert.NoError(wal.Write(page(2, 2), page(1, 3)))
+	assert.NoError(wal.Write(page(3, 4)))
+
+	// The last frame of a transaction is lost in a crash
+	assert.NoError(wal.Write(page(2, 5), page(4, 6)))
+	info, err := os.Stat(dbPath + "-wal")
+	assert.NoError(err)
+	assert.NoError(os.Truncate(dbPath+"-wal", info.Size()-WALFrameHeaderLen-1024))
+
+	// Only committed transactions are replayed
+	wal = open()
+	assert.Equal(3, wal.TotalPages())
+	assertPage(wal, 1, 3)
+	assertPage(wal, 2, 2)
+	assertPage(wal, 3, 4)
+
+	// The log continues after the last commit
+	assert.NoError(wal.Write(page(4, 7)))
+	wal = open()
+	assert.Equal(4, wal.TotalPages())
+	assertPage(wal, 2, 2)
+	assertPage(wal, 4, 7)
+
+	// Frames from before a checkpoint are not replayed again
+	assert.NoError(wal.Checkpoint())
+	assert.NoError(wal.Write(page(2, 8)))
+	wal = open()
+	assertPage(wal, 2, 8)
+	assertPage(wal, 4, 7)
+}
+
+func TestWAL_Read_CorruptFrame(t *testing.T) {
+	assert := require.New(t)
+	dbPath := path.Join(t.TempDir(), "tiny.db")
+
+	page := func(pageNumber int, value byte) Page {
+		data := make([]byte, 1024)
+		data[200] = value
+		return Page{PageNumber: pageNumber, Data: data}
+	}
+
+	dbFile, err := OpenDbFile(dbPath, 1024)
+	assert.NoError(err)
+	assert.NoError(dbFile.Write(page(1, 1)))
+
+	wal, err := OpenWAL(dbFile)
+	assert.NoError(err)
+	assert.NoError(wal.Write(page(2, 2), page(3, 3)))
+
+	// Flip a byte of the content of the first frame
+	f, err := os.OpenFile(dbPath+"-wal", os.O_RDWR, 0)
+	assert.NoError(err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte{0xff}, WALHeaderLen+WALFrameHeaderLen+200)
+	assert.NoError(err)
+
+	_, err = wal.Read(2)
+	assert.Error(err)
+
+	// Other frames are unaffected
+	data, err := wal.Read(3)
+	assert.NoError(err)
+	assert.Equal(byte(3), data[200])
+}
+
+func TestWAL_Recover_CorruptFrame(t *testing.T) {
+	assert := require.New(t)
+	dbPath := path.Join(t.TempDir(), "tiny.db")
+
+	page := func(pageNumber int, value byte) Page {
+		data := make([]byte, 1024)
+		data[200] = value
+		return Page{PageNumber: pageNumber, Data: data}
+	}
+	frameLen := int64(WALFrameHeaderLen + 1024)
+
+	dbFile, err := OpenDbFile(dbPath, 1024)
+	assert.NoError(err)
+	assert.NoError(dbFile.Write(page(1, 1)))
+
+	wal, err := OpenWAL(dbFile)
+	assert.NoError(err)
+	assert.NoError(wal.Write(page(2, 2)))
+	assert.NoError(wal.Write(page(1, 3), page(3, 4)))
+	assert.NoError(wal.Write(page(2, 5)))
+
+	// Flip a byte of the content of the first frame of the second transaction
+	f, err := os.OpenFile(dbPath+"-wal", os.O_RDWR, 0)
+	assert.NoError(err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte{0xff}, WALHeaderLen+frameLen+WALFrameHeaderLen+200)
+	assert.NoError(err)
+
+	// Replay stops at the corrupt frame, the frames after it are not trusted
+	dbFile, err = OpenDbFile(dbPath, 1024)
+	assert.NoError(err)
+	wal, err = OpenWAL(dbFile)
+	assert.NoError(err)
+	assert.Equal(2, wal.TotalPages())
+
+	data, err := wal.Read(1)
+	assert.NoError(err)
+	assert.Equal(byte(1), data[200])
+	data, err = wal.Read(2)
+	assert.NoError(err)
+	assert.Equal(byte(2), data[200])
+
+	// The log continues after the last valid commit
+	assert.NoError(wal.Write(page(3, 6)))
+	dbFile, err = OpenDbFile(dbPath, 1024)
+	assert.NoError(err)
+	wal, err = OpenWAL(dbFile)
+	assert.NoError(err)
+	data, err = wal.Read(3)
+	assert.NoError(err)
+	assert.Equal(byte(6), data[200])
+	data, err = wal.Read(2)
+	assert.NoError(err)
+	assert.Equal(byte(2), data[200])
+}
@@ -0,0 +1,47 @@
+package virtualmachine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/joeandaverde/tinydb/internal/storage"
+)
+
+// applyAffinity converts a register to the type of the column it is stored in
+// when the conversion loses no information. Text that looks like an integer
+// becomes an integer in an integer column, integers and numeric text become
+// floats in a float column and integers become text in a text column. Any
+// other value is stored as is.
+func applyAffinity(r *register, t storage.SQLType) {
+	switch t {
+	case storage.Integer, storage.Byte:
+		if r.typ != RegString {
+			return
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(r.data.(string)))
+		if err != nil {
+			return
+		}
+		r.typ = RegInt32
+		r.data = v
+	case storage.Float:
+		switch r.typ {
+		case RegInt32:
+			r.typ = RegFloat
+			r.data = float64(r.data.(int))
+		case RegString:
+			v, err := strconv.ParseFloat(strings.TrimSpace(r.data.(string)), 64)
+			if err != nil {
+				return
+			}
+			r.typ = RegFloat
+			r.data = v
+		}
+	case storage.Text:
+		if r.typ != RegInt32 {
+			return
+		}
+		r.typ = RegString
+		r.data = strconv.Itoa(r.data.(int))
+	}
+}
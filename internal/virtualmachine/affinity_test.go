@@ -0,0 +1,35 @@
+package virtualmachine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/internal/storage"
+)
+
+func TestApplyAffinity(t *testing.T) {
+	tests := []struct {
+		column   storage.SQLType
+		value    register
+		expected register
+	}{
+		{storage.Integer, register{typ: RegString, data: "42"}, register{typ: RegInt32, data: 42}},
+		{storage.Integer, register{typ: RegString, data: " 007 "}, register{typ: RegInt32, data: 7}},
+		{storage.Integer, register{typ: RegString, data: "4x"}, register{typ: RegString, data: "4x"}},
+		{storage.Integer, register{typ: RegInt32, data: 3}, register{typ: RegInt32, data: 3}},
+		{storage.Integer, register{typ: RegNull}, register{typ: RegNull}},
+		{storage.Byte, register{typ: RegString, data: "9"}, register{typ: RegInt32, data: 9}},
+		{storage.Float, register{typ: RegInt32, data: 2}, register{typ: RegFloat, data: 2.0}},
+		{storage.Float, register{typ: RegString, data: " 1.5 "}, register{typ: RegFloat, data: 1.5}},
+		{storage.Float, register{typ: RegString, data: "abc"}, register{typ: RegString, data: "abc"}},
+		{storage.Text, register{typ: RegInt32, data: 300}, register{typ: RegString, data: "300"}},
+		{storage.Text, register{typ: RegString, data: "12"}, register{typ: RegString, data: "12"}},
+		{storage.Text, register{typ: RegNull}, register{typ: RegNull}},
+	}
+	for _, tc := range tests {
+		r := tc.value
+		applyAffinity(&r, tc.column)
+		require.Equal(t, tc.expected, r, "%v %v", tc.column, tc.value.data)
+	}
+}
@@ -0,0 +1,218 @@
+package virtualmachine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// aggregator accumulates values of an aggregate function over a set of rows
+type aggregator interface {
+	// step adds a value to the aggregate, arg is nil for COUNT(*)
+	step(arg *register) error
+	// final produces the result of the aggregate
+	final() *register
+}
+
+// newAggregator creates the aggregator of the named function, a name
+// suffixed with DISTINCT, e.g. "COUNT DISTINCT", ignores repeated values.
+func newAggregator(name string) (aggregator, error) {
+	if fn := strings.TrimSuffix(name, " DISTINCT"); fn != name {
+		agg, err := newAggregator(fn)
+		if err != nil {
+			return nil, err
+		}
+		return &distinctAggregator{aggregator: agg, seen: make(map[string]struct{})}, nil
+	}
+
+	switch name {
+	case "COUNT":
+		return &countAggregator{}, nil
+	case "SUM":
+		return &sumAggregator{}, nil
+	case "AVG":
+		return &avgAggregator{}, nil
+	case "MIN":
+		return &minMaxAggregator{keep: -1}, nil
+	case "MAX":
+		return &minMaxAggregator{keep: 1}, nil
+	default:
+		return nil, fmt.Errorf("unknown aggregate function: %s", name)
+	}
+}
+
+// countAggregator counts rows or non-NULL values
+type countAggregator struct {
+	count int
+}
+
+func (a *countAggregator) step(arg *register) error {
+	if arg == nil || arg.typ != RegNull {
+		a.count++
+	}
+	return nil
+}
+
+func (a *countAggregator) final() *register {
+	return &register{typ: RegInt32, data: a.count}
+}
+
+// errIntegerOverflow is reported when the integer sum of SUM overflows
+var errIntegerOverflow = errors.New("integer overflow")
+
+// sumAggregator adds non-NULL values. As in SQLite, text is read as the
+// number it spells or 0 when it isn't one, a blob is read as the float its
+// bytes spell, and the sum is an integer unless any of the values is not
+// an integer. The sum of no values is NULL.
+// An integer sum overflowing is an error, the values added so far are
+// then kept as a float sum for AVG.
+type sumAggregator struct {
+	sum     int
+	sumReal float64
+	isReal  bool
+	count   int
+}
+
+func (a *sumAggregator) step(arg *register) error {
+	switch arg.typ {
+	case RegNull:
+		return nil
+	case RegInt32:
+		if err := a.addInt(arg.data.(int)); err != nil {
+			return err
+		}
+	case RegFloat:
+		a.sumReal += arg.data.(float64)
+		a.isReal = true
+	case RegString:
+		text := strings.TrimSpace(arg.data.(string))
+		if v, err := strconv.Atoi(text); err == nil {
+			if err := a.addInt(v); err != nil {
+				return err
+			}
+		} else {
+			v, _ := strconv.ParseFloat(text, 64)
+			a.sumReal += v
+			a.isReal = true
+		}
+	case RegBinary:
+		v, _ := strconv.ParseFloat(strings.TrimSpace(string(arg.data.([]byte))), 64)
+		a.sumReal += v
+		a.isReal = true
+	default:
+		return fmt.Errorf("SUM requires numeric values")
+	}
+	a.count++
+	return nil
+}
+
+// addInt adds an integer to the integer sum
+func (a *sumAggregator) addInt(v int) error {
+	sum, ok := arithmetic(OpAdd, a.sum, v)
+	if !ok {
+		a.sumReal += float64(a.sum) + float64(v)
+		a.sum = 0
+		a.count++
+		return errIntegerOverflow
+	}
+	a.sum = sum
+	return nil
+}
+
+func (a *sumAggregator) total() float64 {
+	return float64(a.sum) + a.sumReal
+}
+
+func (a *sumAggregator) final() *register {
+	if a.count == 0 {
+		return &register{typ: RegNull}
+	}
+	if a.isReal {
+		return &register{typ: RegFloat, data: a.total()}
+	}
+	return &register{typ: RegInt32, data: a.sum}
+}
+
+// avgAggregator averages non-NULL values. The average of no values is NULL.
+type avgAggregator struct {
+	sumAggregator
+}
+
+func (a *avgAggregator) step(arg *register) error {
+	// The average of integers overflowing their sum is still a float
+	if err := a.sumAggregator.step(arg); err != nil && err != errIntegerOverflow {
+		return fmt.Errorf("AVG requires numeric values")
+	}
+	return nil
+}
+
+func (a *avgAggregator) final() *register {
+	if a.count == 0 {
+		return &register{typ: RegNull}
+	}
+	return &register{typ: RegFloat, data: a.total() / float64(a.count)}
+}
+
+// minMaxAggregator keeps the smallest (keep < 0) or largest (keep > 0) non-NULL value
+type minMaxAggregator struct {
+	keep  int
+	value *register
+}
+
+func (a *minMaxAggregator) step(arg *register) error {
+	if arg.typ == RegNull {
+		return nil
+	}
+	if a.value == nil || compare(arg, a.value)*a.keep > 0 {
+		a.value = &register{typ: arg.typ, data: arg.data}
+	}
+	return nil
+}
+
+func (a *minMaxAggregator) final() *register {
+	if a.value == nil {
+		return &register{typ: RegNull}
+	}
+	return a.value
+}
+
+// distinctAggregator passes each distinct non-NULL value to an aggregator once
+type distinctAggregator struct {
+	aggregator
+	seen map[string]struct{}
+}
+
+func (a *distinctAggregator) step(arg *register) error {
+	if arg.typ == RegNull {
+		return nil
+	}
+	key := distinctKey(arg)
+	if _, ok := a.seen[key]; ok {
+		return nil
+	}
+	a.seen[key] = struct{}{}
+	return a.aggregator.step(arg)
+}
+
+// distinctKey serializes a value such that values comparing equal have the
+// same key. Numbers are equal regardless of their type, e.g. 1 and 1.0.
+func distinctKey(r *register) string {
+	switch r.typ {
+	case RegInt32:
+		return "n" + strconv.Itoa(r.data.(int))
+	case RegFloat:
+		f := r.data.(float64)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return "n" + strconv.Itoa(int(f))
+		}
+		return "n" + strconv.FormatFloat(f, 'g', -1, 64)
+	case RegString:
+		return "t" + r.data.(string)
+	case RegBinary:
+		return "b" + string(r.data.([]byte))
+	default:
+		return fmt.Sprintf("%d:%v", r.typ, r.data)
+	}
+}
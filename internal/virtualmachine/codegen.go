@@ -1,8 +1,9 @@
 package virtualmachine
 
 import (
-	"errors"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/joeandaverde/tinydb/internal/metadata"
@@ -29,6 +30,27 @@ func (i Instructions) String() string {
 	return sb.String()
 }
 
+// Listing renders one instruction per line as `addr op p1 p2 p3 p4`.
+// Unlike String, the format is stable and suitable for golden tests.
+func (i Instructions) Listing() string {
+	var sb strings.Builder
+	for addr, x := range i {
+		sb.WriteString(fmt.Sprintf("%d %s %d %d %d %s\n", addr, x.Op.Name(), x.P1, x.P2, x.P3, listingValue(x.P4)))
+	}
+	return sb.String()
+}
+
+func listingValue(v interface{}) string {
+	switch p4 := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return strconv.Quote(p4)
+	default:
+		return fmt.Sprintf("%v", p4)
+	}
+}
+
 func initProgram() *program {
 	return &program{
 		regPool:   make(map[int]struct{}),
@@ -73,14 +95,51 @@ func (p *program) OpString(reg int, s string) int {
 	return p.Op4(OpString, len(s), int(reg), x, s)
 }
 
+func (p *program) OpBlob(reg int, b []byte) int {
+	return p.Op4(OpBlob, x, reg, x, b)
+}
+
 func (p *program) OpInt(reg int, value int) int {
 	return p.Op2(OpInteger, value, int(reg))
 }
 
+func (p *program) OpFloat(reg int, value float64) int {
+	return p.Op4(OpFloat, x, reg, x, value)
+}
+
 func (p *program) OpNull(reg int) int {
 	return p.Op2(OpNull, x, reg)
 }
 
+// OpChangeSchema increments the schema cookie, so that the definitions of
+// tables cached with the previous cookie are read again.
+func (p *program) OpChangeSchema() {
+	cookieReg := p.RegAlloc()
+	oneReg := p.RegAlloc()
+	p.Op2(OpReadCookie, x, cookieReg)
+	p.OpInt(oneReg, 1)
+	p.Op3(OpAdd, cookieReg, oneReg, cookieReg)
+	p.Op3(OpSetCookie, x, x, cookieReg)
+}
+
+// OpColumn loads a column of the current row of a cursor into a register.
+// SQLite stores an INTEGER PRIMARY KEY only as the rowid and leaves the
+// column NULL in the record, a NULL integer primary key is read as the rowid.
+// The rowid column of a table is read from the key of the row.
+func (p *program) OpColumn(cursor int, col *metadata.ColumnDefinition, reg int) int {
+	if col.Offset == rowIDOffset {
+		return p.Op2(OpKey, cursor, reg)
+	}
+	addr := p.Op3(OpColumn, cursor, col.Offset, reg)
+	if col.PrimaryKey && col.Type == storage.Integer {
+		storedLabel := p.MakeLabel()
+		p.Op2(OpNotNull, reg, storedLabel)
+		p.Op2(OpKey, cursor, reg)
+		p.EmitLabel(storedLabel)
+	}
+	return addr
+}
+
 func (p *program) OpHalt() int {
 	return p.Op0(OpHalt)
 }
@@ -111,25 +170,26 @@ func (p *program) RegAlloc() int {
 	panic("who so many registers batman?")
 }
 
+// RegAllocN allocates num contiguous registers and returns the first of them
 func (p *program) RegAllocN(num int) int {
-	remaining := num
 	startReg := 0
-	for ; startReg < 100; startReg++ {
-		_, ok := p.regPool[startReg]
-		// if the reg is taken, reset our count.
-		if ok {
-			remaining = num
-		} else {
-			remaining--
+	for i := 0; i < 100; i++ {
+		// if the reg is taken, the block starts after it.
+		if _, ok := p.regPool[i]; ok {
+			startReg = i + 1
+			continue
 		}
 
 		// If we got all contiguous regs, done.
-		if remaining == 0 {
-			break
+		if i-startReg+1 == num {
+			for r := startReg; r <= i; r++ {
+				p.regPool[r] = struct{}{}
+			}
+			return startReg
 		}
 	}
 
-	return startReg
+	panic("who so many registers batman?")
 }
 
 func (p *program) RegRelease(r int) {
@@ -227,9 +287,111 @@ func CreateTableInstructions(stmt *ast.CreateTableStatement) []*Instruction {
 
 	// Insert record to [Cur 0], record from [Reg 6], key from [Reg 7]
 	p.Op3(OpInsert, openCursor, recordReg, rowIDReg)
+
+	// Each UNIQUE column is enforced by an index with no SQL of its own
+	indexCursor := 1
+	n := 0
+	for _, c := range stmt.Columns {
+		if !c.Unique {
+			continue
+		}
+		n++
+		name := metadata.AutoindexName(stmt.TableName, n)
+		p.Op4(OpCreateIndex, masterTable4Reg, indexCursor, x, name)
+		p.Op1(OpClose, indexCursor)
+		p.OpString(masterTable1Reg, "index")
+		p.OpString(masterTable2Reg, name)
+		p.OpNull(masterTable5Reg)
+		p.Op3(OpMakeRecord, masterTable1Reg, 5, recordReg)
+		p.Op2(OpRowID, openCursor, rowIDReg)
+		p.Op3(OpInsert, openCursor, recordReg, rowIDReg)
+	}
+
+	p.Op1(OpClose, openCursor)
+	p.OpChangeSchema()
+	p.OpHalt()
+
+	return p.instructions
+}
+
+// CreateIndexInstructions generates machine code to create an index and
+// populate it with an entry for each row already in the table.
+// Each entry holds the values of the indexed columns followed by the rowid.
+func CreateIndexInstructions(table *metadata.TableDefinition, stmt *ast.CreateIndexStatement) []*Instruction {
+	p := initProgram()
+
+	// Resolve the indexed columns
+	cols := make([]*metadata.ColumnDefinition, 0, len(stmt.Columns))
+	for _, c := range stmt.Columns {
+		col := table.Column(c)
+		if col == nil {
+			panic(fmt.Sprintf("no such column: %s", c))
+		}
+		cols = append(cols, col)
+	}
+
+	// The system table
+	rootPage := 1
+
+	// Open database file cursor and store cursor at [Cur 0] with 5 columns
+	openCursor := 0
+	p.Op4(OpOpenWrite, openCursor, rootPage, 5, ".schema")
+
+	// Master table entry [Reg 0-4]
+	masterTable1Reg := p.RegAlloc()
+	masterTable2Reg := p.RegAlloc()
+	masterTable3Reg := p.RegAlloc()
+	masterTable4Reg := p.RegAlloc()
+	masterTable5Reg := p.RegAlloc()
+
+	// Create the index btree, store root page in [Reg 3] and open it at [Cur 1]
+	indexCursor := 1
+	p.Op4(OpCreateIndex, masterTable4Reg, indexCursor, x, stmt.Name)
+
+	p.OpString(masterTable1Reg, "index")
+	p.OpString(masterTable2Reg, stmt.Name)
+	p.OpString(masterTable3Reg, table.Name)
+	p.OpString(masterTable5Reg, stmt.RawText)
+
+	recordReg := p.RegAlloc()
+	p.Op3(OpMakeRecord, masterTable1Reg, 5, recordReg)
+
+	rowIDReg := p.RegAlloc()
+	p.Op2(OpRowID, openCursor, rowIDReg)
+	p.Op3(OpInsert, openCursor, recordReg, rowIDReg)
 	p.Op1(OpClose, openCursor)
+
+	// Add an entry to the index for each row of the table
+	tableCursor := 2
+	doneLabel := p.MakeLabel()
+	loopLabel := p.MakeLabel()
+	p.Op4(OpOpenRead, tableCursor, table.RootPage, len(table.Columns), table.Name)
+	p.Op2(OpRewind, tableCursor, doneLabel)
+
+	// The indexed columns are followed by the rowid
+	keyReg := p.RegAlloc()
+	for i := 0; i < len(cols); i++ {
+		p.RegAlloc()
+	}
+	entryReg := p.RegAlloc()
+
+	p.EmitLabel(loopLabel)
+	for i, c := range cols {
+		p.OpColumn(tableCursor, c, keyReg+i)
+	}
+	p.Op2(OpKey, tableCursor, keyReg+len(cols))
+	p.Op3(OpMakeRecord, keyReg, len(cols)+1, entryReg)
+	p.Op3(OpIdxInsert, indexCursor, entryReg, keyReg+len(cols))
+	p.Op2(OpNext, tableCursor, loopLabel)
+
+	p.EmitLabel(doneLabel)
+	p.Op1(OpClose, tableCursor)
+	p.Op1(OpClose, indexCursor)
+	p.OpChangeSchema()
 	p.OpHalt()
 
+	p.Finalize()
+
 	return p.instructions
 }
 
@@ -280,10 +442,10 @@ func CreateTableInstructions(stmt *ast.CreateTableStatement) []*Instruction {
 // |    9 | Transaction |  0 |  1 |  7 | 0         | 01 |         |
 // |   10 | Goto        |  0 |  1 |  0 |           | 00 |         |
 // +------+-------------+----+----+----+-----------+----+---------+
-func InsertInstructions(pager pager.Pager, stmt *ast.InsertStatement) []*Instruction {
+func InsertInstructions(pager pager.Pager, stmt *ast.InsertStatement) ([]*Instruction, error) {
 	table, err := metadata.GetTableDefinition(pager, stmt.Table)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	p := initProgram()
@@ -298,11 +460,27 @@ func InsertInstructions(pager pager.Pager, stmt *ast.InsertStatement) []*Instruc
 		p.RegAlloc()
 	}
 
-	// If there's a returning statement build an easy lookup
+	// Resolve the registers of the returned columns in the order requested,
+	// * returns every column in table order.
 	var returnRegs []int
-	returningLookup := make(map[string]int, len(stmt.Returning))
-	for i, c := range stmt.Returning {
-		returningLookup[c] = i
+	for _, c := range stmt.Returning {
+		if c == "*" {
+			for i := range table.Columns {
+				returnRegs = append(returnRegs, firstReg+i)
+			}
+			continue
+		}
+		found := false
+		for i, column := range table.Columns {
+			if column.Name == c {
+				returnRegs = append(returnRegs, firstReg+i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic(fmt.Sprintf("no such column: %s", c))
+		}
 	}
 
 	// Table cursor
@@ -311,74 +489,170 @@ func InsertInstructions(pager pager.Pager, stmt *ast.InsertStatement) []*Instruc
 	// Open the root page for writing
 	p.Op4(OpOpenWrite, cursorIndex, table.RootPage, len(table.Columns), table.Name)
 
-	// RowID for table
-	p.Op2(OpRowID, cursorIndex, rowIDReg)
+	// Each index is opened for writing with the cursor following the table
+	for i, idx := range table.Indexes {
+		p.Op4(OpOpenWrite, cursorIndex+1+i, idx.RootPage, 0, idx.Name)
+	}
 
-	// Populate registers with values to be inserted
+	// The affinity of each column
+	types := make([]storage.SQLType, len(table.Columns))
 	for i, column := range table.Columns {
-		reg := firstReg + i
+		types[i] = column.Type
+	}
 
-		if _, ok := returningLookup[column.Name]; ok {
-			returnRegs = append(returnRegs, reg)
-		}
+	recordReg := p.RegAlloc()
 
-		// If there's no value that maps to the table column
-		// use the default from table defition.
-		expr, ok := stmt.Values[column.Name]
-		if !ok {
-			p.AddValue(reg, column, column.DefaultValue)
-			continue
+	// Returned columns are copied to a contiguous block of registers
+	returnReg := 0
+	for i := range returnRegs {
+		if r := p.RegAlloc(); i == 0 {
+			returnReg = r
 		}
+	}
 
-		// TODO: generate instructions rather than evaluating the expression during codegen (incorrect).
-		v := Evaluate(expr, nil)
-		p.AddValue(reg, column, v.Value)
+	// Index entries are made from a block large enough for the widest
+	// index, the indexed columns are followed by the rowid.
+	entryWidth := 0
+	for _, idx := range table.Indexes {
+		if len(idx.Columns)+1 > entryWidth {
+			entryWidth = len(idx.Columns) + 1
+		}
+	}
+	entryReg := 0
+	entryRecordReg := 0
+	if entryWidth > 0 {
+		entryReg = p.RegAlloc()
+		for i := 1; i < entryWidth; i++ {
+			p.RegAlloc()
+		}
+		entryRecordReg = p.RegAlloc()
 	}
 
-	// Make the record and store in a register
-	recordReg := p.RegAlloc()
-	p.Op3(OpMakeRecord, firstReg, len(table.Columns), recordReg)
-
-	// Insert the record to the btree, store rowid in reg
-	p.Op3(OpInsert, cursorIndex, recordReg, rowIDReg)
-
-	// // Returning statement
-	// if len(returnRegs) > 0 {
-	// 	regReturnStart := regNewRecord + 1
-	// 	for i, r := range returnRegs {
-	// 		// Copy the original reg value to the new reg in order to be contiguous
-	// 		instructions = append(instructions, Instruction{OpSCopy, r, regReturnStart + i, x, x})
-	// 	}
-	// 	instructions = append(instructions, []*Instruction{
-	// 		{OpResultRow, regReturnStart, len(returnRegs), x, x},
-	// 	}...)
-	// 	regsUsed = regsUsed + len(returnRegs)
-	// }
+	// Each row is inserted with the same registers and cursor
+	for _, row := range stmt.Rows {
+		// An integer primary key with a value is the rowid of the record
+		keyReg := -1
+		for i, column := range table.Columns {
+			if expr, ok := row[column.Name]; ok && column.PrimaryKey && column.Type == storage.Integer {
+				if _, isParam := expr.(*ast.Parameter); isParam || Evaluate(expr, nil).Value != nil {
+					keyReg = firstReg + i
+				}
+			}
+		}
+
+		// RowID for table
+		if keyReg < 0 {
+			p.Op2(OpRowID, cursorIndex, rowIDReg)
+		}
+
+		// Populate registers with values to be inserted
+		for i, column := range table.Columns {
+			reg := firstReg + i
+
+			// If there's no value that maps to the table column
+			// use the default from table defition. An integer primary
+			// key defaults to the rowid of the new record.
+			expr, ok := row[column.Name]
+			if !ok || (column.PrimaryKey && column.Type == storage.Integer && reg != keyReg) {
+				if column.PrimaryKey && column.Type == storage.Integer {
+					p.Op2(OpSCopy, rowIDReg, reg)
+					continue
+				}
+				p.AddValue(reg, column.DefaultValue)
+				continue
+			}
+
+			// A parameter bound to NULL for the integer primary key is
+			// assigned the rowid following the largest rowid.
+			if param, ok := expr.(*ast.Parameter); ok {
+				p.Op2(OpVariable, param.Index, reg)
+				if reg == keyReg {
+					hasKey := p.MakeLabel()
+					p.Op2(OpNotNull, reg, hasKey)
+					p.Op2(OpRowID, cursorIndex, reg)
+					p.EmitLabel(hasKey)
+				}
+				continue
+			}
+
+			// TODO: generate instructions rather than evaluating the expression during codegen (incorrect).
+			v := Evaluate(expr, nil)
+			p.AddValue(reg, v.Value)
+		}
+
+		// Apply the affinity of each column to its value
+		p.Op4(OpAffinity, firstReg, len(table.Columns), x, types)
+
+		// The rowid given for an integer primary key must not be taken
+		if keyReg >= 0 {
+			p.Op2(OpSCopy, keyReg, rowIDReg)
+			keyFreeLabel := p.MakeLabel()
+			p.Op3(OpSeekRowid, cursorIndex, keyFreeLabel, rowIDReg)
+			p.Op4(OpHalt, 1, x, x, fmt.Sprintf("UNIQUE constraint failed: %s.%s", table.Name, table.Columns[keyReg-firstReg].Name))
+			p.EmitLabel(keyFreeLabel)
+		}
+
+		// The value of a UNIQUE column must not be in its index, a NULL
+		// value never conflicts.
+		for i, idx := range table.Indexes {
+			if !idx.Unique {
+				continue
+			}
+			reg := firstReg + idx.Columns[0].Offset
+			noConflictLabel := p.MakeLabel()
+			p.Op2(OpIsNull, reg, noConflictLabel)
+			p.Op4(OpSeekGe, cursorIndex+1+i, noConflictLabel, reg, 1)
+			p.Op4(OpIdxGt, cursorIndex+1+i, noConflictLabel, reg, 1)
+			p.Op4(OpHalt, 1, x, x, fmt.Sprintf("UNIQUE constraint failed: %s.%s", table.Name, idx.Columns[0].Name))
+			p.EmitLabel(noConflictLabel)
+		}
+
+		// Make the record and store in a register
+		p.Op3(OpMakeRecord, firstReg, len(table.Columns), recordReg)
+
+		// Insert the record to the btree, store rowid in reg
+		p.Op3(OpInsert, cursorIndex, recordReg, rowIDReg)
+
+		// Add an entry for the row to each index
+		for i, idx := range table.Indexes {
+			for k, c := range idx.Columns {
+				p.Op2(OpSCopy, firstReg+c.Offset, entryReg+k)
+			}
+			p.Op2(OpSCopy, rowIDReg, entryReg+len(idx.Columns))
+			p.Op3(OpMakeRecord, entryReg, len(idx.Columns)+1, entryRecordReg)
+			p.Op3(OpIdxInsert, cursorIndex+1+i, entryRecordReg, rowIDReg)
+		}
+
+		// Produce the inserted row for the returning clause
+		if len(returnRegs) > 0 {
+			for i, r := range returnRegs {
+				p.Op2(OpSCopy, r, returnReg+i)
+			}
+			p.Op2(OpResultRow, returnReg, len(returnRegs))
+		}
+	}
 
 	// All done
 	p.OpHalt()
+	p.Finalize()
 
-	return p.instructions
+	return p.instructions, nil
 }
 
-func (p *program) AddValue(reg int, column *metadata.ColumnDefinition, value interface{}) int {
-	// Supplied value and column type must match up
+// AddValue stores a value in a register. The value is converted to the
+// type of its column by OpAffinity before the record is made.
+func (p *program) AddValue(reg int, value interface{}) int {
 	switch v := value.(type) {
 	case string:
-		if column.Type != storage.Text {
-			panic("type conversion not implemented")
-		}
 		return p.OpString(reg, v)
 	case int:
-		if column.Type != storage.Integer {
-			panic("type conversion not implemented")
-		}
 		return p.OpInt(reg, v)
 	case byte:
-		if column.Type != storage.Byte {
-			panic("type conversion not implemented")
-		}
 		return p.OpInt(reg, int(v))
+	case float64:
+		return p.OpFloat(reg, v)
+	case []byte:
+		return p.OpBlob(reg, v)
 	case nil:
 		return p.OpNull(reg)
 	default:
@@ -416,35 +690,197 @@ func (p *program) Finalize() {
 // |   12 | String8     |  0 |  2 |  0 | joe      | 00 |         |
 // |   13 | Goto        |  0 |  1 |  0 |          | 00 |         |
 // +------+-------------+----+----+----+----------+----+---------+
-func SelectInstructions(tableDefs map[string]*metadata.TableDefinition, stmt *ast.SelectStatement) []*Instruction {
-	table, ok := tableDefs[stmt.From[0].Name]
-	if !ok {
-		return []*Instruction{}
+func SelectInstructions(tableDefs map[string]*metadata.TableDefinition, stmt *ast.SelectStatement) ([]*Instruction, error) {
+	sources, err := fromSources(tableDefs, stmt.From)
+	if err != nil {
+		return nil, err
 	}
-
-	// TODO: this will also need to handle aliased tables
-	colLookup := make(map[string]*metadata.ColumnDefinition, len(table.Columns))
-	for _, c := range table.Columns {
-		colLookup[c.Name] = c
+	table := sources[0].table
+	joining := len(sources) > 1
+
+	// A single row is read by its rowid when the filter requires a value
+	// of the integer primary key or the rowid. Otherwise rows are read from
+	// an index holding every referenced column when the filter bounds its
+	// first column, or the table is scanned from a lower bound on the rowid.
+	// The tables of a join are scanned.
+	var rowID *ast.BasicLiteral
+	var scan *indexScan
+	var lowerRowID *ast.BasicLiteral
+	var lowerRowIDOp Op
+	if !joining {
+		rowID = planRowIDLookup(sources[0], stmt)
+		if rowID == nil {
+			scan = planIndexScan(table, stmt)
+		}
+		if rowID == nil && scan == nil {
+			lowerRowID, lowerRowIDOp = planRowIDSeek(sources[0], stmt)
+		}
 	}
+	if scan != nil && scan.covering {
+		table = scan.table
+		sources[0].table = table
+	}
+
+	colLookup := fromColumns(sources)
 
-	// Build references to the columns being returned
+	// Build references to the columns being returned.
+	// Computed columns have no column definition and are evaluated per row.
 	selectCols := make([]*metadata.ColumnDefinition, 0, len(stmt.Columns))
+	computedCols := make(map[int]ast.Expression)
+	var aggregates []*ast.AggregateExpression
 	for _, c := range stmt.Columns {
-		if c == "*" {
-			selectCols = append(selectCols, table.Columns...)
-			continue
+		switch e := c.Expr.(type) {
+		case *ast.Star:
+			selectCols = append(selectCols, starColumns(sources)...)
+		case *ast.Ident:
+			selectCols = append(selectCols, colLookup[e.Value])
+		case *ast.AggregateExpression:
+			aggregates = append(aggregates, e)
+		case *ast.CaseExpression, *ast.BinaryOperation, *ast.BasicLiteral, *ast.Parameter:
+			computedCols[len(selectCols)] = e
+			selectCols = append(selectCols, nil)
+		default:
+			panic("unsupported result column")
+		}
+	}
+
+	// Resolve the columns rows are grouped by
+	groupCols := make([]*metadata.ColumnDefinition, 0, len(stmt.GroupBy))
+	groupLookup := make(map[string]int, len(stmt.GroupBy))
+	for i, g := range stmt.GroupBy {
+		groupCols = append(groupCols, colLookup[g])
+		groupLookup[g] = i
+	}
+
+	// Aggregate queries produce a single row after scanning the table,
+	// grouped queries produce a row per group.
+	grouping := len(groupCols) > 0
+	aggregating := len(aggregates) > 0 || grouping
+	if grouping && len(stmt.OrderBy) > 0 {
+		panic("ORDER BY with GROUP BY is not supported")
+	}
+	if stmt.Having != nil && !grouping {
+		panic("HAVING requires a GROUP BY clause")
+	}
+
+	// In an aggregate query each result column is either an aggregate
+	// or a column the rows are grouped by.
+	type aggregateColumn struct {
+		expr *ast.AggregateExpression
+		// column the aggregate is computed over, nil for COUNT(*)
+		col *metadata.ColumnDefinition
+		// index of the sorter column containing the argument when grouping
+		sorterCol int
+		// offset of the accumulator in the result row
+		resultOffset int
+	}
+	type groupColumn struct {
+		keyIndex     int
+		resultOffset int
+	}
+	var aggregateCols []aggregateColumn
+	var groupResultCols []groupColumn
+	aggregateArgCount := 0
+	addAggregate := func(e *ast.AggregateExpression, resultOffset int) {
+		a := aggregateColumn{expr: e, resultOffset: resultOffset}
+		switch arg := e.Arg.(type) {
+		case *ast.Star:
+			if e.Name != "COUNT" {
+				panic("unsupported aggregate argument")
+			}
+		case *ast.Ident:
+			a.col = colLookup[arg.Value]
+			a.sorterCol = len(groupCols) + aggregateArgCount
+			aggregateArgCount++
+		default:
+			panic("unsupported aggregate argument")
+		}
+		aggregateCols = append(aggregateCols, a)
+	}
+	if aggregating {
+		selectCols = selectCols[:0]
+		for i, c := range stmt.Columns {
+			switch e := c.Expr.(type) {
+			case *ast.AggregateExpression:
+				addAggregate(e, i)
+			case *ast.Ident:
+				keyIndex, ok := groupLookup[e.Value]
+				if !ok {
+					panic("cannot mix aggregate and non-aggregate columns")
+				}
+				groupResultCols = append(groupResultCols, groupColumn{keyIndex: keyIndex, resultOffset: i})
+			default:
+				panic("cannot mix aggregate and non-aggregate columns")
+			}
+		}
+	}
+
+	// Aggregates only referenced by HAVING are computed after the result columns
+	havingRegs := make(map[string]int)
+	hiddenCount := 0
+	if stmt.Having != nil {
+		for _, e := range findAggregates(stmt.Having) {
+			found := false
+			for _, a := range aggregateCols {
+				found = found || a.expr.String() == e.String()
+			}
+			if !found {
+				addAggregate(e, len(stmt.Columns)+hiddenCount)
+				hiddenCount++
+			}
+		}
+	}
+
+	// The rows of a single table are counted without reading them when
+	// every row is counted.
+	counting := aggregating && !grouping && !joining && stmt.Filter == nil
+	for _, a := range aggregateCols {
+		counting = counting && a.col == nil
+	}
+
+	// Resolve the columns used to sort the result
+	orderCols := make([]*metadata.ColumnDefinition, 0, len(stmt.OrderBy))
+	orderDesc := make([]bool, 0, len(stmt.OrderBy))
+	for _, o := range stmt.OrderBy {
+		ident, ok := o.Expr.(*ast.Ident)
+		if !ok {
+			panic("unsupported order by expression")
+		}
+		orderCols = append(orderCols, colLookup[ident.Value])
+		orderDesc = append(orderDesc, o.Desc)
+	}
+
+	// Distinct rows are sorted so that duplicates are adjacent, the sort
+	// keys must therefore be part of the result.
+	if stmt.Distinct {
+		if aggregating {
+			panic("DISTINCT with aggregates is not supported")
+		}
+		for _, o := range orderCols {
+			found := false
+			for _, c := range selectCols {
+				found = found || c == o
+			}
+			if !found {
+				panic("ORDER BY term must appear in the select list with DISTINCT")
+			}
 		}
-		selectCols = append(selectCols, colLookup[c])
 	}
 
 	p := initProgram()
 
-	// Set up a read cursor for the root page of the table
+	// Set up a read cursor for the root page of each table
 	readCursor := p.ReadCursor(table.RootPage)
-
-	// Allocate registers for result columns
-	firstColReg := p.RegAllocN(len(selectCols))
+	cursors := map[*metadata.ColumnDefinition]int{}
+	sourceCursors := []int{readCursor}
+	for _, s := range sources[1:] {
+		sourceCursors = append(sourceCursors, p.ReadCursor(s.table.RootPage))
+	}
+	for i, s := range sources {
+		for _, c := range s.columns() {
+			cursors[c] = sourceCursors[i]
+		}
+	}
 
 	// Set up labels for control flow
 	haltLabel := p.MakeLabel()
@@ -452,17 +888,246 @@ func SelectInstructions(tableDefs map[string]*metadata.TableDefinition, stmt *as
 	recordLabel := p.MakeLabel()
 	evalLabel := p.MakeLabel()
 
-	// Open table for reading
-	p.Op4(OpOpenRead, readCursor, table.RootPage, len(selectCols), table.Name)
+	// Allocate a block of contiguous registers
+	regBlock := func(n int) int {
+		start := p.RegAlloc()
+		for i := 1; i < n; i++ {
+			p.RegAlloc()
+		}
+		return start
+	}
+
+	// Initialize the limit and offset counters
+	limitReg := -1
+	if stmt.Limit != nil {
+		limitReg = p.RegAlloc()
+		p.OpInt(limitReg, *stmt.Limit)
+
+		// Nothing to do for LIMIT 0
+		if *stmt.Limit == 0 {
+			p.Op2(OpGoto, x, haltLabel)
+		}
+	}
+	offsetReg := -1
+	if stmt.Offset != nil {
+		offsetReg = p.RegAlloc()
+		p.OpInt(offsetReg, *stmt.Offset)
+	}
+
+	// Rows are sorted before output when ordering or distinct rows are requested.
+	// A sorter row contains the sort keys followed by the result columns.
+	// Distinct rows are also sorted by the result columns after the sort keys.
+	// Grouped rows are sorted by the group keys followed by the aggregate arguments.
+	// The single row of an aggregate query needs no sorting.
+	sorting := (len(orderCols) > 0 || stmt.Distinct) && !aggregating
+	sorterCursor := 0
+	sortRecordReg := 0
+	sorterColCount := 0
+	switch {
+	case sorting:
+		sorterColCount = len(orderCols) + len(selectCols)
+		sortRecordReg = regBlock(sorterColCount)
+		keyCount := len(orderCols)
+		if stmt.Distinct {
+			keyCount = sorterColCount
+		}
+		p.Op4(OpSorterOpen, sorterCursor, keyCount, x, orderDesc)
+	case grouping:
+		sorterColCount = len(groupCols) + aggregateArgCount
+		sortRecordReg = regBlock(sorterColCount)
+		p.Op4(OpSorterOpen, sorterCursor, len(groupCols), x, make([]bool, len(groupCols)))
+	}
+
+	// Allocate registers for result columns
+	resultCount := len(selectCols)
+	firstColReg := 0
+	aggregateArgReg := 0
+	groupKeyReg := 0
+	accumulatorReg := 0
+	if aggregating {
+		resultCount = len(stmt.Columns)
+		firstColReg = regBlock(resultCount + hiddenCount)
+		aggregateArgReg = p.RegAlloc()
+		if grouping {
+			// The key of each row is followed by the key of the current group.
+			// Each aggregate accumulates into its own register and is flushed
+			// into its result register when the group changes.
+			groupKeyReg = regBlock(2 * len(groupCols))
+			accumulatorReg = regBlock(len(aggregateCols))
+		} else {
+			// Each aggregate accumulates into its result register
+			for _, a := range aggregateCols {
+				p.OpNull(firstColReg + a.resultOffset)
+			}
+		}
+	} else if stmt.Distinct {
+		// The result columns are followed by the previous distinct row
+		firstColReg = regBlock(2 * resultCount)
+	} else {
+		firstColReg = regBlock(resultCount)
+	}
+
+	// Produce a row honoring the offset and limit counters.
+	// Rows skipped by the offset continue at skipLabel.
+	emitResultRow := func(skipLabel int, loadColumns func()) {
+		// Skip rows until the offset is exhausted
+		if offsetReg >= 0 {
+			p.Op3(OpIfPos, offsetReg, skipLabel, 1)
+		}
+
+		// Load selected columns into registers
+		loadColumns()
+
+		// Produce a Row
+		p.Op2(OpResultRow, firstColReg, resultCount)
+
+		// Stop once the limit is reached
+		if limitReg >= 0 {
+			p.Op2(OpDecrJumpZero, limitReg, haltLabel)
+		}
+	}
+
+	// Produce the row of an aggregate, replacing the state of each
+	// accumulator with its result.
+	emitAggregateRow := func(skipLabel int) {
+		for _, a := range aggregateCols {
+			p.Op4(OpAggFinal, firstColReg+a.resultOffset, x, x, aggregateFunction(a.expr))
+		}
+		emitResultRow(skipLabel, func() {})
+	}
+
+	// HAVING is evaluated against the result of each aggregate and
+	// the key of the current group.
+	for _, a := range aggregateCols {
+		if _, ok := havingRegs[a.expr.String()]; !ok {
+			havingRegs[a.expr.String()] = firstColReg + a.resultOffset
+		}
+	}
+	for i, g := range groupCols {
+		havingRegs[g.Name] = groupKeyReg + len(groupCols) + i
+	}
+
+	// Produce the row of the current group, resetting each accumulator
+	// for the next group. Groups not satisfying HAVING continue at skipLabel.
+	emitGroupRow := func(skipLabel int) {
+		for i, a := range aggregateCols {
+			p.Op4(OpAggFlush, accumulatorReg+i, x, firstColReg+a.resultOffset, aggregateFunction(a.expr))
+		}
+		if stmt.Having != nil {
+			havingLabel := p.MakeLabel()
+			having := whereClause{p: p, columns: colLookup, registers: havingRegs}
+			having.emit(reworkExpression(stmt.Having), evalContext{
+				te:          havingLabel,
+				fe:          skipLabel,
+				conjunction: true,
+			})
+			p.EmitLabel(havingLabel)
+		}
+		emitResultRow(skipLabel, func() {
+			for _, g := range groupResultCols {
+				p.Op2(OpSCopy, groupKeyReg+len(groupCols)+g.keyIndex, firstColReg+g.resultOffset)
+			}
+		})
+	}
+
+	// Load a selected column of the current row into a register
+	loadColumn := func(i int, reg int) {
+		if e, ok := computedCols[i]; ok {
+			value := whereClause{p: p, columns: colLookup, cursors: cursors}
+			p.Op2(OpSCopy, value.emit(e, evalContext{}), reg)
+			return
+		}
+		p.OpColumn(cursors[selectCols[i]], selectCols[i], reg)
+	}
+
+	// The cursor moving through the entries of the scan, the innermost
+	// loop of a join
+	scanCursor := readCursor
+	var outerLoopLabels, outerNextLabels []int
+
+	scanDoneLabel := p.MakeLabel()
+	if rowID != nil {
+		// Open table for reading
+		p.Op4(OpOpenRead, readCursor, table.RootPage, len(table.Columns), table.Name)
+
+		// Go to the row or go to the end of the scan
+		literal := whereClause{p: p, columns: colLookup, cursors: cursors}
+		p.Op3(OpSeekRowid, readCursor, scanDoneLabel, literal.emit(rowID, evalContext{}))
+
+		p.EmitLabel(evalLabel)
+	} else if counting {
+		// Open table for reading
+		p.Op4(OpOpenRead, readCursor, table.RootPage, len(table.Columns), table.Name)
+
+		// Count the rows into the result register of each aggregate
+		for _, a := range aggregateCols {
+			p.Op2(OpCount, readCursor, firstColReg+a.resultOffset)
+		}
+	} else if scan != nil {
+		// Rows not held by the index are read from the table
+		if !scan.covering {
+			p.Op4(OpOpenRead, readCursor, table.RootPage, len(table.Columns), table.Name)
+			scanCursor = p.ReadCursor(scan.index.RootPage)
+		}
+
+		// Open the index for reading
+		p.Op4(OpOpenRead, scanCursor, scan.index.RootPage, 0, scan.index.Name)
+
+		literal := whereClause{p: p, columns: colLookup, cursors: cursors}
+		upperReg := 0
+		if scan.upper != nil {
+			upperReg = literal.emit(scan.upper, evalContext{})
+		}
+
+		// Go to the first entry within the lower bound or go to the end of the scan
+		if scan.lower != nil {
+			p.Op4(OpSeekGe, scanCursor, scanDoneLabel, literal.emit(scan.lower, evalContext{}), 1)
+		} else {
+			p.Op2(OpRewind, scanCursor, scanDoneLabel)
+		}
+
+		// The scan is complete once an entry is past the upper bound
+		p.EmitLabel(evalLabel)
+		if scan.upper != nil {
+			p.Op4(scan.upperOp, scanCursor, scanDoneLabel, upperReg, 1)
+		}
+
+		// Move to the row of the entry
+		if !scan.covering {
+			p.Op3(OpSeek, readCursor, nextLabel, scanCursor)
+		}
+	} else {
+		// Open tables for reading
+		for i, s := range sources {
+			p.Op4(OpOpenRead, sourceCursors[i], s.table.RootPage, len(s.table.Columns), s.table.Name)
+		}
+
+		// Go to the first row within the lower bound or the first entry in
+		// btree, or go to the end of the scan
+		if lowerRowID != nil {
+			literal := whereClause{p: p, columns: colLookup, cursors: cursors}
+			p.Op3(lowerRowIDOp, readCursor, scanDoneLabel, literal.emit(lowerRowID, evalContext{}))
+		} else {
+			p.Op2(OpRewind, readCursor, scanDoneLabel)
+		}
+
+		// Each row of a table is joined with every row of the following
+		// table. When a table is empty the row of the previous table is done.
+		for i := 1; i < len(sources); i++ {
+			outerLoopLabels = append(outerLoopLabels, p.MakeLabel())
+			outerNextLabels = append(outerNextLabels, p.MakeLabel())
+			p.EmitLabel(outerLoopLabels[i-1])
+			p.Op2(OpRewind, sourceCursors[i], outerNextLabels[i-1])
+		}
+		scanCursor = sourceCursors[len(sources)-1]
 
-	// Go to first entry in btree or go to halt
-	p.Op2(OpRewind, readCursor, haltLabel)
+		p.EmitLabel(evalLabel)
+	}
 
 	// Add instructions to check against each row
-	p.EmitLabel(evalLabel)
 	if stmt.Filter != nil {
 		transformedExpr := reworkExpression(stmt.Filter)
-		where := whereClause{p: p, tableDefs: tableDefs}
+		where := whereClause{p: p, columns: colLookup, cursors: cursors}
 		where.emit(transformedExpr, evalContext{
 			te:          recordLabel,
 			fe:          nextLabel,
@@ -470,29 +1135,139 @@ func SelectInstructions(tableDefs map[string]*metadata.TableDefinition, stmt *as
 		})
 	}
 
-	// Load selected columns into registers
-	for i, c := range selectCols {
-		p.Op3(OpColumn, readCursor, c.Offset, firstColReg+i)
-	}
-
-	// Produce a Row
+	// The record satisfies the filter
 	p.EmitLabel(recordLabel)
-	p.Op2(OpResultRow, firstColReg, len(selectCols))
 
-	// Move cursor to next record and go to address if success, otherwise, fallthrough
+	switch {
+	case grouping:
+		// Load the group keys and aggregate arguments into the sorter
+		for i, c := range groupCols {
+			p.OpColumn(cursors[c], c, sortRecordReg+i)
+		}
+		for _, a := range aggregateCols {
+			if a.col != nil {
+				p.OpColumn(cursors[a.col], a.col, sortRecordReg+a.sorterCol)
+			}
+		}
+		p.Op3(OpSorterInsert, sorterCursor, sortRecordReg, sorterColCount)
+	case counting:
+		// The rows were counted without reading them
+	case aggregating:
+		// Step each aggregate with the row
+		for _, a := range aggregateCols {
+			if a.col != nil {
+				p.OpColumn(cursors[a.col], a.col, aggregateArgReg)
+				p.Op4(OpAggStep, firstColReg+a.resultOffset, 1, aggregateArgReg, aggregateFunction(a.expr))
+			} else {
+				p.Op4(OpAggStep, firstColReg+a.resultOffset, 0, 0, aggregateFunction(a.expr))
+			}
+		}
+	case sorting:
+		// Load the sort keys and selected columns into the sorter
+		for i, c := range orderCols {
+			p.OpColumn(cursors[c], c, sortRecordReg+i)
+		}
+		for i := range selectCols {
+			loadColumn(i, sortRecordReg+len(orderCols)+i)
+		}
+		p.Op3(OpSorterInsert, sorterCursor, sortRecordReg, sorterColCount)
+	default:
+		emitResultRow(nextLabel, func() {
+			for i := range selectCols {
+				loadColumn(i, firstColReg+i)
+			}
+		})
+	}
+
+	// Move cursor to next record and go to address if success, otherwise, fallthrough.
+	// There is no other row after one read by its rowid or after counting.
 	p.EmitLabel(nextLabel)
-	p.Op2(OpNext, readCursor, evalLabel)
+	if rowID == nil && !counting {
+		p.Op2(OpNext, scanCursor, evalLabel)
+	}
+	for i := len(outerNextLabels) - 1; i >= 0; i-- {
+		p.EmitLabel(outerNextLabels[i])
+		p.Op2(OpNext, sourceCursors[i], outerLoopLabels[i])
+	}
+
+	// The scan is complete
+	p.EmitLabel(scanDoneLabel)
+
+	switch {
+	case grouping:
+		groupLoopLabel := p.MakeLabel()
+		newGroupLabel := p.MakeLabel()
+		sameGroupLabel := p.MakeLabel()
+
+		// Sort the rows by group
+		p.Op2(OpSorterSort, sorterCursor, haltLabel)
+
+		// Compare the key of each row with the current group
+		p.EmitLabel(groupLoopLabel)
+		for i := range groupCols {
+			p.Op3(OpSorterColumn, sorterCursor, i, groupKeyReg+i)
+		}
+		p.Op3(OpGroupBy, groupKeyReg, sameGroupLabel, len(groupCols))
+
+		// The group changed, produce the row for the previous group
+		emitGroupRow(newGroupLabel)
+
+		// Remember the key of the new group
+		p.EmitLabel(newGroupLabel)
+		for i := range groupCols {
+			p.Op2(OpSCopy, groupKeyReg+i, groupKeyReg+len(groupCols)+i)
+		}
+
+		// Step each aggregate with the row
+		p.EmitLabel(sameGroupLabel)
+		for i, a := range aggregateCols {
+			if a.col != nil {
+				p.Op3(OpSorterColumn, sorterCursor, a.sorterCol, aggregateArgReg)
+				p.Op4(OpAggStep, accumulatorReg+i, 1, aggregateArgReg, aggregateFunction(a.expr))
+			} else {
+				p.Op4(OpAggStep, accumulatorReg+i, 0, 0, aggregateFunction(a.expr))
+			}
+		}
+		p.Op2(OpSorterNext, sorterCursor, groupLoopLabel)
+
+		// Produce the row for the last group
+		emitGroupRow(haltLabel)
+	case counting:
+		// Produce the counts
+		emitResultRow(haltLabel, func() {})
+	case aggregating:
+		// Produce the aggregated row
+		emitAggregateRow(haltLabel)
+	case sorting:
+		// Sort the rows and produce them in order
+		outputLabel := p.MakeLabel()
+		sorterNextLabel := p.MakeLabel()
+		p.Op2(OpSorterSort, sorterCursor, haltLabel)
+		p.EmitLabel(outputLabel)
+		loadColumns := func() {
+			for i := range selectCols {
+				p.Op3(OpSorterColumn, sorterCursor, len(orderCols)+i, firstColReg+i)
+			}
+		}
+		if stmt.Distinct {
+			// Skip duplicates before the offset and limit are applied
+			loadColumns()
+			p.Op3(OpDistinct, firstColReg, sorterNextLabel, resultCount)
+			loadColumns = func() {}
+		}
+		emitResultRow(sorterNextLabel, loadColumns)
+		p.EmitLabel(sorterNextLabel)
+		p.Op2(OpSorterNext, sorterCursor, outputLabel)
+	}
 
 	// Set the jump address for halt if there are no records
 	p.EmitLabel(haltLabel)
 	p.OpHalt()
 
-	// Load all literals into registers
-
 	// Finalize the program to return complete instructions
 	p.Finalize()
 
-	return p.instructions
+	return p.instructions, nil
 }
 
 func BeginInstructions(stmt *ast.BeginStatement) []*Instruction {
@@ -522,6 +1297,33 @@ func RollbackInstructions(stmt *ast.RollbackStatement) []*Instruction {
 	return p.instructions
 }
 
+func SavepointInstructions(stmt *ast.SavepointStatement) []*Instruction {
+	p := initProgram()
+
+	p.Op4(OpSavepoint, int(SavepointBegin), x, x, stmt.Name)
+	p.OpHalt()
+
+	return p.instructions
+}
+
+func ReleaseInstructions(stmt *ast.ReleaseStatement) []*Instruction {
+	p := initProgram()
+
+	p.Op4(OpSavepoint, int(SavepointRelease), x, x, stmt.Name)
+	p.OpHalt()
+
+	return p.instructions
+}
+
+func RollbackToInstructions(stmt *ast.RollbackToStatement) []*Instruction {
+	p := initProgram()
+
+	p.Op4(OpSavepoint, int(SavepointRollback), x, x, stmt.Name)
+	p.OpHalt()
+
+	return p.instructions
+}
+
 type evalContext struct {
 	conjunction bool
 	disjunction bool
@@ -530,8 +1332,20 @@ type evalContext struct {
 }
 
 type whereClause struct {
-	p         *program
-	tableDefs map[string]*metadata.TableDefinition
+	p *program
+
+	// columns of the tables of the query by name, either unqualified or
+	// qualified by their table
+	columns map[string]*metadata.ColumnDefinition
+
+	// registers holding values already computed for the expression, e.g.
+	// aggregates and group keys in a HAVING clause. When set, columns are
+	// only resolved from here rather than read from the cursor.
+	registers map[string]int
+
+	// cursor each column is read with, columns not found are read with
+	// the first cursor
+	cursors map[*metadata.ColumnDefinition]int
 }
 
 func (c whereClause) emit(expr ast.Expression, evalCtx evalContext) int {
@@ -540,22 +1354,64 @@ func (c whereClause) emit(expr ast.Expression, evalCtx evalContext) int {
 		return c.emitLogicalExpression(e, evalCtx)
 	case *ast.BinaryOperation:
 		return c.emitBinaryOperation(e, evalCtx)
+	case *ast.NullTest:
+		return c.emitNullTest(e, evalCtx)
+	case *ast.InExpression:
+		return c.emitInExpression(e, evalCtx)
+	case *ast.CaseExpression:
+		return c.emitCase(e)
 	case *ast.BasicLiteral:
 		litReg := c.p.RegAlloc()
 		switch e.Kind {
 		case lexer.TokenString:
 			c.p.OpString(litReg, e.Value)
+		case lexer.TokenNumber:
+			if v, f, ok := integerLiteral(e.Value); ok {
+				c.p.OpInt(litReg, v)
+			} else {
+				c.p.OpFloat(litReg, f)
+			}
+		case lexer.TokenFloat:
+			v, err := strconv.ParseFloat(e.Value, 64)
+			if err != nil {
+				panic(err)
+			}
+			c.p.OpFloat(litReg, v)
+		case lexer.TokenBlob:
+			v, err := hex.DecodeString(e.Value)
+			if err != nil {
+				panic(err)
+			}
+			c.p.OpBlob(litReg, v)
+		case lexer.TokenNull:
+			c.p.OpNull(litReg)
+		default:
+			panic("unsupported literal")
 		}
 		return litReg
+	case *ast.Parameter:
+		paramReg := c.p.RegAlloc()
+		c.p.Op2(OpVariable, e.Index, paramReg)
+		return paramReg
+	case *ast.AggregateExpression:
+		reg, ok := c.registers[e.String()]
+		if !ok {
+			panic("aggregate functions are not allowed here")
+		}
+		return reg
 	case *ast.Ident:
-		// Find the table and cursor
-		_, columnDef, err := c.emitIdent(e.Value)
+		if c.registers != nil {
+			// a column of a HAVING clause is a group key, see checkSelect
+			return c.registers[c.columns[e.Value].Name]
+		}
+
+		// Find the column and cursor
+		columnDef, err := c.emitIdent(e.Value)
 		if err != nil {
 			panic(err)
 		}
-		// TODO: get correct read cursor
 		colReg := c.p.RegAlloc()
-		c.p.Op3(OpColumn, 0, columnDef.Offset, colReg)
+		c.p.OpColumn(c.cursors[columnDef], columnDef, colReg)
 		return colReg
 	default:
 		panic("unexpected expression type")
@@ -582,12 +1438,17 @@ func (c whereClause) emitLogicalExpression(e *ast.LogicalOperation, evalCtx eval
 		trueLabel := c.p.MakeLabel()
 		lastTermIndex := len(e.Terms) - 1
 		for i, t := range e.Terms {
+			// If any term evaluates to false, short circuit evaluation
 			if i != lastTermIndex {
 				c.emit(t, evalContext{fe: evalCtx.fe, conjunction: true})
 			} else {
-				c.emit(t, evalContext{te: evalCtx.te, conjunction: true})
+				c.emit(t, evalContext{te: evalCtx.te, fe: evalCtx.fe, conjunction: true})
 			}
 		}
+		// Every term held, an enclosing OR is satisfied
+		if evalCtx.disjunction {
+			c.p.Op2(OpGoto, x, evalCtx.te)
+		}
 		c.p.EmitLabel(trueLabel)
 	default:
 		panic("unexpected logical operator")
@@ -596,16 +1457,147 @@ func (c whereClause) emitLogicalExpression(e *ast.LogicalOperation, evalCtx eval
 	return -1
 }
 
-func (c whereClause) emitIdent(ident string) (*metadata.TableDefinition, *metadata.ColumnDefinition, error) {
-	// TODO: Make this efficient and use table aliases
-	for _, t := range c.tableDefs {
-		for _, c := range t.Columns {
-			if c.Name == ident {
-				return t, c, nil
-			}
+// emitIdent finds the column of an ident, which is qualified by the name or
+// alias of its table when more than one table has a column of that name
+func (c whereClause) emitIdent(ident string) (*metadata.ColumnDefinition, error) {
+	col, ok := c.columns[ident]
+	if !ok {
+		return nil, fmt.Errorf("no such column: %s", ident)
+	}
+	if col == nil {
+		return nil, fmt.Errorf("ambiguous column name: %s", ident)
+	}
+	return col, nil
+}
+
+func (c whereClause) emitNullTest(n *ast.NullTest, evalCtx evalContext) int {
+	reg := c.emit(n.Expr, evalContext{})
+
+	// Jump to the false exit when the test fails, or the true exit when it passes
+	passOp, failOp := OpIsNull, OpNotNull
+	if n.Not {
+		passOp, failOp = OpNotNull, OpIsNull
+	}
+	if evalCtx.conjunction {
+		c.p.Op2(failOp, reg, evalCtx.fe)
+	} else if evalCtx.disjunction {
+		c.p.Op2(passOp, reg, evalCtx.te)
+	} else {
+		panic("unknown logical context")
+	}
+
+	c.p.Comment(n.String())
+	return -1
+}
+
+func (c whereClause) emitInExpression(in *ast.InExpression, evalCtx evalContext) int {
+	// pass and fail are where evaluation continues when the test holds or
+	// not. One of them is a label local to the test.
+	var pass, fail int
+	if evalCtx.conjunction {
+		pass, fail = c.p.MakeLabel(), evalCtx.fe
+	} else if evalCtx.disjunction {
+		pass, fail = evalCtx.te, c.p.MakeLabel()
+	} else {
+		panic("unknown logical context")
+	}
+
+	// NULL is neither in nor not in a list with values. Once the value is known
+	// not to be NULL, OpEq never matches a NULL in the list. Nothing is in an
+	// empty list so it needs no checks at all.
+	var reg int
+	if len(in.Values) > 0 {
+		reg = c.emit(in.Expr, evalContext{})
+		c.p.Op2(OpIsNull, reg, fail)
+	}
+
+	for _, v := range in.Values {
+		valueReg := c.emit(v, evalContext{})
+		if in.Not {
+			// A NULL in the list might be any value so NOT IN can't hold
+			c.p.Op2(OpIsNull, valueReg, fail)
+			c.p.Op3(OpEq, reg, fail, valueReg)
+		} else {
+			c.p.Op3(OpEq, reg, pass, valueReg)
+		}
+	}
+
+	// Falling through the checks means NOT IN holds or IN does not
+	if in.Not && evalCtx.disjunction {
+		c.p.Op2(OpGoto, x, pass)
+	} else if !in.Not && evalCtx.conjunction {
+		c.p.Op2(OpGoto, x, fail)
+	}
+
+	if evalCtx.conjunction {
+		c.p.EmitLabel(pass)
+	} else {
+		c.p.EmitLabel(fail)
+	}
+
+	c.p.Comment(in.String())
+	return -1
+}
+
+// emitCase evaluates each arm in order and returns the register holding the
+// result of the first arm that matches.
+func (c whereClause) emitCase(e *ast.CaseExpression) int {
+	resultReg := c.p.RegAlloc()
+	elseLabel := c.p.MakeLabel()
+	endLabel := c.p.MakeLabel()
+
+	operandReg := 0
+	if e.Operand != nil {
+		operandReg = c.emit(e.Operand, evalContext{})
+		// A NULL operand matches no arm
+		c.p.Op2(OpIsNull, operandReg, elseLabel)
+	}
+
+	for _, w := range e.Whens {
+		nextArmLabel := c.p.MakeLabel()
+		if e.Operand != nil {
+			valueReg := c.emit(w.Condition, evalContext{})
+			c.p.Op4(OpNe, operandReg, nextArmLabel, valueReg, true)
+		} else {
+			c.emit(reworkExpression(w.Condition), evalContext{fe: nextArmLabel, conjunction: true})
 		}
+		c.p.Op2(OpSCopy, c.emit(w.Result, evalContext{}), resultReg)
+		c.p.Op2(OpGoto, x, endLabel)
+		c.p.EmitLabel(nextArmLabel)
+	}
+
+	// No arm matched
+	c.p.EmitLabel(elseLabel)
+	if e.Else != nil {
+		c.p.Op2(OpSCopy, c.emit(e.Else, evalContext{}), resultReg)
+	} else {
+		c.p.OpNull(resultReg)
 	}
-	return nil, nil, errors.New("cannot resolve ident")
+	c.p.EmitLabel(endLabel)
+
+	return resultReg
+}
+
+// relationalOps maps a relational or pattern matching operator to the op
+// jumping when the comparison holds and the op jumping when it does not.
+var relationalOps = map[string]struct {
+	op      Op
+	negated Op
+}{
+	"<":        {OpLt, OpGe},
+	"<=":       {OpLe, OpGt},
+	">":        {OpGt, OpLe},
+	">=":       {OpGe, OpLt},
+	"LIKE":     {OpLike, OpNotLike},
+	"NOT LIKE": {OpNotLike, OpLike},
+}
+
+// arithmeticOps maps an arithmetic operator to the op computing it
+var arithmeticOps = map[string]Op{
+	"+": OpAdd,
+	"-": OpSubtract,
+	"*": OpMultiply,
+	"/": OpDivide,
 }
 
 func (c whereClause) emitBinaryOperation(o *ast.BinaryOperation, evalCtx evalContext) int {
@@ -614,30 +1606,145 @@ func (c whereClause) emitBinaryOperation(o *ast.BinaryOperation, evalCtx evalCon
 		leftReg := c.emit(o.Left, evalContext{})
 		rightReg := c.emit(o.Right, evalContext{})
 		if evalCtx.conjunction {
-			c.p.Op3(OpNe, leftReg, evalCtx.fe, rightReg)
+			// Rows where either side is NULL do not satisfy the comparison
+			c.p.Op4(OpNe, leftReg, evalCtx.fe, rightReg, true)
 		} else if evalCtx.disjunction {
 			c.p.Op3(OpEq, leftReg, evalCtx.te, rightReg)
 		} else {
 			panic("unknown logical context")
 		}
 
+		c.p.Comment(o.String())
+		return -1
+	case "<", "<=", ">", ">=", "LIKE", "NOT LIKE":
+		leftReg := c.emit(o.Left, evalContext{})
+		rightReg := c.emit(o.Right, evalContext{})
+		cmp := relationalOps[o.Operator]
+		if evalCtx.conjunction {
+			// Rows where either side is NULL do not satisfy the comparison
+			c.p.Op4(cmp.negated, leftReg, evalCtx.fe, rightReg, true)
+		} else if evalCtx.disjunction {
+			c.p.Op3(cmp.op, leftReg, evalCtx.te, rightReg)
+		} else {
+			panic("unknown logical context")
+		}
+
 		c.p.Comment(o.String())
 		return -1
 	case "!=":
 		leftReg := c.emit(o.Left, evalContext{})
 		rightReg := c.emit(o.Right, evalContext{})
-		if evalCtx.te != 0 {
+		if evalCtx.conjunction {
+			c.p.Op4(OpEq, leftReg, evalCtx.fe, rightReg, true)
+		} else if evalCtx.disjunction {
 			c.p.Op3(OpNe, leftReg, evalCtx.te, rightReg)
 		} else {
-			c.p.Op3(OpEq, leftReg, evalCtx.fe, rightReg)
+			panic("unknown logical context")
 		}
 		c.p.Comment(o.String())
 		return -1
+	case "+", "-", "*", "/":
+		leftReg := c.emit(o.Left, evalContext{})
+		rightReg := c.emit(o.Right, evalContext{})
+		resultReg := c.p.RegAlloc()
+		c.p.Op3(arithmeticOps[o.Operator], leftReg, rightReg, resultReg)
+		c.p.Comment(o.String())
+		return resultReg
 	}
 
 	panic("unexpected operator")
 }
 
+// aggregateFunction names the aggregator of an aggregate expression
+func aggregateFunction(e *ast.AggregateExpression) string {
+	if e.Distinct {
+		return e.Name + " DISTINCT"
+	}
+	return e.Name
+}
+
+// findAggregates returns the aggregates referenced by an expression
+func findAggregates(expr ast.Expression) []*ast.AggregateExpression {
+	switch e := expr.(type) {
+	case *ast.AggregateExpression:
+		return []*ast.AggregateExpression{e}
+	case *ast.BinaryOperation:
+		return append(findAggregates(e.Left), findAggregates(e.Right)...)
+	case *ast.UnaryOperation:
+		return findAggregates(e.Expr)
+	case *ast.NullTest:
+		return findAggregates(e.Expr)
+	case *ast.BetweenExpression:
+		return append(findAggregates(e.Expr), append(findAggregates(e.Low), findAggregates(e.High)...)...)
+	case *ast.CaseExpression:
+		aggregates := findAggregates(e.Operand)
+		for _, w := range e.Whens {
+			aggregates = append(aggregates, findAggregates(w.Condition)...)
+			aggregates = append(aggregates, findAggregates(w.Result)...)
+		}
+		return append(aggregates, findAggregates(e.Else)...)
+	case *ast.InExpression:
+		aggregates := findAggregates(e.Expr)
+		for _, v := range e.Values {
+			aggregates = append(aggregates, findAggregates(v)...)
+		}
+		return aggregates
+	case *ast.LogicalOperation:
+		var aggregates []*ast.AggregateExpression
+		for _, t := range e.Terms {
+			aggregates = append(aggregates, findAggregates(t)...)
+		}
+		return aggregates
+	default:
+		return nil
+	}
+}
+
+// negatedOps maps a comparison operator to the operator of its negation
+var negatedOps = map[string]string{
+	"=":        "!=",
+	"!=":       "=",
+	"<":        ">=",
+	"<=":       ">",
+	">":        "<=",
+	">=":       "<",
+	"LIKE":     "NOT LIKE",
+	"NOT LIKE": "LIKE",
+	"AND":      "OR",
+	"OR":       "AND",
+}
+
+// negate produces the negation of the operand of a NOT without the NOT.
+// Comparisons are inverted and NOT is pushed into the terms of AND and OR.
+// It reports false when the operand is not a condition.
+func negate(not *ast.UnaryOperation) (ast.Expression, bool) {
+	switch e := not.Expr.(type) {
+	case *ast.UnaryOperation:
+		return e.Expr, true
+	case *ast.BinaryOperation:
+		op, ok := negatedOps[e.Operator]
+		if !ok {
+			return nil, false
+		}
+		if e.Operator == "AND" || e.Operator == "OR" {
+			return &ast.BinaryOperation{
+				Left:     &ast.UnaryOperation{Op: "NOT", Expr: e.Left},
+				Operator: op,
+				Right:    &ast.UnaryOperation{Op: "NOT", Expr: e.Right},
+			}, true
+		}
+		return &ast.BinaryOperation{Left: e.Left, Operator: op, Right: e.Right}, true
+	case *ast.NullTest:
+		return &ast.NullTest{Expr: e.Expr, Not: !e.Not}, true
+	case *ast.InExpression:
+		return &ast.InExpression{Expr: e.Expr, Values: e.Values, Not: !e.Not}, true
+	case *ast.BetweenExpression:
+		return &ast.BetweenExpression{Expr: e.Expr, Low: e.Low, High: e.High, Not: !e.Not}, true
+	default:
+		return nil, false
+	}
+}
+
 func reworkExpression(expr ast.Expression) ast.Expression {
 	logicalGrouper := logicalGrouper{}
 	return logicalGrouper.Visit(expr)
@@ -667,13 +1774,31 @@ func (g logicalGrouper) Visit(expr ast.Expression) ast.Expression {
 
 			rightExpr := g.Visit(e.Right)
 			if rightTerm, ok := rightExpr.(*ast.LogicalOperation); ok && rightTerm.Operator == e.Operator {
-				result.Terms = rightTerm.Terms
+				result.Terms = append(result.Terms, rightTerm.Terms...)
 			} else {
 				result.Terms = append(result.Terms, rightExpr)
 			}
 
 			return result
 		}
+	case *ast.UnaryOperation:
+		// NOT is applied to the operand so that rows where it is NULL are
+		// still filtered out, NOT (a = b) is a != b.
+		if negated, ok := negate(e); ok {
+			return g.Visit(negated)
+		}
+	case *ast.BetweenExpression:
+		// x BETWEEN a AND b is x >= a AND x <= b. NOT BETWEEN is x < a OR x > b.
+		lowOp, highOp, operator := ">=", "<=", "AND"
+		if e.Not {
+			lowOp, highOp, operator = "<", ">", "OR"
+		}
+
+		return g.Visit(&ast.BinaryOperation{
+			Left:     &ast.BinaryOperation{Left: e.Expr, Operator: lowOp, Right: e.Low},
+			Operator: operator,
+			Right:    &ast.BinaryOperation{Left: e.Expr, Operator: highOp, Right: e.High},
+		})
 	}
 
 	return expr
@@ -1,22 +1,47 @@
 package virtualmachine
 
 import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/joeandaverde/tinydb/internal/metadata"
+	"github.com/joeandaverde/tinydb/internal/pager"
 	"github.com/joeandaverde/tinydb/internal/storage"
 	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
 	"github.com/joeandaverde/tinydb/tsql/parser"
 )
 
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
 // jumpOps are the ops that contain a jump destination in P2
 var jumpOps = map[Op]bool{
 	OpEq: true, OpNe: true,
 	OpLt: true, OpLe: true,
 	OpGt: true, OpGe: true,
 	OpRewind: true, OpNext: true,
+	OpGoto: true, OpIfPos: true,
+	OpDecrJumpZero: true,
+	OpSorterSort:   true,
+	OpSorterNext:   true,
+	OpIsNull:       true,
+	OpLike:         true,
+	OpNotLike:      true,
+	OpNotNull:      true,
+	OpGroupBy:      true,
+	OpDistinct:     true,
+	OpSeek:         true,
+	OpSeekGe:       true,
+	OpSeekRowid:    true,
+	OpIdxGt:        true,
+	OpIdxGe:        true,
+	OpIdxLt:        true,
+	OpIdxLe:        true,
 }
 
 var testTableDefs = map[string]*metadata.TableDefinition{
@@ -31,13 +56,36 @@ var testTableDefs = map[string]*metadata.TableDefinition{
 	},
 }
 
+func TestProgram_RegAllocN(t *testing.T) {
+	r := require.New(t)
+	const n = 4
+
+	p := initProgram()
+	for i := 0; i < n; i++ {
+		r.Equal(i, p.RegAlloc())
+	}
+
+	// A block of registers follows the registers already taken
+	r.Equal(n, p.RegAllocN(n))
+	r.Equal(2*n, p.RegAlloc())
+
+	// A gap smaller than the block is skipped and remains free
+	p.RegRelease(1)
+	p.RegRelease(2)
+	r.Equal(2*n+1, p.RegAllocN(3))
+	r.Equal(1, p.RegAllocN(2))
+	r.Equal(2*n+4, p.RegAlloc())
+}
+
 func TestSelectInstructions(t *testing.T) {
 	r := require.New(t)
 
 	stmt, err := parser.ParseStatement("SELECT * FROM foo")
 	r.NoError(err)
 
-	instructions := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
 	r.NotEmpty(instructions)
 	result := Instructions(instructions).String()
 	r.NotEmpty(result)
@@ -71,7 +119,9 @@ func TestSelectInstructions_SingleConditionWhereClause(t *testing.T) {
 	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE email = 'a'")
 	r.NoError(err)
 
-	instructions := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
 	r.NotEmpty(instructions)
 
 	assertJumpsValid(instructions, t)
@@ -110,7 +160,9 @@ func TestSelectInstructions2(t *testing.T) {
 	`)
 	r.NoError(err)
 
-	instructions := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
 	r.NotEmpty(instructions)
 
 	code := Instructions(instructions).String()
@@ -119,6 +171,27 @@ func TestSelectInstructions2(t *testing.T) {
 	assertJumpsValid(instructions, t)
 }
 
+func TestSelectInstructions_TwoTermOr(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id = 1 OR state = 'b'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the first term produces the row when it holds, the last skips to
+	// the next record when it fails
+	r.Len(groupedByOp[OpEq], 1)
+	r.Len(groupedByOp[OpNe], 1)
+	r.Equal(groupedByOp[OpNe][0].addr+1, groupedByOp[OpEq][0].ixn.P2)
+	r.Equal(groupedByOp[OpNext][0].addr, groupedByOp[OpNe][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
 func TestSelectInstructions3(t *testing.T) {
 	r := require.New(t)
 
@@ -131,7 +204,9 @@ func TestSelectInstructions3(t *testing.T) {
 	`)
 	r.NoError(err)
 
-	instructions := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
 	r.NotEmpty(instructions)
 
 	code := Instructions(instructions).String()
@@ -140,6 +215,1019 @@ func TestSelectInstructions3(t *testing.T) {
 	assertJumpsValid(instructions, t)
 }
 
+func TestSelectInstructions_ThreeTermAnd(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id = 1 AND email = 'a' AND state = 'b'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// every term jumps to the next record when it fails
+	r.Len(groupedByOp[OpNe], 3)
+	nextAddr := groupedByOp[OpNext][0].addr
+	for _, ne := range groupedByOp[OpNe] {
+		r.Equal(nextAddr, ne.ixn.P2)
+	}
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_NestedAnd(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id = 1 AND (email = 'a' AND (state = 'b' AND id = 2))")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// nested conjunctions are flattened without losing terms
+	r.Len(groupedByOp[OpNe], 4)
+	nextAddr := groupedByOp[OpNext][0].addr
+	for _, ne := range groupedByOp[OpNe] {
+		r.Equal(nextAddr, ne.ixn.P2)
+	}
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_Between(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id = 1 AND id BETWEEN 3 AND 7")
+	r.NoError(err)
+
+	// BETWEEN is lowered into the enclosing conjunction
+	r.Equal(&ast.LogicalOperation{
+		Operator: "AND",
+		Terms: []ast.Expression{
+			&ast.BinaryOperation{Left: &ast.Ident{Value: "id"}, Operator: "=", Right: &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber}},
+			&ast.BinaryOperation{Left: &ast.Ident{Value: "id"}, Operator: ">=", Right: &ast.BasicLiteral{Value: "3", Kind: lexer.TokenNumber}},
+			&ast.BinaryOperation{Left: &ast.Ident{Value: "id"}, Operator: "<=", Right: &ast.BasicLiteral{Value: "7", Kind: lexer.TokenNumber}},
+		},
+	}, reworkExpression(stmt.(*ast.SelectStatement).Filter))
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the bounds are inclusive so the negated ops skip the row
+	nextAddr := groupedByOp[OpNext][0].addr
+	r.Len(groupedByOp[OpLt], 1)
+	r.Equal(nextAddr, groupedByOp[OpLt][0].ixn.P2)
+	r.Len(groupedByOp[OpGt], 1)
+	r.Equal(nextAddr, groupedByOp[OpGt][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_AndWithinOr(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id BETWEEN 3 AND 7 OR email = 'a'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// when every term of the conjunction holds the row is produced without
+	// evaluating the rest of the disjunction
+	r.Len(groupedByOp[OpGoto], 1)
+	r.Len(groupedByOp[OpNe], 1)
+	r.Equal(groupedByOp[OpNe][0].addr+1, groupedByOp[OpGoto][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_RangesWithinOr(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE (id > 1 AND email < 'm') OR state = 'TX'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// either failed range moves on to the last term of the disjunction
+	r.Len(groupedByOp[OpLe], 1)
+	r.Len(groupedByOp[OpGe], 1)
+	r.Len(groupedByOp[OpNe], 1)
+	stateTest := groupedByOp[OpGoto][0].addr + 1
+	r.Equal(stateTest, groupedByOp[OpLe][0].ixn.P2)
+	r.Equal(stateTest, groupedByOp[OpGe][0].ixn.P2)
+
+	// when both ranges hold the row is produced, otherwise the last term decides
+	r.Len(groupedByOp[OpGoto], 1)
+	r.Equal(groupedByOp[OpNe][0].addr+1, groupedByOp[OpGoto][0].ixn.P2)
+	r.Equal(groupedByOp[OpNext][0].addr, groupedByOp[OpNe][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_NestedOrWithinAndWithinOr(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE (id >= 1 AND (email <= 'b' OR state > 'm')) OR id < 0")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the conjunction moves to the last term of the outer disjunction when
+	// its range or both terms of the inner disjunction fail
+	r.Len(groupedByOp[OpGoto], 1)
+	r.Len(groupedByOp[OpLe], 2)
+	lastTerm := groupedByOp[OpGoto][0].addr + 1
+	r.Equal(lastTerm, groupedByOp[OpLt][0].ixn.P2)
+	r.Equal(lastTerm, groupedByOp[OpLe][1].ixn.P2)
+
+	// the first term of the inner disjunction holding completes the conjunction
+	r.Equal(groupedByOp[OpGoto][0].addr, groupedByOp[OpLe][0].ixn.P2)
+	r.Equal(groupedByOp[OpGe][0].addr+1, groupedByOp[OpGoto][0].ixn.P2)
+
+	// the last term of the outer disjunction skips the row when it fails
+	r.Equal(groupedByOp[OpNext][0].addr, groupedByOp[OpGe][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_Case(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT CASE WHEN id = 1 THEN 'one' WHEN id = 2 THEN 'two' END FROM foo")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// each arm that fails moves on to the next, each arm that matches skips the rest
+	r.Len(groupedByOp[OpNe], 2)
+	r.Len(groupedByOp[OpGoto], 2)
+	r.Equal(groupedByOp[OpGoto][0].addr+1, groupedByOp[OpNe][0].ixn.P2)
+	r.Equal(groupedByOp[OpGoto][1].addr+1, groupedByOp[OpNe][1].ixn.P2)
+	r.Equal(groupedByOp[OpGoto][0].ixn.P2, groupedByOp[OpGoto][1].ixn.P2)
+
+	// without ELSE the result is NULL
+	r.Len(groupedByOp[OpNull], 1)
+	r.Equal(groupedByOp[OpGoto][1].addr+1, groupedByOp[OpNull][0].addr)
+	r.Equal(groupedByOp[OpNull][0].addr+1, groupedByOp[OpGoto][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_Comparisons(t *testing.T) {
+	tests := []struct {
+		operator string
+		op       Op
+		negated  Op
+	}{
+		{"<", OpLt, OpGe},
+		{"<=", OpLe, OpGt},
+		{">", OpGt, OpLe},
+		{">=", OpGe, OpLt},
+	}
+	for _, tc := range tests {
+		t.Run(tc.operator, func(t *testing.T) {
+			r := require.New(t)
+
+			// A single comparison jumps to the next record when it does not hold
+			stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE id " + tc.operator + " 5")
+			r.NoError(err)
+			instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+			r.NoError(err)
+			groupedByOp := groupInstructions(instructions)
+			r.Len(groupedByOp[tc.negated], 1)
+			r.Equal(groupedByOp[OpNext][0].addr, groupedByOp[tc.negated][0].ixn.P2)
+			r.Equal(true, groupedByOp[tc.negated][0].ixn.P4)
+			assertJumpsValid(instructions, t)
+
+			// Within OR the comparison jumps to the record when it holds
+			stmt, err = parser.ParseStatement("SELECT * FROM foo WHERE id " + tc.operator + " 5 OR email = 'a'")
+			r.NoError(err)
+			instructions, err = SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+			r.NoError(err)
+			groupedByOp = groupInstructions(instructions)
+			r.Len(groupedByOp[tc.op], 1)
+			r.Nil(groupedByOp[tc.op][0].ixn.P4)
+			assertJumpsValid(instructions, t)
+		})
+	}
+}
+
+func TestSelectInstructions_NullTest(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE email IS NULL AND state IS NOT NULL")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// each test jumps to the next record when it fails
+	nextAddr := groupedByOp[OpNext][0].addr
+	r.Len(groupedByOp[OpNotNull], 1)
+	r.Equal(nextAddr, groupedByOp[OpNotNull][0].ixn.P2)
+	r.Len(groupedByOp[OpIsNull], 1)
+	r.Equal(nextAddr, groupedByOp[OpIsNull][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_In(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE email IN ('a', 'b') AND id NOT IN (1, 2)")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+	nextAddr := groupedByOp[OpNext][0].addr
+
+	// IN jumps past the goto to the next record when a value matches
+	r.Len(groupedByOp[OpGoto], 1)
+	r.Equal(nextAddr, groupedByOp[OpGoto][0].ixn.P2)
+	r.Len(groupedByOp[OpEq], 4)
+	r.Equal(groupedByOp[OpGoto][0].addr+1, groupedByOp[OpEq][0].ixn.P2)
+	r.Equal(groupedByOp[OpGoto][0].addr+1, groupedByOp[OpEq][1].ixn.P2)
+
+	// NOT IN skips to the next record when a value matches or is NULL
+	r.Equal(nextAddr, groupedByOp[OpEq][2].ixn.P2)
+	r.Equal(nextAddr, groupedByOp[OpEq][3].ixn.P2)
+	r.Len(groupedByOp[OpIsNull], 4)
+	for _, isNull := range groupedByOp[OpIsNull] {
+		r.Equal(nextAddr, isNull.ixn.P2)
+	}
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_LimitOffset(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo WHERE email = 'a' LIMIT 10 OFFSET 5")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// offset is checked before loading columns and skips to the next record
+	r.Len(groupedByOp[OpIfPos], 1)
+	r.Equal(groupedByOp[OpNext][0].addr, groupedByOp[OpIfPos][0].ixn.P2)
+	r.Less(groupedByOp[OpIfPos][0].addr, groupedByOp[OpColumn][len(groupedByOp[OpColumn])-1].addr)
+
+	// limit is checked after producing a row and jumps to halt
+	r.Len(groupedByOp[OpDecrJumpZero], 1)
+	r.Equal(groupedByOp[OpResultRow][0].addr+1, groupedByOp[OpDecrJumpZero][0].addr)
+	r.Equal(groupedByOp[OpHalt][0].addr, groupedByOp[OpDecrJumpZero][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_LimitZero(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM foo LIMIT 0")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+	r.Len(groupedByOp[OpGoto], 1)
+	r.Equal(groupedByOp[OpHalt][0].addr, groupedByOp[OpGoto][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_OrderBy(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT email FROM foo WHERE state = 'TX' ORDER BY state DESC, id LIMIT 2")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// sorter is keyed by the order by columns
+	r.Len(groupedByOp[OpSorterOpen], 1)
+	r.Equal(2, groupedByOp[OpSorterOpen][0].ixn.P2)
+	r.Equal([]bool{true, false}, groupedByOp[OpSorterOpen][0].ixn.P4)
+
+	// sort keys followed by the result column are inserted
+	r.Len(groupedByOp[OpSorterInsert], 1)
+	r.Equal(3, groupedByOp[OpSorterInsert][0].ixn.P3)
+
+	// the scan finishes by sorting
+	r.Equal(groupedByOp[OpSorterSort][0].addr, groupedByOp[OpRewind][0].ixn.P2)
+	r.Equal(groupedByOp[OpNext][0].addr+1, groupedByOp[OpSorterSort][0].addr)
+
+	// the result column is read from the sorter after the sort key columns
+	r.Len(groupedByOp[OpSorterColumn], 1)
+	r.Equal(2, groupedByOp[OpSorterColumn][0].ixn.P2)
+	r.Equal(groupedByOp[OpSorterColumn][0].addr, groupedByOp[OpSorterNext][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_DistinctOrderBy(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT DISTINCT state, email FROM foo ORDER BY state DESC LIMIT 2 OFFSET 1")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// sorter is keyed by the order by column followed by the result columns
+	r.Len(groupedByOp[OpSorterOpen], 1)
+	r.Equal(3, groupedByOp[OpSorterOpen][0].ixn.P2)
+	r.Equal([]bool{true}, groupedByOp[OpSorterOpen][0].ixn.P4)
+
+	// duplicates are skipped before the offset and limit are applied
+	r.Len(groupedByOp[OpDistinct], 1)
+	r.Equal(2, groupedByOp[OpDistinct][0].ixn.P3)
+	r.Equal(groupedByOp[OpSorterNext][0].addr, groupedByOp[OpDistinct][0].ixn.P2)
+	r.Less(groupedByOp[OpSorterColumn][1].addr, groupedByOp[OpDistinct][0].addr)
+	r.Less(groupedByOp[OpDistinct][0].addr, groupedByOp[OpIfPos][0].addr)
+	r.Less(groupedByOp[OpDistinct][0].addr, groupedByOp[OpDecrJumpZero][0].addr)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_Aggregate(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT COUNT(*), MAX(email) FROM foo WHERE state = 'TX'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// accumulators are stepped in the scan loop
+	steps := groupedByOp[OpAggStep]
+	r.Len(steps, 2)
+	r.Equal("COUNT", steps[0].ixn.P4)
+	r.Equal(0, steps[0].ixn.P2)
+	r.Equal("MAX", steps[1].ixn.P4)
+	r.Equal(1, steps[1].ixn.P2)
+	r.Equal(steps[0].ixn.P1+1, steps[1].ixn.P1)
+	r.Less(steps[1].addr, groupedByOp[OpNext][0].addr)
+
+	// the column is loaded before stepping the aggregate
+	column := groupedByOp[OpColumn]
+	r.Len(column, 2)
+	r.Equal(1, column[1].ixn.P2)
+	r.Equal(steps[1].ixn.P3, column[1].ixn.P3)
+
+	// accumulators are finalized after the loop and produce a single row
+	finals := groupedByOp[OpAggFinal]
+	r.Len(finals, 2)
+	r.Equal(groupedByOp[OpNext][0].addr+1, finals[0].addr)
+	r.Equal(finals[0].addr, groupedByOp[OpRewind][0].ixn.P2)
+	r.Len(groupedByOp[OpResultRow], 1)
+	r.Equal(steps[0].ixn.P1, groupedByOp[OpResultRow][0].ixn.P1)
+	r.Equal(2, groupedByOp[OpResultRow][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_CountStar(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT COUNT(*) FROM foo")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the rows are counted without scanning the table
+	r.Empty(groupedByOp[OpRewind])
+	r.Empty(groupedByOp[OpNext])
+	r.Empty(groupedByOp[OpAggStep])
+	r.Empty(groupedByOp[OpAggFinal])
+
+	count := groupedByOp[OpCount]
+	r.Len(count, 1)
+	r.Equal(groupedByOp[OpOpenRead][0].ixn.P1, count[0].ixn.P1)
+	r.Equal(count[0].ixn.P2, groupedByOp[OpResultRow][0].ixn.P1)
+
+	// a filter requires reading the rows
+	stmt, err = parser.ParseStatement("SELECT COUNT(*) FROM foo WHERE state = 'TX'")
+	r.NoError(err)
+	instructions, err = SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	r.NoError(err)
+	r.Empty(groupInstructions(instructions)[OpCount])
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_GroupBy(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT state, COUNT(*), MAX(email) FROM foo GROUP BY state")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// rows are sorted by the group key followed by the aggregate argument
+	r.Len(groupedByOp[OpSorterOpen], 1)
+	r.Equal(1, groupedByOp[OpSorterOpen][0].ixn.P2)
+	r.Len(groupedByOp[OpSorterInsert], 1)
+	r.Equal(2, groupedByOp[OpSorterInsert][0].ixn.P3)
+
+	// aggregates are stepped from the sorter, not the table
+	r.Len(groupedByOp[OpAggStep], 2)
+	for _, step := range groupedByOp[OpAggStep] {
+		r.Greater(step.addr, groupedByOp[OpSorterSort][0].addr)
+	}
+
+	// group boundaries are detected on the sorted key
+	r.Len(groupedByOp[OpGroupBy], 1)
+	r.Equal(1, groupedByOp[OpGroupBy][0].ixn.P3)
+
+	// a row is produced when the group changes and after the last group
+	r.Len(groupedByOp[OpAggFlush], 4)
+	r.Len(groupedByOp[OpResultRow], 2)
+	r.Greater(groupedByOp[OpResultRow][1].addr, groupedByOp[OpSorterNext][0].addr)
+	r.Equal(3, groupedByOp[OpResultRow][0].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_GroupByMultipleColumns(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT state, email, COUNT(*) FROM foo WHERE id = 1 GROUP BY state, email")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	r.Len(groupedByOp[OpSorterOpen], 1)
+	r.Equal(2, groupedByOp[OpSorterOpen][0].ixn.P2)
+	r.Len(groupedByOp[OpGroupBy], 1)
+	r.Equal(2, groupedByOp[OpGroupBy][0].ixn.P3)
+
+	// the filter is applied before rows reach the sorter
+	r.Less(groupedByOp[OpNe][0].addr, groupedByOp[OpSorterInsert][0].addr)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestPrepare_ColumnMeta(t *testing.T) {
+	r := require.New(t)
+	pgr := pagerWithTable(t, "CREATE TABLE members (member_id int PRIMARY KEY, age int NOT NULL, nickname text)")
+
+	stmt, err := parser.ParseStatement("SELECT age, nickname, COUNT(*), MAX(age) FROM members GROUP BY age, nickname")
+	r.NoError(err)
+	prepared, err := Prepare(stmt, pgr)
+	r.NoError(err)
+
+	r.Equal([]ColumnMeta{
+		{Name: "age", Type: storage.Integer, Nullable: false},
+		{Name: "nickname", Type: storage.Text, Nullable: true},
+		{Name: "COUNT(*)", Type: storage.Integer, Nullable: false},
+		{Name: "MAX(age)", Type: storage.Integer, Nullable: true},
+	}, prepared.ColumnMeta)
+	r.Equal([]string{"age", "nickname", "COUNT(*)", "MAX(age)"}, prepared.Columns)
+
+	// aliased columns are named by their alias
+	stmt, err = parser.ParseStatement("SELECT nickname AS name, COUNT(*) AS total FROM members GROUP BY nickname")
+	r.NoError(err)
+	prepared, err = Prepare(stmt, pgr)
+	r.NoError(err)
+
+	r.Equal([]ColumnMeta{
+		{Name: "name", Type: storage.Text, Nullable: true},
+		{Name: "total", Type: storage.Integer, Nullable: false},
+	}, prepared.ColumnMeta)
+	r.Equal([]string{"name", "total"}, prepared.Columns)
+
+	// computed columns are named by their expression
+	stmt, err = parser.ParseStatement("SELECT age + 1, 'a' FROM members")
+	r.NoError(err)
+	prepared, err = Prepare(stmt, pgr)
+	r.NoError(err)
+	r.Equal([]string{"(age + 1)", "'a'"}, prepared.Columns)
+
+	stmt, err = parser.ParseStatement("SELECT * FROM members")
+	r.NoError(err)
+	prepared, err = Prepare(stmt, pgr)
+	r.NoError(err)
+
+	r.Equal([]ColumnMeta{
+		{Name: "member_id", Type: storage.Integer, Nullable: false},
+		{Name: "age", Type: storage.Integer, Nullable: false},
+		{Name: "nickname", Type: storage.Text, Nullable: true},
+	}, prepared.ColumnMeta)
+
+	stmt, err = parser.ParseStatement("INSERT INTO members (age) VALUES (1) RETURNING nickname, *")
+	r.NoError(err)
+	prepared, err = Prepare(stmt, pgr)
+	r.NoError(err)
+	r.Equal([]string{"nickname", "member_id", "age", "nickname"}, prepared.Columns)
+
+	stmt, err = parser.ParseStatement("INSERT INTO members (age) VALUES (1) RETURNING missing")
+	r.NoError(err)
+	_, err = Prepare(stmt, pgr)
+	r.EqualError(err, "no such column: missing")
+}
+
+func TestSelectInstructions_Join(t *testing.T) {
+	r := require.New(t)
+
+	tableDefs := map[string]*metadata.TableDefinition{
+		"foo": testTableDefs["foo"],
+		"bar": {
+			Name: "bar",
+			Columns: []*metadata.ColumnDefinition{
+				{Name: "foo_id", Offset: 0, Type: storage.Integer},
+				{Name: "label", Offset: 1, Type: storage.Text},
+			},
+			RootPage: 1338,
+		},
+	}
+
+	stmt, err := parser.ParseStatement("SELECT email, b.label, foo.state FROM foo, bar b")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// each table is read with its own cursor
+	r.Len(groupedByOp[OpOpenRead], 2)
+	r.Equal(0, groupedByOp[OpOpenRead][0].ixn.P1)
+	r.Equal(1337, groupedByOp[OpOpenRead][0].ixn.P2)
+	r.Equal(1, groupedByOp[OpOpenRead][1].ixn.P1)
+	r.Equal(1338, groupedByOp[OpOpenRead][1].ixn.P2)
+
+	// columns are read from the cursor of their table
+	r.Len(groupedByOp[OpColumn], 3)
+	r.Equal([]int{0, 1}, []int{groupedByOp[OpColumn][0].ixn.P1, groupedByOp[OpColumn][0].ixn.P2})
+	r.Equal([]int{1, 1}, []int{groupedByOp[OpColumn][1].ixn.P1, groupedByOp[OpColumn][1].ixn.P2})
+	r.Equal([]int{0, 2}, []int{groupedByOp[OpColumn][2].ixn.P1, groupedByOp[OpColumn][2].ixn.P2})
+
+	// the inner table is rewound for each row of the outer table
+	r.Len(groupedByOp[OpRewind], 2)
+	r.Len(groupedByOp[OpNext], 2)
+	r.Equal(1, groupedByOp[OpNext][0].ixn.P1)
+	r.Equal(0, groupedByOp[OpNext][1].ixn.P1)
+	r.Equal(groupedByOp[OpRewind][1].addr, groupedByOp[OpNext][1].ixn.P2)
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestPrepare_JoinColumns(t *testing.T) {
+	r := require.New(t)
+	pgr := pagerWithTable(t, "CREATE TABLE owners (owner_id int, name text)")
+	stmt, err := parser.ParseStatement("CREATE TABLE pets (owner_id int, name text, species text)")
+	r.NoError(err)
+	prepared, err := Prepare(stmt, pgr)
+	r.NoError(err)
+	_, err = NewProgram(1, prepared).Run(context.Background(), Flags{AutoCommit: true}, pgr)
+	r.NoError(err)
+
+	stmt, err = parser.ParseStatement("SELECT o.name, species, * FROM owners o, pets")
+	r.NoError(err)
+	prepared, err = Prepare(stmt, pgr)
+	r.NoError(err)
+	r.Equal([]string{"name", "species", "owner_id", "name", "owner_id", "name", "species"}, prepared.Columns)
+
+	stmt, err = parser.ParseStatement("SELECT name FROM owners, pets")
+	r.NoError(err)
+	_, err = Prepare(stmt, pgr)
+	r.EqualError(err, "ambiguous column name: name")
+
+	stmt, err = parser.ParseStatement("SELECT missing FROM owners, pets")
+	r.NoError(err)
+	_, err = Prepare(stmt, pgr)
+	r.EqualError(err, "no such column: missing")
+}
+
+func TestSelectInstructions_IndexRange(t *testing.T) {
+	r := require.New(t)
+
+	foo := testTableDefs["foo"]
+	indexed := *foo
+	indexed.Indexes = []*metadata.IndexDefinition{
+		{Name: "foo_email", Columns: []*metadata.ColumnDefinition{foo.Columns[1], foo.Columns[0]}, RootPage: 42},
+	}
+	tableDefs := map[string]*metadata.TableDefinition{"foo": &indexed}
+
+	stmt, err := parser.ParseStatement("SELECT id, email FROM foo WHERE email >= 'b' AND 'd' > email AND id > 3")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// the index is read rather than the table
+	r.Len(groupedByOp[OpOpenRead], 1)
+	r.Equal(42, groupedByOp[OpOpenRead][0].ixn.P2)
+	r.Equal("foo_email", groupedByOp[OpOpenRead][0].ixn.P4)
+
+	// the scan starts at the lower bound and stops at the upper bound
+	r.Len(groupedByOp[OpRewind], 0)
+	r.Len(groupedByOp[OpSeekGe], 1)
+	r.Len(groupedByOp[OpIdxGe], 1)
+	scanDone := groupedByOp[OpSeekGe][0].ixn.P2
+	r.Equal(scanDone, groupedByOp[OpIdxGe][0].ixn.P2)
+	r.Equal(groupedByOp[OpNext][0].addr+1, scanDone)
+	r.Equal(groupedByOp[OpIdxGe][0].addr, groupedByOp[OpNext][0].ixn.P2)
+
+	// columns are read from their position in the index entry
+	var cols []int
+	for _, c := range groupedByOp[OpColumn] {
+		cols = append(cols, c.ixn.P2)
+	}
+	r.Equal([]int{0, 0, 1, 1, 0}, cols)
+
+	assertJumpsValid(instructions, t)
+
+	// a column missing from the index requires reading the table
+	stmt, err = parser.ParseStatement("SELECT state FROM foo WHERE email >= 'b'")
+	r.NoError(err)
+
+	instructions, err = SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp = groupInstructions(instructions)
+	r.Equal(foo.RootPage, groupedByOp[OpOpenRead][0].ixn.P2)
+	r.Len(groupedByOp[OpSeekGe], 0)
+}
+
+func TestSelectInstructions_IndexLookup(t *testing.T) {
+	r := require.New(t)
+
+	foo := testTableDefs["foo"]
+	indexed := *foo
+	indexed.Indexes = []*metadata.IndexDefinition{
+		{Name: "foo_email", Columns: []*metadata.ColumnDefinition{foo.Columns[1]}, RootPage: 42},
+	}
+	tableDefs := map[string]*metadata.TableDefinition{"foo": &indexed}
+
+	stmt, err := parser.ParseStatement("SELECT state FROM foo WHERE email = 'a@b.c'")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the table is read at the rows of the index entries
+	r.Len(groupedByOp[OpOpenRead], 2)
+	table, index := groupedByOp[OpOpenRead][0].ixn, groupedByOp[OpOpenRead][1].ixn
+	r.Equal(foo.RootPage, table.P2)
+	r.Equal(42, index.P2)
+	r.Equal("foo_email", index.P4)
+
+	// entries equal to the value are visited
+	r.Len(groupedByOp[OpSeekGe], 1)
+	r.Len(groupedByOp[OpIdxGt], 1)
+	r.Equal(index.P1, groupedByOp[OpSeekGe][0].ixn.P1)
+	r.Equal(index.P1, groupedByOp[OpIdxGt][0].ixn.P1)
+	r.Equal(index.P1, groupedByOp[OpNext][0].ixn.P1)
+	r.Equal(groupedByOp[OpIdxGt][0].addr, groupedByOp[OpNext][0].ixn.P2)
+
+	// the row of each entry is looked up before the filter and columns are read
+	r.Len(groupedByOp[OpSeek], 1)
+	seek := groupedByOp[OpSeek][0]
+	r.Equal(groupedByOp[OpIdxGt][0].addr+1, seek.addr)
+	r.Equal(table.P1, seek.ixn.P1)
+	r.Equal(index.P1, seek.ixn.P3)
+	r.Equal(groupedByOp[OpNext][0].addr, seek.ixn.P2)
+	for _, c := range groupedByOp[OpColumn] {
+		r.Equal(table.P1, c.ixn.P1)
+		r.Less(seek.addr, c.addr)
+	}
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_RowIDLookup(t *testing.T) {
+	r := require.New(t)
+
+	foo := testTableDefs["foo"]
+	keyed := *foo
+	id := *foo.Columns[0]
+	id.PrimaryKey = true
+	keyed.Columns = []*metadata.ColumnDefinition{&id, foo.Columns[1], foo.Columns[2]}
+	tableDefs := map[string]*metadata.TableDefinition{"foo": &keyed}
+
+	stmt, err := parser.ParseStatement("SELECT email FROM foo WHERE state = 'CA' AND 5 = id")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the row is read by its rowid rather than scanning the table
+	r.Len(groupedByOp[OpOpenRead], 1)
+	r.Empty(groupedByOp[OpRewind])
+	r.Empty(groupedByOp[OpNext])
+	r.Len(groupedByOp[OpSeekRowid], 1)
+	seek := groupedByOp[OpSeekRowid][0]
+	r.Equal(groupedByOp[OpOpenRead][0].ixn.P1, seek.ixn.P1)
+
+	// the rowid is loaded before seeking
+	r.Equal(5, groupedByOp[OpInteger][0].ixn.P1)
+	r.Equal(groupedByOp[OpInteger][0].ixn.P2, seek.ixn.P3)
+	r.Less(groupedByOp[OpInteger][0].addr, seek.addr)
+
+	// the rest of the filter is still evaluated for the row
+	r.Len(groupedByOp[OpResultRow], 1)
+	r.Less(seek.addr, groupedByOp[OpResultRow][0].addr)
+	r.NotEmpty(groupedByOp[OpNe])
+	assertJumpsValid(instructions, t)
+
+	// a range of rowids scans the table
+	stmt, err = parser.ParseStatement("SELECT email FROM foo WHERE id > 5")
+	r.NoError(err)
+	instructions, err = SelectInstructions(tableDefs, stmt.(*ast.SelectStatement))
+	r.NoError(err)
+	r.Empty(groupInstructions(instructions)[OpSeekRowid])
+
+	assertJumpsValid(instructions, t)
+}
+
+func TestSelectInstructions_MissingTable(t *testing.T) {
+	r := require.New(t)
+
+	stmt, err := parser.ParseStatement("SELECT * FROM missing")
+	r.NoError(err)
+
+	instructions, err := SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	r.EqualError(err, "no such table: missing")
+	r.Nil(instructions)
+
+	// every table of a join must exist
+	stmt, err = parser.ParseStatement("SELECT * FROM foo, missing")
+	r.NoError(err)
+
+	instructions, err = SelectInstructions(testTableDefs, stmt.(*ast.SelectStatement))
+	r.EqualError(err, "no such table: missing")
+	r.Nil(instructions)
+}
+
+func TestInsertInstructions_Index(t *testing.T) {
+	r := require.New(t)
+
+	pgr := pagerWithTable(t, "CREATE TABLE inventory (sku text, quantity int)")
+
+	stmt, err := parser.ParseStatement("CREATE INDEX inventory_quantity ON inventory (quantity, sku)")
+	r.NoError(err)
+	prepared, err := Prepare(stmt, pgr)
+	r.NoError(err)
+	_, err = NewProgram(1, prepared).Run(context.Background(), Flags{AutoCommit: true}, pgr)
+	r.NoError(err)
+
+	stmt, err = parser.ParseStatement("INSERT INTO inventory (sku, quantity) VALUES ('a', 1), ('b', 2)")
+	r.NoError(err)
+
+	instructions, err := InsertInstructions(pgr, stmt.(*ast.InsertStatement))
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the index is opened with the cursor following the table
+	r.Len(groupedByOp[OpOpenWrite], 2)
+	r.Equal(1, groupedByOp[OpOpenWrite][1].ixn.P1)
+	r.Equal("inventory_quantity", groupedByOp[OpOpenWrite][1].ixn.P4)
+
+	// an entry is added to the index after each row is inserted
+	r.Len(groupedByOp[OpIdxInsert], 2)
+	for i, idxInsert := range groupedByOp[OpIdxInsert] {
+		insert := groupedByOp[OpInsert][i]
+		r.Less(insert.addr, idxInsert.addr)
+		r.Equal(1, idxInsert.ixn.P1)
+		r.Equal(insert.ixn.P3, idxInsert.ixn.P3)
+	}
+
+	// the entry holds the indexed columns followed by the rowid
+	row := groupedByOp[OpMakeRecord][0].ixn
+	entry := groupedByOp[OpMakeRecord][1].ixn
+	r.Equal(3, entry.P2)
+	r.Equal([]int{row.P1 + 1, row.P1, groupedByOp[OpInsert][0].ixn.P3}, []int{
+		instructions[groupedByOp[OpMakeRecord][1].addr-3].P1,
+		instructions[groupedByOp[OpMakeRecord][1].addr-2].P1,
+		instructions[groupedByOp[OpMakeRecord][1].addr-1].P1,
+	})
+}
+
+func TestInsertInstructions_Unique(t *testing.T) {
+	r := require.New(t)
+
+	pgr := pagerWithTable(t, "CREATE TABLE mailboxes (owner text, address text UNIQUE)")
+
+	stmt, err := parser.ParseStatement("INSERT INTO mailboxes (owner, address) VALUES ('a', 'a@example.com')")
+	r.NoError(err)
+
+	instructions, err := InsertInstructions(pgr, stmt.(*ast.InsertStatement))
+	r.NoError(err)
+	groupedByOp := groupInstructions(instructions)
+
+	// the index created with the table is opened following the table
+	r.Len(groupedByOp[OpOpenWrite], 2)
+	r.Equal("sqlite_autoindex_mailboxes_1", groupedByOp[OpOpenWrite][1].ixn.P4)
+
+	// the value is looked up in the index before the row is inserted
+	r.Len(groupedByOp[OpSeekGe], 1)
+	seek := groupedByOp[OpSeekGe][0]
+	r.Equal(1, seek.ixn.P1)
+	r.Equal(1, seek.ixn.P4)
+	r.Less(seek.addr, groupedByOp[OpInsert][0].addr)
+
+	// a matching entry halts with a constraint failure
+	halt := groupedByOp[OpHalt][0].ixn
+	r.Equal(1, halt.P1)
+	r.Equal("UNIQUE constraint failed: mailboxes.address", halt.P4)
+	r.Equal(seek.ixn.P2, groupedByOp[OpIdxGt][0].ixn.P2)
+}
+
+func TestInsertInstructions_MissingTable(t *testing.T) {
+	r := require.New(t)
+
+	pgr := pagerWithTable(t, "CREATE TABLE vendors (name text)")
+
+	stmt, err := parser.ParseStatement("INSERT INTO suppliers (name) VALUES ('a')")
+	r.NoError(err)
+
+	instructions, err := InsertInstructions(pgr, stmt.(*ast.InsertStatement))
+	r.EqualError(err, "no such table: suppliers")
+	r.Nil(instructions)
+
+	_, err = Prepare(stmt, pgr)
+	r.EqualError(err, "no such table: suppliers")
+}
+
+func TestInsertInstructions_Returning(t *testing.T) {
+	r := require.New(t)
+
+	pgr := pagerWithTable(t, "CREATE TABLE company (company_id int PRIMARY KEY, company_name text, description text)")
+
+	stmt, err := parser.ParseStatement("INSERT INTO company (company_name) VALUES ('a'), ('b') RETURNING description, company_id")
+	r.NoError(err)
+
+	instructions, err := InsertInstructions(pgr, stmt.(*ast.InsertStatement))
+	r.NoError(err)
+	r.NotEmpty(instructions)
+
+	groupedByOp := groupInstructions(instructions)
+
+	// a row is produced after each insert
+	r.Len(groupedByOp[OpInsert], 2)
+	r.Len(groupedByOp[OpResultRow], 2)
+	for i, result := range groupedByOp[OpResultRow] {
+		r.Less(groupedByOp[OpInsert][i].addr, result.addr)
+		r.Equal(2, result.ixn.P2)
+	}
+
+	// the returned columns are copied in the order requested
+	insert := groupedByOp[OpMakeRecord][0].ixn
+	result := groupedByOp[OpResultRow][0]
+	description := instructions[result.addr-2]
+	companyID := instructions[result.addr-1]
+	r.Equal(OpSCopy, description.Op)
+	r.Equal(insert.P1+2, description.P1)
+	r.Equal(result.ixn.P1, description.P2)
+	r.Equal(OpSCopy, companyID.Op)
+	r.Equal(insert.P1, companyID.P1)
+	r.Equal(result.ixn.P1+1, companyID.P2)
+}
+
+func TestGolden(t *testing.T) {
+	pgr := pagerWithTable(t, "CREATE TABLE company (company_id int PRIMARY KEY, company_name text, description text)")
+
+	tests := []struct {
+		name string
+		sql  string
+	}{
+		{name: "select_star", sql: "SELECT * FROM foo"},
+		{name: "select_filter", sql: "SELECT id, email FROM foo WHERE email = 'a' OR id >= 5 LIMIT 3"},
+		{name: "select_rowid_range", sql: "SELECT rowid, email FROM foo WHERE rowid > 10"},
+		{name: "insert", sql: "INSERT INTO company (company_id, company_name) VALUES (99, 'hashicorp')"},
+		{name: "insert_returning", sql: "INSERT INTO company (company_name) VALUES ('hashicorp') RETURNING company_id, *"},
+		{name: "create_index", sql: "CREATE INDEX foo_state ON foo (state, id)"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			stmt, err := parser.ParseStatement(tc.sql)
+			r.NoError(err)
+
+			var instructions Instructions
+			switch s := stmt.(type) {
+			case *ast.SelectStatement:
+				instructions, err = SelectInstructions(testTableDefs, s)
+				r.NoError(err)
+			case *ast.InsertStatement:
+				instructions, err = InsertInstructions(pgr, s)
+				r.NoError(err)
+			case *ast.CreateIndexStatement:
+				instructions = CreateIndexInstructions(testTableDefs[s.Table], s)
+			}
+
+			assertGolden(t, tc.name, instructions.Listing())
+		})
+	}
+}
+
+// pagerWithTable creates an in memory database containing a table
+func pagerWithTable(t *testing.T, createSQL string) pager.Pager {
+	r := require.New(t)
+
+	file := storage.NewMemoryFile(4096)
+	r.NoError(pager.Initialize(file))
+	pgr := pager.NewPager(file)
+
+	stmt, err := parser.ParseStatement(createSQL)
+	r.NoError(err)
+	prepared, err := Prepare(stmt, pgr)
+	r.NoError(err)
+	_, err = NewProgram(1, prepared).Run(context.Background(), Flags{AutoCommit: true}, pgr)
+	r.NoError(err)
+
+	return pgr
+}
+
+// assertGolden compares a program listing with testdata/<name>.golden.
+// Run the tests with -update to rewrite the golden files.
+func assertGolden(t *testing.T, name string, listing string) {
+	r := require.New(t)
+	path := filepath.Join("testdata", name+".golden")
+
+	if *updateGolden {
+		r.NoError(os.MkdirAll("testdata", 0755))
+		r.NoError(os.WriteFile(path, []byte(listing), 0644))
+	}
+
+	expected, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Equal(string(expected), listing)
+}
+
 type groupItem struct {
 	addr int
 	ixn  *Instruction
@@ -0,0 +1,285 @@
+package virtualmachine
+
+import (
+	"strconv"
+
+	"github.com/joeandaverde/tinydb/internal/metadata"
+	"github.com/joeandaverde/tinydb/internal/storage"
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+)
+
+// indexScan reads the rows of a query through an index rather than
+// scanning the table, starting at the lower bound of the first indexed
+// column and stopping past the upper bound. When the index holds every
+// column referenced by the query rows are read straight from its entries,
+// otherwise the row of each entry is looked up in the table.
+type indexScan struct {
+	index *metadata.IndexDefinition
+
+	// covering is set when rows are read from the index entries
+	covering bool
+
+	// table describes the rows read by the scan. For a covering index
+	// each column is at its position in the index entry.
+	table *metadata.TableDefinition
+
+	lower *ast.BasicLiteral
+
+	upper *ast.BasicLiteral
+	// op jumping when an entry is past the upper bound
+	upperOp Op
+}
+
+// planIndexScan finds an index covering the query with a bound on its first
+// column, or an index to look up rows equal to a value of its first column.
+// Returns nil when the table should be scanned.
+func planIndexScan(table *metadata.TableDefinition, stmt *ast.SelectStatement) *indexScan {
+	terms := filterTerms(stmt)
+	if terms == nil {
+		return nil
+	}
+
+	referenced := referencedColumns(table, stmt)
+
+	var lookup *indexScan
+	for _, idx := range table.Indexes {
+		scan := &indexScan{index: idx, table: table}
+		if covers(idx, referenced) {
+			scan.covering = true
+			scan.table = indexTable(table, idx)
+		}
+
+		equality := false
+		for _, t := range terms {
+			op, lit, ok := indexBound(idx.Columns[0], t)
+			if !ok {
+				continue
+			}
+			switch op {
+			case ">", ">=":
+				if scan.lower == nil {
+					scan.lower = lit
+				}
+			case "<":
+				if scan.upper == nil {
+					scan.upper, scan.upperOp = lit, OpIdxGe
+				}
+			case "<=":
+				if scan.upper == nil {
+					scan.upper, scan.upperOp = lit, OpIdxGt
+				}
+			case "=":
+				equality = true
+				if scan.lower == nil {
+					scan.lower = lit
+				}
+				if scan.upper == nil {
+					scan.upper, scan.upperOp = lit, OpIdxGt
+				}
+			}
+		}
+
+		switch {
+		case scan.covering && (scan.lower != nil || scan.upper != nil):
+			return scan
+		case equality && lookup == nil:
+			// Looking up each row of a range may read more pages than
+			// scanning the table.
+			lookup = scan
+		}
+	}
+
+	return lookup
+}
+
+// planRowIDLookup finds the value the filter requires of the integer
+// primary key or the rowid of the table. The only row that may satisfy the
+// filter is then read by its rowid. Returns nil when there is no such value.
+func planRowIDLookup(source *fromSource, stmt *ast.SelectStatement) *ast.BasicLiteral {
+	for _, col := range source.columns() {
+		if !col.PrimaryKey || col.Type != storage.Integer {
+			continue
+		}
+		for _, t := range filterTerms(stmt) {
+			if op, lit, ok := indexBound(col, t); ok && op == "=" {
+				return lit
+			}
+		}
+	}
+	return nil
+}
+
+// planRowIDSeek finds an integer lower bound the filter places on the
+// integer primary key or the rowid of the table, along with the op moving a
+// cursor to the first row within the bound. The rows before the bound are
+// then skipped by the scan. Returns nil when there is no such bound.
+func planRowIDSeek(source *fromSource, stmt *ast.SelectStatement) (*ast.BasicLiteral, Op) {
+	for _, col := range source.columns() {
+		if !col.PrimaryKey || col.Type != storage.Integer {
+			continue
+		}
+		for _, t := range filterTerms(stmt) {
+			op, lit, ok := indexBound(col, t)
+			if !ok {
+				continue
+			}
+			// A rowid between two integers is not a position in the table
+			if _, err := strconv.Atoi(lit.Value); err != nil {
+				continue
+			}
+			switch op {
+			case ">":
+				return lit, OpSeekGt
+			case ">=":
+				return lit, OpSeekGe
+			}
+		}
+	}
+	return nil, 0
+}
+
+// filterTerms lists the expressions every row satisfying the filter of a
+// query satisfies. Returns nil when there is no filter.
+func filterTerms(stmt *ast.SelectStatement) []ast.Expression {
+	if stmt.Filter == nil {
+		return nil
+	}
+
+	filter := reworkExpression(stmt.Filter)
+	if l, ok := filter.(*ast.LogicalOperation); ok && l.Operator == "AND" {
+		return l.Terms
+	}
+	return []ast.Expression{filter}
+}
+
+// indexBound determines if an expression compares a column with a literal
+// of the same type, returning the comparison with the column on the left.
+func indexBound(col *metadata.ColumnDefinition, expr ast.Expression) (string, *ast.BasicLiteral, bool) {
+	b, ok := expr.(*ast.BinaryOperation)
+	if !ok {
+		return "", nil, false
+	}
+
+	flipped := map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	op, ok := flipped[b.Operator]
+	if !ok {
+		return "", nil, false
+	}
+
+	ident, isIdent := b.Left.(*ast.Ident)
+	lit, isLit := b.Right.(*ast.BasicLiteral)
+	if isIdent && isLit {
+		op = b.Operator
+	} else {
+		ident, isIdent = b.Right.(*ast.Ident)
+		lit, isLit = b.Left.(*ast.BasicLiteral)
+	}
+	if !isIdent || !isLit || ident.Value != col.Name {
+		return "", nil, false
+	}
+
+	// Values of another type are ordered differently by the index
+	switch {
+	case lit.Kind == lexer.TokenNumber && col.Type == storage.Integer:
+	case lit.Kind == lexer.TokenString && col.Type == storage.Text:
+	default:
+		return "", nil, false
+	}
+
+	return op, lit, true
+}
+
+// covers determines if the index holds every referenced column
+func covers(idx *metadata.IndexDefinition, referenced []string) bool {
+	for _, name := range referenced {
+		found := false
+		for _, c := range idx.Columns {
+			found = found || c.Name == name
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// indexTable describes the entries of an index as a table so that columns
+// are read from their position in the entry.
+func indexTable(table *metadata.TableDefinition, idx *metadata.IndexDefinition) *metadata.TableDefinition {
+	result := &metadata.TableDefinition{
+		Name:     table.Name,
+		RootPage: idx.RootPage,
+	}
+	for _, c := range table.Columns {
+		col := *c
+		col.Offset = -1
+		for i, ic := range idx.Columns {
+			if ic.Name == c.Name {
+				col.Offset = i
+			}
+		}
+		result.Columns = append(result.Columns, &col)
+	}
+	return result
+}
+
+// referencedColumns lists the columns of the table used anywhere in a query
+func referencedColumns(table *metadata.TableDefinition, stmt *ast.SelectStatement) []string {
+	var names []string
+	for _, c := range stmt.Columns {
+		if _, ok := c.Expr.(*ast.Star); ok {
+			for _, col := range table.Columns {
+				names = append(names, col.Name)
+			}
+			continue
+		}
+		names = append(names, findIdents(c.Expr)...)
+	}
+	names = append(names, findIdents(stmt.Filter)...)
+	names = append(names, findIdents(stmt.Having)...)
+	names = append(names, stmt.GroupBy...)
+	for _, o := range stmt.OrderBy {
+		names = append(names, findIdents(o.Expr)...)
+	}
+	return names
+}
+
+// findIdents returns the names referenced by an expression
+func findIdents(expr ast.Expression) []string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return []string{e.Value}
+	case *ast.AggregateExpression:
+		return findIdents(e.Arg)
+	case *ast.BinaryOperation:
+		return append(findIdents(e.Left), findIdents(e.Right)...)
+	case *ast.UnaryOperation:
+		return findIdents(e.Expr)
+	case *ast.NullTest:
+		return findIdents(e.Expr)
+	case *ast.BetweenExpression:
+		return append(findIdents(e.Expr), append(findIdents(e.Low), findIdents(e.High)...)...)
+	case *ast.CaseExpression:
+		idents := findIdents(e.Operand)
+		for _, w := range e.Whens {
+			idents = append(idents, findIdents(w.Condition)...)
+			idents = append(idents, findIdents(w.Result)...)
+		}
+		return append(idents, findIdents(e.Else)...)
+	case *ast.InExpression:
+		idents := findIdents(e.Expr)
+		for _, v := range e.Values {
+			idents = append(idents, findIdents(v)...)
+		}
+		return idents
+	case *ast.LogicalOperation:
+		var idents []string
+		for _, t := range e.Terms {
+			idents = append(idents, findIdents(t)...)
+		}
+		return idents
+	default:
+		return nil
+	}
+}
@@ -1,12 +1,11 @@
 package virtualmachine
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
 
-	"github.com/joeandaverde/tinydb/internal/metadata"
-	"github.com/joeandaverde/tinydb/internal/pager"
 	"github.com/joeandaverde/tinydb/tsql/ast"
 	"github.com/joeandaverde/tinydb/tsql/lexer"
 )
@@ -45,12 +44,6 @@ func Evaluate(expression ast.Expression, ctx EvaluationContext) EvaluatedExpress
 	}
 }
 
-type ExecutionEnvironment struct {
-	Tables  map[string]*metadata.TableDefinition
-	Columns []string
-	Pager   pager.Pager
-}
-
 func evaluateBinaryOperation(o *ast.BinaryOperation, ctx EvaluationContext) EvaluatedExpression {
 	left := Evaluate(o.Left, ctx).Value
 	right := Evaluate(o.Right, ctx).Value
@@ -61,18 +54,42 @@ func evaluateBinaryOperation(o *ast.BinaryOperation, ctx EvaluationContext) Eval
 		rightIsInt := isInt(right)
 
 		if leftIsInt && rightIsInt {
+			if sum, ok := arithmetic(OpAdd, left.(int), right.(int)); ok {
+				return EvaluatedExpression{
+					Value: sum,
+				}
+			}
+		}
+
+		// An integer added to a float, or a sum overflowing an integer,
+		// is converted to a float
+		l, leftIsNumber := toFloat(left)
+		r, rightIsNumber := toFloat(right)
+		if leftIsNumber && rightIsNumber {
 			return EvaluatedExpression{
-				Value: left.(int) + right.(int),
+				Value: l + r,
 			}
 		}
 
 		return EvaluatedExpression{
-			Error: errors.New("can only add two integers"),
+			Error: errors.New("can only add two numbers"),
 		}
 	case "=":
 		return EvaluatedExpression{
 			Value: left == right,
 		}
+	case "LIKE", "NOT LIKE":
+		pattern, ok := right.(string)
+		if !ok {
+			return EvaluatedExpression{
+				Error: errors.New("LIKE pattern must be a string"),
+			}
+		}
+
+		matched := likePattern(pattern).MatchString(fmt.Sprint(left))
+		return EvaluatedExpression{
+			Value: matched == (o.Operator == "LIKE"),
+		}
 	case "AND":
 		return EvaluatedExpression{
 			Value: left == true && right == true,
@@ -96,7 +113,17 @@ func evaluateLiteral(l *ast.BasicLiteral, ctx EvaluationContext) EvaluatedExpres
 			Value: value,
 		}
 	case lexer.TokenNumber:
-		value, _ := strconv.Atoi(l.Value)
+		value, f, ok := integerLiteral(l.Value)
+		if !ok {
+			return EvaluatedExpression{
+				Value: f,
+			}
+		}
+		return EvaluatedExpression{
+			Value: value,
+		}
+	case lexer.TokenFloat:
+		value, _ := strconv.ParseFloat(l.Value, 64)
 		return EvaluatedExpression{
 			Value: value,
 		}
@@ -104,6 +131,12 @@ func evaluateLiteral(l *ast.BasicLiteral, ctx EvaluationContext) EvaluatedExpres
 		return EvaluatedExpression{
 			Value: l.Value,
 		}
+	case lexer.TokenBlob:
+		value, err := hex.DecodeString(l.Value)
+		return EvaluatedExpression{
+			Value: value,
+			Error: err,
+		}
 	}
 
 	return EvaluatedExpression{
@@ -131,6 +164,8 @@ func (e EvaluatedExpression) String() string {
 		return e.Value.(string)
 	case int:
 		return strconv.Itoa(e.Value.(int))
+	case float64:
+		return strconv.FormatFloat(e.Value.(float64), 'g', -1, 64)
 	case bool:
 		return strconv.FormatBool(e.Value.(bool))
 	}
@@ -142,3 +177,14 @@ func isInt(v interface{}) bool {
 	_, success := v.(int)
 	return success
 }
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
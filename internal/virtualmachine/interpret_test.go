@@ -0,0 +1,135 @@
+package virtualmachine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+)
+
+type mapEvalContext map[string]interface{}
+
+func (m mapEvalContext) GetValue(ident *ast.Ident) (interface{}, bool) {
+	v, ok := m[ident.Value]
+	return v, ok
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := mapEvalContext{"name": "foo", "age": 30, "pct": "100%", "height": 1.5}
+
+	tests := []struct {
+		name     string
+		expr     ast.Expression
+		expected interface{}
+	}{
+		{
+			name:     "number literal",
+			expr:     &ast.BasicLiteral{Kind: lexer.TokenNumber, Value: "42"},
+			expected: 42,
+		},
+		{
+			name:     "float literal",
+			expr:     &ast.BasicLiteral{Kind: lexer.TokenFloat, Value: "3.14"},
+			expected: 3.14,
+		},
+		{
+			name:     "string literal",
+			expr:     &ast.BasicLiteral{Kind: lexer.TokenString, Value: "bar"},
+			expected: "bar",
+		},
+		{
+			name: "addition",
+			expr: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "age"},
+				Operator: "+",
+				Right:    &ast.BasicLiteral{Kind: lexer.TokenNumber, Value: "1"},
+			},
+			expected: 31,
+		},
+		{
+			name: "addition promotes integers to float",
+			expr: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "age"},
+				Operator: "+",
+				Right:    &ast.Ident{Value: "height"},
+			},
+			expected: 31.5,
+		},
+		{
+			name: "addition overflowing an integer is a float",
+			expr: &ast.BinaryOperation{
+				Left:     &ast.BasicLiteral{Kind: lexer.TokenNumber, Value: "9223372036854775807"},
+				Operator: "+",
+				Right:    &ast.BasicLiteral{Kind: lexer.TokenNumber, Value: "9223372036854775806"},
+			},
+			expected: 9223372036854775807.0 + 9223372036854775806.0,
+		},
+		{
+			name: "equality",
+			expr: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "name"},
+				Operator: "=",
+				Right:    &ast.BasicLiteral{Kind: lexer.TokenString, Value: "foo"},
+			},
+			expected: true,
+		},
+		{
+			name:     "like prefix",
+			expr:     likeOperation("name", "LIKE", "fo%"),
+			expected: true,
+		},
+		{
+			name:     "like suffix",
+			expr:     likeOperation("name", "LIKE", "%oo"),
+			expected: true,
+		},
+		{
+			name:     "like infix",
+			expr:     likeOperation("name", "LIKE", "%o%"),
+			expected: true,
+		},
+		{
+			name:     "like single character",
+			expr:     likeOperation("name", "LIKE", "f_"),
+			expected: false,
+		},
+		{
+			name:     "like is case sensitive",
+			expr:     likeOperation("name", "LIKE", "FOO"),
+			expected: false,
+		},
+		{
+			name:     "like escaped wildcard",
+			expr:     likeOperation("pct", "LIKE", `100\%`),
+			expected: true,
+		},
+		{
+			name:     "not like",
+			expr:     likeOperation("name", "NOT LIKE", "b%"),
+			expected: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			v := Evaluate(tc.expr, ctx)
+			r.NoError(v.Error)
+			r.Equal(tc.expected, v.Value)
+		})
+	}
+}
+
+func likeOperation(ident string, operator string, pattern string) *ast.BinaryOperation {
+	return &ast.BinaryOperation{
+		Left:     &ast.Ident{Value: ident},
+		Operator: operator,
+		Right:    &ast.BasicLiteral{Kind: lexer.TokenString, Value: pattern},
+	}
+}
+
+func TestEvaluate_UnknownIdent(t *testing.T) {
+	v := Evaluate(&ast.Ident{Value: "missing"}, nil)
+	require.Error(t, v.Error)
+}
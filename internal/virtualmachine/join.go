@@ -0,0 +1,110 @@
+package virtualmachine
+
+import (
+	"fmt"
+
+	"github.com/joeandaverde/tinydb/internal/metadata"
+	"github.com/joeandaverde/tinydb/internal/storage"
+	"github.com/joeandaverde/tinydb/tsql/ast"
+)
+
+// fromSource is a table of the FROM clause of a query. The rows of a join
+// are produced by reading every table with its own cursor in a nested loop,
+// the first table being the outermost loop.
+type fromSource struct {
+	// name qualifies the columns of the table, the alias when there is one
+	name  string
+	table *metadata.TableDefinition
+
+	// rowID is the rowid of the rows of the table, nil when a column of
+	// the table is named rowid
+	rowID *metadata.ColumnDefinition
+}
+
+// columns lists the columns of the table followed by its rowid
+func (s *fromSource) columns() []*metadata.ColumnDefinition {
+	if s.rowID == nil {
+		return s.table.Columns
+	}
+	columns := make([]*metadata.ColumnDefinition, 0, len(s.table.Columns)+1)
+	return append(append(columns, s.table.Columns...), s.rowID)
+}
+
+// rowIDOffset is the offset of the rowid column, which is read from the key
+// of a row rather than from its record
+const rowIDOffset = -2
+
+// rowIDColumn describes the rowid of a table as a column named rowid unless
+// the table has a column of that name. Returns nil when it does.
+func rowIDColumn(table *metadata.TableDefinition) *metadata.ColumnDefinition {
+	for _, c := range table.Columns {
+		if c.Name == "rowid" {
+			return nil
+		}
+	}
+	return &metadata.ColumnDefinition{
+		Name:       "rowid",
+		Type:       storage.Integer,
+		Offset:     rowIDOffset,
+		PrimaryKey: true,
+		NotNull:    true,
+	}
+}
+
+// fromSources resolves the tables of a FROM clause. The columns of each
+// table of a join are copies so that a table joined with itself has distinct
+// columns for each occurrence.
+func fromSources(tableDefs map[string]*metadata.TableDefinition, from []ast.TableAlias) ([]*fromSource, error) {
+	var sources []*fromSource
+	for _, f := range from {
+		table, ok := tableDefs[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", f.Name)
+		}
+
+		name := f.Alias
+		if name == "" {
+			name = f.Name
+		}
+
+		if len(from) > 1 {
+			copied := *table
+			copied.Columns = nil
+			for _, c := range table.Columns {
+				col := *c
+				copied.Columns = append(copied.Columns, &col)
+			}
+			table = &copied
+		}
+
+		sources = append(sources, &fromSource{name: name, table: table, rowID: rowIDColumn(table)})
+	}
+	return sources, nil
+}
+
+// fromColumns finds the columns of the sources by name, either unqualified
+// or qualified by the name of their source. An unqualified name of a column
+// held by more than one source is ambiguous and maps to nil.
+func fromColumns(sources []*fromSource) map[string]*metadata.ColumnDefinition {
+	lookup := make(map[string]*metadata.ColumnDefinition)
+	for _, s := range sources {
+		for _, c := range s.columns() {
+			if _, ok := lookup[c.Name]; ok {
+				lookup[c.Name] = nil
+			} else {
+				lookup[c.Name] = c
+			}
+			lookup[s.name+"."+c.Name] = c
+		}
+	}
+	return lookup
+}
+
+// starColumns lists the columns of every source in order
+func starColumns(sources []*fromSource) []*metadata.ColumnDefinition {
+	var cols []*metadata.ColumnDefinition
+	for _, s := range sources {
+		cols = append(cols, s.table.Columns...)
+	}
+	return cols
+}
@@ -0,0 +1,54 @@
+package virtualmachine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// likePattern compiles a LIKE pattern to an anchored regular expression.
+// % matches any sequence of characters and _ matches a single character.
+// A backslash matches the character following it literally, e.g. \% or \_.
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString(`(?s)^`)
+
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(`.*`)
+		case r == '_':
+			expr.WriteString(`.`)
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	// A trailing backslash matches itself
+	if escaped {
+		expr.WriteString(regexp.QuoteMeta(`\`))
+	}
+
+	expr.WriteString(`$`)
+	return regexp.MustCompile(expr.String())
+}
+
+// like reports whether the text of the value register matches the pattern register
+func (p *Program) like(value *register, pattern *register) bool {
+	text := fmt.Sprint(value.data)
+	patternText := fmt.Sprint(pattern.data)
+
+	re, ok := p.patterns[patternText]
+	if !ok {
+		re = likePattern(patternText)
+		p.patterns[patternText] = re
+	}
+
+	return re.MatchString(text)
+}
@@ -0,0 +1,40 @@
+package virtualmachine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		match   bool
+	}{
+		{"%", "", true},
+		{"%", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"ba%", "banana", true},
+		{"ba%", "abba", false},
+		{"%na", "banana", true},
+		{"%an%", "banana", true},
+		{"b_n", "bun", true},
+		{"b_n", "bn", false},
+		{"b_n", "bunn", false},
+		{"Ba%", "banana", false},
+		{`100\%`, "100%", true},
+		{`100\%`, "1000", false},
+		{`a\_c`, "a_c", true},
+		{`a\_c`, "abc", false},
+		{`a.c`, "abc", false},
+		{`a\`, `a\`, true},
+		{"%\n%", "a\nb", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.pattern+"/"+tc.text, func(t *testing.T) {
+			require.Equal(t, tc.match, likePattern(tc.pattern).MatchString(tc.text))
+		})
+	}
+}
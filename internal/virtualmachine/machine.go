@@ -1,12 +1,13 @@
 package virtualmachine
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
-// TODO: this is to get things to compile, need to actually get auto incr key
-var keys = make(map[string]uint32)
-
 // Register Types
 type reg uint
 
@@ -17,6 +18,8 @@ const (
 	RegString
 	RegBinary
 	RegRecord
+	RegFloat
+	RegAggregate
 )
 
 // Op Codes
@@ -47,35 +50,166 @@ const (
 	// 	P2 - Jump Address
 	OpNext
 	OpPrev
+	// Store the number of records of the table btree of cursor P1 in
+	// register P2 without reading them
+	// 	P1 - Cursor
+	// 	P2 - destination register
+	OpCount
+	// Move table cursor P1 to the row of the current entry of index cursor P3
+	// 	P1 - table cursor
+	// 	P2 - Jump address (if the row does not exist)
+	// 	P3 - index cursor
 	OpSeek
+	// Move table cursor P1 to the first row with a rowid greater than the
+	// integer in register P3
+	// 	P1 - table cursor
+	// 	P2 - Jump address (if there is no such row)
+	// 	P3 - register containing the rowid
 	OpSeekGt
+	// Point the index cursor at the first entry not less than the key
+	// made of the P4 registers starting at P3. Without key registers
+	// move table cursor P1 to the first row with a rowid not less than
+	// the integer in register P3.
+	// 	P1 - Cursor
+	// 	P2 - Jump address (if there is no such entry)
+	// 	P3 - first key register
+	// 	P4 - number of key registers, 0 for a rowid
 	OpSeekGe
+	// Move table cursor P1 to the last row with a rowid less than the
+	// integer in register P3
+	// 	P1 - table cursor
+	// 	P2 - Jump address (if there is no such row)
+	// 	P3 - register containing the rowid
 	OpSeekLt
+	// Move table cursor P1 to the last row with a rowid not greater than
+	// the integer in register P3
+	// 	P1 - table cursor
+	// 	P2 - Jump address (if there is no such row)
+	// 	P3 - register containing the rowid
 	OpSeekLe
+	// Move table cursor P1 to the row with the rowid in register P3
+	// 	P1 - table cursor
+	// 	P2 - Jump address (if the row does not exist)
+	// 	P3 - register containing the rowid
+	OpSeekRowid
+	// Jump unconditionally to address P2
+	// 	P2 - Jump address
+	OpGoto
+	// If the value in register P1 is 1 or more, subtract P3 from it and jump to P2.
+	// 	P1 - register containing an integer
+	// 	P2 - Jump address
+	// 	P3 - amount to decrement by
+	OpIfPos
+	// Decrement the value in register P1 and jump to P2 if the new value is exactly zero.
+	// 	P1 - register containing an integer
+	// 	P2 - Jump address
+	OpDecrJumpZero
+
+	// Open a sorter that sorts rows by the first P2 columns.
+	// 	P1 - sorter
+	// 	P2 - number of key columns
+	// 	P4 - []bool descending flag for each key column
+	OpSorterOpen
+	// Copy a block of registers into a new sorter row.
+	// 	P1 - sorter
+	// 	P2 - register start
+	// 	P3 - count of registers
+	OpSorterInsert
+	// Sort the rows and point to the first row.
+	// 	P1 - sorter
+	// 	P2 - Jump address (if sorter is empty)
+	OpSorterSort
+	// Move to the next sorter row and go to address if more, otherwise, fallthrough.
+	// 	P1 - sorter
+	// 	P2 - Jump Address
+	OpSorterNext
+	// 	P1 - sorter
+	// 	P2 - column index (0 based)
+	// 	P3 - register for column value
+	OpSorterColumn
+
+	// Step the aggregate function P4 with the value in register P3.
+	// The state of the aggregate is accumulated in register P1.
+	// 	P1 - accumulator register
+	// 	P2 - number of arguments (0 for COUNT(*))
+	// 	P3 - argument register
+	// 	P4 - function name
+	OpAggStep
+	// Replace the state of the aggregate in register P1 with its result.
+	// 	P1 - accumulator register
+	// 	P4 - function name
+	OpAggFinal
+	// Store the result of the aggregate accumulated in register P1 in
+	// register P3 and reset the accumulator for the next group.
+	// 	P1 - accumulator register
+	// 	P3 - result register
+	// 	P4 - function name
+	OpAggFlush
+	// Compare the key in the P3 registers starting at P1 with the key of the
+	// current group, held in the P3 registers that follow. Go to address P2 if
+	// the key belongs to the current group, otherwise, fallthrough. The first
+	// key seen starts the first group.
+	// 	P1 - first key register
+	// 	P2 - Jump address (if same group)
+	// 	P3 - number of key registers
+	OpGroupBy
+	// Compare the P3 registers starting at P1 with the row previously
+	// compared, held in the P3 registers that follow. Go to address P2 if
+	// the rows are the same, otherwise, remember the row and fallthrough.
+	// 	P1 - first register of the row
+	// 	P2 - Jump address (if duplicate)
+	// 	P3 - number of registers in the row
+	OpDistinct
 
 	// Set the database auto-commit flag to P1 (1 or 0).
 	// If P2 is true, roll back any currently active btree transactions.
 	// This instruction causes the VM to halt.
 	OpAutoCommit
+	// Start, release or roll back to the savepoint named P4.
+	// This instruction causes the VM to halt.
+	// 	P1 - SavepointBegin, SavepointRelease or SavepointRollback
+	// 	P4 - savepoint name
+	OpSavepoint
 
 	// 	P1 - cursor
 	// 	P2 - column index (0 based)
 	// 	P3 - register for column value
 	OpColumn
+	// Store the rowid of the current entry at cursor P1 in register P2
+	// 	P1 - cursor
+	// 	P2 - register for the rowid
 	OpKey
 	// Stores int in register
 	// 	P1 - the int
 	// 	P2 - the register
 	OpInteger
+	// Stores a float in register
+	// 	P2 - the register
+	// 	P4 - the float64
+	OpFloat
 	OpString
+	// Stores binary data in register
+	// 	P2 - the register
+	// 	P4 - the []byte
+	OpBlob
 	OpNull
+	// Store the value bound to a parameter in register P2
+	// 	P1 - the parameter number, $1 is 1
+	// 	P2 - the register
+	OpVariable
 	// 	P1 - register start
 	// 	P2 - # cols
 	OpResultRow
+	// Coerces registers to the affinity of the columns they are stored in
+	// 	P1 - register start
+	// 	P2 - count of cols
+	// 	P4 - []storage.SQLType the type of each column
+	OpAffinity
 	// 	P1 - register start
 	// 	P2 - count of cols
 	// 	P3 - store record in this register
 	OpMakeRecord
+	// Write the rowid following the largest rowid of the table to register P2
 	// 	P1 - cursor for table to get rowid
 	// 	P2 - write rowid to this register
 	OpRowID
@@ -87,29 +221,86 @@ const (
 	// If either P1 or P2 is 0 (false) then the result is 0 even if the other input is NULL. A NULL and true or two NULLs give a NULL output.
 	OpAnd
 	// Add the value in register P1 to the value in register P2 and store the result in register P3. If either input is NULL, the result is NULL.
+	// An integer added to a float is converted to a float.
 	OpAdd
+	// Subtract the value in register P2 from the value in register P1 and store the result in register P3.
+	// NULLs and floats are handled as in OpAdd.
+	OpSubtract
+	// Multiply the values in registers P1 and P2 and store the result in register P3.
+	// NULLs and floats are handled as in OpAdd.
+	OpMultiply
+	// Divide the value in register P1 by the value in register P2 and store the result in register P3.
+	// Division of two integers truncates. Division by zero gives NULL.
+	OpDivide
 	// Compare the values in register P1 and P3.
 	// If reg(P3)==reg(P1) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpEq
 	// Compare the values in register P1 and P3.
 	// If reg(P3)!=reg(P1) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpNe
+	// Compare the values in register P1 and P3.
+	// If reg(P1)<reg(P3) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpLt
+	// Compare the values in register P1 and P3.
+	// If reg(P1)<=reg(P3) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpLe
+	// Compare the values in register P1 and P3.
+	// If reg(P1)>reg(P3) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpGt
+	// Compare the values in register P1 and P3.
+	// If reg(P1)>=reg(P3) then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
 	OpGe
+	// If the value in register P1 matches the LIKE pattern in register P3
+	// then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
+	OpLike
+	// If the value in register P1 does not match the LIKE pattern in register P3
+	// then jump to address P2.
+	// If either value is NULL, jump only if P4 is true.
+	OpNotLike
+	// If the value in register P1 is NULL then jump to address P2.
+	OpIsNull
+	// If the value in register P1 is not NULL then jump to address P2.
+	OpNotNull
+	// Compare the leading fields of the current entry at index cursor P1
+	// with the key made of the P4 registers starting at P3.
+	// If entry>key then jump to address P2.
 	OpIdxGt
+	// If entry>=key then jump to address P2.
 	OpIdxGe
+	// If entry<key then jump to address P2.
 	OpIdxLt
+	// If entry<=key then jump to address P2.
 	OpIdxLe
 	OpIdxPKey
+	// Insert the record in register P2 into the index at cursor P1
+	// 	P1 - cursor
+	// 	P2 - record register
+	// 	P3 - register containing the rowid of the table row
 	OpIdxInsert
 	// Create a new B-Tree
 	// 	P1 - register for root page
 	OpCreateTable
+	// Create a new index B-Tree and open it for writing
+	// 	P1 - register for root page
+	// 	P2 - cursor
 	OpCreateIndex
+	// Store the schema cookie of the database in register P2
+	OpReadCookie
+	// Set the schema cookie of the database to the integer in register P3.
+	// The cookie is changed by every change to the schema so that cached
+	// table definitions are read again.
+	OpSetCookie
 	OpCopy
 	OpSCopy
+	// Stop the program. When P1 is not zero the program fails with a
+	// violation of a constraint described by P4.
 	OpHalt
 )
 
@@ -128,25 +319,28 @@ type register struct {
 	data interface{}
 }
 
-// nextKey is a temporary mechanism to generate an identifier for new records
-func nextKey(tableName string) uint32 {
-	if _, ok := keys[tableName]; !ok {
-		keys[tableName] = 0
+func less(a *register, b *register) bool {
+	// Integers and floats are compared by value
+	if a.typ == RegInt32 && b.typ == RegFloat {
+		return compareIntFloat(a.data.(int), b.data.(float64)) < 0
+	}
+	if a.typ == RegFloat && b.typ == RegInt32 {
+		return compareIntFloat(b.data.(int), a.data.(float64)) > 0
 	}
-	keys[tableName] = keys[tableName] + 1
-	return keys[tableName]
-}
 
-func less(a *register, b *register) bool {
 	if a.typ != b.typ {
 		return false
 	}
 
 	switch a.typ {
 	case RegString:
+		// Strings are compared byte by byte like SQLite's BINARY collation,
+		// for UTF-8 text this is the order of the code points.
 		return a.data.(string) < b.data.(string)
 	case RegInt32:
 		return a.data.(int) < b.data.(int)
+	case RegFloat:
+		return a.data.(float64) < b.data.(float64)
 	case RegNull:
 		return false
 	case RegBinary:
@@ -155,15 +349,140 @@ func less(a *register, b *register) bool {
 		// lengths, order is determined by the common bytes between the two blobs.
 		// If the common bytes are equal, then the blob with the fewer bytes
 		// is considered to be less than the blob with more bytes.
-		// TODO: implement above
-		return len(a.data.([]byte)) < len(b.data.([]byte))
+		return bytes.Compare(a.data.([]byte), b.data.([]byte)) < 0
 	}
 
 	return false
 }
 
 func eq(a *register, b *register) bool {
-	return !less(a, b) && !less(b, a)
+	return compare(a, b) == 0
+}
+
+// compare orders two registers of any type. NULL comes first followed by
+// numbers, strings and binary data.
+func compare(a *register, b *register) int {
+	if ra, rb := typeRank(a.typ), typeRank(b.typ); ra != rb {
+		return ra - rb
+	}
+	if less(a, b) {
+		return -1
+	}
+	if less(b, a) {
+		return 1
+	}
+	return 0
+}
+
+// compareIntFloat orders an integer and a float exactly, even where the
+// integer can't be represented as a float
+func compareIntFloat(i int, f float64) int {
+	switch {
+	case math.IsNaN(f) || f >= -float64(minInt):
+		return -1
+	case f < float64(minInt):
+		return 1
+	case float64(i) < f:
+		return -1
+	case float64(i) > f:
+		return 1
+	}
+	// The float is integral and within range when it equals an integer
+	if t := int(f); i < t {
+		return -1
+	} else if i > t {
+		return 1
+	}
+	return 0
+}
+
+// numericOperands reads two integer or float registers as floats
+func numericOperands(a *register, b *register) (float64, float64, bool) {
+	x, ok := numericValue(a)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := numericValue(b)
+	if !ok {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+// minInt is the smallest integer
+const minInt = -1 << (strconv.IntSize - 1)
+
+// arithmetic applies an arithmetic op to two integers. Returns false when
+// the result overflows an integer.
+func arithmetic(op Op, x int, y int) (int, bool) {
+	switch op {
+	case OpSubtract:
+		r := x - y
+		return r, (r <= x) == (y >= 0)
+	case OpMultiply:
+		if x == 0 || y == 0 {
+			return 0, true
+		}
+		r := x * y
+		return r, r/y == x && !(x == -1 && y == minInt) && !(y == -1 && x == minInt)
+	case OpDivide:
+		return x / y, !(x == minInt && y == -1)
+	default:
+		r := x + y
+		return r, (r >= x) == (y >= 0)
+	}
+}
+
+// integerLiteral reads an integer literal. As in SQLite a literal too large
+// for an integer is read as a float, returning false.
+func integerLiteral(text string) (int, float64, bool) {
+	if v, err := strconv.Atoi(text); err == nil {
+		return v, 0, true
+	}
+	v, _ := strconv.ParseFloat(text, 64)
+	return 0, v, false
+}
+
+// arithmeticFloat applies an arithmetic op to two floats
+func arithmeticFloat(op Op, x float64, y float64) float64 {
+	switch op {
+	case OpSubtract:
+		return x - y
+	case OpMultiply:
+		return x * y
+	case OpDivide:
+		return x / y
+	default:
+		return x + y
+	}
+}
+
+func numericValue(r *register) (float64, bool) {
+	switch r.typ {
+	case RegInt32:
+		return float64(r.data.(int)), true
+	case RegFloat:
+		return r.data.(float64), true
+	default:
+		return 0, false
+	}
+}
+
+func typeRank(t reg) int {
+	switch t {
+	case RegNull:
+		return 0
+	case RegInt32:
+		return 1
+	case RegString:
+		return 2
+	case RegFloat:
+		return 1
+	case RegBinary:
+		return 3
+	default:
+		return 4
+	}
 }
 
 func (i Instruction) String() string {
@@ -188,28 +507,66 @@ func (o Op) String() string {
 		return "OpNext(cur, jmp)"
 	case OpPrev:
 		return "OpPrev"
+	case OpCount:
+		return "OpCount(cur, reg)"
 	case OpSeek:
-		return "OpSeek"
+		return "OpSeek(cur, jmp, idx)"
 	case OpSeekGt:
-		return "OpSeekGt"
+		return "OpSeekGt(cur, jmp, reg)"
 	case OpSeekGe:
-		return "OpSeekGe"
+		return "OpSeekGe(cur, jmp, reg, n)"
 	case OpSeekLt:
-		return "OpSeekLt"
+		return "OpSeekLt(cur, jmp, reg)"
 	case OpSeekLe:
-		return "OpSeekLe"
+		return "OpSeekLe(cur, jmp, reg)"
+	case OpSeekRowid:
+		return "OpSeekRowid(cur, jmp, reg)"
+	case OpGoto:
+		return "OpGoto(jmp)"
+	case OpIfPos:
+		return "OpIfPos(reg, jmp, decr)"
+	case OpDecrJumpZero:
+		return "OpDecrJumpZero(reg, jmp)"
+	case OpSorterOpen:
+		return "OpSorterOpen(sorter, keys, desc)"
+	case OpSorterInsert:
+		return "OpSorterInsert(sorter, reg, cols)"
+	case OpSorterSort:
+		return "OpSorterSort(sorter, jmp)"
+	case OpSorterNext:
+		return "OpSorterNext(sorter, jmp)"
+	case OpSorterColumn:
+		return "OpSorterColumn(sorter, col, reg)"
+	case OpAggStep:
+		return "OpAggStep(acc, args, reg, func)"
+	case OpAggFinal:
+		return "OpAggFinal(acc, func)"
+	case OpAggFlush:
+		return "OpAggFlush(acc, reg, func)"
+	case OpGroupBy:
+		return "OpGroupBy(reg, jmp, n)"
+	case OpDistinct:
+		return "OpDistinct(reg, jmp, n)"
 	case OpColumn:
 		return "OpColumn(cur, col, reg)"
 	case OpKey:
-		return "OpKey"
+		return "OpKey(cur, reg)"
 	case OpInteger:
 		return "OpInteger(int, reg)"
+	case OpFloat:
+		return "OpFloat(reg, float)"
 	case OpString:
 		return "OpString"
+	case OpBlob:
+		return "OpBlob"
 	case OpNull:
 		return "OpNull"
+	case OpVariable:
+		return "OpVariable(param, reg)"
 	case OpResultRow:
 		return "OpResultRow(reg, cols)"
+	case OpAffinity:
+		return "OpAffinity(startreg, cols)"
 	case OpMakeRecord:
 		return "OpMakeRecord(startreg, cols, reg)"
 	case OpRowID:
@@ -228,29 +585,64 @@ func (o Op) String() string {
 		return "OpGt"
 	case OpGe:
 		return "OpGe"
+	case OpLike:
+		return "OpLike(reg, jmp, pattern)"
+	case OpNotLike:
+		return "OpNotLike(reg, jmp, pattern)"
+	case OpIsNull:
+		return "OpIsNull(reg, jmp)"
+	case OpNotNull:
+		return "OpNotNull(reg, jmp)"
 	case OpIdxGt:
-		return "OpIdxGt"
+		return "OpIdxGt(cur, jmp, reg, n)"
 	case OpIdxGe:
-		return "OpIdxGe"
+		return "OpIdxGe(cur, jmp, reg, n)"
 	case OpIdxLt:
-		return "OpIdxLt"
+		return "OpIdxLt(cur, jmp, reg, n)"
 	case OpIdxLe:
-		return "OpIdxLe"
+		return "OpIdxLe(cur, jmp, reg, n)"
 	case OpIdxPKey:
 		return "OpIdxPKey"
 	case OpIdxInsert:
-		return "OpIdxInsert"
+		return "OpIdxInsert(cur, rec, reg)"
 	case OpCreateTable:
 		return "OpCreateTable(reg)"
 	case OpCreateIndex:
-		return "OpCreateIndex"
+		return "OpCreateIndex(reg, cur)"
+	case OpReadCookie:
+		return "OpReadCookie(reg)"
+	case OpSetCookie:
+		return "OpSetCookie(reg)"
 	case OpCopy:
 		return "OpCopy"
 	case OpSCopy:
 		return "OpSCopy"
 	case OpHalt:
 		return "OpHalt"
+	case OpAutoCommit:
+		return "OpAutoCommit(commit, rollback)"
+	case OpSavepoint:
+		return "OpSavepoint(op, name)"
+	case OpAnd:
+		return "OpAnd"
+	case OpAdd:
+		return "OpAdd"
+	case OpSubtract:
+		return "OpSubtract"
+	case OpMultiply:
+		return "OpMultiply"
+	case OpDivide:
+		return "OpDivide"
 	}
 
-	return string(o)
+	return fmt.Sprintf("Op(%d)", o)
+}
+
+// Name is the name of the op without its parameters
+func (o Op) Name() string {
+	s := o.String()
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		return s[:i]
+	}
+	return s
 }
@@ -2,44 +2,184 @@ package virtualmachine
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/joeandaverde/tinydb/internal/metadata"
 	"github.com/joeandaverde/tinydb/internal/pager"
+	"github.com/joeandaverde/tinydb/internal/storage"
 	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
 )
 
 type PreparedStatement struct {
 	Statement    ast.Statement
 	Tag          string
 	Columns      []string
+	ColumnMeta   []ColumnMeta
 	Instructions []*Instruction
+
+	// ParamCount is the number of parameters bound to the statement
+	// each time it is executed.
+	ParamCount int
+
+	// Explain is set when the instructions are those of an explained
+	// statement, they are listed by ExplainRows rather than run.
+	Explain bool
+}
+
+// CheckParams ensures the number of parameters supplied to execute the
+// statement is the number of parameters it requires.
+func (s *PreparedStatement) CheckParams(n int) error {
+	return checkParamCount(n, s.ParamCount)
+}
+
+func checkParamCount(supplied, required int) error {
+	if supplied != required {
+		return fmt.Errorf("bind supplies %d parameters, but prepared statement requires %d", supplied, required)
+	}
+	return nil
+}
+
+// ExplainRows lists the instructions of an explained statement, a row for
+// each instruction holding its address, opcode, P1 to P4 and comment.
+func (s *PreparedStatement) ExplainRows() [][]interface{} {
+	rows := make([][]interface{}, 0, len(s.Instructions))
+	for addr, x := range s.Instructions {
+		var p4 interface{}
+		if x.P4 != nil {
+			p4 = fmt.Sprint(x.P4)
+		}
+		rows = append(rows, []interface{}{addr, x.Op.Name(), x.P1, x.P2, x.P3, p4, x.Comment})
+	}
+	return rows
+}
+
+// ReturnsRows reports whether running the statement produces rows, e.g. a
+// SELECT or an INSERT with a RETURNING clause.
+func (s *PreparedStatement) ReturnsRows() bool {
+	return s.Statement.ReturnsRows()
+}
+
+// ColumnMeta describes a column returned by a prepared statement
+type ColumnMeta struct {
+	Name     string
+	Type     storage.SQLType
+	Nullable bool
+}
+
+// explainColumns describes the row of each instruction listed by EXPLAIN
+var explainColumns = []ColumnMeta{
+	{Name: "addr", Type: storage.Integer},
+	{Name: "opcode", Type: storage.Text},
+	{Name: "p1", Type: storage.Integer},
+	{Name: "p2", Type: storage.Integer},
+	{Name: "p3", Type: storage.Integer},
+	{Name: "p4", Type: storage.Text, Nullable: true},
+	{Name: "comment", Type: storage.Text},
 }
 
 // Prepare compiles a statement into a set of instructions to run in the database virtual machine.
 func Prepare(stmt ast.Statement, pager pager.Pager) (*PreparedStatement, error) {
+	paramCount, err := paramCount(stmt)
+	if err != nil {
+		return nil, err
+	}
+
 	preparedStatement := &PreparedStatement{
-		Statement: stmt,
+		Statement:  stmt,
+		ParamCount: paramCount,
 	}
 
 	switch s := stmt.(type) {
 	case *ast.CreateTableStatement:
 		preparedStatement.Tag = "CREATE"
 		preparedStatement.Instructions = CreateTableInstructions(s)
+	case *ast.CreateIndexStatement:
+		preparedStatement.Tag = "CREATE INDEX"
+		table, err := metadata.GetTableDefinition(pager, s.Table)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range s.Columns {
+			if table.Column(c) == nil {
+				return nil, fmt.Errorf("no such column: %s", c)
+			}
+		}
+		for _, idx := range table.Indexes {
+			if idx.Name == s.Name {
+				return nil, fmt.Errorf("index %s already exists", s.Name)
+			}
+		}
+		preparedStatement.Instructions = CreateIndexInstructions(table, s)
 	case *ast.InsertStatement:
 		preparedStatement.Tag = "INSERT"
-		preparedStatement.Columns = s.Returning
-		preparedStatement.Instructions = InsertInstructions(pager, s)
+		if err := checkInsert(s); err != nil {
+			return nil, err
+		}
+		if len(s.Returning) > 0 {
+			table, err := metadata.GetTableDefinition(pager, s.Table)
+			if err != nil {
+				return nil, err
+			}
+
+			colLookup := make(map[string]bool, len(table.Columns))
+			for _, c := range table.Columns {
+				colLookup[c.Name] = true
+			}
+
+			returning := make([]ast.ResultColumn, 0, len(s.Returning))
+			for _, c := range s.Returning {
+				if c == "*" {
+					returning = append(returning, ast.ResultColumn{Expr: &ast.Star{}})
+					continue
+				}
+				if !colLookup[c] {
+					return nil, fmt.Errorf("no such column: %s", c)
+				}
+				returning = append(returning, ast.ResultColumn{Expr: &ast.Ident{Value: c}})
+			}
+
+			sources := []*fromSource{{name: table.Name, table: table}}
+			preparedStatement.ColumnMeta = resultColumns(table.Columns, fromColumns(sources), returning)
+			for _, c := range preparedStatement.ColumnMeta {
+				preparedStatement.Columns = append(preparedStatement.Columns, c.Name)
+			}
+		}
+		instructions, err := InsertInstructions(pager, s)
+		if err != nil {
+			return nil, err
+		}
+		preparedStatement.Instructions = instructions
 	case *ast.SelectStatement:
 		preparedStatement.Tag = "SELECT"
-		table, err := metadata.GetTableDefinition(pager, s.From[0].Name)
+		tableLookup := make(map[string]*metadata.TableDefinition)
+		for _, from := range s.From {
+			table, err := metadata.GetTableDefinition(pager, from.Name)
+			if err != nil {
+				return nil, err
+			}
+			tableLookup[table.Name] = table
+		}
+
+		// Result columns may be read from any table of the query
+		sources, err := fromSources(tableLookup, s.From)
 		if err != nil {
 			return nil, err
 		}
-		tableLookup := make(map[string]*metadata.TableDefinition)
-		tableLookup[table.Name] = table
+		colLookup := fromColumns(sources)
+		if err := checkSelect(s, colLookup); err != nil {
+			return nil, err
+		}
 
-		preparedStatement.Columns = s.Columns
-		preparedStatement.Instructions = SelectInstructions(tableLookup, s)
+		preparedStatement.ColumnMeta = resultColumns(starColumns(sources), colLookup, s.Columns)
+		for _, c := range preparedStatement.ColumnMeta {
+			preparedStatement.Columns = append(preparedStatement.Columns, c.Name)
+		}
+		instructions, err := SelectInstructions(tableLookup, s)
+		if err != nil {
+			return nil, err
+		}
+		preparedStatement.Instructions = instructions
 	case *ast.BeginStatement:
 		preparedStatement.Tag = "BEGIN"
 		preparedStatement.Instructions = BeginInstructions(s)
@@ -49,9 +189,408 @@ func Prepare(stmt ast.Statement, pager pager.Pager) (*PreparedStatement, error)
 	case *ast.RollbackStatement:
 		preparedStatement.Tag = "ROLLBACK"
 		preparedStatement.Instructions = RollbackInstructions(s)
+	case *ast.SavepointStatement:
+		preparedStatement.Tag = "SAVEPOINT"
+		preparedStatement.Instructions = SavepointInstructions(s)
+	case *ast.ReleaseStatement:
+		preparedStatement.Tag = "RELEASE"
+		preparedStatement.Instructions = ReleaseInstructions(s)
+	case *ast.RollbackToStatement:
+		preparedStatement.Tag = "ROLLBACK"
+		preparedStatement.Instructions = RollbackToInstructions(s)
+	case *ast.SetStatement:
+		// Session parameters are applied by the backend
+		preparedStatement.Tag = "SET"
+	case *ast.ExplainStatement:
+		// The listing of the program is produced instead of running it
+		explained, err := Prepare(s.Statement, pager)
+		if err != nil {
+			return nil, err
+		}
+		preparedStatement.Tag = "EXPLAIN"
+		preparedStatement.ColumnMeta = explainColumns
+		for _, c := range explainColumns {
+			preparedStatement.Columns = append(preparedStatement.Columns, c.Name)
+		}
+		preparedStatement.Instructions = explained.Instructions
+		preparedStatement.Explain = true
 	default:
 		return nil, fmt.Errorf("unexpected statement type")
 	}
 
 	return preparedStatement, nil
 }
+
+// checkSelect reports the errors of a query instructions cannot be
+// generated for, such as a column of none of its tables or a result column
+// neither aggregated nor grouped by in an aggregate query.
+func checkSelect(s *ast.SelectStatement, colLookup map[string]*metadata.ColumnDefinition) error {
+	aggregates := findAggregates(s.Having)
+	for _, c := range s.Columns {
+		switch e := c.Expr.(type) {
+		case *ast.Star, *ast.Ident, *ast.CaseExpression:
+			if err := checkColumns(colLookup, c.Expr); err != nil {
+				return err
+			}
+			if err := checkNot(c.Expr, false); err != nil {
+				return err
+			}
+		case *ast.AggregateExpression:
+			aggregates = append(aggregates, e)
+		default:
+			if !computable(c.Expr) {
+				return fmt.Errorf("unsupported result column: %s", c.Expr)
+			}
+			if err := checkColumns(colLookup, c.Expr); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, a := range aggregates {
+		switch a.Arg.(type) {
+		case *ast.Star:
+			if a.Name != "COUNT" {
+				return fmt.Errorf("wrong number of arguments to function %s()", a.Name)
+			}
+		case *ast.Ident:
+			if err := checkColumns(colLookup, a.Arg); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported aggregate argument: %s", a)
+		}
+	}
+
+	// Rows are filtered before they are aggregated
+	if err := checkColumns(colLookup, s.Filter); err != nil {
+		return err
+	}
+	if filterAggregates := findAggregates(s.Filter); len(filterAggregates) > 0 {
+		return fmt.Errorf("misuse of aggregate: %s", filterAggregates[0])
+	}
+	for _, e := range []ast.Expression{s.Filter, s.Having} {
+		if err := checkNot(e, true); err != nil {
+			return err
+		}
+	}
+
+	grouped := make(map[string]bool, len(s.GroupBy))
+	groupedCols := make(map[*metadata.ColumnDefinition]bool, len(s.GroupBy))
+	for _, g := range s.GroupBy {
+		if err := checkColumns(colLookup, &ast.Ident{Value: g}); err != nil {
+			return err
+		}
+		grouped[g] = true
+		groupedCols[colLookup[g]] = true
+	}
+
+	if s.Having != nil && len(s.GroupBy) == 0 {
+		return fmt.Errorf("HAVING requires a GROUP BY clause")
+	}
+
+	// HAVING filters groups, a column outside of its aggregates has a
+	// single value in a group only when rows are grouped by it
+	if err := checkColumns(colLookup, s.Having); err != nil {
+		return err
+	}
+	aggregated := make(map[string]int)
+	for _, a := range findAggregates(s.Having) {
+		for _, name := range findIdents(a.Arg) {
+			aggregated[name]++
+		}
+	}
+	for _, name := range findIdents(s.Having) {
+		if aggregated[name] > 0 {
+			aggregated[name]--
+			continue
+		}
+		if !groupedCols[colLookup[name]] {
+			return fmt.Errorf("column %s must appear in the GROUP BY clause or be used in an aggregate function", name)
+		}
+	}
+
+	// The result is sorted by columns of the tables
+	for _, o := range s.OrderBy {
+		if _, ok := o.Expr.(*ast.Ident); !ok {
+			return fmt.Errorf("unsupported order by expression: %s", o.Expr)
+		}
+		if err := checkColumns(colLookup, o.Expr); err != nil {
+			return err
+		}
+	}
+	if len(s.OrderBy) > 0 && len(s.GroupBy) > 0 {
+		return fmt.Errorf("ORDER BY with GROUP BY is not supported")
+	}
+
+	// Distinct rows are sorted so that duplicates are adjacent, the sort
+	// keys must therefore be part of the result
+	if s.Distinct {
+		if len(aggregates) > 0 || len(s.GroupBy) > 0 {
+			return fmt.Errorf("DISTINCT with aggregates is not supported")
+		}
+		for _, o := range s.OrderBy {
+			found := false
+			for _, c := range s.Columns {
+				switch e := c.Expr.(type) {
+				case *ast.Star:
+					found = true
+				case *ast.Ident:
+					found = found || colLookup[e.Value] == colLookup[o.Expr.(*ast.Ident).Value]
+				}
+			}
+			if !found {
+				return fmt.Errorf("ORDER BY term must appear in the select list with DISTINCT")
+			}
+		}
+	}
+
+	// Each result column of an aggregate query is an aggregate or a
+	// column the rows are grouped by
+	if len(aggregates) > 0 || len(s.GroupBy) > 0 {
+		for _, c := range s.Columns {
+			switch e := c.Expr.(type) {
+			case *ast.AggregateExpression:
+			case *ast.Ident:
+				if grouped[e.Value] {
+					continue
+				}
+				if len(s.GroupBy) > 0 {
+					return fmt.Errorf("column %s must appear in the GROUP BY clause or be used in an aggregate function", e.Value)
+				}
+				return fmt.Errorf("cannot mix aggregate and non-aggregate columns")
+			default:
+				return fmt.Errorf("cannot mix aggregate and non-aggregate columns")
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkInsert reports the errors of an insert instructions cannot be
+// generated for. The values of a row are computed before the row exists,
+// they cannot reference its columns.
+func checkInsert(s *ast.InsertStatement) error {
+	for _, row := range s.Rows {
+		cols := make([]string, 0, len(row))
+		for c := range row {
+			cols = append(cols, c)
+		}
+		sort.Strings(cols)
+
+		for _, c := range cols {
+			if idents := findIdents(row[c]); len(idents) > 0 {
+				return fmt.Errorf("no such column: %s", idents[0])
+			}
+		}
+	}
+	return nil
+}
+
+// checkNot ensures each NOT in an expression is applied to a condition
+// that can be negated. condition is whether the expression is a condition
+// rather than a value.
+func checkNot(expr ast.Expression, condition bool) error {
+	var operands []ast.Expression
+	switch e := expr.(type) {
+	case *ast.UnaryOperation:
+		if _, ok := negate(e); !ok || !condition {
+			return fmt.Errorf("unsupported use of NOT: %s", e)
+		}
+		return checkNot(e.Expr, true)
+	case *ast.BinaryOperation:
+		if e.Operator == "AND" || e.Operator == "OR" {
+			if err := checkNot(e.Left, true); err != nil {
+				return err
+			}
+			return checkNot(e.Right, true)
+		}
+		operands = []ast.Expression{e.Left, e.Right}
+	case *ast.NullTest:
+		operands = []ast.Expression{e.Expr}
+	case *ast.InExpression:
+		operands = append([]ast.Expression{e.Expr}, e.Values...)
+	case *ast.BetweenExpression:
+		operands = []ast.Expression{e.Expr, e.Low, e.High}
+	case *ast.CaseExpression:
+		operands = []ast.Expression{e.Operand, e.Else}
+		for _, w := range e.Whens {
+			if err := checkNot(w.Condition, e.Operand == nil); err != nil {
+				return err
+			}
+			operands = append(operands, w.Result)
+		}
+	}
+	for _, o := range operands {
+		if err := checkNot(o, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkColumns ensures each column referenced by an expression is a column
+// of exactly one table of the query
+func checkColumns(colLookup map[string]*metadata.ColumnDefinition, expr ast.Expression) error {
+	if _, ok := expr.(*ast.Star); ok {
+		return nil
+	}
+	for _, name := range findIdents(expr) {
+		col, ok := colLookup[name]
+		if !ok {
+			return fmt.Errorf("no such column: %s", name)
+		}
+		if col == nil {
+			return fmt.Errorf("ambiguous column name: %s", name)
+		}
+	}
+	return nil
+}
+
+// paramCount finds the number of parameters of a statement, which is the
+// largest parameter number as parameters may be referenced in any order.
+func paramCount(stmt ast.Statement) (int, error) {
+	var exprs []ast.Expression
+	switch s := stmt.(type) {
+	case *ast.SelectStatement:
+		for _, c := range s.Columns {
+			exprs = append(exprs, c.Expr)
+		}
+		exprs = append(exprs, s.Filter, s.Having)
+		for _, o := range s.OrderBy {
+			exprs = append(exprs, o.Expr)
+		}
+	case *ast.InsertStatement:
+		for _, row := range s.Rows {
+			for _, v := range row {
+				exprs = append(exprs, v)
+			}
+		}
+	}
+
+	count := 0
+	for _, e := range exprs {
+		for _, param := range findParameters(e) {
+			if param.Index < 1 {
+				return 0, fmt.Errorf("invalid parameter %s, parameters are numbered from $1", param)
+			}
+			if param.Index > count {
+				count = param.Index
+			}
+		}
+	}
+	return count, nil
+}
+
+// findParameters returns the parameters referenced by an expression
+func findParameters(expr ast.Expression) []*ast.Parameter {
+	switch e := expr.(type) {
+	case *ast.Parameter:
+		return []*ast.Parameter{e}
+	case *ast.AggregateExpression:
+		return findParameters(e.Arg)
+	case *ast.FunctionCall:
+		var params []*ast.Parameter
+		for _, a := range e.Args {
+			params = append(params, findParameters(a)...)
+		}
+		return params
+	case *ast.BinaryOperation:
+		return append(findParameters(e.Left), findParameters(e.Right)...)
+	case *ast.NullTest:
+		return findParameters(e.Expr)
+	case *ast.BetweenExpression:
+		return append(findParameters(e.Expr), append(findParameters(e.Low), findParameters(e.High)...)...)
+	case *ast.CaseExpression:
+		params := findParameters(e.Operand)
+		for _, w := range e.Whens {
+			params = append(params, findParameters(w.Condition)...)
+			params = append(params, findParameters(w.Result)...)
+		}
+		return append(params, findParameters(e.Else)...)
+	case *ast.InExpression:
+		params := findParameters(e.Expr)
+		for _, v := range e.Values {
+			params = append(params, findParameters(v)...)
+		}
+		return params
+	case *ast.LogicalOperation:
+		var params []*ast.Parameter
+		for _, t := range e.Terms {
+			params = append(params, findParameters(t)...)
+		}
+		return params
+	default:
+		return nil
+	}
+}
+
+// computable reports whether a result column is computed from the values
+// of a row, e.g. arithmetic on columns and literals
+func computable(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.Ident, *ast.Parameter, *ast.CaseExpression:
+		return true
+	case *ast.BasicLiteral:
+		return e.Kind != lexer.TokenBoolean
+	case *ast.BinaryOperation:
+		_, ok := arithmeticOps[e.Operator]
+		return ok && computable(e.Left) && computable(e.Right)
+	default:
+		return false
+	}
+}
+
+// resultColumns describes the columns produced by a select. A star is
+// expanded to starCols and other columns are found in colLookup.
+func resultColumns(starCols []*metadata.ColumnDefinition, colLookup map[string]*metadata.ColumnDefinition, columns []ast.ResultColumn) []ColumnMeta {
+	var result []ColumnMeta
+	for _, c := range columns {
+		var meta ColumnMeta
+		switch e := c.Expr.(type) {
+		case *ast.Star:
+			for _, col := range starCols {
+				result = append(result, columnMeta(col))
+			}
+			continue
+		case *ast.Ident:
+			meta = ColumnMeta{Name: e.Value, Type: storage.Unknown, Nullable: true}
+			if col := colLookup[e.Value]; col != nil {
+				meta = columnMeta(col)
+			}
+		case *ast.AggregateExpression:
+			meta = ColumnMeta{Name: fmt.Sprint(e), Type: storage.Unknown, Nullable: true}
+			switch e.Name {
+			case "COUNT":
+				meta.Type, meta.Nullable = storage.Integer, false
+			case "MIN", "MAX", "SUM":
+				// An aggregate over no rows is NULL
+				if ident, ok := e.Arg.(*ast.Ident); ok {
+					if col := colLookup[ident.Value]; col != nil {
+						meta.Type = col.Type
+					}
+				}
+			}
+		default:
+			meta = ColumnMeta{Name: fmt.Sprint(c.Expr), Type: storage.Unknown, Nullable: true}
+		}
+
+		// An aliased column is reported by its alias
+		if c.Alias != "" {
+			meta.Name = c.Alias
+		}
+		result = append(result, meta)
+	}
+	return result
+}
+
+func columnMeta(col *metadata.ColumnDefinition) ColumnMeta {
+	// An integer primary key is the rowid which is never NULL
+	rowID := col.PrimaryKey && col.Type == storage.Integer
+	return ColumnMeta{
+		Name:     col.Name,
+		Type:     col.Type,
+		Nullable: !col.NotNull && !rowID,
+	}
+}
@@ -4,16 +4,65 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 
 	"github.com/joeandaverde/tinydb/internal/pager"
 	"github.com/joeandaverde/tinydb/internal/storage"
 )
 
+// cancelCheckInterval is the number of instructions executed between
+// checks for cancellation of the program
+const cancelCheckInterval = 256
+
 type Flags struct {
 	AutoCommit bool
 	Rollback   bool
+
+	// Savepoint is set when the program starts, releases or rolls back
+	// to a savepoint
+	Savepoint *Savepoint
+}
+
+// SavepointOp is the operation of a savepoint statement
+type SavepointOp int
+
+const (
+	SavepointBegin SavepointOp = iota
+	SavepointRelease
+	SavepointRollback
+)
+
+// Savepoint is a savepoint operation to be carried out by the backend
+type Savepoint struct {
+	Op   SavepointOp
+	Name string
+}
+
+// ConstraintError is returned by a program halted by a violation of a
+// constraint of a table
+type ConstraintError struct {
+	Message string
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Message
+}
+
+// StatementError is returned by a program halted by an error of the values
+// the statement computes, e.g. an integer overflow. Only the statement
+// fails, the database is as it was before the statement.
+type StatementError struct {
+	Message string
+}
+
+func (e *StatementError) Error() string {
+	return e.Message
 }
 
+// Output is a result row of a program. The values of a row are only valid
+// until the next row is received, a consumer keeping a row must copy it
+// before receiving another.
 type Output struct {
 	Data []interface{}
 }
@@ -23,10 +72,24 @@ type Program struct {
 	instructions []*Instruction
 	regs         []*register
 	cursors      []*pager.Cursor
+	sorters      map[int]*sorter
+	patterns     map[string]*regexp.Regexp
 	pc           int
 	halted       bool
 	out          chan Output
 	err          string
+	constraint   bool
+	statement    bool
+
+	// rows are the buffers result rows are written to in turn. The
+	// output is unbuffered so a row is overwritten only once the row
+	// following it was received.
+	rows     [2][]interface{}
+	rowCount int
+
+	// params are the values bound to the parameters of the statement
+	params     []interface{}
+	paramCount int
 }
 
 func NewProgram(pid int, stmt *PreparedStatement) *Program {
@@ -43,21 +106,50 @@ func NewProgram(pid int, stmt *PreparedStatement) *Program {
 		pid:          pid,
 		pc:           0,
 		cursors:      make([]*pager.Cursor, 5),
+		sorters:      make(map[int]*sorter),
+		patterns:     make(map[string]*regexp.Regexp),
 		instructions: stmt.Instructions,
 		regs:         regs,
 		out:          make(chan Output),
+		paramCount:   stmt.ParamCount,
+	}
+}
+
+// Bind sets the values of the parameters of the statement before the
+// program is run, the first value is bound to $1.
+func (p *Program) Bind(params []interface{}) error {
+	if err := checkParamCount(len(params), p.paramCount); err != nil {
+		return err
 	}
+	p.params = params
+	return nil
 }
 
 func (p *Program) Run(ctx context.Context, flags Flags, pgr pager.Pager) (Flags, error) {
 	defer close(p.out)
-	for p.pc < len(p.instructions) {
+	for steps := 0; p.pc < len(p.instructions); steps++ {
+		// Stop if the program was canceled or timed out
+		if steps%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return Flags{
+					AutoCommit: false,
+					Rollback:   true,
+				}, err
+			}
+		}
+
 		nextPc := p.step(ctx, &flags, pgr)
 		if nextPc == -1 {
+			var err error = errors.New(p.err)
+			if p.constraint {
+				err = &ConstraintError{Message: p.err}
+			} else if p.statement {
+				err = &StatementError{Message: p.err}
+			}
 			return Flags{
 				AutoCommit: false,
 				Rollback:   true,
-			}, errors.New(p.err)
+			}, err
 		}
 
 		if p.halted {
@@ -69,6 +161,15 @@ func (p *Program) Run(ctx context.Context, flags Flags, pgr pager.Pager) (Flags,
 		}
 		p.pc = p.pc + 1
 	}
+
+	// The program halts early when canceled while producing a row
+	if err := ctx.Err(); err != nil {
+		return Flags{
+			AutoCommit: false,
+			Rollback:   true,
+		}, err
+	}
+
 	return flags, nil
 }
 
@@ -76,6 +177,8 @@ func (p *Program) Pid() int {
 	return p.pid
 }
 
+// Output is the channel result rows are sent to, it is closed when the
+// program completes. A row must be copied to keep it past the next row.
 func (p *Program) Output() <-chan Output {
 	return p.out
 }
@@ -86,67 +189,110 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 	switch i.Op {
 	case OpNoOp:
 	case OpHalt:
+		if i.P1 != 0 {
+			p.constraint = true
+			return p.error(i.P4.(string))
+		}
 		p.halted = true
 	case OpInteger:
 		p.setIntReg(i.P2, i.P1)
+	case OpFloat:
+		reg := p.reg(i.P2)
+		reg.typ = RegFloat
+		reg.data = i.P4.(float64)
 	case OpString:
 		r := i.P2
 		s := i.P4.(string)
 		reg := p.reg(r)
 		reg.data = s
 		reg.typ = RegString
+	case OpBlob:
+		reg := p.reg(i.P2)
+		reg.typ = RegBinary
+		reg.data = i.P4.([]byte)
 	case OpNull:
 		r := i.P2
 		reg := p.reg(r)
 		reg.data = nil
 		reg.typ = RegNull
+	case OpVariable:
+		if i.P1 < 1 || i.P1 > len(p.params) {
+			return p.error(fmt.Sprintf("parameter $%d is not bound", i.P1))
+		}
+		reg := p.reg(i.P2)
+		switch v := p.params[i.P1-1].(type) {
+		case nil:
+			reg.typ, reg.data = RegNull, nil
+		case int:
+			reg.typ, reg.data = RegInt32, v
+		case int64:
+			reg.typ, reg.data = RegInt32, int(v)
+		case float64:
+			reg.typ, reg.data = RegFloat, v
+		case string:
+			reg.typ, reg.data = RegString, v
+		case []byte:
+			reg.typ, reg.data = RegBinary, v
+		default:
+			return p.error(fmt.Sprintf("unsupported type %T bound to parameter $%d", v, i.P1))
+		}
 	case OpSCopy:
 		r1 := p.reg(i.P1)
 		r2 := p.reg(i.P2)
 		r2.data = r1.data
 		r2.typ = r1.typ
-	case OpEq:
+	case OpEq, OpNe:
 		a := p.reg(i.P1)
 		jmp := i.P2
 		b := p.reg(i.P3)
-		if eq(a, b) {
-			return jmp
+		// A comparison with NULL is neither true nor false
+		if a.typ == RegNull || b.typ == RegNull {
+			if jumpIfNull, _ := i.P4.(bool); jumpIfNull {
+				return jmp
+			}
+			break
 		}
-	case OpLt:
-		a := p.reg(i.P1)
-		jmp := i.P2
-		b := p.reg(i.P3)
-		if less(a, b) {
+		if eq(a, b) == (i.Op == OpEq) {
 			return jmp
 		}
-	case OpLe:
+	case OpLt, OpLe, OpGt, OpGe:
 		a := p.reg(i.P1)
 		jmp := i.P2
 		b := p.reg(i.P3)
-		if less(a, b) || eq(a, b) {
-			return jmp
+		// A comparison with NULL is neither true nor false
+		if a.typ == RegNull || b.typ == RegNull {
+			if jumpIfNull, _ := i.P4.(bool); jumpIfNull {
+				return jmp
+			}
+			break
 		}
-	case OpGt:
-		a := p.reg(i.P1)
-		jmp := i.P2
-		b := p.reg(i.P3)
-		if !less(a, b) && !eq(a, b) {
+		c := compare(a, b)
+		if (i.Op == OpLt && c < 0) || (i.Op == OpLe && c <= 0) ||
+			(i.Op == OpGt && c > 0) || (i.Op == OpGe && c >= 0) {
 			return jmp
 		}
-	case OpGe:
+	case OpLike, OpNotLike:
 		a := p.reg(i.P1)
 		jmp := i.P2
 		b := p.reg(i.P3)
-		if !less(a, b) {
-			return jmp
+		// A NULL value or pattern neither matches nor fails to match
+		if a.typ == RegNull || b.typ == RegNull {
+			if jumpIfNull, _ := i.P4.(bool); jumpIfNull {
+				return jmp
+			}
+			break
 		}
-	case OpNe:
-		a := p.reg(i.P1)
-		jmp := i.P2
-		b := p.reg(i.P3)
-		if !eq(a, b) {
+		if p.like(a, b) == (i.Op == OpLike) {
 			return jmp
 		}
+	case OpIsNull:
+		if p.reg(i.P1).typ == RegNull {
+			return i.P2
+		}
+	case OpNotNull:
+		if p.reg(i.P1).typ != RegNull {
+			return i.P2
+		}
 	case OpOpenRead:
 		cursor := i.P1
 		pageNo := i.P2
@@ -154,7 +300,7 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 		if err != nil {
 			return p.error("open read error")
 		}
-		p.cursors[cursor] = f
+		p.setCursor(cursor, f)
 	case OpOpenWrite:
 		cursorIndex := i.P1
 		pageNo := i.P2
@@ -162,7 +308,7 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 		if err != nil {
 			return p.error("open write error")
 		}
-		p.cursors[cursorIndex] = f
+		p.setCursor(cursorIndex, f)
 	case OpClose:
 		p.cursors[i.P1] = nil
 	case OpRewind:
@@ -175,6 +321,71 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 		if !hasRecords {
 			return jmpAddr
 		}
+	case OpSeek:
+		entry, err := p.cursors[i.P3].CurrentCell()
+		if err != nil {
+			return p.error(err.Error())
+		}
+		found, err := p.cursors[i.P1].SeekRowID(entry.RowID)
+		if err != nil {
+			return p.error("error seeking cursor")
+		}
+		if !found {
+			return i.P2
+		}
+	case OpSeekRowid:
+		rowID, ok := p.reg(i.P3).data.(int)
+		if !ok || rowID < 0 {
+			return i.P2
+		}
+		found, err := p.cursors[i.P1].SeekRowID(uint32(rowID))
+		if err != nil {
+			return p.error("error seeking cursor")
+		}
+		if !found {
+			return i.P2
+		}
+	case OpSeekGt, OpSeekGe, OpSeekLt, OpSeekLe:
+		var found bool
+		var err error
+		if n, _ := i.P4.(int); n > 0 {
+			if i.Op != OpSeekGe {
+				return p.error(fmt.Sprintf("unsupported index seek: %s", i.Op))
+			}
+			fields, ferr := p.recordFields(i.P3, n)
+			if ferr != nil {
+				return p.error(ferr.Error())
+			}
+			found, err = p.cursors[i.P1].SeekGE(storage.NewRecord(0, fields))
+		} else {
+			found, err = seekRowIDRange(p.cursors[i.P1], i.Op, p.reg(i.P3))
+		}
+		if err != nil {
+			return p.error("error seeking cursor")
+		}
+		if !found {
+			return i.P2
+		}
+	case OpIdxGt, OpIdxGe, OpIdxLt, OpIdxLe:
+		record, err := p.cursors[i.P1].CurrentCell()
+		if err != nil {
+			return p.error(err.Error())
+		}
+
+		// Compare the leading fields of the entry with the key
+		c := 0
+		for k := 0; k < i.P4.(int) && c == 0; k++ {
+			entry := &register{}
+			if err := fieldRegister(record.Fields[k], entry); err != nil {
+				return p.error(err.Error())
+			}
+			c = compare(entry, p.reg(i.P3+k))
+		}
+
+		if i.Op == OpIdxGt && c > 0 || i.Op == OpIdxGe && c >= 0 ||
+			i.Op == OpIdxLt && c < 0 || i.Op == OpIdxLe && c <= 0 {
+			return i.P2
+		}
 	case OpNext:
 		cursor := p.cursors[i.P1]
 		jmpAddr := i.P2
@@ -186,10 +397,136 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 		if hasMore {
 			return jmpAddr
 		}
+	case OpCount:
+		count, err := p.cursors[i.P1].Count()
+		if err != nil {
+			return p.error("error counting records")
+		}
+		p.setIntReg(i.P2, count)
+	case OpGoto:
+		return i.P2
+	case OpIfPos:
+		reg := p.reg(i.P1)
+		if v := reg.data.(int); v > 0 {
+			p.setIntReg(i.P1, v-i.P3)
+			return i.P2
+		}
+	case OpDecrJumpZero:
+		reg := p.reg(i.P1)
+		v := reg.data.(int) - 1
+		p.setIntReg(i.P1, v)
+		if v == 0 {
+			return i.P2
+		}
+	case OpSorterOpen:
+		desc, _ := i.P4.([]bool)
+		p.sorters[i.P1] = newSorter(i.P2, desc)
+	case OpSorterInsert:
+		regs := make([]*register, i.P3)
+		for r := range regs {
+			regs[r] = p.reg(i.P2 + r)
+		}
+		p.sorters[i.P1].insert(regs)
+	case OpSorterSort:
+		if !p.sorters[i.P1].sort() {
+			return i.P2
+		}
+	case OpSorterNext:
+		if p.sorters[i.P1].next() {
+			return i.P2
+		}
+	case OpSorterColumn:
+		src := p.sorters[i.P1].column(i.P2)
+		dest := p.reg(i.P3)
+		dest.typ = src.typ
+		dest.data = src.data
+	case OpAggStep:
+		acc := p.reg(i.P1)
+		if acc.typ != RegAggregate {
+			agg, err := newAggregator(i.P4.(string))
+			if err != nil {
+				return p.error(err.Error())
+			}
+			acc.typ = RegAggregate
+			acc.data = agg
+		}
+		var arg *register
+		if i.P2 > 0 {
+			arg = p.reg(i.P3)
+		}
+		if err := acc.data.(aggregator).step(arg); err != nil {
+			p.statement = true
+			return p.error(err.Error())
+		}
+	case OpAggFinal:
+		acc := p.reg(i.P1)
+		// No rows were stepped through the aggregate
+		if acc.typ != RegAggregate {
+			agg, err := newAggregator(i.P4.(string))
+			if err != nil {
+				return p.error(err.Error())
+			}
+			acc.data = agg
+		}
+		result := acc.data.(aggregator).final()
+		acc.typ = result.typ
+		acc.data = result.data
+	case OpAggFlush:
+		acc := p.reg(i.P1)
+		// No rows were stepped through the aggregate
+		if acc.typ != RegAggregate {
+			agg, err := newAggregator(i.P4.(string))
+			if err != nil {
+				return p.error(err.Error())
+			}
+			acc.data = agg
+		}
+		result := acc.data.(aggregator).final()
+		acc.typ = RegNull
+		acc.data = nil
+		dest := p.reg(i.P3)
+		dest.typ = result.typ
+		dest.data = result.data
+	case OpGroupBy:
+		n := i.P3
+		// The first key starts the first group
+		if p.reg(i.P1+n).typ == RegUnspecified {
+			for k := 0; k < n; k++ {
+				src, dest := p.reg(i.P1+k), p.reg(i.P1+n+k)
+				dest.typ = src.typ
+				dest.data = src.data
+			}
+			return i.P2
+		}
+		for k := 0; k < n; k++ {
+			if !eq(p.reg(i.P1+k), p.reg(i.P1+n+k)) {
+				return 0
+			}
+		}
+		return i.P2
+	case OpDistinct:
+		n := i.P3
+		if p.reg(i.P1+n).typ != RegUnspecified {
+			same := true
+			for k := 0; k < n && same; k++ {
+				same = eq(p.reg(i.P1+k), p.reg(i.P1+n+k))
+			}
+			if same {
+				return i.P2
+			}
+		}
+		for k := 0; k < n; k++ {
+			src, dest := p.reg(i.P1+k), p.reg(i.P1+n+k)
+			dest.typ = src.typ
+			dest.data = src.data
+		}
 	case OpAutoCommit:
 		flags.AutoCommit = i.P1 == 1
 		flags.Rollback = i.P2 == 1
 		p.halted = true
+	case OpSavepoint:
+		flags.Savepoint = &Savepoint{Op: SavepointOp(i.P1), Name: i.P4.(string)}
+		p.halted = true
 	case OpColumn:
 		cursor := p.cursors[i.P1]
 		col := i.P2
@@ -199,41 +536,39 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 			return p.error(err.Error())
 		}
 
-		field := record.Fields[col]
-		reg.data = field.Data
-		if field.Data == nil {
+		// Records written before a column was added have no field for it
+		if col >= len(record.Fields) {
 			reg.typ = RegNull
-		} else {
-			switch field.Type {
-			case storage.Text:
-				reg.typ = RegString
-			case storage.Integer:
-				reg.typ = RegInt32
-			case storage.Byte:
-				reg.typ = RegBinary
-			default:
-				return p.error(fmt.Sprintf("unexpected field type %v", field.Type))
-			}
+			reg.data = nil
+			break
+		}
+
+		if err := fieldRegister(record.Fields[col], reg); err != nil {
+			return p.error(err.Error())
 		}
+	case OpKey:
+		record, err := p.cursors[i.P1].CurrentCell()
+		if err != nil {
+			return p.error(err.Error())
+		}
+		p.setIntReg(i.P2, int(record.RowID))
 	case OpResultRow:
 		startReg := i.P1
 		colCount := i.P2
 		endReg := startReg + colCount - 1
-		var result []interface{}
+		result := p.rows[p.rowCount%2][:0]
 		for i := startReg; i <= endReg; i++ {
 			reg := p.reg(i)
 			switch reg.typ {
-			case RegInt32:
-				result = append(result, reg.data.(int))
-			case RegBinary:
-				// TODO: should copy the buffer?
-				result = append(result, reg.data.([]byte))
-			case RegString:
-				result = append(result, reg.data.(string))
+			case RegInt32, RegFloat, RegString, RegBinary:
+				// TODO: should copy the buffer of a blob?
+				result = append(result, reg.data)
 			case RegNull:
 				result = append(result, nil)
 			}
 		}
+		p.rows[p.rowCount%2] = result
+		p.rowCount++
 
 		select {
 		case <-ctx.Done():
@@ -250,67 +585,213 @@ func (p *Program) step(ctx context.Context, flags *Flags, pgr pager.Pager) int {
 			return p.error(fmt.Sprintf("unable to persist new table page: %s", err.Error()))
 		}
 		p.setIntReg(i.P1, rootPage.Number())
-	case OpMakeRecord:
-		startReg := i.P1
-		colCount := i.P2
-		endReg := startReg + colCount - 1
-		destReg := p.reg(i.P3)
-		var fields []*storage.Field
+	case OpCreateIndex:
+		// Allocate a page for the new index
+		rootPage, err := pgr.Allocate(pager.PageTypeLeafIndex)
+		if err != nil {
+			return p.error(fmt.Sprintf("unable to allocate page for index: %s", err.Error()))
+		}
+		if err := pgr.Write(rootPage); err != nil {
+			return p.error(fmt.Sprintf("unable to persist new index page: %s", err.Error()))
+		}
+		p.setIntReg(i.P1, rootPage.Number())
 
-		for i := startReg; i <= endReg; i++ {
-			reg := p.reg(i)
-			switch reg.typ {
-			case RegInt32:
-				// TODO: this needs to be more sophisticated and handle signed ints appropriately
-				value := reg.data.(int)
-
-				// Can this number fit in a single byte?
-				if 0xFF&value == value {
-					fields = append(fields, &storage.Field{
-						Type: storage.Byte,
-						Data: byte(value),
-					})
-					continue
-				}
-
-				// Can't fit in a single byte - store as int
-				fields = append(fields, &storage.Field{
-					Type: storage.Integer,
-					Data: value,
-				})
-			case RegString:
-				fields = append(fields, &storage.Field{
-					Type: storage.Text,
-					Data: reg.data.(string),
-				})
-			case RegNull:
-				fields = append(fields, &storage.Field{
-					Type: storage.Null,
-					Data: nil,
-				})
-			default:
-				return p.error("unsupported register type for record")
-			}
+		f, err := pager.NewCursor(pgr, pager.CURSOR_WRITE, rootPage.Number(), i.P4.(string))
+		if err != nil {
+			return p.error("open write error")
+		}
+		p.setCursor(i.P2, f)
+	case OpReadCookie:
+		cookie, err := pager.SchemaCookie(pgr)
+		if err != nil {
+			return p.error(fmt.Sprintf("unable to read schema cookie: %s", err.Error()))
+		}
+		p.setIntReg(i.P2, int(cookie))
+	case OpSetCookie:
+		if err := pager.SetSchemaCookie(pgr, uint32(p.reg(i.P3).data.(int))); err != nil {
+			return p.error(fmt.Sprintf("unable to write schema cookie: %s", err.Error()))
+		}
+	case OpAffinity:
+		types := i.P4.([]storage.SQLType)
+		for c := 0; c < i.P2; c++ {
+			applyAffinity(p.reg(i.P1+c), types[c])
+		}
+	case OpMakeRecord:
+		fields, err := p.recordFields(i.P1, i.P2)
+		if err != nil {
+			return p.error(err.Error())
 		}
 
+		destReg := p.reg(i.P3)
 		destReg.typ = RegRecord
 		destReg.data = fields
 	case OpRowID:
-		cursor := p.cursors[i.P1]
-		p.setIntReg(i.P2, int(nextKey(cursor.Name)))
+		// The next rowid follows the largest rowid of the table
+		maxRowID, err := p.cursors[i.P1].MaxRowID()
+		if err != nil {
+			return p.error(fmt.Sprintf("error reading rowid: %s", err.Error()))
+		}
+		p.setIntReg(i.P2, int(maxRowID)+1)
 	case OpInsert:
 		cursor := p.cursors[i.P1]
 		fields := p.reg(i.P2).data.([]*storage.Field)
-		key := p.reg(i.P3).data.(int)
+		key, ok := p.reg(i.P3).data.(int)
+		if !ok || key < 0 {
+			return p.error("datatype mismatch")
+		}
 		record := storage.NewRecord(uint32(key), fields)
 		if err := cursor.Insert(record); err != nil {
 			return p.error("error performing insert")
 		}
+	case OpAdd, OpSubtract, OpMultiply, OpDivide:
+		a, b, dest := p.reg(i.P1), p.reg(i.P2), p.reg(i.P3)
+		if a.typ == RegNull || b.typ == RegNull {
+			dest.typ, dest.data = RegNull, nil
+			break
+		}
+		if a.typ == RegInt32 && b.typ == RegInt32 {
+			x, y := a.data.(int), b.data.(int)
+			if i.Op == OpDivide && y == 0 {
+				dest.typ, dest.data = RegNull, nil
+				break
+			}
+			// A result overflowing an integer is a float as in SQLite
+			if v, ok := arithmetic(i.Op, x, y); ok {
+				dest.typ, dest.data = RegInt32, v
+				break
+			}
+		}
+		x, y, ok := numericOperands(a, b)
+		if !ok {
+			return p.error("datatype mismatch")
+		}
+		if i.Op == OpDivide && y == 0 {
+			dest.typ, dest.data = RegNull, nil
+			break
+		}
+		dest.typ, dest.data = RegFloat, arithmeticFloat(i.Op, x, y)
+	case OpIdxInsert:
+		cursor := p.cursors[i.P1]
+		fields := p.reg(i.P2).data.([]*storage.Field)
+		key := p.reg(i.P3).data.(int)
+		record := storage.NewRecord(uint32(key), fields)
+		if err := cursor.IdxInsert(record); err != nil {
+			return p.error(fmt.Sprintf("error performing index insert: %s", err.Error()))
+		}
 	}
 
 	return 0
 }
 
+// recordFields converts a block of registers to the fields of a record
+func (p *Program) recordFields(startReg int, count int) ([]*storage.Field, error) {
+	var fields []*storage.Field
+
+	for r := startReg; r < startReg+count; r++ {
+		reg := p.reg(r)
+		switch reg.typ {
+		case RegInt32:
+			// The record stores the integer in as few bytes as it fits in
+			fields = append(fields, &storage.Field{
+				Type: storage.Integer,
+				Data: reg.data.(int),
+			})
+		case RegFloat:
+			fields = append(fields, &storage.Field{
+				Type: storage.Float,
+				Data: reg.data.(float64),
+			})
+		case RegString:
+			fields = append(fields, &storage.Field{
+				Type: storage.Text,
+				Data: reg.data.(string),
+			})
+		case RegBinary:
+			fields = append(fields, &storage.Field{
+				Type: storage.Blob,
+				Data: reg.data.([]byte),
+			})
+		case RegNull:
+			fields = append(fields, &storage.Field{
+				Type: storage.Null,
+				Data: nil,
+			})
+		default:
+			return nil, errors.New("unsupported register type for record")
+		}
+	}
+
+	return fields, nil
+}
+
+// fieldRegister stores the value of a record field in a register
+func fieldRegister(field *storage.Field, reg *register) error {
+	reg.data = field.Data
+	if field.Data == nil {
+		reg.typ = RegNull
+		return nil
+	}
+
+	switch field.Type {
+	case storage.Text:
+		reg.typ = RegString
+	case storage.Integer:
+		reg.typ = RegInt32
+	case storage.Float:
+		reg.typ = RegFloat
+	case storage.Blob:
+		reg.typ = RegBinary
+	default:
+		return fmt.Errorf("unexpected field type %v", field.Type)
+	}
+
+	return nil
+}
+
+// setCursor stores an open cursor, making room for as many as needed
+// seekRowIDRange positions a table cursor at the first row with a rowid
+// greater than (or equal to) the rowid in a register, or at the last row with
+// a rowid less than (or equal to) it. A value that is not an integer matches
+// no row. returns true if there is such a row false otherwise
+func seekRowIDRange(cursor *pager.Cursor, op Op, reg *register) (bool, error) {
+	rowID, ok := reg.data.(int)
+	if !ok {
+		return false, nil
+	}
+
+	switch op {
+	case OpSeekGt, OpSeekGe:
+		if op == OpSeekGt {
+			rowID++
+		}
+		if rowID < 0 {
+			rowID = 0
+		}
+		if int64(rowID) > math.MaxUint32 {
+			return false, nil
+		}
+		return cursor.SeekRowIDGE(uint32(rowID))
+	default:
+		if op == OpSeekLt {
+			rowID--
+		}
+		if rowID < 0 {
+			return false, nil
+		}
+		if int64(rowID) > math.MaxUint32 {
+			rowID = math.MaxUint32
+		}
+		return cursor.SeekRowIDLE(uint32(rowID))
+	}
+}
+
+func (p *Program) setCursor(i int, c *pager.Cursor) {
+	for len(p.cursors) <= i {
+		p.cursors = append(p.cursors, nil)
+	}
+	p.cursors[i] = c
+}
+
 func (p *Program) setIntReg(r int, v int) {
 	reg := p.reg(r)
 	reg.typ = RegInt32
@@ -324,7 +805,7 @@ func (p *Program) error(message string) int {
 
 func (p *Program) reg(i int) *register {
 	if len(p.regs) <= i {
-		diff := len(p.regs) - i + 1
+		diff := i - len(p.regs) + 1
 		// Allocate some number of registers
 		for i := 0; i < diff; i++ {
 			p.regs = append(p.regs, &register{
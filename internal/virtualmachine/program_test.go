@@ -0,0 +1,321 @@
+package virtualmachine
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/internal/pager"
+	"github.com/joeandaverde/tinydb/internal/storage"
+)
+
+func TestProgram_Add(t *testing.T) {
+	tests := []struct {
+		name     string
+		left     *Instruction
+		right    *Instruction
+		expected interface{}
+	}{
+		{"integers", &Instruction{Op: OpInteger, P1: 2, P2: 0}, &Instruction{Op: OpInteger, P1: 3, P2: 1}, 5},
+		{"floats", &Instruction{Op: OpFloat, P2: 0, P4: 1.25}, &Instruction{Op: OpFloat, P2: 1, P4: 0.5}, 1.75},
+		{"integer and float", &Instruction{Op: OpInteger, P1: 2, P2: 0}, &Instruction{Op: OpFloat, P2: 1, P4: 0.5}, 2.5},
+		{"float and integer", &Instruction{Op: OpFloat, P2: 0, P4: 0.5}, &Instruction{Op: OpInteger, P1: 2, P2: 1}, 2.5},
+		{"null", &Instruction{Op: OpNull, P2: 0}, &Instruction{Op: OpFloat, P2: 1, P4: 0.5}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+				tc.left,
+				tc.right,
+				{Op: OpAdd, P1: 0, P2: 1, P3: 2},
+				{Op: OpResultRow, P1: 2, P2: 1},
+				{Op: OpHalt},
+			}})
+
+			var rows [][]interface{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for o := range program.Output() {
+					rows = append(rows, append([]interface{}(nil), o.Data...))
+				}
+			}()
+
+			_, err := program.Run(context.Background(), Flags{}, nil)
+			r.NoError(err)
+			<-done
+			r.Equal([][]interface{}{{tc.expected}}, rows)
+		})
+	}
+}
+
+func TestProgram_Arithmetic(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       Op
+		left     *Instruction
+		right    *Instruction
+		expected interface{}
+	}{
+		{"subtract integers", OpSubtract, &Instruction{Op: OpInteger, P1: 2, P2: 0}, &Instruction{Op: OpInteger, P1: 3, P2: 1}, -1},
+		{"subtract float", OpSubtract, &Instruction{Op: OpInteger, P1: 2, P2: 0}, &Instruction{Op: OpFloat, P2: 1, P4: 0.5}, 1.5},
+		{"multiply integers", OpMultiply, &Instruction{Op: OpInteger, P1: 2, P2: 0}, &Instruction{Op: OpInteger, P1: 3, P2: 1}, 6},
+		{"multiply float", OpMultiply, &Instruction{Op: OpFloat, P2: 0, P4: 0.5}, &Instruction{Op: OpInteger, P1: 3, P2: 1}, 1.5},
+		{"divide integers", OpDivide, &Instruction{Op: OpInteger, P1: 7, P2: 0}, &Instruction{Op: OpInteger, P1: 2, P2: 1}, 3},
+		{"divide float", OpDivide, &Instruction{Op: OpFloat, P2: 0, P4: 7.0}, &Instruction{Op: OpInteger, P1: 2, P2: 1}, 3.5},
+		{"divide by zero", OpDivide, &Instruction{Op: OpInteger, P1: 7, P2: 0}, &Instruction{Op: OpInteger, P1: 0, P2: 1}, nil},
+		{"divide by zero float", OpDivide, &Instruction{Op: OpFloat, P2: 0, P4: 7.0}, &Instruction{Op: OpFloat, P2: 1, P4: 0.0}, nil},
+		{"null", OpMultiply, &Instruction{Op: OpNull, P2: 0}, &Instruction{Op: OpInteger, P1: 2, P2: 1}, nil},
+		{"add overflow", OpAdd, &Instruction{Op: OpInteger, P1: math.MaxInt64, P2: 0}, &Instruction{Op: OpInteger, P1: 1, P2: 1}, float64(math.MaxInt64) + 1},
+		{"subtract overflow", OpSubtract, &Instruction{Op: OpInteger, P1: math.MinInt64, P2: 0}, &Instruction{Op: OpInteger, P1: 1, P2: 1}, float64(math.MinInt64) - 1},
+		{"multiply overflow", OpMultiply, &Instruction{Op: OpInteger, P1: math.MaxInt64, P2: 0}, &Instruction{Op: OpInteger, P1: 2, P2: 1}, float64(math.MaxInt64) * 2},
+		{"divide overflow", OpDivide, &Instruction{Op: OpInteger, P1: math.MinInt64, P2: 0}, &Instruction{Op: OpInteger, P1: -1, P2: 1}, -float64(math.MinInt64)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+			program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+				tc.left,
+				tc.right,
+				{Op: tc.op, P1: 0, P2: 1, P3: 2},
+				{Op: OpResultRow, P1: 2, P2: 1},
+				{Op: OpHalt},
+			}})
+
+			var rows [][]interface{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for o := range program.Output() {
+					rows = append(rows, append([]interface{}(nil), o.Data...))
+				}
+			}()
+
+			_, err := program.Run(context.Background(), Flags{}, nil)
+			r.NoError(err)
+			<-done
+			r.Equal([][]interface{}{{tc.expected}}, rows)
+		})
+	}
+}
+
+func TestProgram_Add_DatatypeMismatch(t *testing.T) {
+	program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+		{Op: OpString, P2: 0, P4: "a"},
+		{Op: OpFloat, P2: 1, P4: 0.5},
+		{Op: OpAdd, P1: 0, P2: 1, P3: 2},
+		{Op: OpHalt},
+	}})
+
+	_, err := program.Run(context.Background(), Flags{}, nil)
+	require.EqualError(t, err, "datatype mismatch")
+}
+
+func TestProgram_Column(t *testing.T) {
+	r := require.New(t)
+
+	file := storage.NewMemoryFile(4096)
+	r.NoError(pager.Initialize(file))
+	pgr := pager.NewPager(file)
+
+	root, err := pgr.Allocate(pager.PageTypeLeaf)
+	r.NoError(err)
+	r.NoError(pgr.Write(root))
+
+	table := pager.NewBTreeTable(root.Number(), pgr)
+	r.NoError(table.Insert(storage.NewRecord(1, []*storage.Field{
+		{Type: storage.Text, Data: "joe"},
+		{Type: storage.Integer, Data: -40000},
+		{Type: storage.Blob, Data: []byte{0xca, 0xfe}},
+		{Type: storage.Float, Data: 1.5},
+		{Type: storage.Text, Data: nil},
+	})))
+
+	program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+		{Op: OpOpenRead, P1: 0, P2: root.Number(), P3: 5, P4: "people"},
+		{Op: OpRewind, P1: 0, P2: 8},
+		{Op: OpColumn, P1: 0, P2: 0, P3: 0},
+		{Op: OpColumn, P1: 0, P2: 1, P3: 1},
+		{Op: OpColumn, P1: 0, P2: 2, P3: 2},
+		{Op: OpColumn, P1: 0, P2: 3, P3: 3},
+		{Op: OpColumn, P1: 0, P2: 4, P3: 4},
+		{Op: OpResultRow, P1: 0, P2: 5},
+		{Op: OpHalt},
+	}})
+
+	var rows [][]interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for o := range program.Output() {
+			rows = append(rows, append([]interface{}(nil), o.Data...))
+		}
+	}()
+
+	_, err = program.Run(context.Background(), Flags{}, pgr)
+	r.NoError(err)
+	<-done
+	r.Equal([][]interface{}{{"joe", -40000, []byte{0xca, 0xfe}, 1.5, nil}}, rows)
+}
+
+func TestProgram_Column_BeyondRecord(t *testing.T) {
+	r := require.New(t)
+
+	file := storage.NewMemoryFile(4096)
+	r.NoError(pager.Initialize(file))
+	pgr := pager.NewPager(file)
+
+	root, err := pgr.Allocate(pager.PageTypeLeaf)
+	r.NoError(err)
+	r.NoError(pgr.Write(root))
+
+	// The record has fewer fields than the columns being read
+	table := pager.NewBTreeTable(root.Number(), pgr)
+	r.NoError(table.Insert(storage.NewRecord(1, []*storage.Field{
+		{Type: storage.Text, Data: "joe"},
+	})))
+
+	program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+		{Op: OpOpenRead, P1: 0, P2: root.Number(), P3: 2, P4: "people"},
+		{Op: OpRewind, P1: 0, P2: 5},
+		{Op: OpColumn, P1: 0, P2: 0, P3: 0},
+		{Op: OpColumn, P1: 0, P2: 1, P3: 1},
+		{Op: OpResultRow, P1: 0, P2: 2},
+		{Op: OpHalt},
+	}})
+
+	var rows [][]interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for o := range program.Output() {
+			rows = append(rows, append([]interface{}(nil), o.Data...))
+		}
+	}()
+
+	_, err = program.Run(context.Background(), Flags{}, pgr)
+	r.NoError(err)
+	<-done
+	r.Equal([][]interface{}{{"joe", nil}}, rows)
+}
+
+func TestProgram_SeekRowidRange(t *testing.T) {
+	r := require.New(t)
+
+	file := storage.NewMemoryFile(4096)
+	r.NoError(pager.Initialize(file))
+	pgr := pager.NewPager(file)
+
+	root, err := pgr.Allocate(pager.PageTypeLeaf)
+	r.NoError(err)
+	r.NoError(pgr.Write(root))
+
+	table := pager.NewBTreeTable(root.Number(), pgr)
+	for _, rowID := range []uint32{2, 4, 6} {
+		r.NoError(table.Insert(storage.NewRecord(rowID, []*storage.Field{
+			{Type: storage.Text, Data: "joe"},
+		})))
+	}
+
+	for _, tc := range []struct {
+		op    Op
+		rowID int
+		want  [][]interface{}
+	}{
+		{OpSeekGt, 0, [][]interface{}{{2}}},
+		{OpSeekGt, 4, [][]interface{}{{6}}},
+		{OpSeekGt, 6, nil},
+		{OpSeekGe, 4, [][]interface{}{{4}}},
+		{OpSeekGe, 5, [][]interface{}{{6}}},
+		{OpSeekGe, 7, nil},
+		{OpSeekLt, 4, [][]interface{}{{2}}},
+		{OpSeekLt, 100, [][]interface{}{{6}}},
+		{OpSeekLt, 2, nil},
+		{OpSeekLe, 4, [][]interface{}{{4}}},
+		{OpSeekLe, 3, [][]interface{}{{2}}},
+		{OpSeekLe, 1, nil},
+	} {
+		program := NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+			{Op: OpOpenRead, P1: 0, P2: root.Number(), P3: 1, P4: "people"},
+			{Op: OpInteger, P1: tc.rowID, P2: 0},
+			{Op: tc.op, P1: 0, P2: 5, P3: 0},
+			{Op: OpKey, P1: 0, P2: 1},
+			{Op: OpResultRow, P1: 1, P2: 1},
+			{Op: OpHalt},
+		}})
+
+		var rows [][]interface{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for o := range program.Output() {
+				rows = append(rows, append([]interface{}(nil), o.Data...))
+			}
+		}()
+
+		_, err = program.Run(context.Background(), Flags{}, pgr)
+		r.NoError(err)
+		<-done
+		r.Equal(tc.want, rows, "%s %d", tc.op, tc.rowID)
+	}
+}
+
+// countdownProgram produces n rows of (i, i+1000) for i from n down to 1
+func countdownProgram(n int) *Program {
+	return NewProgram(1, &PreparedStatement{Instructions: []*Instruction{
+		{Op: OpInteger, P1: n, P2: 0},
+		{Op: OpInteger, P1: 1000, P2: 2},
+		{Op: OpAdd, P1: 0, P2: 2, P3: 1},
+		{Op: OpResultRow, P1: 0, P2: 2},
+		{Op: OpDecrJumpZero, P1: 0, P2: 6},
+		{Op: OpGoto, P2: 2},
+		{Op: OpHalt},
+	}})
+}
+
+func TestProgram_ResultRowCopied(t *testing.T) {
+	r := require.New(t)
+
+	const n = 100
+	program := countdownProgram(n)
+
+	// rows are copied as they are received, they aren't overwritten by
+	// the rows that follow
+	var rows [][]interface{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for o := range program.Output() {
+			rows = append(rows, append([]interface{}(nil), o.Data...))
+		}
+	}()
+
+	_, err := program.Run(context.Background(), Flags{}, nil)
+	r.NoError(err)
+	<-done
+
+	r.Len(rows, n)
+	for i, row := range rows {
+		r.Equal([]interface{}{n - i, n - i + 1000}, row)
+	}
+}
+
+func BenchmarkProgram_ResultRow(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		program := countdownProgram(10000)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range program.Output() {
+			}
+		}()
+		if _, err := program.Run(context.Background(), Flags{}, nil); err != nil {
+			b.Fatal(err)
+		}
+		<-done
+	}
+}
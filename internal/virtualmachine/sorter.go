@@ -0,0 +1,59 @@
+package virtualmachine
+
+import "sort"
+
+// sorter accumulates rows in memory so they can be sorted by their
+// leading key columns before being read back in order.
+type sorter struct {
+	keyCount int
+	desc     []bool
+	rows     [][]*register
+	pos      int
+}
+
+func newSorter(keyCount int, desc []bool) *sorter {
+	return &sorter{
+		keyCount: keyCount,
+		desc:     desc,
+	}
+}
+
+// insert copies the registers into a new row
+func (s *sorter) insert(regs []*register) {
+	row := make([]*register, len(regs))
+	for i, r := range regs {
+		row[i] = &register{typ: r.typ, data: r.data}
+	}
+	s.rows = append(s.rows, row)
+}
+
+// sort orders the rows by the key columns and positions the sorter at the
+// first row. returns true if there are any rows.
+func (s *sorter) sort() bool {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		for k := 0; k < s.keyCount; k++ {
+			c := compare(s.rows[i][k], s.rows[j][k])
+			if c == 0 {
+				continue
+			}
+			if k < len(s.desc) && s.desc[k] {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	s.pos = 0
+	return len(s.rows) > 0
+}
+
+// next advances to the next row. returns true if there is a row.
+func (s *sorter) next() bool {
+	s.pos++
+	return s.pos < len(s.rows)
+}
+
+// column returns the register at column i of the current row
+func (s *sorter) column(i int) *register {
+	return s.rows[s.pos][i]
+}
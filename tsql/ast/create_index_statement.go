@@ -0,0 +1,16 @@
+package ast
+
+// CreateIndexStatement represents an instruction to create an index on
+// columns of a table
+type CreateIndexStatement struct {
+	Name    string
+	Table   string
+	Columns []string
+	RawText string
+}
+
+func (*CreateIndexStatement) iStatement() {}
+
+func (*CreateIndexStatement) Mutates() bool { return true }
+
+func (*CreateIndexStatement) ReturnsRows() bool { return false }
@@ -5,6 +5,8 @@ type ColumnDefinition struct {
 	Name       string
 	Type       string
 	PrimaryKey bool
+	NotNull    bool
+	Unique     bool
 }
 
 // CreateTableStatement represents an instruction to create a table
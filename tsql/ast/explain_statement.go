@@ -0,0 +1,12 @@
+package ast
+
+// ExplainStatement describes the program of a statement rather than running it
+type ExplainStatement struct {
+	Statement Statement
+}
+
+func (*ExplainStatement) iStatement() {}
+
+func (*ExplainStatement) Mutates() bool { return false }
+
+func (*ExplainStatement) ReturnsRows() bool { return true }
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/joeandaverde/tinydb/tsql/lexer"
 )
@@ -23,21 +24,111 @@ type BinaryOperation struct {
 	Operator string
 }
 
+// UnaryOperation is an expression with one operand, e.g. NOT (a = b)
+type UnaryOperation struct {
+	Op   string
+	Expr Expression
+}
+
 // Ident is a reference to something in the environment
 type Ident struct {
 	Value string
 }
 
-// BasicLiteral represents a string, number, or boolean value
+// BasicLiteral represents a string, number, blob, or boolean value. The value
+// of a blob is its hex digits.
 type BasicLiteral struct {
 	Value string
 	Kind  lexer.Kind
 }
 
-func (*BinaryOperation) iExpression()  {}
-func (*LogicalOperation) iExpression() {}
-func (*Ident) iExpression()            {}
-func (*BasicLiteral) iExpression()     {}
+// FunctionCall is a call to a named function, e.g. COUNT(*)
+type FunctionCall struct {
+	Name     string
+	Args     []Expression
+	Distinct bool
+}
+
+// AggregateExpression is an aggregate function computed over a set of rows,
+// e.g. COUNT(*) or SUM(price). Distinct aggregates, e.g. COUNT(DISTINCT
+// price), only consider each distinct value once.
+type AggregateExpression struct {
+	Name     string
+	Arg      Expression
+	Distinct bool
+}
+
+// NullTest tests whether an expression is NULL, e.g. email IS NOT NULL
+type NullTest struct {
+	Expr Expression
+	Not  bool
+}
+
+// InExpression tests whether an expression is one of a list of values,
+// e.g. status NOT IN ('active', 'pending')
+type InExpression struct {
+	Expr   Expression
+	Values []Expression
+	Not    bool
+}
+
+// BetweenExpression tests whether an expression is within an inclusive range,
+// e.g. age BETWEEN 18 AND 65
+type BetweenExpression struct {
+	Expr Expression
+	Low  Expression
+	High Expression
+	Not  bool
+}
+
+// CaseExpression chooses the result of the first arm whose condition holds,
+// e.g. CASE WHEN qty > 10 THEN 'many' ELSE 'few' END. When Operand is set
+// each condition is a value compared with the operand, e.g. CASE state WHEN 'IL' THEN 1 END.
+type CaseExpression struct {
+	Operand Expression
+	Whens   []WhenClause
+	// Else is the result when no arm matches, NULL when not set
+	Else Expression
+}
+
+// WhenClause is an arm of a CASE expression
+type WhenClause struct {
+	Condition Expression
+	Result    Expression
+}
+
+// Star refers to all columns, e.g. SELECT * or COUNT(*)
+type Star struct{}
+
+// Parameter is a placeholder for a value bound when the statement is
+// executed, e.g. $1. Parameters are numbered from 1.
+type Parameter struct {
+	Index int
+}
+
+func (*BinaryOperation) iExpression()     {}
+func (*UnaryOperation) iExpression()      {}
+func (*LogicalOperation) iExpression()    {}
+func (*Ident) iExpression()               {}
+func (*BasicLiteral) iExpression()        {}
+func (*FunctionCall) iExpression()        {}
+func (*AggregateExpression) iExpression() {}
+func (*NullTest) iExpression()            {}
+func (*InExpression) iExpression()        {}
+func (*BetweenExpression) iExpression()   {}
+func (*CaseExpression) iExpression()      {}
+func (*Star) iExpression()                {}
+func (*Parameter) iExpression()           {}
+
+// IsAggregateFunction reports whether the named function aggregates a set of rows
+func IsAggregateFunction(name string) bool {
+	switch strings.ToUpper(name) {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	default:
+		return false
+	}
+}
 
 func IdentLiteralOperation(op *BinaryOperation) (*Ident, *BasicLiteral) {
 	if leftIdent, rightLiteral := asIdent(op.Left), asLiteral(op.Right); leftIdent != nil && rightLiteral != nil {
@@ -67,10 +158,98 @@ func asLiteral(e Expression) *BasicLiteral {
 	return nil
 }
 
+func (l *BasicLiteral) String() string {
+	switch l.Kind {
+	case lexer.TokenString:
+		return "'" + strings.ReplaceAll(l.Value, "'", "''") + "'"
+	case lexer.TokenBlob:
+		return "X'" + l.Value + "'"
+	case lexer.TokenNull:
+		return "NULL"
+	default:
+		return l.Value
+	}
+}
+
 func (o *BinaryOperation) String() string {
 	return fmt.Sprintf("(%s %s %s)", o.Left, o.Operator, o.Right)
 }
 
+func (o *UnaryOperation) String() string {
+	return fmt.Sprintf("(%s %s)", o.Op, o.Expr)
+}
+
 func (o *LogicalOperation) String() string {
 	return fmt.Sprintf("(%s %v)", o.Operator, o.Terms)
 }
+
+func (i *Ident) String() string {
+	return i.Value
+}
+
+func (f *FunctionCall) String() string {
+	args := make([]string, 0, len(f.Args))
+	for _, a := range f.Args {
+		args = append(args, fmt.Sprint(a))
+	}
+	if f.Distinct {
+		return fmt.Sprintf("%s(DISTINCT %s)", f.Name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
+}
+
+func (a *AggregateExpression) String() string {
+	if a.Distinct {
+		return fmt.Sprintf("%s(DISTINCT %s)", a.Name, a.Arg)
+	}
+	return fmt.Sprintf("%s(%s)", a.Name, a.Arg)
+}
+
+func (n *NullTest) String() string {
+	if n.Not {
+		return fmt.Sprintf("(%s IS NOT NULL)", n.Expr)
+	}
+	return fmt.Sprintf("(%s IS NULL)", n.Expr)
+}
+
+func (in *InExpression) String() string {
+	values := make([]string, 0, len(in.Values))
+	for _, v := range in.Values {
+		values = append(values, fmt.Sprint(v))
+	}
+	if in.Not {
+		return fmt.Sprintf("(%s NOT IN (%s))", in.Expr, strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("(%s IN (%s))", in.Expr, strings.Join(values, ", "))
+}
+
+func (b *BetweenExpression) String() string {
+	if b.Not {
+		return fmt.Sprintf("(%s NOT BETWEEN %s AND %s)", b.Expr, b.Low, b.High)
+	}
+	return fmt.Sprintf("(%s BETWEEN %s AND %s)", b.Expr, b.Low, b.High)
+}
+
+func (c *CaseExpression) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if c.Operand != nil {
+		fmt.Fprintf(&b, " %s", c.Operand)
+	}
+	for _, w := range c.Whens {
+		fmt.Fprintf(&b, " WHEN %s THEN %s", w.Condition, w.Result)
+	}
+	if c.Else != nil {
+		fmt.Fprintf(&b, " ELSE %s", c.Else)
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+func (*Star) String() string {
+	return "*"
+}
+
+func (p *Parameter) String() string {
+	return fmt.Sprintf("$%d", p.Index)
+}
@@ -2,10 +2,11 @@ package ast
 
 type ValueSet map[string]Expression
 
-// InsertStatement represents an instruction to insert data into a table and expressions that evaluate to values
+// InsertStatement represents an instruction to insert data into a table and expressions that evaluate to values.
+// Each row maps the columns named by the statement to the values of a VALUES tuple.
 type InsertStatement struct {
 	Table     string
-	Values    ValueSet
+	Rows      []ValueSet
 	Returning []string
 }
 
@@ -8,11 +8,30 @@ type TableAlias struct {
 	Alias string
 }
 
+// OrderingTerm represents an expression used to sort the result of a select
+type OrderingTerm struct {
+	Expr Expression
+	Desc bool
+}
+
+// ResultColumn represents an expression of the result of a select and the
+// name it is given, if any
+type ResultColumn struct {
+	Expr  Expression
+	Alias string
+}
+
 // SelectStatement represents an instruction to select/filter rows from one or more tables
 type SelectStatement struct {
-	From    []TableAlias
-	Columns []string
-	Filter  Expression
+	Distinct bool
+	From     []TableAlias
+	Columns  []ResultColumn
+	Filter   Expression
+	GroupBy  []string
+	Having   Expression
+	OrderBy  []OrderingTerm
+	Limit    *int
+	Offset   *int
 }
 
 func (s *SelectStatement) String() string {
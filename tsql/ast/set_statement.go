@@ -0,0 +1,13 @@
+package ast
+
+// SetStatement changes a configuration parameter of the session
+type SetStatement struct {
+	Name  string
+	Value string
+}
+
+func (*SetStatement) iStatement() {}
+
+func (*SetStatement) Mutates() bool { return false }
+
+func (*SetStatement) ReturnsRows() bool { return false }
@@ -9,14 +9,39 @@ type CommitStatement struct{}
 // RollbackStatement rolls back a transaction
 type RollbackStatement struct{}
 
-func (*BeginStatement) iStatement()    {}
-func (*CommitStatement) iStatement()   {}
-func (*RollbackStatement) iStatement() {}
+// SavepointStatement marks a point in a transaction that may be rolled back to
+type SavepointStatement struct {
+	Name string
+}
 
-func (*BeginStatement) Mutates() bool    { return false }
-func (*CommitStatement) Mutates() bool   { return false }
-func (*RollbackStatement) Mutates() bool { return false }
+// ReleaseStatement forgets a savepoint and the savepoints following it,
+// keeping the changes made since
+type ReleaseStatement struct {
+	Name string
+}
 
-func (*BeginStatement) ReturnsRows() bool    { return false }
-func (*CommitStatement) ReturnsRows() bool   { return false }
-func (*RollbackStatement) ReturnsRows() bool { return false }
+// RollbackToStatement undoes the changes made since a savepoint
+type RollbackToStatement struct {
+	Name string
+}
+
+func (*BeginStatement) iStatement()      {}
+func (*CommitStatement) iStatement()     {}
+func (*RollbackStatement) iStatement()   {}
+func (*SavepointStatement) iStatement()  {}
+func (*ReleaseStatement) iStatement()    {}
+func (*RollbackToStatement) iStatement() {}
+
+func (*BeginStatement) Mutates() bool      { return false }
+func (*CommitStatement) Mutates() bool     { return false }
+func (*RollbackStatement) Mutates() bool   { return false }
+func (*SavepointStatement) Mutates() bool  { return false }
+func (*ReleaseStatement) Mutates() bool    { return false }
+func (*RollbackToStatement) Mutates() bool { return false }
+
+func (*BeginStatement) ReturnsRows() bool      { return false }
+func (*CommitStatement) ReturnsRows() bool     { return false }
+func (*RollbackStatement) ReturnsRows() bool   { return false }
+func (*SavepointStatement) ReturnsRows() bool  { return false }
+func (*ReleaseStatement) ReturnsRows() bool    { return false }
+func (*RollbackToStatement) ReturnsRows() bool { return false }
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -20,6 +21,9 @@ type Lexer struct {
 	start     int
 	pos       int
 	width     int
+
+	// params is the largest parameter number so far
+	params int
 }
 
 // NewLexer initializes a lexer with input.
@@ -43,9 +47,30 @@ func (l *Lexer) Exec() <-chan Token {
 	return l.items
 }
 
+// lexWhiteSpace lexes white space along with any comments within it.
+// A -- comment runs to the end of the line and a /* comment runs to the
+// first */ following it.
 func lexWhiteSpace(l *Lexer) stateFn {
-	for isWhiteSpace(l.peek()) {
-		l.next()
+	for {
+		if isWhiteSpace(l.peek()) {
+			l.next()
+		} else if l.peek() == '-' && l.peek2() == '-' {
+			for !isEndOfLine(l.peek()) {
+				l.next()
+			}
+		} else if l.peek() == '/' && l.peek2() == '*' {
+			l.next()
+			l.next()
+			for !(l.peek() == '*' && l.peek2() == '/') {
+				if l.next() == eof {
+					return l.errorf("non terminated comment")
+				}
+			}
+			l.next()
+			l.next()
+		} else {
+			break
+		}
 	}
 
 	l.emit(TokenWhiteSpace)
@@ -58,11 +83,52 @@ func lexNumber(l *Lexer) stateFn {
 		l.next()
 	}
 
-	l.emit(TokenNumber)
+	// A fractional part or an exponent makes the number a float, e.g. 1.5,
+	// .5 or 1e3. A dot not followed by a digit is not part of the number.
+	float := false
+	if l.peek() == '.' && unicode.IsDigit(l.peek2()) {
+		l.next()
+		for unicode.IsDigit(l.peek()) {
+			l.next()
+		}
+		float = true
+	}
+	if l.acceptExponent() {
+		float = true
+	}
+
+	if float {
+		l.emit(TokenFloat)
+	} else {
+		l.emit(TokenNumber)
+	}
 
 	return lexTinySQL
 }
 
+// acceptExponent consumes the exponent of a number, e.g. e3 or E-3, if one
+// is next. Nothing is consumed when the e is not followed by digits.
+func (l *Lexer) acceptExponent() bool {
+	if r := l.peek(); r != 'e' && r != 'E' {
+		return false
+	}
+
+	pos := l.pos
+	l.next()
+	if r := l.peek(); r == '+' || r == '-' {
+		l.next()
+	}
+	if !unicode.IsDigit(l.peek()) {
+		l.pos = pos
+		return false
+	}
+	for unicode.IsDigit(l.peek()) {
+		l.next()
+	}
+
+	return true
+}
+
 func lexAlphaNumeric(l *Lexer) stateFn {
 	for {
 		r := l.next()
@@ -77,12 +143,22 @@ func lexAlphaNumeric(l *Lexer) stateFn {
 
 		if strings.ToUpper(value) == "SELECT" {
 			l.emit(TokenSelect)
+		} else if strings.ToUpper(value) == "DISTINCT" {
+			l.emit(TokenDistinct)
 		} else if strings.ToUpper(value) == "FROM" {
 			l.emit(TokenFrom)
 		} else if strings.ToUpper(value) == "AS" {
 			l.emit(TokenAs)
 		} else if strings.ToUpper(value) == "TABLE" {
 			l.emit(TokenTable)
+		} else if strings.ToUpper(value) == "INDEX" {
+			l.emit(TokenIndex)
+		} else if strings.ToUpper(value) == "ON" {
+			l.emit(TokenOn)
+		} else if strings.ToUpper(value) == "JOIN" {
+			l.emit(TokenJoin)
+		} else if strings.ToUpper(value) == "INNER" {
+			l.emit(TokenInner)
 		} else if strings.ToUpper(value) == "WHERE" {
 			l.emit(TokenWhere)
 		} else if strings.ToUpper(value) == "AND" {
@@ -103,6 +179,24 @@ func lexAlphaNumeric(l *Lexer) stateFn {
 			l.emit(TokenNot)
 		} else if strings.ToUpper(value) == "EXISTS" {
 			l.emit(TokenExists)
+		} else if strings.ToUpper(value) == "IS" {
+			l.emit(TokenIs)
+		} else if strings.ToUpper(value) == "LIKE" {
+			l.emit(TokenLike)
+		} else if strings.ToUpper(value) == "IN" {
+			l.emit(TokenIn)
+		} else if strings.ToUpper(value) == "BETWEEN" {
+			l.emit(TokenBetween)
+		} else if strings.ToUpper(value) == "CASE" {
+			l.emit(TokenCase)
+		} else if strings.ToUpper(value) == "WHEN" {
+			l.emit(TokenWhen)
+		} else if strings.ToUpper(value) == "THEN" {
+			l.emit(TokenThen)
+		} else if strings.ToUpper(value) == "ELSE" {
+			l.emit(TokenElse)
+		} else if strings.ToUpper(value) == "END" {
+			l.emit(TokenEnd)
 		} else if strings.ToUpper(value) == "RETURNING" {
 			l.emit(TokenReturning)
 		} else if strings.ToUpper(value) == "VALUES" {
@@ -115,8 +209,34 @@ func lexAlphaNumeric(l *Lexer) stateFn {
 			l.emit(TokenCommit)
 		} else if strings.ToUpper(value) == "ROLLBACK" {
 			l.emit(TokenRollback)
+		} else if strings.ToUpper(value) == "SAVEPOINT" {
+			l.emit(TokenSavepoint)
+		} else if strings.ToUpper(value) == "RELEASE" {
+			l.emit(TokenRelease)
+		} else if strings.ToUpper(value) == "TO" {
+			l.emit(TokenTo)
+		} else if strings.ToUpper(value) == "SET" {
+			l.emit(TokenSet)
+		} else if strings.ToUpper(value) == "EXPLAIN" {
+			l.emit(TokenExplain)
 		} else if strings.ToUpper(value) == "NULL" {
 			l.emit(TokenNull)
+		} else if strings.ToUpper(value) == "GROUP" {
+			l.emit(TokenGroup)
+		} else if strings.ToUpper(value) == "HAVING" {
+			l.emit(TokenHaving)
+		} else if strings.ToUpper(value) == "ORDER" {
+			l.emit(TokenOrder)
+		} else if strings.ToUpper(value) == "BY" {
+			l.emit(TokenBy)
+		} else if strings.ToUpper(value) == "ASC" {
+			l.emit(TokenAsc)
+		} else if strings.ToUpper(value) == "DESC" {
+			l.emit(TokenDesc)
+		} else if strings.ToUpper(value) == "LIMIT" {
+			l.emit(TokenLimit)
+		} else if strings.ToUpper(value) == "OFFSET" {
+			l.emit(TokenOffset)
 		} else {
 			l.emit(TokenIdentifier)
 		}
@@ -139,9 +259,12 @@ func lexSymbol(l *Lexer) stateFn {
 	case '<':
 		l.next()
 
-		if l.next() == '=' {
+		switch l.next() {
+		case '=':
 			l.emit(TokenLte)
-		} else {
+		case '>':
+			l.emit(TokenNotEq)
+		default:
 			l.backup()
 			l.emit(TokenLt)
 		}
@@ -175,6 +298,29 @@ func lexSymbol(l *Lexer) stateFn {
 	case ',':
 		l.next()
 		l.emit(TokenComma)
+	case ';':
+		l.next()
+		l.emit(TokenSemicolon)
+	case '$':
+		l.next()
+		if !unicode.IsDigit(l.peek()) {
+			return l.errorf("expected parameter number")
+		}
+		for unicode.IsDigit(l.peek()) {
+			l.next()
+		}
+		n, err := strconv.Atoi(l.input[l.start+1 : l.pos])
+		if err != nil {
+			return l.errorf("invalid parameter number")
+		}
+		if n > l.params {
+			l.params = n
+		}
+		l.emitParam(n)
+	case '?':
+		l.next()
+		l.params++
+		l.emitParam(l.params)
 	default:
 		return nil
 	}
@@ -209,18 +355,83 @@ func lexString(l *Lexer) stateFn {
 	return nil
 }
 
+// lexQuotedIdentifier lexes an identifier in double quotes or backticks,
+// which may be a keyword or contain spaces. The quotes are not part of the
+// identifier and a quote is escaped by doubling it.
+func lexQuotedIdentifier(l *Lexer) stateFn {
+	quote := l.peek()
+	if quote != '"' && quote != '`' {
+		return nil
+	}
+	l.next()
+
+	var name strings.Builder
+	for {
+		current := l.next()
+		if current == eof {
+			return l.errorf("non terminated identifier")
+		}
+		if current == quote {
+			if l.peek() != quote {
+				break
+			}
+			l.next()
+		}
+		name.WriteRune(current)
+	}
+
+	l.emitText(TokenIdentifier, name.String())
+	return lexTinySQL
+}
+
+// lexBlob lexes a hex literal, an x followed by a quoted even number of hex digits
+func lexBlob(l *Lexer) stateFn {
+	if r := l.peek(); (r != 'x' && r != 'X') || l.peek2() != '\'' {
+		return nil
+	}
+	l.next()
+	l.next()
+
+	digits := 0
+	for {
+		current := l.next()
+		if current == '\'' {
+			break
+		} else if current == eof {
+			l.errorf("non terminated blob")
+			return lexTinySQL
+		} else if !unicode.Is(unicode.ASCII_Hex_Digit, current) {
+			l.errorf("malformed blob literal")
+			return lexTinySQL
+		}
+		digits++
+	}
+
+	if digits%2 != 0 {
+		l.errorf("malformed blob literal")
+		return lexTinySQL
+	}
+
+	l.emit(TokenBlob)
+	return lexTinySQL
+}
+
 func lexTinySQL(l *Lexer) stateFn {
 	r := l.peek()
 
 	if r == eof {
 		l.emit(TokenEOF)
-	} else if isWhiteSpace(r) {
+	} else if isWhiteSpace(r) || l.atComment() {
 		return lexWhiteSpace(l)
 	} else if resume := lexSymbol(l); resume != nil {
 		return resume
 	} else if resume := lexString(l); resume != nil {
 		return resume
-	} else if unicode.IsDigit(r) {
+	} else if resume := lexQuotedIdentifier(l); resume != nil {
+		return resume
+	} else if resume := lexBlob(l); resume != nil {
+		return resume
+	} else if unicode.IsDigit(r) || (r == '.' && unicode.IsDigit(l.peek2())) {
 		return lexNumber(l)
 	} else if isAlphaNumeric(r) {
 		return lexAlphaNumeric(l)
@@ -278,6 +489,18 @@ func (l *Lexer) atTerminator() bool {
 	return false
 }
 
+// atComment reports whether a comment starts at the current position
+func (l *Lexer) atComment() bool {
+	switch l.peek() {
+	case '-':
+		return l.peek2() == '-'
+	case '/':
+		return l.peek2() == '*'
+	}
+
+	return false
+}
+
 func (l *Lexer) errorf(format string, args ...interface{}) stateFn {
 	l.items <- Token{
 		Kind:     TokenError,
@@ -302,6 +525,29 @@ func (l *Lexer) emit(kind Kind) {
 	l.start = l.pos
 }
 
+// emitText emits a token with text other than its input
+func (l *Lexer) emitText(kind Kind, text string) {
+	l.items <- Token{
+		Kind:     kind,
+		Text:     text,
+		Position: l.start,
+	}
+	l.remaining = l.input[l.pos:]
+	l.start = l.pos
+}
+
+// emitParam emits a parameter token with its number
+func (l *Lexer) emitParam(n int) {
+	l.items <- Token{
+		Kind:     TokenParameter,
+		Text:     l.input[l.start:l.pos],
+		Position: l.start,
+		Param:    n,
+	}
+	l.remaining = l.input[l.pos:]
+	l.start = l.pos
+}
+
 func isAlphaNumeric(r rune) bool {
 	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
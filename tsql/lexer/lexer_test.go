@@ -0,0 +1,80 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lex collects the tokens of input other than white space and EOF
+func lex(input string) []Token {
+	var tokens []Token
+	for t := range NewLexer(input).Exec() {
+		if t.Kind != TokenWhiteSpace && t.Kind != TokenEOF {
+			tokens = append(tokens, Token{Kind: t.Kind, Text: t.Text})
+		}
+	}
+	return tokens
+}
+
+func TestLexNumber(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []Token
+	}{
+		{"15", []Token{{Kind: TokenNumber, Text: "15"}}},
+		{"1.5", []Token{{Kind: TokenFloat, Text: "1.5"}}},
+		{".5", []Token{{Kind: TokenFloat, Text: ".5"}}},
+		{"1e3", []Token{{Kind: TokenFloat, Text: "1e3"}}},
+		{"1E3", []Token{{Kind: TokenFloat, Text: "1E3"}}},
+		{"2.5e-3", []Token{{Kind: TokenFloat, Text: "2.5e-3"}}},
+		{".5E+10", []Token{{Kind: TokenFloat, Text: ".5E+10"}}},
+		{"1 + .5", []Token{
+			{Kind: TokenNumber, Text: "1"},
+			{Kind: TokenPlus, Text: "+"},
+			{Kind: TokenFloat, Text: ".5"},
+		}},
+		// an e without digits is not an exponent
+		{"1 e", []Token{
+			{Kind: TokenNumber, Text: "1"},
+			{Kind: TokenIdentifier, Text: "e"},
+		}},
+		{"1e+", []Token{
+			{Kind: TokenNumber, Text: "1"},
+			{Kind: TokenIdentifier, Text: "e"},
+			{Kind: TokenPlus, Text: "+"},
+		}},
+		// a dot within a name is part of the identifier
+		{"apples.size", []Token{{Kind: TokenIdentifier, Text: "apples.size"}}},
+		{"t1.e5", []Token{{Kind: TokenIdentifier, Text: "t1.e5"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			require.Equal(t, tt.tokens, lex(tt.input))
+		})
+	}
+}
+
+func TestLexComparison(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []Token
+	}{
+		{"<", []Token{{Kind: TokenLt, Text: "<"}}},
+		{"<=", []Token{{Kind: TokenLte, Text: "<="}}},
+		{"<>", []Token{{Kind: TokenNotEq, Text: "<>"}}},
+		{"!=", []Token{{Kind: TokenNotEq, Text: "!="}}},
+		{"n<>10", []Token{
+			{Kind: TokenIdentifier, Text: "n"},
+			{Kind: TokenNotEq, Text: "<>"},
+			{Kind: TokenNumber, Text: "10"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			require.Equal(t, tt.tokens, lex(tt.input))
+		})
+	}
+}
@@ -12,6 +12,8 @@ const (
 	TokenWhiteSpace
 
 	TokenComma
+	// TokenSemicolon ends a statement
+	TokenSemicolon
 	TokenOpenParen
 	TokenCloseParen
 	TokenAsterisk
@@ -21,19 +23,46 @@ const (
 	TokenBegin
 	TokenCommit
 	TokenRollback
+	TokenSavepoint
+	TokenRelease
+	TokenTo
+	TokenSet
+	TokenExplain
 
 	TokenSelect
+	TokenDistinct
 	TokenFrom
 	TokenWhere
 	TokenAs
 	TokenIf
 	TokenNot
 	TokenExists
+	TokenIs
+	TokenLike
+	TokenIn
+	TokenBetween
+	TokenCase
+	TokenWhen
+	TokenThen
+	TokenElse
+	TokenEnd
+	TokenGroup
+	TokenHaving
+	TokenOrder
+	TokenBy
+	TokenAsc
+	TokenDesc
+	TokenLimit
+	TokenOffset
 
 	TokenCreate
 	TokenInsert
 	TokenInto
 	TokenTable
+	TokenIndex
+	TokenOn
+	TokenJoin
+	TokenInner
 	TokenValues
 	TokenReturning
 
@@ -53,8 +82,16 @@ const (
 
 	TokenString
 	TokenNumber
+	// TokenFloat is a number with a fractional part, e.g. 3.14
+	TokenFloat
+	// TokenBlob is a hex literal of binary data, e.g. x'DEADBEEF'
+	TokenBlob
 	TokenBoolean
 	TokenNull
+
+	// TokenParameter is a placeholder for a bound value, either numbered
+	// e.g. $1 or positional ?
+	TokenParameter
 )
 
 // Token is an output from the lexer
@@ -62,6 +99,10 @@ type Token struct {
 	Kind     Kind
 	Text     string
 	Position int
+
+	// Param is the number of a parameter token. A positional ? is numbered
+	// one more than the largest number of the parameters before it.
+	Param int
 }
 
 func (t Kind) String() string {
@@ -76,26 +117,96 @@ func (t Kind) String() string {
 		return "COMMIT"
 	case t == TokenRollback:
 		return "ROLLBACK"
+	case t == TokenSavepoint:
+		return "SAVEPOINT"
+	case t == TokenRelease:
+		return "RELEASE"
+	case t == TokenTo:
+		return "TO"
+	case t == TokenSet:
+		return "SET"
+	case t == TokenExplain:
+		return "EXPLAIN"
 	case t == TokenSelect:
 		return "SELECT"
+	case t == TokenDistinct:
+		return "DISTINCT"
 	case t == TokenFrom:
 		return "FROM"
 	case t == TokenWhere:
 		return "WHERE"
+	case t == TokenGroup:
+		return "GROUP"
+	case t == TokenHaving:
+		return "HAVING"
+	case t == TokenOrder:
+		return "ORDER"
+	case t == TokenBy:
+		return "BY"
+	case t == TokenAsc:
+		return "ASC"
+	case t == TokenDesc:
+		return "DESC"
+	case t == TokenLimit:
+		return "LIMIT"
+	case t == TokenOffset:
+		return "OFFSET"
+	case t == TokenIndex:
+		return "INDEX"
+	case t == TokenOn:
+		return "ON"
+	case t == TokenJoin:
+		return "JOIN"
+	case t == TokenInner:
+		return "INNER"
+	case t == TokenIs:
+		return "IS"
+	case t == TokenLike:
+		return "LIKE"
+	case t == TokenIn:
+		return "IN"
+	case t == TokenBetween:
+		return "BETWEEN"
+	case t == TokenCase:
+		return "CASE"
+	case t == TokenWhen:
+		return "WHEN"
+	case t == TokenThen:
+		return "THEN"
+	case t == TokenElse:
+		return "ELSE"
+	case t == TokenEnd:
+		return "END"
 	case t == TokenAnd:
 		return "AND"
 	case t == TokenOr:
 		return "OR"
 	case t == TokenEquals:
 		return "="
+	case t == TokenNotEq:
+		return "!="
+	case t == TokenGt:
+		return ">"
+	case t == TokenLt:
+		return "<"
+	case t == TokenGte:
+		return ">="
+	case t == TokenLte:
+		return "<="
 	case t == TokenString:
 		return "String"
+	case t == TokenBlob:
+		return "Blob"
 	case t == TokenIdentifier:
 		return "Ident"
 	case t == TokenComma:
 		return "Comma"
+	case t == TokenSemicolon:
+		return "Semicolon"
 	case t == TokenAsterisk:
 		return "Asterisk"
+	case t == TokenParameter:
+		return "Parameter"
 	default:
 		return fmt.Sprintf("Kind(%d)", t)
 	}
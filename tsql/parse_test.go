@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/tsql/ast"
 )
 
 func TestParse(t *testing.T) {
@@ -27,6 +29,62 @@ func TestParse(t *testing.T) {
 			name: "select with where clause",
 			text: "SELECT a, b FROM foo, bar WHERE a = 1",
 		},
+		{
+			name: "select with limit",
+			text: "SELECT a FROM foo LIMIT 10",
+		},
+		{
+			name: "select with limit and offset",
+			text: "SELECT a FROM foo WHERE a = 1 LIMIT 10 OFFSET 5",
+		},
+		{
+			name: "select with order by",
+			text: "SELECT a, b FROM foo WHERE a = 1 ORDER BY a DESC, b ASC LIMIT 10",
+		},
+		{
+			name: "select with group by",
+			text: "SELECT a, COUNT(*) FROM foo WHERE a = 1 GROUP BY a LIMIT 10",
+		},
+		{
+			name: "create table with constraints",
+			text: "CREATE TABLE foo (id int PRIMARY KEY NOT NULL, a text NOT NULL, b int)",
+		},
+		{
+			name: "select with having",
+			text: "SELECT a, COUNT(*) FROM foo GROUP BY a HAVING COUNT(*) = 2",
+		},
+		{
+			name: "create index",
+			text: "CREATE INDEX foo_a ON foo (a, b)",
+		},
+		{
+			name: "set statement timeout",
+			text: "SET statement_timeout = 500",
+		},
+		{
+			name: "savepoint",
+			text: "SAVEPOINT sp1",
+		},
+		{
+			name: "release savepoint",
+			text: "RELEASE SAVEPOINT sp1",
+		},
+		{
+			name: "release",
+			text: "release sp1",
+		},
+		{
+			name: "rollback to savepoint",
+			text: "ROLLBACK TO SAVEPOINT sp1",
+		},
+		{
+			name: "select with trailing semicolon",
+			text: "SELECT a FROM foo;",
+		},
+		{
+			name: "explain select",
+			text: "EXPLAIN SELECT a FROM foo WHERE a = 1",
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -37,3 +95,22 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_Savepoint(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected ast.Statement
+	}{
+		{"SAVEPOINT sp1", &ast.SavepointStatement{Name: "sp1"}},
+		{"RELEASE SAVEPOINT sp1", &ast.ReleaseStatement{Name: "sp1"}},
+		{"RELEASE sp1", &ast.ReleaseStatement{Name: "sp1"}},
+		{"ROLLBACK TO SAVEPOINT sp1", &ast.RollbackToStatement{Name: "sp1"}},
+		{"ROLLBACK TO sp1", &ast.RollbackToStatement{Name: "sp1"}},
+		{"ROLLBACK", &ast.RollbackStatement{}},
+	}
+	for _, tc := range tests {
+		stmt, err := Parse(tc.text)
+		require.NoError(t, err, tc.text)
+		require.Equal(t, tc.expected, stmt, tc.text)
+	}
+}
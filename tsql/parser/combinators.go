@@ -37,9 +37,9 @@ func text(r string) parserFn {
 }
 
 // regex constructs a regex from the provided string and
-// continues if it matches the next token
+// continues if it matches the entire text of the next token
 func regex(r string) parserFn {
-	regex := regexp.MustCompile(r)
+	regex := regexp.MustCompile(`^(?:` + r + `)$`)
 	return func(scanner scan.TinyScanner) (bool, interface{}) {
 		next := scanner.Peek()
 
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+func Test_regex_MatchesEntireToken(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		match   bool
+	}{
+		{`-`, `- 1`, true},
+		{`-`, `'-'`, false},
+		{`-`, `"per-kg"`, false},
+		{`-`, `2.5e-3`, false},
+		{`\*`, `'a*b'`, false},
+		{`/`, `"kg/m"`, false},
+		{`\+`, `1e+3`, false},
+		{`[a-z]+`, `apples`, true},
+		{`[a-z]+`, `apples2`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.input, func(t *testing.T) {
+			scanner := scan.NewScanner(tt.input)
+			ok, _ := regex(tt.pattern)(scanner)
+			require.Equal(t, tt.match, ok)
+		})
+	}
+}
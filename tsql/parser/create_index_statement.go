@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+func parseCreateIndex(scanner scan.TinyScanner) (*ast.CreateIndexStatement, error) {
+	createIndexStatement := ast.CreateIndexStatement{}
+
+	ok, _ := allX(
+		keyword(lexer.TokenCreate),
+		keyword(lexer.TokenIndex),
+		committed("INDEX_NAME", ident(func(name string) {
+			createIndexStatement.Name = name
+		})),
+		committed("ON", keyword(lexer.TokenOn)),
+		committed("TABLE_NAME", ident(func(tableName string) {
+			createIndexStatement.Table = tableName
+		})),
+		committed("COLUMNS", parensCommaSep(
+			ident(func(column string) {
+				createIndexStatement.Columns = append(createIndexStatement.Columns, column)
+			}),
+		)),
+	)(scanner)
+
+	if !ok {
+		return nil, nil
+	}
+
+	createIndexStatement.RawText = scanner.Text()
+	return &createIndexStatement, nil
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+func Test_parseCreateIndex(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`CREATE INDEX foo_email ON foo (email, state)`)
+
+	stmt, err := parseCreateIndex(scanner)
+	assert.NoError(err)
+	assert.Equal(&ast.CreateIndexStatement{
+		Name:    "foo_email",
+		Table:   "foo",
+		Columns: []string{"email", "state"},
+		RawText: "CREATE INDEX foo_email ON foo (email, state)",
+	}, stmt)
+}
+
+func Test_parseCreateIndex_CreateTable(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`CREATE TABLE foo (a int)`)
+
+	stmt, err := parseCreateIndex(scanner)
+	assert.NoError(err)
+	assert.Nil(stmt)
+}
@@ -15,25 +15,45 @@ func parseCreateTable(scanner scan.TinyScanner) (*ast.CreateTableStatement, erro
 		requiredToken(lexer.TokenIdentifier, nil),
 		reqWS,
 		requiredToken(lexer.TokenIdentifier, nil),
-		optional(all([]parserFn{
-			reqWS,
-			text("PRIMARY"),
-			reqWS,
-			text("KEY"),
-		}, nil), func(tokens []lexer.Token) {
-			flags["primary_key"] = "true"
-		}),
+		zeroOrMore(oneOf([]parserFn{
+			all([]parserFn{
+				reqWS,
+				text("PRIMARY"),
+				reqWS,
+				text("KEY"),
+			}, func(tokens [][]lexer.Token) {
+				flags["primary_key"] = "true"
+			}),
+			all([]parserFn{
+				reqWS,
+				token(lexer.TokenNot),
+				reqWS,
+				token(lexer.TokenNull),
+			}, func(tokens [][]lexer.Token) {
+				flags["not_null"] = "true"
+			}),
+			all([]parserFn{
+				reqWS,
+				text("UNIQUE"),
+			}, func(tokens [][]lexer.Token) {
+				flags["unique"] = "true"
+			}),
+		}, nil)),
 		optWS,
 	}, func(tokens [][]lexer.Token) {
 		columnName := tokens[1][0].Text
 		columnType := tokens[3][0].Text
 
 		_, isPrimaryKey := flags["primary_key"]
+		_, isNotNull := flags["not_null"]
+		_, isUnique := flags["unique"]
 
 		createTableStatement.Columns = append(createTableStatement.Columns, ast.ColumnDefinition{
 			Name:       columnName,
 			Type:       columnType,
 			PrimaryKey: isPrimaryKey,
+			NotNull:    isNotNull,
+			Unique:     isUnique,
 		})
 
 		flags = make(map[string]string)
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"errors"
+
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+// parseExplain parses EXPLAIN followed by the statement to explain. The
+// statement is parsed from the remaining text as any other statement.
+func parseExplain(scanner scan.TinyScanner) (*ast.ExplainStatement, error) {
+	ok, _ := keyword(lexer.TokenExplain)(scanner)
+	if !ok {
+		return nil, nil
+	}
+
+	next := scanner.Peek()
+	if next.Kind == lexer.TokenEOF {
+		return nil, errors.New("EXPLAIN requires a statement")
+	}
+
+	stmt, err := ParseStatement(scanner.Text()[next.Position:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ExplainStatement{Statement: stmt}, nil
+}
@@ -30,6 +30,12 @@ func parseTermExpression() expressionParserFn {
 		var expr ast.Expression
 
 		ok, _ := oneOf([]parserFn{
+			caseExpression(func(expression ast.Expression) {
+				expr = expression
+			}),
+			functionCall(func(expression ast.Expression) {
+				expr = expression
+			}),
 			parseTerm(func(expression ast.Expression) {
 				expr = expression
 			}),
@@ -55,6 +61,101 @@ func parseTermExpression() expressionParserFn {
 	}
 }
 
+// nullTest parses an expression optionally followed by IS [NOT] NULL
+func nullTest(ep expressionParserFn) expressionParserFn {
+	return func(scanner scan.TinyScanner) (bool, ast.Expression) {
+		success, expression := ep(scanner)
+		if !success {
+			return false, nil
+		}
+
+		not := false
+		isNull, _ := allX(
+			keyword(lexer.TokenIs),
+			optional(keyword(lexer.TokenNot), func(tokens []lexer.Token) {
+				not = true
+			}),
+			keyword(lexer.TokenNull),
+		)(scanner)
+		if isNull {
+			return true, &ast.NullTest{Expr: expression, Not: not}
+		}
+
+		return true, expression
+	}
+}
+
+// inList parses an expression optionally followed by [NOT] IN (value, ...).
+// The list of values may be empty.
+func inList(ep expressionParserFn) expressionParserFn {
+	return func(scanner scan.TinyScanner) (bool, ast.Expression) {
+		success, expression := ep(scanner)
+		if !success {
+			return false, nil
+		}
+
+		in := &ast.InExpression{Expr: expression}
+		isIn, _ := allX(
+			optional(keyword(lexer.TokenNot), func(tokens []lexer.Token) {
+				in.Not = true
+			}),
+			keyword(lexer.TokenIn),
+			parens(optionalX(commaSeparated(makeExpressionParser(func(value ast.Expression) {
+				in.Values = append(in.Values, value)
+			})))),
+		)(scanner)
+		if isIn {
+			return true, in
+		}
+
+		return true, expression
+	}
+}
+
+// between parses an expression optionally followed by [NOT] BETWEEN low AND high.
+// The bounds are parsed with the same parser as the expression so the AND
+// separating them is not mistaken for a logical operator.
+func between(ep expressionParserFn) expressionParserFn {
+	return func(scanner scan.TinyScanner) (bool, ast.Expression) {
+		success, expression := ep(scanner)
+		if !success {
+			return false, nil
+		}
+
+		b := &ast.BetweenExpression{Expr: expression}
+		isBetween, _ := allX(
+			optional(keyword(lexer.TokenNot), func(tokens []lexer.Token) {
+				b.Not = true
+			}),
+			keyword(lexer.TokenBetween),
+			bound(ep, func(low ast.Expression) {
+				b.Low = low
+			}),
+			keyword(lexer.TokenAnd),
+			bound(ep, func(high ast.Expression) {
+				b.High = high
+			}),
+		)(scanner)
+		if isBetween {
+			return true, b
+		}
+
+		return true, expression
+	}
+}
+
+// bound adapts an expression parser to a parserFn
+func bound(ep expressionParserFn, nodify nodifyExpression) parserFn {
+	return func(scanner scan.TinyScanner) (bool, interface{}) {
+		success, expr := ep(scanner)
+		if success {
+			nodify(expr)
+		}
+
+		return success, expr
+	}
+}
+
 func makeBinaryExpression() expressionMaker {
 	return func(operatorStr string, left ast.Expression, right ast.Expression) ast.Expression {
 		return &ast.BinaryOperation{
@@ -131,17 +232,40 @@ func firstNonSpace(tokens []lexer.Token) lexer.Token {
 }
 
 func comparison() opParserFn {
-	return operatorParser(operator(`=`), func(token lexer.Token) string {
-		return token.Text
+	return operatorParser(oneOf([]parserFn{
+		symbol(lexer.TokenEquals),
+		symbol(lexer.TokenNotEq),
+		symbol(lexer.TokenLte),
+		symbol(lexer.TokenGte),
+		symbol(lexer.TokenLt),
+		symbol(lexer.TokenGt),
+		keyword(lexer.TokenLike),
+		allX(keyword(lexer.TokenNot), keyword(lexer.TokenLike)),
+	}, nil), func(token lexer.Token) string {
+		switch token.Kind {
+		case lexer.TokenLike:
+			return "LIKE"
+		case lexer.TokenNot:
+			return "NOT LIKE"
+		case lexer.TokenNotEq:
+			// <> is the same comparison as !=
+			return "!="
+		default:
+			return token.Text
+		}
 	})
 }
 
 func logical() opParserFn {
 	return operatorParser(oneOf([]parserFn{
-		operator(`AND`),
-		operator(`OR`),
+		keyword(lexer.TokenAnd),
+		keyword(lexer.TokenOr),
 	}, nil), func(token lexer.Token) string {
-		return token.Text
+		// keywords are matched in any case
+		if token.Kind == lexer.TokenAnd {
+			return "AND"
+		}
+		return "OR"
 	})
 }
 
@@ -165,8 +289,8 @@ func sum() opParserFn {
 
 func parseExpression() expressionParserFn {
 	return chainl(
-		chainl(
-			chainl(
+		not(chainl(
+			nullTest(inList(between(chainl(
 				chainl(
 					parseTermExpression(),
 					makeBinaryExpression(),
@@ -174,15 +298,36 @@ func parseExpression() expressionParserFn {
 				),
 				makeBinaryExpression(),
 				sum(),
-			),
+			)))),
 			makeBinaryExpression(),
 			comparison(),
-		),
+		)),
 		makeBinaryExpression(),
 		logical(),
 	)
 }
 
+// not parses an expression preceded by any number of NOT operators. NOT
+// binds more loosely than comparisons and more tightly than AND and OR.
+func not(ep expressionParserFn) expressionParserFn {
+	var parse expressionParserFn
+	parse = func(scanner scan.TinyScanner) (bool, ast.Expression) {
+		_, reset := scanner.Mark()
+		if isNot, _ := keyword(lexer.TokenNot)(scanner); !isNot {
+			return ep(scanner)
+		}
+
+		success, expression := parse(scanner)
+		if !success {
+			reset()
+			return false, nil
+		}
+
+		return true, &ast.UnaryOperation{Op: "NOT", Expr: expression}
+	}
+	return parse
+}
+
 func parseTerm(nodify nodifyExpression) parserFn {
 	return oneOf([]parserFn{
 		requiredToken(lexer.TokenIdentifier, func(tokens []lexer.Token) {
@@ -200,6 +345,14 @@ func parseTerm(nodify nodifyExpression) parserFn {
 				})
 			}
 		}),
+		requiredToken(lexer.TokenBlob, func(tokens []lexer.Token) {
+			if nodify != nil {
+				nodify(&ast.BasicLiteral{
+					Value: tokens[0].Text[2 : len(tokens[0].Text)-1],
+					Kind:  tokens[0].Kind,
+				})
+			}
+		}),
 		requiredToken(lexer.TokenNumber, func(tokens []lexer.Token) {
 			if nodify != nil {
 				nodify(&ast.BasicLiteral{
@@ -208,6 +361,27 @@ func parseTerm(nodify nodifyExpression) parserFn {
 				})
 			}
 		}),
+		requiredToken(lexer.TokenFloat, func(tokens []lexer.Token) {
+			if nodify != nil {
+				nodify(&ast.BasicLiteral{
+					Value: tokens[0].Text,
+					Kind:  tokens[0].Kind,
+				})
+			}
+		}),
+		// A minus sign directly before a number is part of the literal,
+		// elsewhere it is subtraction, e.g. 3 - 5
+		all([]parserFn{
+			token(lexer.TokenMinus),
+			oneOf([]parserFn{token(lexer.TokenNumber), token(lexer.TokenFloat)}, nil),
+		}, func(tokens [][]lexer.Token) {
+			if nodify != nil {
+				nodify(&ast.BasicLiteral{
+					Value: "-" + tokens[1][0].Text,
+					Kind:  tokens[1][0].Kind,
+				})
+			}
+		}),
 		requiredToken(lexer.TokenBoolean, func(tokens []lexer.Token) {
 			if nodify != nil {
 				nodify(&ast.BasicLiteral{
@@ -224,9 +398,92 @@ func parseTerm(nodify nodifyExpression) parserFn {
 				})
 			}
 		}),
+		requiredToken(lexer.TokenParameter, func(tokens []lexer.Token) {
+			if nodify != nil {
+				nodify(&ast.Parameter{Index: tokens[0].Param})
+			}
+		}),
 	}, nil)
 }
 
+// functionCall parses a call to a named function, e.g. LOWER(name).
+// Calls to aggregate functions such as COUNT(*) produce an aggregate expression.
+func functionCall(nodify nodifyExpression) parserFn {
+	var call *ast.FunctionCall
+
+	return all([]parserFn{
+		ident(func(name string) {
+			call = &ast.FunctionCall{Name: strings.ToUpper(name)}
+		}),
+		parens(optionalX(oneOf([]parserFn{
+			requiredToken(lexer.TokenAsterisk, func(tokens []lexer.Token) {
+				call.Args = []ast.Expression{&ast.Star{}}
+			}),
+			allX(
+				optional(keyword(lexer.TokenDistinct), func(tokens []lexer.Token) {
+					call.Distinct = true
+				}),
+				separatedBy1(commaSeparator, lazy(func() parserFn {
+					return makeExpressionParser(func(arg ast.Expression) {
+						call.Args = append(call.Args, arg)
+					})
+				})),
+			),
+		}, nil))),
+	}, func(tokens [][]lexer.Token) {
+		if nodify == nil {
+			return
+		}
+		if ast.IsAggregateFunction(call.Name) && len(call.Args) == 1 {
+			nodify(&ast.AggregateExpression{Name: call.Name, Arg: call.Args[0], Distinct: call.Distinct})
+			return
+		}
+		nodify(call)
+	})
+}
+
+// caseExpression parses CASE [operand] WHEN condition THEN result ... [ELSE result] END
+func caseExpression(nodify nodifyExpression) parserFn {
+	var c *ast.CaseExpression
+	var when ast.WhenClause
+
+	whenClause := allX(
+		keyword(lexer.TokenWhen),
+		makeExpressionParser(func(condition ast.Expression) {
+			when = ast.WhenClause{Condition: condition}
+		}),
+		keyword(lexer.TokenThen),
+		makeExpressionParser(func(result ast.Expression) {
+			when.Result = result
+			c.Whens = append(c.Whens, when)
+		}),
+	)
+
+	return all([]parserFn{
+		requiredToken(lexer.TokenCase, func(tokens []lexer.Token) {
+			c = &ast.CaseExpression{}
+		}),
+		optWS,
+		optionalX(makeExpressionParser(func(operand ast.Expression) {
+			c.Operand = operand
+		})),
+		whenClause,
+		zeroOrMore(whenClause),
+		optionalX(allX(
+			keyword(lexer.TokenElse),
+			makeExpressionParser(func(result ast.Expression) {
+				c.Else = result
+			}),
+		)),
+		optWS,
+		token(lexer.TokenEnd),
+	}, func(tokens [][]lexer.Token) {
+		if nodify != nil {
+			nodify(c)
+		}
+	})
+}
+
 func optionalToken(expected lexer.Kind) parserFn {
 	return func(scanner scan.TinyScanner) (bool, interface{}) {
 		next := scanner.Peek()
@@ -267,6 +524,15 @@ func operator(operatorText string) parserFn {
 	)
 }
 
+// symbol matches a single operator token by kind, e.g. >= or !=
+func symbol(t lexer.Kind) parserFn {
+	return allX(
+		optWS,
+		token(t),
+		optWS,
+	)
+}
+
 func parens(inner parserFn) parserFn {
 	return allX(
 		optWS,
@@ -12,7 +12,19 @@ func parseInsert(scanner scan.TinyScanner) (*ast.InsertStatement, error) {
 	insertTableStatement := ast.InsertStatement{}
 
 	var columns []string
-	var values []ast.Expression
+	var row []ast.Expression
+	var rows [][]ast.Expression
+
+	valuesRow := all([]parserFn{
+		parensCommaSep(
+			makeExpressionParser(func(e ast.Expression) {
+				row = append(row, e)
+			}),
+		),
+	}, func(tokens [][]lexer.Token) {
+		rows = append(rows, row)
+		row = nil
+	})
 
 	returningClause := allX(
 		keyword(lexer.TokenReturning),
@@ -39,11 +51,7 @@ func parseInsert(scanner scan.TinyScanner) (*ast.InsertStatement, error) {
 			}),
 		),
 		keyword(lexer.TokenValues),
-		parensCommaSep(
-			makeExpressionParser(func(e ast.Expression) {
-				values = append(values, e)
-			}),
-		),
+		commaSeparated(valuesRow),
 		optionalX(returningClause),
 	)(scanner)
 
@@ -51,19 +59,17 @@ func parseInsert(scanner scan.TinyScanner) (*ast.InsertStatement, error) {
 		return nil, nil
 	}
 
-	// if columns and values are not of same length or are empty blow up
-	// create map
-	numColumns := len(columns)
-	numValues := len(values)
-
-	if numColumns != numValues {
-		return nil, fmt.Errorf("unexpected number of values")
-	}
-
-	insertTableStatement.Values = make(map[string]ast.Expression)
+	// Each row must have a value for every column
+	for r, values := range rows {
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("VALUES tuple %d has %d values for %d columns", r+1, len(values), len(columns))
+		}
 
-	for i := 0; i < numColumns; i++ {
-		insertTableStatement.Values[columns[i]] = values[i]
+		valueSet := make(ast.ValueSet, len(columns))
+		for i, c := range columns {
+			valueSet[c] = values[i]
+		}
+		insertTableStatement.Rows = append(insertTableStatement.Rows, valueSet)
 	}
 
 	return &insertTableStatement, nil
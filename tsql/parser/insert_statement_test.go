@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+func Test_parseInsert_MultipleRows(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`INSERT INTO foo (a, b) VALUES (1, 'x'), (2,'y') ,(3.25, 'z')`)
+
+	stmt, err := parseInsert(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	number := func(v string) ast.Expression { return &ast.BasicLiteral{Value: v, Kind: lexer.TokenNumber} }
+	float := func(v string) ast.Expression { return &ast.BasicLiteral{Value: v, Kind: lexer.TokenFloat} }
+	str := func(v string) ast.Expression { return &ast.BasicLiteral{Value: v, Kind: lexer.TokenString} }
+	assert.Equal(&ast.InsertStatement{
+		Table: "foo",
+		Rows: []ast.ValueSet{
+			{"a": number("1"), "b": str("x")},
+			{"a": number("2"), "b": str("y")},
+			{"a": float("3.25"), "b": str("z")},
+		},
+	}, stmt)
+}
+
+func Test_parseInsert_RowArity(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`INSERT INTO foo (a, b) VALUES (1, 'x'), (2)`)
+
+	stmt, err := parseInsert(scanner)
+	assert.Nil(stmt)
+	assert.EqualError(err, "VALUES tuple 2 has 1 values for 2 columns")
+
+	_, err = ParseStatement(`INSERT INTO foo (a, b) VALUES (1)`)
+	assert.EqualError(err, "VALUES tuple 1 has 1 values for 2 columns")
+}
+
+func Test_parseInsert_Blob(t *testing.T) {
+	assert := require.New(t)
+
+	stmt, err := ParseStatement(`INSERT INTO foo (a, b) VALUES (x'DEADbeef', X'')`)
+	assert.NoError(err)
+	assert.Equal(&ast.InsertStatement{
+		Table: "foo",
+		Rows: []ast.ValueSet{
+			{
+				"a": &ast.BasicLiteral{Value: "DEADbeef", Kind: lexer.TokenBlob},
+				"b": &ast.BasicLiteral{Value: "", Kind: lexer.TokenBlob},
+			},
+		},
+	}, stmt)
+
+	// A blob is an even number of hex digits
+	for _, literal := range []string{`x'ABC'`, `x'GG'`, `x'AB`} {
+		_, err = ParseStatement(`INSERT INTO foo (a) VALUES (` + literal + `)`)
+		assert.Error(err, literal)
+	}
+}
@@ -2,7 +2,6 @@ package parser
 
 import (
 	"errors"
-	"fmt"
 
 	"github.com/joeandaverde/tinydb/tsql/ast"
 	"github.com/joeandaverde/tinydb/tsql/scan"
@@ -19,6 +18,13 @@ var topLevelStatements = []struct {
 			return s, s != nil, err
 		},
 	},
+	{
+		Name: "CREATE INDEX",
+		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
+			s, err := parseCreateIndex(scanner)
+			return s, s != nil, err
+		},
+	},
 	{
 		Name: "INSERT",
 		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
@@ -47,6 +53,13 @@ var topLevelStatements = []struct {
 			return s, s != nil, err
 		},
 	},
+	{
+		Name: "ROLLBACK TO",
+		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
+			s, err := parseRollbackTo(scanner)
+			return s, s != nil, err
+		},
+	},
 	{
 		Name: "ROLLBACK",
 		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
@@ -54,17 +67,49 @@ var topLevelStatements = []struct {
 			return s, s != nil, err
 		},
 	},
+	{
+		Name: "SAVEPOINT",
+		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
+			s, err := parseSavepoint(scanner)
+			return s, s != nil, err
+		},
+	},
+	{
+		Name: "RELEASE",
+		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
+			s, err := parseRelease(scanner)
+			return s, s != nil, err
+		},
+	},
+	{
+		Name: "SET",
+		Parse: func(scanner scan.TinyScanner) (ast.Statement, bool, error) {
+			s, err := parseSet(scanner)
+			return s, s != nil, err
+		},
+	},
 }
 
 // ParseStatement parses a string of sql and produces a statement or parse failure.
 func ParseStatement(sql string) (ast.Statement, error) {
 	scanner := scan.NewScanner(sql)
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Any other statement may be explained
+	if stmt, err := parseExplain(scanner); err != nil {
+		return nil, err
+	} else if stmt != nil {
+		return stmt, nil
+	}
+	scanner.Reset()
 
 	for _, p := range topLevelStatements {
+		// A statement that parses but is invalid is reported as is
 		stmt, ok, err := p.Parse(scanner)
 		if err != nil {
-			return nil, fmt.Errorf("[%s] parse error at character: %d\nparsed:\n\t%s",
-				p.Name, scanner.Pos(), scanner.Committed())
+			return nil, err
 		}
 		if ok {
 			return stmt, nil
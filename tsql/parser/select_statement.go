@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+
 	"github.com/joeandaverde/tinydb/tsql/ast"
 	"github.com/joeandaverde/tinydb/tsql/lexer"
 	"github.com/joeandaverde/tinydb/tsql/scan"
@@ -9,6 +13,73 @@ import (
 func parseSelect(scanner scan.TinyScanner) (*ast.SelectStatement, error) {
 	selectStatement := ast.SelectStatement{}
 
+	var limitText, offsetText string
+
+	addColumn := func(e ast.Expression) {
+		selectStatement.Columns = append(selectStatement.Columns, ast.ResultColumn{Expr: e})
+	}
+
+	// A result column is named by an identifier following it, with or without AS
+	columnAlias := optional(allX(
+		optWS,
+		optionalX(allX(token(lexer.TokenAs), reqWS)),
+		token(lexer.TokenIdentifier),
+	), func(tokens []lexer.Token) {
+		selectStatement.Columns[len(selectStatement.Columns)-1].Alias = tokens[len(tokens)-1].Text
+	})
+
+	relation := func(add func(ast.TableAlias)) parserFn {
+		return all([]parserFn{
+			committed("RELATION", token(lexer.TokenIdentifier)),
+			optionalX(allX(
+				reqWS,
+				optionalX(allX(token(lexer.TokenAs), reqWS)),
+				token(lexer.TokenIdentifier),
+			)),
+		}, func(tokens [][]lexer.Token) {
+			if len(tokens[1]) > 0 {
+				add(ast.TableAlias{
+					Name:  tokens[0][0].Text,
+					Alias: tokens[1][len(tokens[1])-1].Text,
+				})
+			} else {
+				add(ast.TableAlias{
+					Name:  tokens[0][0].Text,
+					Alias: "",
+				})
+			}
+		})
+	}
+
+	addRelation := func(t ast.TableAlias) {
+		selectStatement.From = append(selectStatement.From, t)
+	}
+
+	// An inner join is a cross join filtered by its ON condition, so the
+	// condition is kept aside and folded into the WHERE filter once parsed.
+	var joins int
+	var joinFilters []ast.Expression
+	var joined ast.TableAlias
+	var joinOn ast.Expression
+	joinClause := allX(
+		optionalX(keyword(lexer.TokenInner)),
+		all([]parserFn{keyword(lexer.TokenJoin)}, func(tokens [][]lexer.Token) {
+			joins++
+		}),
+		committed("JOIN", all([]parserFn{
+			relation(func(t ast.TableAlias) {
+				joined = t
+			}),
+			keyword(lexer.TokenOn),
+			makeExpressionParser(func(on ast.Expression) {
+				joinOn = on
+			}),
+		}, func(tokens [][]lexer.Token) {
+			addRelation(joined)
+			joinFilters = append(joinFilters, joinOn)
+		})),
+	)
+
 	whereClause := allX(
 		keyword(lexer.TokenWhere),
 		committed("WHERE", makeExpressionParser(func(filter ast.Expression) {
@@ -16,44 +87,125 @@ func parseSelect(scanner scan.TinyScanner) (*ast.SelectStatement, error) {
 		})),
 	)
 
+	groupByClause := allX(
+		keyword(lexer.TokenGroup),
+		keyword(lexer.TokenBy),
+		committed("GROUP BY", commaSeparated(
+			ident(func(name string) {
+				selectStatement.GroupBy = append(selectStatement.GroupBy, name)
+			}),
+		)),
+	)
+
+	havingClause := allX(
+		keyword(lexer.TokenHaving),
+		committed("HAVING", makeExpressionParser(func(filter ast.Expression) {
+			selectStatement.Having = filter
+		})),
+	)
+
+	var orderingTerm ast.OrderingTerm
+	orderByClause := allX(
+		keyword(lexer.TokenOrder),
+		keyword(lexer.TokenBy),
+		committed("ORDER BY", commaSeparated(
+			all([]parserFn{
+				makeExpressionParser(func(e ast.Expression) {
+					orderingTerm = ast.OrderingTerm{Expr: e}
+				}),
+				optional(oneOf([]parserFn{
+					keyword(lexer.TokenAsc),
+					keyword(lexer.TokenDesc),
+				}, nil), func(tokens []lexer.Token) {
+					orderingTerm.Desc = firstNonSpace(tokens).Kind == lexer.TokenDesc
+				}),
+			}, func(tokens [][]lexer.Token) {
+				selectStatement.OrderBy = append(selectStatement.OrderBy, orderingTerm)
+			}),
+		)),
+	)
+
+	limitClause := allX(
+		keyword(lexer.TokenLimit),
+		committed("LIMIT", requiredToken(lexer.TokenNumber, func(tokens []lexer.Token) {
+			limitText = tokens[0].Text
+		})),
+		optionalX(allX(
+			keyword(lexer.TokenOffset),
+			committed("OFFSET", requiredToken(lexer.TokenNumber, func(tokens []lexer.Token) {
+				offsetText = tokens[0].Text
+			})),
+		)),
+	)
+
 	ok, _ := allX(
 		committed("SELECT", keyword(lexer.TokenSelect)),
+		optional(keyword(lexer.TokenDistinct), func(tokens []lexer.Token) {
+			selectStatement.Distinct = true
+		}),
 		committed("COLUMNS", commaSeparated(
 			oneOf([]parserFn{
-				token(lexer.TokenIdentifier),
-				token(lexer.TokenAsterisk),
-			}, func(tokens []lexer.Token) {
-				selectStatement.Columns = append(selectStatement.Columns, tokens[0].Text)
-			}),
+				allX(makeExpressionParser(addColumn), columnAlias),
+				requiredToken(lexer.TokenAsterisk, func(tokens []lexer.Token) {
+					addColumn(&ast.Star{})
+				}),
+			}, nil),
 		)),
 		committed("FROM", keyword(lexer.TokenFrom)),
-		committed("RELATIONS", commaSeparated(
-			all([]parserFn{
-				committed("RELATION", token(lexer.TokenIdentifier)),
-				optionalX(allX(
-					reqWS,
-					token(lexer.TokenIdentifier),
-				)),
-			}, func(tokens [][]lexer.Token) {
-				if len(tokens[1]) > 0 {
-					selectStatement.From = append(selectStatement.From, ast.TableAlias{
-						Name:  tokens[0][0].Text,
-						Alias: tokens[1][1].Text,
-					})
-				} else {
-					selectStatement.From = append(selectStatement.From, ast.TableAlias{
-						Name:  tokens[0][0].Text,
-						Alias: "",
-					})
-				}
-			}),
+		committed("RELATIONS", allX(
+			optWS,
+			relation(addRelation),
+			zeroOrMore(oneOf([]parserFn{
+				allX(commaSeparator, relation(addRelation)),
+				joinClause,
+			}, nil)),
+			optWS,
 		)),
 		optionalX(whereClause),
+		optionalX(groupByClause),
+		optionalX(havingClause),
+		optionalX(orderByClause),
+		optionalX(limitClause),
 	)(scanner)
 
-	if ok {
-		return &selectStatement, nil
+	if !ok {
+		return nil, nil
+	}
+
+	if joins != len(joinFilters) {
+		return nil, errors.New("JOIN requires a table and an ON clause")
+	}
+
+	if len(joinFilters) > 0 {
+		filter := joinFilters[0]
+		for _, on := range joinFilters[1:] {
+			filter = &ast.BinaryOperation{Left: filter, Right: on, Operator: "AND"}
+		}
+		if selectStatement.Filter != nil {
+			filter = &ast.BinaryOperation{Left: filter, Right: selectStatement.Filter, Operator: "AND"}
+		}
+		selectStatement.Filter = filter
+	}
+
+	if selectStatement.Having != nil && len(selectStatement.GroupBy) == 0 {
+		return nil, errors.New("HAVING requires a GROUP BY clause")
+	}
+
+	if limitText != "" {
+		limit, err := strconv.Atoi(limitText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %s", limitText)
+		}
+		selectStatement.Limit = &limit
+	}
+
+	if offsetText != "" {
+		offset, err := strconv.Atoi(offsetText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset: %s", offsetText)
+		}
+		selectStatement.Offset = &offset
 	}
 
-	return nil, nil
+	return &selectStatement, nil
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
 	"github.com/joeandaverde/tinydb/tsql/scan"
 )
 
@@ -22,7 +23,699 @@ func Test_parseSelect(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(&ast.SelectStatement{
 		From:    []ast.TableAlias{{Name: "apples", Alias: ""}},
-		Columns: []string{"*"},
+		Columns: []ast.ResultColumn{{Expr: &ast.Star{}}},
 		Filter:  nil,
 	}, stmt)
 }
+
+func Test_parseSelect_TableAlias(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT t.name FROM apples AS t, apples u, pears WHERE t.name = 'foo'`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.TableAlias{
+		{Name: "apples", Alias: "t"},
+		{Name: "apples", Alias: "u"},
+		{Name: "pears", Alias: ""},
+	}, stmt.From)
+	assert.Equal([]ast.ResultColumn{{Expr: &ast.Ident{Value: "t.name"}}}, stmt.Columns)
+	assert.NotNil(stmt.Filter)
+}
+
+func Test_parseSelect_Comments(t *testing.T) {
+	assert := require.New(t)
+
+	stmt, err := ParseStatement(`SELECT name,/* the color */color FROM apples WHERE color = 'red' -- only red ones`)
+	assert.NoError(err)
+
+	expected, err := ParseStatement(`SELECT name, color FROM apples WHERE color = 'red'`)
+	assert.NoError(err)
+	assert.Equal(expected, stmt)
+
+	// A comment runs to the end of its line
+	stmt, err = ParseStatement("SELECT name, -- the name\n color FROM apples WHERE color = 'red'")
+	assert.NoError(err)
+	assert.Equal(expected, stmt)
+
+	_, err = ParseStatement(`SELECT name FROM apples /* unfinished`)
+	assert.EqualError(err, "non terminated comment")
+}
+
+func Test_parseSelect_QuotedIdentifiers(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner("SELECT \"select\", `order` AS \"sort \"\"key\"\"\" FROM \"fruit bowls\" WHERE \"select\" = 'select'")
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.Ident{Value: "select"}},
+		{Expr: &ast.Ident{Value: "order"}, Alias: `sort "key"`},
+	}, stmt.Columns)
+	assert.Equal([]ast.TableAlias{{Name: "fruit bowls"}}, stmt.From)
+	assert.Equal(&ast.BinaryOperation{
+		Left:     &ast.Ident{Value: "select"},
+		Right:    &ast.BasicLiteral{Value: "select", Kind: lexer.TokenString},
+		Operator: "=",
+	}, stmt.Filter)
+
+	_, err = ParseStatement(`SELECT "select FROM apples`)
+	assert.EqualError(err, "non terminated identifier")
+}
+
+func Test_parseSelect_TokenAt(t *testing.T) {
+	assert := require.New(t)
+
+	input := `SELECT name FROM apples WHERE size > 5`
+	scanner := scan.NewScanner(input)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	// The span of each token is found by its position in the scanner
+	var spans []string
+	for pos := 0; ; pos++ {
+		token, ok := scanner.TokenAt(pos)
+		if !ok || token.Kind == lexer.TokenEOF {
+			break
+		}
+		if token.Kind == lexer.TokenIdentifier {
+			spans = append(spans, input[token.Position:token.Position+len(token.Text)])
+		}
+	}
+	assert.Equal([]string{"name", "apples", "size"}, spans)
+
+	token, ok := scanner.TokenAt(6)
+	assert.True(ok)
+	assert.Equal(lexer.TokenIdentifier, token.Kind)
+	assert.Equal(17, token.Position)
+	assert.Equal([]lexer.Token{token}, scanner.Range(6, 7))
+
+	_, ok = scanner.TokenAt(-1)
+	assert.False(ok)
+	_, ok = scanner.TokenAt(100)
+	assert.False(ok)
+}
+
+func Test_parseSelect_ColumnAlias(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT name AS full_name, COUNT(*) total, color, * FROM apples GROUP BY name`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.Ident{Value: "name"}, Alias: "full_name"},
+		{Expr: &ast.AggregateExpression{Name: "COUNT", Arg: &ast.Star{}}, Alias: "total"},
+		{Expr: &ast.Ident{Value: "color"}},
+		{Expr: &ast.Star{}},
+	}, stmt.Columns)
+	assert.Equal([]string{"name"}, stmt.GroupBy)
+}
+
+func Test_parseSelect_ComputedColumn(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT id + 10, (size - 1) * 2 AS doubled, name FROM apples`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "id"},
+			Operator: "+",
+			Right:    &ast.BasicLiteral{Value: "10", Kind: lexer.TokenNumber},
+		}},
+		{Expr: &ast.BinaryOperation{
+			Left: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "size"},
+				Operator: "-",
+				Right:    &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber},
+			},
+			Operator: "*",
+			Right:    &ast.BasicLiteral{Value: "2", Kind: lexer.TokenNumber},
+		}, Alias: "doubled"},
+		{Expr: &ast.Ident{Value: "name"}},
+	}, stmt.Columns)
+}
+
+func Test_parseSelect_NegativeNumbers(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT 3 - 5, 3-5, -5, -2.5, 3 - -5 FROM apples WHERE id = -3`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	subtraction := &ast.BinaryOperation{
+		Left:     &ast.BasicLiteral{Value: "3", Kind: lexer.TokenNumber},
+		Operator: "-",
+		Right:    &ast.BasicLiteral{Value: "5", Kind: lexer.TokenNumber},
+	}
+	assert.Equal([]ast.ResultColumn{
+		{Expr: subtraction},
+		{Expr: subtraction},
+		{Expr: &ast.BasicLiteral{Value: "-5", Kind: lexer.TokenNumber}},
+		{Expr: &ast.BasicLiteral{Value: "-2.5", Kind: lexer.TokenFloat}},
+		{Expr: &ast.BinaryOperation{
+			Left:     &ast.BasicLiteral{Value: "3", Kind: lexer.TokenNumber},
+			Operator: "-",
+			Right:    &ast.BasicLiteral{Value: "-5", Kind: lexer.TokenNumber},
+		}},
+	}, stmt.Columns)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left:     &ast.Ident{Value: "id"},
+		Operator: "=",
+		Right:    &ast.BasicLiteral{Value: "-3", Kind: lexer.TokenNumber},
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_Join(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT a.x, b.y FROM a JOIN b ON a.id = b.a_id INNER JOIN c AS z ON z.id = b.id WHERE a.x = 1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.TableAlias{
+		{Name: "a", Alias: ""},
+		{Name: "b", Alias: ""},
+		{Name: "c", Alias: "z"},
+	}, stmt.From)
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.BinaryOperation{
+			Left: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "a.id"},
+				Right:    &ast.Ident{Value: "b.a_id"},
+				Operator: "=",
+			},
+			Right: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "z.id"},
+				Right:    &ast.Ident{Value: "b.id"},
+				Operator: "=",
+			},
+			Operator: "AND",
+		},
+		Right: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "a.x"},
+			Right:    &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber},
+			Operator: "=",
+		},
+		Operator: "AND",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_JoinWithoutOn(t *testing.T) {
+	assert := require.New(t)
+
+	for _, sql := range []string{
+		`SELECT * FROM a JOIN b`,
+		`SELECT * FROM a INNER JOIN b ON`,
+		`SELECT * FROM a JOIN ON a.id = 1`,
+	} {
+		_, err := ParseStatement(sql)
+		assert.EqualError(err, "JOIN requires a table and an ON clause", sql)
+	}
+}
+
+func Test_parseSelect_LimitOffset(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples LIMIT 10 OFFSET 20`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	limit, offset := 10, 20
+	assert.Equal(&ast.SelectStatement{
+		From:    []ast.TableAlias{{Name: "apples", Alias: ""}},
+		Columns: []ast.ResultColumn{{Expr: &ast.Star{}}},
+		Limit:   &limit,
+		Offset:  &offset,
+	}, stmt)
+}
+
+func Test_parseSelect_DistinctOrderByLimit(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT DISTINCT color, size FROM apples ORDER BY color DESC LIMIT 5`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	limit := 5
+	assert.Equal(&ast.SelectStatement{
+		Distinct: true,
+		From:     []ast.TableAlias{{Name: "apples", Alias: ""}},
+		Columns:  []ast.ResultColumn{{Expr: &ast.Ident{Value: "color"}}, {Expr: &ast.Ident{Value: "size"}}},
+		OrderBy: []ast.OrderingTerm{
+			{Expr: &ast.Ident{Value: "color"}, Desc: true},
+		},
+		Limit: &limit,
+	}, stmt)
+}
+
+func Test_parseSelect_OrderBy(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples ORDER BY color DESC, name ASC, size LIMIT 1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	limit := 1
+	assert.Equal(&ast.SelectStatement{
+		From:    []ast.TableAlias{{Name: "apples", Alias: ""}},
+		Columns: []ast.ResultColumn{{Expr: &ast.Star{}}},
+		OrderBy: []ast.OrderingTerm{
+			{Expr: &ast.Ident{Value: "color"}, Desc: true},
+			{Expr: &ast.Ident{Value: "name"}, Desc: false},
+			{Expr: &ast.Ident{Value: "size"}, Desc: false},
+		},
+		Limit: &limit,
+	}, stmt)
+}
+
+func Test_parseSelect_Aggregates(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT count(*), SUM(a), avg(b), MIN(c), max(d), name FROM apples WHERE color = 'red'`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.AggregateExpression{Name: "COUNT", Arg: &ast.Star{}}},
+		{Expr: &ast.AggregateExpression{Name: "SUM", Arg: &ast.Ident{Value: "a"}}},
+		{Expr: &ast.AggregateExpression{Name: "AVG", Arg: &ast.Ident{Value: "b"}}},
+		{Expr: &ast.AggregateExpression{Name: "MIN", Arg: &ast.Ident{Value: "c"}}},
+		{Expr: &ast.AggregateExpression{Name: "MAX", Arg: &ast.Ident{Value: "d"}}},
+		{Expr: &ast.Ident{Value: "name"}},
+	}, stmt.Columns)
+	assert.NotNil(stmt.Filter)
+}
+
+func Test_parseSelect_AggregateDistinct(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT COUNT(DISTINCT a), count(a) FROM apples`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.AggregateExpression{Name: "COUNT", Arg: &ast.Ident{Value: "a"}, Distinct: true}},
+		{Expr: &ast.AggregateExpression{Name: "COUNT", Arg: &ast.Ident{Value: "a"}}},
+	}, stmt.Columns)
+	assert.Equal("COUNT(DISTINCT a)", stmt.Columns[0].Expr.(*ast.AggregateExpression).String())
+}
+
+func Test_parseSelect_FunctionCall(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT lower(name) FROM apples`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.FunctionCall{Name: "LOWER", Args: []ast.Expression{&ast.Ident{Value: "name"}}}},
+	}, stmt.Columns)
+}
+
+func Test_parseSelect_GroupBy(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT state, COUNT(*) FROM apples WHERE color = 'red' GROUP BY state, color LIMIT 1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]string{"state", "color"}, stmt.GroupBy)
+	assert.NotNil(stmt.Filter)
+	assert.NotNil(stmt.Limit)
+}
+
+func Test_parseSelect_Having(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT state, COUNT(*) FROM apples GROUP BY state HAVING COUNT(*) = 5 LIMIT 1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal([]string{"state"}, stmt.GroupBy)
+	assert.Equal(&ast.BinaryOperation{
+		Left:     &ast.AggregateExpression{Name: "COUNT", Arg: &ast.Star{}},
+		Right:    &ast.BasicLiteral{Value: "5", Kind: lexer.TokenNumber},
+		Operator: "=",
+	}, stmt.Having)
+	assert.NotNil(stmt.Limit)
+}
+
+func Test_parseSelect_HavingWithoutGroupBy(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT COUNT(*) FROM apples HAVING COUNT(*) = 5`)
+
+	stmt, err := parseSelect(scanner)
+	assert.Error(err)
+	assert.Nil(stmt)
+}
+
+func Test_parseSelect_Comparisons(t *testing.T) {
+	for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+		t.Run(op, func(t *testing.T) {
+			assert := require.New(t)
+
+			scanner := scan.NewScanner(`SELECT * FROM apples WHERE size ` + op + ` 5`)
+
+			stmt, err := parseSelect(scanner)
+			assert.NoError(err)
+			assert.NotNil(stmt)
+
+			assert.Equal(&ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "size"},
+				Right:    &ast.BasicLiteral{Value: "5", Kind: lexer.TokenNumber},
+				Operator: op,
+			}, stmt.Filter)
+		})
+	}
+}
+
+func Test_parseSelect_LowercaseLogical(t *testing.T) {
+	assert := require.New(t)
+
+	stmt, err := ParseStatement(`select * from apples where size != 10 and size != 20 or color = 'red'`)
+	assert.NoError(err)
+
+	expected, err := ParseStatement(`SELECT * FROM apples WHERE size != 10 AND size != 20 OR color = 'red'`)
+	assert.NoError(err)
+	assert.Equal(expected, stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.BinaryOperation{
+			Left: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "size"},
+				Right:    &ast.BasicLiteral{Value: "10", Kind: lexer.TokenNumber},
+				Operator: "!=",
+			},
+			Right: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "size"},
+				Right:    &ast.BasicLiteral{Value: "20", Kind: lexer.TokenNumber},
+				Operator: "!=",
+			},
+			Operator: "AND",
+		},
+		Right: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "color"},
+			Right:    &ast.BasicLiteral{Value: "red", Kind: lexer.TokenString},
+			Operator: "=",
+		},
+		Operator: "OR",
+	}, stmt.(*ast.SelectStatement).Filter)
+}
+
+func Test_parseSelect_ComparisonsWithoutSpaces(t *testing.T) {
+	for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+		t.Run(op, func(t *testing.T) {
+			assert := require.New(t)
+
+			scanner := scan.NewScanner(`SELECT * FROM apples WHERE size` + op + `5 AND color = 'red'`)
+
+			stmt, err := parseSelect(scanner)
+			assert.NoError(err)
+			assert.NotNil(stmt)
+
+			assert.Equal(&ast.BinaryOperation{
+				Left: &ast.BinaryOperation{
+					Left:     &ast.Ident{Value: "size"},
+					Right:    &ast.BasicLiteral{Value: "5", Kind: lexer.TokenNumber},
+					Operator: op,
+				},
+				Right: &ast.BinaryOperation{
+					Left:     &ast.Ident{Value: "color"},
+					Right:    &ast.BasicLiteral{Value: "red", Kind: lexer.TokenString},
+					Operator: "=",
+				},
+				Operator: "AND",
+			}, stmt.Filter)
+		})
+	}
+}
+
+func Test_parseSelect_OperatorWithinToken(t *testing.T) {
+	assert := require.New(t)
+
+	// an operator within the text of a token is not an operator
+	stmt, err := ParseStatement(`SELECT price "per-kg", weight "kg/m", 2.5e-3 FROM apples ORDER BY price`)
+	assert.NoError(err)
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.Ident{Value: "price"}, Alias: "per-kg"},
+		{Expr: &ast.Ident{Value: "weight"}, Alias: "kg/m"},
+		{Expr: &ast.BasicLiteral{Value: "2.5e-3", Kind: lexer.TokenFloat}},
+	}, stmt.(*ast.SelectStatement).Columns)
+}
+
+func Test_parseSelect_NullTest(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE color IS NULL AND size IS NOT NULL`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left:     &ast.NullTest{Expr: &ast.Ident{Value: "color"}},
+		Right:    &ast.NullTest{Expr: &ast.Ident{Value: "size"}, Not: true},
+		Operator: "AND",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_Not(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE NOT (color = 'red') AND NOT NOT size IS NULL OR NOT size > 2`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.BinaryOperation{
+			Left: &ast.UnaryOperation{Op: "NOT", Expr: &ast.BinaryOperation{
+				Left:     &ast.Ident{Value: "color"},
+				Right:    &ast.BasicLiteral{Value: "red", Kind: lexer.TokenString},
+				Operator: "=",
+			}},
+			Right: &ast.UnaryOperation{Op: "NOT", Expr: &ast.UnaryOperation{Op: "NOT", Expr: &ast.NullTest{
+				Expr: &ast.Ident{Value: "size"},
+			}}},
+			Operator: "AND",
+		},
+		Right: &ast.UnaryOperation{Op: "NOT", Expr: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "size"},
+			Right:    &ast.BasicLiteral{Value: "2", Kind: lexer.TokenNumber},
+			Operator: ">",
+		}},
+		Operator: "OR",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_In(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE color IN ('red', 'green') AND size NOT IN (1)`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.InExpression{
+			Expr: &ast.Ident{Value: "color"},
+			Values: []ast.Expression{
+				&ast.BasicLiteral{Value: "red", Kind: lexer.TokenString},
+				&ast.BasicLiteral{Value: "green", Kind: lexer.TokenString},
+			},
+		},
+		Right: &ast.InExpression{
+			Expr:   &ast.Ident{Value: "size"},
+			Values: []ast.Expression{&ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber}},
+			Not:    true,
+		},
+		Operator: "AND",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_InEmpty(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE color IN ( )`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.InExpression{Expr: &ast.Ident{Value: "color"}}, stmt.Filter)
+}
+
+func Test_parseSelect_Between(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE size BETWEEN 1 AND 2 + 3 AND color NOT BETWEEN 'a' AND 'c'`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.BetweenExpression{
+			Expr: &ast.Ident{Value: "size"},
+			Low:  &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber},
+			High: &ast.BinaryOperation{
+				Left:     &ast.BasicLiteral{Value: "2", Kind: lexer.TokenNumber},
+				Right:    &ast.BasicLiteral{Value: "3", Kind: lexer.TokenNumber},
+				Operator: "+",
+			},
+		},
+		Right: &ast.BetweenExpression{
+			Expr: &ast.Ident{Value: "color"},
+			Low:  &ast.BasicLiteral{Value: "a", Kind: lexer.TokenString},
+			High: &ast.BasicLiteral{Value: "c", Kind: lexer.TokenString},
+			Not:  true,
+		},
+		Operator: "AND",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_Case(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT CASE WHEN size > 5 THEN 'big' WHEN size > 2 THEN 'medium' ELSE 'small' END FROM apples WHERE CASE color WHEN 'red' THEN 1 END = 1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	size := &ast.Ident{Value: "size"}
+	assert.Equal([]ast.ResultColumn{
+		{Expr: &ast.CaseExpression{
+			Whens: []ast.WhenClause{
+				{
+					Condition: &ast.BinaryOperation{Left: size, Operator: ">", Right: &ast.BasicLiteral{Value: "5", Kind: lexer.TokenNumber}},
+					Result:    &ast.BasicLiteral{Value: "big", Kind: lexer.TokenString},
+				},
+				{
+					Condition: &ast.BinaryOperation{Left: size, Operator: ">", Right: &ast.BasicLiteral{Value: "2", Kind: lexer.TokenNumber}},
+					Result:    &ast.BasicLiteral{Value: "medium", Kind: lexer.TokenString},
+				},
+			},
+			Else: &ast.BasicLiteral{Value: "small", Kind: lexer.TokenString},
+		}},
+	}, stmt.Columns)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.CaseExpression{
+			Operand: &ast.Ident{Value: "color"},
+			Whens: []ast.WhenClause{
+				{
+					Condition: &ast.BasicLiteral{Value: "red", Kind: lexer.TokenString},
+					Result:    &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber},
+				},
+			},
+		},
+		Operator: "=",
+		Right:    &ast.BasicLiteral{Value: "1", Kind: lexer.TokenNumber},
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_Like(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT * FROM apples WHERE color like 're%' OR name NOT LIKE '_x'`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.NotNil(stmt)
+
+	assert.Equal(&ast.BinaryOperation{
+		Left: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "color"},
+			Right:    &ast.BasicLiteral{Value: "re%", Kind: lexer.TokenString},
+			Operator: "LIKE",
+		},
+		Right: &ast.BinaryOperation{
+			Left:     &ast.Ident{Value: "name"},
+			Right:    &ast.BasicLiteral{Value: "_x", Kind: lexer.TokenString},
+			Operator: "NOT LIKE",
+		},
+		Operator: "OR",
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_Parameters(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := scan.NewScanner(`SELECT name FROM people WHERE age > $2 AND name = $1`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+	assert.Equal(&ast.BinaryOperation{
+		Left:     &ast.BinaryOperation{Left: &ast.Ident{Value: "age"}, Operator: ">", Right: &ast.Parameter{Index: 2}},
+		Operator: "AND",
+		Right:    &ast.BinaryOperation{Left: &ast.Ident{Value: "name"}, Operator: "=", Right: &ast.Parameter{Index: 1}},
+	}, stmt.Filter)
+}
+
+func Test_parseSelect_PositionalParameters(t *testing.T) {
+	assert := require.New(t)
+
+	// A ? is numbered one past the largest number before it
+	scanner := scan.NewScanner(`SELECT name FROM people WHERE age > ? AND name = $5 AND id = ?`)
+
+	stmt, err := parseSelect(scanner)
+	assert.NoError(err)
+
+	var params []int
+	var walk func(ast.Expression)
+	walk = func(e ast.Expression) {
+		switch e := e.(type) {
+		case *ast.BinaryOperation:
+			walk(e.Left)
+			walk(e.Right)
+		case *ast.LogicalOperation:
+			for _, t := range e.Terms {
+				walk(t)
+			}
+		case *ast.Parameter:
+			params = append(params, e.Index)
+		}
+	}
+	walk(stmt.Filter)
+	assert.Equal([]int{1, 5, 6}, params)
+}
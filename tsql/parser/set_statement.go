@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"github.com/joeandaverde/tinydb/tsql/ast"
+	"github.com/joeandaverde/tinydb/tsql/lexer"
+	"github.com/joeandaverde/tinydb/tsql/scan"
+)
+
+func parseSet(scanner scan.TinyScanner) (*ast.SetStatement, error) {
+	setStatement := ast.SetStatement{}
+
+	ok, _ := allX(
+		keyword(lexer.TokenSet),
+		committed("NAME", ident(func(name string) {
+			setStatement.Name = name
+		})),
+		committed("EQUALS", symbol(lexer.TokenEquals)),
+		committed("VALUE", oneOf([]parserFn{
+			requiredToken(lexer.TokenNumber, func(tokens []lexer.Token) {
+				setStatement.Value = tokens[0].Text
+			}),
+			requiredToken(lexer.TokenString, func(tokens []lexer.Token) {
+				setStatement.Value = tokens[0].Text[1 : len(tokens[0].Text)-1]
+			}),
+			ident(func(value string) {
+				setStatement.Value = value
+			}),
+		}, nil)),
+	)(scanner)
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &setStatement, nil
+}
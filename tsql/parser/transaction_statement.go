@@ -41,3 +41,56 @@ func parseRollback(scanner scan.TinyScanner) (*ast.RollbackStatement, error) {
 
 	return nil, nil
 }
+
+func parseSavepoint(scanner scan.TinyScanner) (*ast.SavepointStatement, error) {
+	stmt := ast.SavepointStatement{}
+	parser := allX(
+		keyword(lexer.TokenSavepoint),
+		committed("NAME", ident(func(name string) {
+			stmt.Name = name
+		})),
+	)
+
+	if ok, _ := parser(scanner); ok {
+		return &stmt, nil
+	}
+
+	return nil, nil
+}
+
+// parseRelease parses RELEASE [SAVEPOINT] name
+func parseRelease(scanner scan.TinyScanner) (*ast.ReleaseStatement, error) {
+	stmt := ast.ReleaseStatement{}
+	parser := allX(
+		keyword(lexer.TokenRelease),
+		optionalX(keyword(lexer.TokenSavepoint)),
+		committed("NAME", ident(func(name string) {
+			stmt.Name = name
+		})),
+	)
+
+	if ok, _ := parser(scanner); ok {
+		return &stmt, nil
+	}
+
+	return nil, nil
+}
+
+// parseRollbackTo parses ROLLBACK TO [SAVEPOINT] name
+func parseRollbackTo(scanner scan.TinyScanner) (*ast.RollbackToStatement, error) {
+	stmt := ast.RollbackToStatement{}
+	parser := allX(
+		keyword(lexer.TokenRollback),
+		keyword(lexer.TokenTo),
+		optionalX(keyword(lexer.TokenSavepoint)),
+		committed("NAME", ident(func(name string) {
+			stmt.Name = name
+		})),
+	)
+
+	if ok, _ := parser(scanner); ok {
+		return &stmt, nil
+	}
+
+	return nil, nil
+}
@@ -1,6 +1,7 @@
 package scan
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/joeandaverde/tinydb/tsql/lexer"
@@ -13,11 +14,24 @@ type TinyScanner interface {
 	Next() lexer.Token
 	Commit(landmark string)
 	Committed() string
+
+	// Pos is the position of the scanner, the number of tokens before the
+	// next one. A position maps to a span of the input with TokenAt.
 	Pos() int
+
 	Mark() (int, func())
-	Range(int, int) []lexer.Token
+
+	// Range returns the tokens from position start up to position end,
+	// both of which must have been scanned.
+	Range(start int, end int) []lexer.Token
+
+	// TokenAt returns the token at a position, reading ahead if needed.
+	// The token's Position and Text are its span of the input.
+	TokenAt(pos int) (lexer.Token, bool)
+
 	Reset()
 	Text() string
+	Err() error
 }
 
 // NewScanner returns a new TinyScanner to navigate the tokens from the input.
@@ -111,6 +125,41 @@ func (s *tinyScanner) Next() lexer.Token {
 	return token
 }
 
+func (s *tinyScanner) TokenAt(pos int) (lexer.Token, bool) {
+	for pos >= len(s.items) {
+		token, ok := <-s.tokens
+		if !ok {
+			return lexer.Token{}, false
+		}
+		s.items = append(s.items, token)
+	}
+
+	if pos < 0 {
+		return lexer.Token{}, false
+	}
+
+	return s.items[pos], true
+}
+
 func (s *tinyScanner) Commit(landmark string) {
 	s.committed = landmark
 }
+
+// Err reads the rest of the input and reports the first error of the lexer
+func (s *tinyScanner) Err() error {
+	for len(s.items) == 0 || s.items[len(s.items)-1].Kind != lexer.TokenEOF {
+		token, ok := <-s.tokens
+		if !ok {
+			break
+		}
+		s.items = append(s.items, token)
+	}
+
+	for _, token := range s.items {
+		if token.Kind == lexer.TokenError && token.Text != "" {
+			return errors.New(token.Text)
+		}
+	}
+
+	return nil
+}